@@ -0,0 +1,30 @@
+// Command clawdbot-proxy is a small reverse proxy that fronts the Clawdbot
+// Node gateway: it serves the Control UI static build, forwards /api/* with
+// per-IP rate limiting, and relays /ws WebSocket sessions. All of the logic
+// lives in pkg/proxy so other programs can embed it; this wrapper only
+// dispatches subcommands.
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/clawdbot/clawdbot/proxy/pkg/proxy"
+)
+
+func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(proxy.RunCheck(os.Args[2:], os.Stdout))
+		case "print-config":
+			os.Exit(proxy.RunPrintConfig(os.Args[2:], os.Stdout))
+		case "service":
+			os.Exit(proxy.RunService(os.Args[2:], os.Stdout))
+		default:
+			os.Stderr.WriteString("unknown command " + os.Args[1] + " (available: check, print-config, service)\n")
+			os.Exit(2)
+		}
+	}
+	os.Exit(proxy.Run(os.Args[1:]))
+}
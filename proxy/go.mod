@@ -0,0 +1,3 @@
+module github.com/clawdbot/clawdbot/proxy
+
+go 1.21
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rotatingWriter appends to a log file, rotating it when it exceeds maxSize
+// or when the calendar day changes. Rotated files are optionally gzipped and
+// pruned down to keep copies.
+type rotatingWriter struct {
+	path     string
+	maxSize  int64
+	keep     int
+	compress bool
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	day  int // year*1000 + yearday of the open file
+}
+
+func newRotatingWriter(path string, maxSize int64, keep int, compress bool) *rotatingWriter {
+	return &rotatingWriter{path: path, maxSize: maxSize, keep: keep, compress: compress}
+}
+
+func (w *rotatingWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		if err := w.openLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if w.size+int64(len(b)) > w.maxSize || dayStamp(time.Now()) != w.day {
+		if err := w.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) openLocked() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f = f
+	w.size = info.Size()
+	w.day = dayStamp(time.Now())
+	return nil
+}
+
+func (w *rotatingWriter) rotateLocked() error {
+	w.f.Close()
+	w.f = nil
+	rotated := fmt.Sprintf("%s.%s", w.path, time.Now().Format("20060102-150405.000"))
+	if err := os.Rename(w.path, rotated); err != nil {
+		return err
+	}
+	if w.compress {
+		// Compress in the background so a large rotation never stalls
+		// request handling.
+		go gzipFile(rotated)
+	}
+	w.pruneLocked()
+	return w.openLocked()
+}
+
+// pruneLocked removes the oldest rotated files beyond the retention count.
+func (w *rotatingWriter) pruneLocked() {
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil || len(matches) <= w.keep {
+		return
+	}
+	sort.Strings(matches) // timestamped names sort chronologically
+	for _, old := range matches[:len(matches)-w.keep] {
+		os.Remove(old)
+	}
+}
+
+func gzipFile(path string) {
+	src, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err == nil && gz.Close() == nil && dst.Close() == nil {
+		os.Remove(path)
+		return
+	}
+	dst.Close()
+	os.Remove(path + ".gz")
+}
+
+func dayStamp(t time.Time) int {
+	return t.Year()*1000 + t.YearDay()
+}
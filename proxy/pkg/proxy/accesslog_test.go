@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterRotatesOnSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w := newRotatingWriter(path, 100, 5, false)
+	line := strings.Repeat("x", 40) + "\n"
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) == 0 {
+		t.Fatal("expected at least one rotated file")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 100 {
+		t.Errorf("live file size = %d, want <= 100", info.Size())
+	}
+}
+
+func TestRotatingWriterPrunesOldFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w := newRotatingWriter(path, 10, 2, false)
+	for i := 0; i < 8; i++ {
+		w.Write([]byte("0123456789abcdef\n"))
+		time.Sleep(2 * time.Millisecond) // distinct rotation timestamps
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) > 3 {
+		t.Errorf("rotated files = %d, want pruned to <= 3", len(rotated))
+	}
+}
+
+func TestRotatingWriterCompressesRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w := newRotatingWriter(path, 10, 5, true)
+	w.Write([]byte("0123456789abcdef\n"))
+	w.Write([]byte("0123456789abcdef\n"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if gz, _ := filepath.Glob(path + ".*.gz"); len(gz) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("rotated file was not compressed")
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	p := newTestProxy(t, &Config{AccessLogSample: 10})
+	var buf strings.Builder
+	p.accessLogger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	ok := p.accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i := 0; i < 20; i++ {
+		ok.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/x", nil))
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 2 {
+		t.Errorf("logged %d of 20 sampled requests, want 2", got)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_access_log_sampled_total`) != 18 {
+		t.Errorf("sampled counter = %d, want 18", p.metrics.Counter(`clawdbot_proxy_access_log_sampled_total`))
+	}
+
+	// Errors bypass sampling entirely.
+	buf.Reset()
+	boom := p.accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	for i := 0; i < 5; i++ {
+		boom.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/x", nil))
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 5 {
+		t.Errorf("logged %d of 5 error requests, want all", got)
+	}
+}
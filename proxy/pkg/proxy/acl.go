@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// aclRule collects the allow and deny networks for one path prefix.
+type aclRule struct {
+	prefix string
+	allow  []*net.IPNet
+	deny   []*net.IPNet
+}
+
+// ACLStore restricts path prefixes to client networks. Rules come from a file
+// that is re-read when its mtime changes, same as the API key file, so lists
+// can be tightened without restarting the proxy.
+type ACLStore struct {
+	path string
+
+	mu       sync.Mutex
+	rules    []aclRule // sorted longest prefix first
+	lastMod  time.Time
+	lastStat time.Time
+}
+
+// Rule file format, one directive per line:
+//
+//	allow <path-prefix> <cidr>[,<cidr>...]   # comment
+//	deny  <path-prefix> <cidr>[,<cidr>...]
+//
+// The longest matching prefix decides. Within it, a deny match rejects; if an
+// allow list exists the client must be on it.
+func NewACLStore(path string) (*ACLStore, error) {
+	s := &ACLStore{path: path}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ACLStore) reload() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	byPrefix := make(map[string]*aclRule)
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: want \"allow|deny <prefix> <cidrs>\"", s.path, lineNo)
+		}
+		nets, err := parseCIDRList(splitCommaList(fields[2]))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", s.path, lineNo, err)
+		}
+		rule := byPrefix[fields[1]]
+		if rule == nil {
+			rule = &aclRule{prefix: fields[1]}
+			byPrefix[fields[1]] = rule
+		}
+		switch fields[0] {
+		case "allow":
+			rule.allow = append(rule.allow, nets...)
+		case "deny":
+			rule.deny = append(rule.deny, nets...)
+		default:
+			return fmt.Errorf("%s:%d: unknown directive %q", s.path, lineNo, fields[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	rules := make([]aclRule, 0, len(byPrefix))
+	for _, r := range byPrefix {
+		rules = append(rules, *r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return len(rules[i].prefix) > len(rules[j].prefix) })
+	s.rules = rules
+	s.lastMod = info.ModTime()
+	return nil
+}
+
+// maybeReload stats the rule file at most once per second and reloads it when
+// the mtime moved. Reload errors keep the previous rules.
+func (s *ACLStore) maybeReload() {
+	if time.Since(s.lastStat) < time.Second {
+		return
+	}
+	s.lastStat = time.Now()
+	info, err := os.Stat(s.path)
+	if err != nil || info.ModTime().Equal(s.lastMod) {
+		return
+	}
+	s.reload()
+}
+
+// Allowed reports whether host may access path. Paths without a matching
+// rule are unrestricted.
+func (s *ACLStore) Allowed(path, host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maybeReload()
+	for _, rule := range s.rules {
+		if !strings.HasPrefix(path, rule.prefix) {
+			continue
+		}
+		if ipInNets(host, rule.deny) {
+			return false
+		}
+		if len(rule.allow) > 0 && !ipInNets(host, rule.allow) {
+			return false
+		}
+		return true
+	}
+	return true
+}
+
+// checkACL rejects requests that hit a deny rule or miss a required allow
+// list, before any routing or auth runs.
+func (p *ProxyServer) checkACL(w http.ResponseWriter, r *http.Request) bool {
+	if p.acl == nil {
+		return true
+	}
+	client := p.clientIP(r)
+	if p.acl.Allowed(r.URL.Path, client) {
+		return true
+	}
+	p.metrics.Inc(`clawdbot_proxy_acl_denied_total`)
+	p.log.Warn("acl denied", "event", "acl_denied", "path", r.URL.Path, "client", client)
+	p.httpError(w, r, http.StatusForbidden, "access denied")
+	return false
+}
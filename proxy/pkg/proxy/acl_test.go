@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeACLFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "acl.conf")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestACLAllowList(t *testing.T) {
+	store, err := NewACLStore(writeACLFile(t, "allow /api/admin/ 10.0.0.0/8 # LAN only\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Allowed("/api/admin/keys", "10.1.2.3") {
+		t.Error("LAN client must be allowed")
+	}
+	if store.Allowed("/api/admin/keys", "203.0.113.5") {
+		t.Error("external client must be denied")
+	}
+	if !store.Allowed("/api/status", "203.0.113.5") {
+		t.Error("paths without rules must stay unrestricted")
+	}
+}
+
+func TestACLDenyList(t *testing.T) {
+	store, err := NewACLStore(writeACLFile(t, "deny /api/ 203.0.113.0/24\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Allowed("/api/status", "203.0.113.9") {
+		t.Error("denied network must be rejected")
+	}
+	if !store.Allowed("/api/status", "198.51.100.1") {
+		t.Error("other clients must be allowed")
+	}
+}
+
+func TestACLLongestPrefixWins(t *testing.T) {
+	store, err := NewACLStore(writeACLFile(t, "deny /api/ 0.0.0.0/0\nallow /api/public/ 0.0.0.0/0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Allowed("/api/status", "198.51.100.1") {
+		t.Error("broad deny must apply to /api/status")
+	}
+	if !store.Allowed("/api/public/info", "198.51.100.1") {
+		t.Error("more specific allow must win for /api/public/")
+	}
+}
+
+func TestACLDenyBeatsAllowWithinPrefix(t *testing.T) {
+	store, err := NewACLStore(writeACLFile(t, "allow /api/ 10.0.0.0/8\ndeny /api/ 10.0.5.0/24\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Allowed("/api/status", "10.0.5.7") {
+		t.Error("deny must take precedence over allow")
+	}
+	if !store.Allowed("/api/status", "10.0.6.7") {
+		t.Error("rest of the allow range must pass")
+	}
+}
+
+func TestACLReloadPicksUpChanges(t *testing.T) {
+	path := writeACLFile(t, "deny /api/ 10.0.0.0/8\n")
+	store, err := NewACLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Allowed("/api/x", "10.1.1.1") {
+		t.Fatal("initial deny must apply")
+	}
+	if err := os.WriteFile(path, []byte("deny /api/ 192.0.2.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !store.Allowed("/api/x", "10.1.1.1") {
+		t.Error("reload must drop the old deny rule")
+	}
+	if store.Allowed("/api/x", "192.0.2.5") {
+		t.Error("reload must apply the new deny rule")
+	}
+}
+
+func TestACLRejectsMalformedFile(t *testing.T) {
+	if _, err := NewACLStore(writeACLFile(t, "permit /api/ 10.0.0.0/8\n")); err == nil {
+		t.Error("unknown directive must be rejected")
+	}
+	if _, err := NewACLStore(writeACLFile(t, "allow /api/\n")); err == nil {
+		t.Error("missing CIDR field must be rejected")
+	}
+}
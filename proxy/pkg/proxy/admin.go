@@ -0,0 +1,315 @@
+package proxy
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+// newAdminHandler exposes runtime operations on the (localhost-bound) admin
+// listener. Nothing here is ever routed from the public listener.
+func (p *ProxyServer) newAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/ratelimit", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fmt.Sprintf(`{"entries":%d}`, p.limiter.Len()))
+	})
+	mux.HandleFunc("/admin/ratelimit/flush", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		flushed := p.limiter.Flush()
+		p.log.Info("rate limiter flushed via admin API", "entries", flushed)
+		writeJSON(w, fmt.Sprintf(`{"flushed":%d}`, flushed))
+	}))
+	mux.HandleFunc("/admin/ws", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fmt.Sprintf(`{"active":%d}`, int(p.metrics.Gauge(`clawdbot_proxy_ws_active`))))
+	})
+	mux.HandleFunc("/admin/ws/sessions", func(w http.ResponseWriter, r *http.Request) {
+		type info struct {
+			ID       string    `json:"id"`
+			ClientIP string    `json:"client_ip"`
+			Path     string    `json:"path"`
+			Started  time.Time `json:"started"`
+			BytesIn  int64     `json:"bytes_in"`
+			BytesOut int64     `json:"bytes_out"`
+			Set      string    `json:"set,omitempty"`
+		}
+		sessions := p.sessions.snapshot()
+		out := make([]info, 0, len(sessions))
+		for _, s := range sessions {
+			out = append(out, info{
+				ID:       s.id,
+				ClientIP: s.clientIP,
+				Path:     s.path,
+				Started:  s.started,
+				// "in" and "out" are from the proxy's perspective: bytes
+				// written toward the backend arrived from the client.
+				BytesIn:  s.backend.written.Load(),
+				BytesOut: s.client.written.Load(),
+				Set:      s.set,
+			})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("/admin/ws/kill", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		s := p.sessions.find(id)
+		if s == nil {
+			http.Error(w, "no such session", http.StatusNotFound)
+			return
+		}
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "closed by administrator"
+		}
+		s.sendClose(1001, reason)
+		s.forceClose()
+		p.log.Info("websocket session killed via admin API", "id", id, "reason", reason)
+		writeJSON(w, fmt.Sprintf(`{"killed":%q}`, id))
+	}))
+	mux.HandleFunc("/admin/pool", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fmt.Sprintf(`{"open":%d,"dials":%d,"dial_errors":%d,"max_idle":%d,"max_idle_per_host":%d,"max_per_host":%d}`,
+			int(p.metrics.Gauge(`clawdbot_proxy_backend_conns_open`)),
+			p.metrics.Counter(`clawdbot_proxy_backend_dials_total`),
+			p.metrics.Counter(`clawdbot_proxy_backend_dial_errors_total`),
+			p.cfg.PoolMaxIdle, p.cfg.PoolMaxIdlePerHost, p.cfg.PoolMaxPerHost))
+	})
+	mux.HandleFunc("/admin/lb", func(w http.ResponseWriter, r *http.Request) {
+		type targetInfo struct {
+			Host    string  `json:"host"`
+			Healthy bool    `json:"healthy"`
+			Success float64 `json:"success,omitempty"`
+			Latency float64 `json:"latency_ms,omitempty"`
+			Weight  float64 `json:"weight,omitempty"`
+		}
+		out := []targetInfo{}
+		if p.lb != nil {
+			pool := p.lb.poolLatency()
+			for _, t := range p.lb.targets() {
+				info := targetInfo{Host: t.url.Host, Healthy: t.healthy()}
+				if t.stats != nil {
+					success, latency, _ := t.stats.snapshot()
+					info.Success = success
+					info.Latency = latency * 1000
+					info.Weight = t.stats.weight(pool)
+				}
+				out = append(out, info)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("/admin/bans", func(w http.ResponseWriter, r *http.Request) {
+		if p.bans == nil {
+			http.Error(w, "banning not enabled", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.bans.list())
+	})
+	mux.HandleFunc("/admin/ban", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		if p.bans == nil {
+			http.Error(w, "banning not enabled", http.StatusNotFound)
+			return
+		}
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			http.Error(w, "ip parameter required", http.StatusBadRequest)
+			return
+		}
+		duration := time.Duration(0) // escalate from history by default
+		if d := r.URL.Query().Get("duration"); d != "" {
+			var err error
+			if duration, err = time.ParseDuration(d); err != nil || duration <= 0 {
+				http.Error(w, "invalid duration", http.StatusBadRequest)
+				return
+			}
+		}
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "banned by administrator"
+		}
+		p.bans.ban(ip, reason, duration)
+		writeJSON(w, fmt.Sprintf(`{"banned":%q}`, ip))
+	}))
+	mux.HandleFunc("/admin/unban", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		if p.bans == nil {
+			http.Error(w, "banning not enabled", http.StatusNotFound)
+			return
+		}
+		ip := r.URL.Query().Get("ip")
+		if !p.bans.unban(ip) {
+			http.Error(w, "no such ban", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, fmt.Sprintf(`{"unbanned":%q}`, ip))
+	}))
+	mux.HandleFunc("/admin/cache/purge", requirePOST(p.handleCachePurge))
+	mux.HandleFunc("/admin/maintenance", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		on := r.URL.Query().Get("on") == "true"
+		p.enterMaintenance(on)
+		p.log.Info("maintenance mode toggled via admin API", "on", on)
+		writeJSON(w, fmt.Sprintf(`{"maintenance":%v}`, on))
+	}))
+	mux.HandleFunc("/admin/reload", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		reloaded := false
+		if p.apiKeys != nil && p.apiKeys.path != "" {
+			if err := p.apiKeys.reload(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			p.log.Info("api key file reloaded via admin API")
+			reloaded = true
+		}
+		if p.acl != nil {
+			if err := p.acl.reload(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			p.log.Info("acl rules reloaded via admin API")
+			reloaded = true
+		}
+		if !reloaded {
+			writeJSON(w, `{"reloaded":false,"reason":"no reloadable sources configured"}`)
+			return
+		}
+		writeJSON(w, `{"reloaded":true}`)
+	}))
+	mux.HandleFunc("/admin/chaos", p.handleChaos)
+	mux.HandleFunc("/admin/chaos/disable", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		p.chaos.disable()
+		p.log.Info("chaos injection disabled via admin API")
+		writeJSON(w, p.chaos.statusJSON())
+	}))
+	mux.HandleFunc("/admin/capture", func(w http.ResponseWriter, r *http.Request) {
+		active, entries := p.capture.status()
+		writeJSON(w, fmt.Sprintf(`{"active":%v,"entries":%d}`, active, entries))
+	})
+	mux.HandleFunc("/admin/capture/start", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		p.capture.start()
+		p.log.Info("request capture armed via admin API")
+		writeJSON(w, `{"active":true}`)
+	}))
+	mux.HandleFunc("/admin/capture/stop", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		p.capture.stop()
+		p.log.Info("request capture stopped via admin API")
+		writeJSON(w, `{"active":false}`)
+	}))
+	mux.HandleFunc("/admin/capture/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="clawdbot-proxy.har"`)
+		p.capture.writeHAR(w)
+	})
+	// Live status dashboard (see dashboard.go); admin-gated by virtue of
+	// living on this listener only.
+	mux.HandleFunc("/proxy-status", p.handleDashboard)
+	mux.HandleFunc("/proxy-status/stream", p.handleDashboardStream)
+	// Runtime debugging lives here because the admin listener is
+	// localhost-bound; none of this is ever reachable from the public
+	// listener (ServeHTTP has no /debug or /admin routes).
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/admin/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		// Full stacks plus the relay bookkeeping, for chasing WS
+		// goroutine leaks: every live session should account for exactly
+		// two relay goroutines.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "goroutines: %d\nws_sessions: %d\n\n", runtime.NumGoroutine(), p.sessions.len())
+		rpprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	mux.HandleFunc("/admin/switch", func(w http.ResponseWriter, r *http.Request) {
+		if p.bg == nil {
+			http.Error(w, "blue/green sets not configured", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSON(w, fmt.Sprintf(`{"active":%q}`, p.bg.active().name))
+			return
+		}
+		prev, changed, err := p.bg.switchTo(r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if changed {
+			p.log.Info("backend set switched via admin API", "from", prev.name, "to", p.bg.active().name)
+			p.drainSet(prev.name)
+		}
+		writeJSON(w, fmt.Sprintf(`{"active":%q,"switched":%v}`, p.bg.active().name, changed))
+	})
+	mux.HandleFunc("/admin/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		if p.logLevel == nil {
+			http.Error(w, "log level not adjustable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSON(w, fmt.Sprintf(`{"level":%q}`, strings.ToLower(p.logLevel.Level().String())))
+			return
+		}
+		level := r.URL.Query().Get("level")
+		switch level {
+		case "debug", "info", "warn", "error":
+		default:
+			http.Error(w, "level must be debug, info, warn or error", http.StatusBadRequest)
+			return
+		}
+		p.logLevel.Set(parseLogLevel(level))
+		p.log.Info("log level changed via admin API", "level", level)
+		writeJSON(w, fmt.Sprintf(`{"level":%q}`, level))
+	})
+	mux.HandleFunc("/admin/drain", requirePOST(func(w http.ResponseWriter, r *http.Request) {
+		if p.onDrain == nil {
+			http.Error(w, "drain not available", http.StatusServiceUnavailable)
+			return
+		}
+		p.log.Info("drain requested via admin API")
+		writeJSON(w, `{"draining":true}`)
+		p.onDrain()
+	}))
+	return p.auditAdmin(mux)
+}
+
+// startAdminServer runs the admin API on its own listener when configured.
+func (p *ProxyServer) startAdminServer(addr string) error {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			p.log.Warn("admin listener is not bound to localhost", "addr", addr)
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: p.newAdminHandler()}
+	go func() {
+		p.log.Info("admin API listening", "addr", addr)
+		srv.Serve(ln)
+	}()
+	return nil
+}
+
+func requirePOST(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintln(w, body)
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestProxy(t *testing.T, cfg *Config) *ProxyServer {
+	t.Helper()
+	if cfg.Backend == "" {
+		cfg.Backend = "http://127.0.0.1:0"
+	}
+	p, err := NewProxyServer(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAdminRateLimitFlush(t *testing.T) {
+	p := newTestProxy(t, &Config{RateLimitRPS: 1, RateLimitBurst: 1})
+	p.limiter.Allow("10.0.0.1")
+	p.limiter.Allow("10.0.0.2")
+	admin := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/ratelimit", nil))
+	if !strings.Contains(rec.Body.String(), `"entries":2`) {
+		t.Errorf("ratelimit view = %q, want entries:2", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/ratelimit/flush", nil))
+	if !strings.Contains(rec.Body.String(), `"flushed":2`) {
+		t.Errorf("flush = %q, want flushed:2", rec.Body.String())
+	}
+	if p.limiter.Len() != 0 {
+		t.Error("limiter should be empty after flush")
+	}
+}
+
+func TestAdminMaintenanceToggle(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	admin := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/maintenance?on=true", nil))
+	if !p.maintenance.Load() {
+		t.Fatal("maintenance should be on")
+	}
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("API status during maintenance = %d, want 503", rec.Code)
+	}
+
+	admin.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/maintenance?on=false", nil))
+	if p.maintenance.Load() {
+		t.Error("maintenance should be off again")
+	}
+}
+
+func TestAdminDebugEndpoints(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	admin := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/goroutines", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutines:") {
+		t.Errorf("goroutine dump = %d %q", rec.Code, rec.Body.String()[:min(80, rec.Body.Len())])
+	}
+	if !strings.Contains(rec.Body.String(), "ws_sessions: 0") {
+		t.Error("dump should include the WS session count")
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, rec.Code)
+		}
+	}
+
+	// The public listener must never expose the debug surface.
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rec.Code == http.StatusOK && strings.Contains(rec.Body.String(), "profiles") {
+		t.Error("pprof reachable on the public listener")
+	}
+}
+
+func TestAdminEndpointsRequirePOST(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	admin := p.newAdminHandler()
+	for _, path := range []string{"/admin/ratelimit/flush", "/admin/maintenance", "/admin/reload", "/admin/drain", "/admin/cache/purge"} {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s = %d, want 405", path, rec.Code)
+		}
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	p.logLevel = &slog.LevelVar{}
+	admin := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/loglevel?level=debug", nil))
+	if rec.Code != http.StatusOK || p.logLevel.Level() != slog.LevelDebug {
+		t.Fatalf("POST loglevel = %d, level = %v", rec.Code, p.logLevel.Level())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/loglevel", nil))
+	if !strings.Contains(rec.Body.String(), `"debug"`) {
+		t.Errorf("GET loglevel = %q, want current level", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/loglevel?level=chatty", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bogus level accepted: %d", rec.Code)
+	}
+}
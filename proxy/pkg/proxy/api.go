@@ -0,0 +1,104 @@
+// Package proxy is the Clawdbot edge proxy as an importable library: it
+// serves the Control UI static build, forwards /api/* to the Node gateway
+// with rate limiting and auth, and relays /ws WebSocket sessions. The
+// clawdbot-proxy command (cmd/clawdbot-proxy) is a thin wrapper over Run
+// and the subcommand entry points below; other Go programs embed the
+// proxy through New, Handler, Start, and Shutdown.
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// Run executes the full proxy process — daemonizing, logging, signal
+// handling, serving — and returns the process exit code. It blocks until
+// shutdown.
+func Run(args []string) int { return run(args) }
+
+// RunCheck validates a configuration (the `check` subcommand).
+func RunCheck(args []string, out io.Writer) int { return runCheck(args, out) }
+
+// RunPrintConfig dumps the effective configuration (the `print-config`
+// subcommand).
+func RunPrintConfig(args []string, out io.Writer) int { return runPrintConfig(args, out) }
+
+// RunService handles Windows service management (the `service`
+// subcommand); on other platforms it reports an error.
+func RunService(args []string, out io.Writer) int { return runService(args, out) }
+
+// Server is the embeddable form of the proxy: a ProxyServer plus just
+// enough lifecycle to start and stop it programmatically. Embedders that
+// need daemonizing, pidfiles, or signal-driven reloads should exec the
+// clawdbot-proxy binary instead.
+type Server struct {
+	Proxy *ProxyServer
+
+	srv *http.Server
+	ln  net.Listener
+}
+
+// New builds an embeddable proxy from a configuration. Use DefaultConfig
+// for the baseline and adjust fields before calling.
+func New(cfg *Config, log *slog.Logger) (*Server, error) {
+	p, err := NewProxyServer(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Proxy: p}, nil
+}
+
+// DefaultConfig returns a configuration with every option at its flag
+// default.
+func DefaultConfig() (*Config, error) {
+	return parseConfig(nil)
+}
+
+// Handler returns the proxy's full public handler chain, for mounting
+// inside an existing http.Server. Register custom middleware on s.Proxy
+// (Use, UseBefore) before calling.
+func (s *Server) Handler() http.Handler {
+	return s.Proxy.publicHandler()
+}
+
+// Start listens on the configured address and serves in the background;
+// it returns once the listener is up. Addr reports the bound address.
+func (s *Server) Start() error {
+	ln, err := listen(s.Proxy.cfg)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	s.srv = &http.Server{
+		Handler:           s.Handler(),
+		ReadTimeout:       s.Proxy.cfg.ReadTimeout,
+		ReadHeaderTimeout: s.Proxy.cfg.ReadHeaderTimeout,
+		WriteTimeout:      s.Proxy.cfg.WriteTimeout,
+	}
+	go s.srv.Serve(ln)
+	return nil
+}
+
+// Addr returns the bound listener address, or "" before Start.
+func (s *Server) Addr() string {
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Shutdown drains in-flight requests and WebSocket sessions within the
+// context's deadline, then closes the listener.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	s.Proxy.beginDrain()
+	err := s.srv.Shutdown(ctx)
+	s.Proxy.awaitSessions(ctx)
+	s.srv.Close()
+	return err
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedServerLifecycle(t *testing.T) {
+	cfg, err := DefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Listen = "127.0.0.1:0"
+	cfg.Backend = echoBackendScheme
+
+	s, err := New(cfg, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://" + s.Addr() + "/api/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Echo-Backend") != "1" {
+		t.Fatalf("embedded proxy = %d %q, want 200 from echo backend", resp.StatusCode, body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := http.Get("http://" + s.Addr() + "/api/hello"); err == nil {
+		t.Fatal("listener still accepting after Shutdown")
+	}
+}
+
+func TestDefaultConfigMatchesFlagDefaults(t *testing.T) {
+	cfg, err := DefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen == "" || cfg.RateLimitRPS <= 0 {
+		t.Fatalf("DefaultConfig = %+v, want flag defaults populated", cfg)
+	}
+}
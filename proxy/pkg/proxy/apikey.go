@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiKeyEntry carries optional per-key rate limit overrides (zero means
+// "use the global limits").
+type apiKeyEntry struct {
+	rps   float64
+	burst int
+}
+
+// APIKeyStore validates client API keys from flags and/or a key file. The
+// file is re-read when its mtime changes, so keys can be added or revoked
+// without restarting the proxy.
+type APIKeyStore struct {
+	path string
+
+	mu       sync.Mutex
+	keys     map[string]apiKeyEntry
+	static   map[string]apiKeyEntry
+	lastMod  time.Time
+	lastStat time.Time
+}
+
+// Key file format, one key per line:
+//
+//	<key> [rps [burst]]   # comment
+func NewAPIKeyStore(staticKeys []string, path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{path: path, static: make(map[string]apiKeyEntry)}
+	for _, k := range staticKeys {
+		s.static[k] = apiKeyEntry{}
+	}
+	s.keys = s.static
+	if path != "" {
+		if err := s.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *APIKeyStore) reload() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]apiKeyEntry, len(s.static))
+	for k, e := range s.static {
+		keys[k] = e
+	}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := apiKeyEntry{}
+		if len(fields) > 1 {
+			entry.rps, _ = strconv.ParseFloat(fields[1], 64)
+		}
+		if len(fields) > 2 {
+			entry.burst, _ = strconv.Atoi(fields[2])
+		}
+		keys[fields[0]] = entry
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	s.keys = keys
+	s.lastMod = info.ModTime()
+	return nil
+}
+
+// maybeReload stats the key file at most once per second and reloads it when
+// the mtime moved. Reload errors keep the previous key set.
+func (s *APIKeyStore) maybeReload() {
+	if s.path == "" || time.Since(s.lastStat) < time.Second {
+		return
+	}
+	s.lastStat = time.Now()
+	info, err := os.Stat(s.path)
+	if err != nil || info.ModTime().Equal(s.lastMod) {
+		return
+	}
+	s.reload()
+}
+
+// Lookup reports whether key is valid and returns its overrides.
+func (s *APIKeyStore) Lookup(key string) (apiKeyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maybeReload()
+	for stored, entry := range s.keys {
+		if len(stored) == len(key) && subtle.ConstantTimeCompare([]byte(stored), []byte(key)) == 1 {
+			return entry, true
+		}
+	}
+	return apiKeyEntry{}, false
+}
+
+// checkAPIKey enforces API key auth on /api/* when a key store is
+// configured. It returns the validated key so per-key rate limits can be
+// applied downstream.
+func (p *ProxyServer) checkAPIKey(w http.ResponseWriter, r *http.Request) (string, apiKeyEntry, bool) {
+	if p.apiKeys == nil {
+		return "", apiKeyEntry{}, true
+	}
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		p.httpError(w, r, http.StatusUnauthorized, "missing API key")
+		return "", apiKeyEntry{}, false
+	}
+	entry, ok := p.apiKeys.Lookup(key)
+	if !ok {
+		p.metrics.Inc(`clawdbot_proxy_auth_failures_total{kind="api_key"}`)
+		p.strike(r, "invalid api key")
+		p.log.Warn("api key rejected", "path", r.URL.Path, "client", p.clientIP(r))
+		p.httpError(w, r, http.StatusUnauthorized, "invalid API key")
+		return "", apiKeyEntry{}, false
+	}
+	return key, entry, true
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyStoreStaticKeys(t *testing.T) {
+	s, err := NewAPIKeyStore([]string{"alpha", "beta"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Lookup("alpha"); !ok {
+		t.Error("alpha should be valid")
+	}
+	if _, ok := s.Lookup("gamma"); ok {
+		t.Error("gamma should be rejected")
+	}
+}
+
+func TestAPIKeyStoreFileWithOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "plain-key\nlimited-key 5 10  # heavy user\n# comment line\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewAPIKeyStore(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Lookup("plain-key"); !ok {
+		t.Error("plain-key should be valid")
+	}
+	entry, ok := s.Lookup("limited-key")
+	if !ok {
+		t.Fatal("limited-key should be valid")
+	}
+	if entry.rps != 5 || entry.burst != 10 {
+		t.Errorf("overrides = %v, want rps=5 burst=10", entry)
+	}
+}
+
+func TestAPIKeyStoreRevocationOnReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("doomed-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewAPIKeyStore(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Lookup("doomed-key"); !ok {
+		t.Fatal("doomed-key should be valid before revocation")
+	}
+
+	if err := os.WriteFile(path, []byte("other-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Force the mtime check past its 1s stat throttle.
+	s.lastStat = time.Time{}
+	future := time.Now().Add(2 * time.Second)
+	os.Chtimes(path, future, future)
+
+	if _, ok := s.Lookup("doomed-key"); ok {
+		t.Error("doomed-key should be revoked after file change")
+	}
+	if _, ok := s.Lookup("other-key"); !ok {
+		t.Error("other-key should be valid after reload")
+	}
+}
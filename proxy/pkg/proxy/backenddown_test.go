@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// downProxy points at a port nothing listens on, so every backend request
+// fails with connection refused.
+func downProxy(t *testing.T) *ProxyServer {
+	t.Helper()
+	return newTestProxy(t, &Config{Backend: "http://127.0.0.1:1"})
+}
+
+func TestBackendDownServesRetryPageForBrowsers(t *testing.T) {
+	p := downProxy(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("Accept", "text/html")
+	p.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Gateway starting") || !strings.Contains(body, "fetch(") {
+		t.Fatalf("missing retry page: %q", body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After")
+	}
+	if p.metrics.Counter(`clawdbot_proxy_backend_errors_total{cause="refused"}`) != 1 {
+		t.Fatal("refused cause not counted")
+	}
+}
+
+func TestBackendDownAnswersJSONForAPIClients(t *testing.T) {
+	p := downProxy(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("Accept", "application/json")
+	p.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+	var env map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("body %q: %v", rec.Body.String(), err)
+	}
+	if env["code"] != float64(502) || env["retry_after"] != float64(backendRetrySeconds) {
+		t.Fatalf("envelope = %v", env)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After")
+	}
+}
+
+func TestBackendErrorCause(t *testing.T) {
+	status, cause := backendErrorCause(timeoutErr{})
+	if status != http.StatusGatewayTimeout || cause != "timeout" {
+		t.Fatalf("timeout classified as %d/%s", status, cause)
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
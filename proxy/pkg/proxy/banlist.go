@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fail2ban-style automatic banning. Single rejections are business as
+// usual, but an IP that keeps tripping the rate limiter or failing auth is
+// probing, and each attempt still costs a full request's worth of work.
+// With -ban-threshold set, offenses are counted per IP in a sliding
+// window; crossing the threshold bans the IP outright — banned requests
+// are answered 403 before auth or routing runs. Repeat offenders escalate:
+// every new ban doubles the duration up to banMaxDuration. The list can be
+// persisted with -ban-file (one "<ip> <until-unix> <count> <reason>" per
+// line) so bans survive restarts, and /admin/ban, /admin/unban, and
+// /admin/bans manage it at runtime.
+
+// banMaxDuration caps the escalation doubling.
+const banMaxDuration = 24 * time.Hour
+
+type banEntry struct {
+	IP     string    `json:"ip"`
+	Until  time.Time `json:"until"`
+	Count  int       `json:"count"` // times banned; drives escalation
+	Reason string    `json:"reason"`
+}
+
+type offenseWindow struct {
+	count int
+	start time.Time
+}
+
+type banManager struct {
+	threshold int
+	window    time.Duration
+	base      time.Duration
+	path      string
+	metrics   *Metrics
+	log       *slog.Logger
+	audit     *auditLog        // nil unless -audit-log is set
+	hooks     *webhookNotifier // nil unless -webhook-urls is set
+
+	mu       sync.Mutex
+	bans     map[string]*banEntry // kept after expiry so escalation sticks
+	offenses map[string]*offenseWindow
+}
+
+func newBanManager(cfg *Config, metrics *Metrics, log *slog.Logger) (*banManager, error) {
+	m := &banManager{
+		threshold: cfg.BanThreshold,
+		window:    cfg.BanWindow,
+		base:      cfg.BanDuration,
+		path:      cfg.BanFile,
+		metrics:   metrics,
+		log:       log,
+		bans:      make(map[string]*banEntry),
+		offenses:  make(map[string]*offenseWindow),
+	}
+	if m.path != "" {
+		if err := m.load(); err != nil {
+			return nil, fmt.Errorf("loading ban file: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// banned reports whether ip is currently banned and how long remains.
+func (m *banManager) banned(ip string) (bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.bans[ip]
+	if !ok {
+		return false, 0
+	}
+	left := time.Until(e.Until)
+	if left <= 0 {
+		return false, 0
+	}
+	return true, left
+}
+
+// offense counts one violation; crossing the threshold inside the window
+// bans the IP.
+func (m *banManager) offense(ip, reason string) {
+	m.mu.Lock()
+	now := time.Now()
+	o := m.offenses[ip]
+	if o == nil || now.Sub(o.start) > m.window {
+		// Same pragmatic cleanup as the rate limiter: reset wholesale when
+		// the map grows unreasonably.
+		if len(m.offenses) > 10000 {
+			m.offenses = make(map[string]*offenseWindow)
+		}
+		o = &offenseWindow{start: now}
+		m.offenses[ip] = o
+	}
+	o.count++
+	if o.count < m.threshold {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.offenses, ip)
+	m.banLocked(ip, reason, 0)
+	m.mu.Unlock()
+}
+
+// ban imposes (or extends) a ban; duration 0 escalates from the entry's
+// history, non-zero (admin use) is taken as-is without escalating.
+func (m *banManager) ban(ip, reason string, duration time.Duration) {
+	m.mu.Lock()
+	m.banLocked(ip, reason, duration)
+	m.mu.Unlock()
+}
+
+func (m *banManager) banLocked(ip, reason string, duration time.Duration) {
+	e := m.bans[ip]
+	if e == nil {
+		e = &banEntry{IP: ip}
+		m.bans[ip] = e
+	}
+	if duration == 0 {
+		e.Count++
+		duration = m.base << (e.Count - 1)
+		if duration > banMaxDuration || duration <= 0 {
+			duration = banMaxDuration
+		}
+	}
+	e.Until = time.Now().Add(duration)
+	e.Reason = reason
+	m.metrics.Inc(`clawdbot_proxy_bans_total`)
+	m.log.Warn("ip banned", "ip", ip, "reason", reason, "until", e.Until, "count", e.Count)
+	m.audit.record("ban", "ip", ip, "reason", reason, "until", e.Until.Format(time.RFC3339))
+	m.hooks.notify("ban", "ip", ip, "reason", reason, "until", e.Until.Format(time.RFC3339))
+	m.saveLocked()
+	m.updateGaugeLocked()
+}
+
+// unban lifts a ban and forgets its escalation history.
+func (m *banManager) unban(ip string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.bans[ip]; !ok {
+		return false
+	}
+	delete(m.bans, ip)
+	m.saveLocked()
+	m.updateGaugeLocked()
+	return true
+}
+
+// list returns the active bans sorted by IP.
+func (m *banManager) list() []banEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]banEntry, 0, len(m.bans))
+	for _, e := range m.bans {
+		if time.Now().Before(e.Until) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].IP < out[j].IP })
+	return out
+}
+
+func (m *banManager) updateGaugeLocked() {
+	active := 0
+	for _, e := range m.bans {
+		if time.Now().Before(e.Until) {
+			active++
+		}
+	}
+	m.metrics.SetGauge(`clawdbot_proxy_bans_active`, float64(active))
+}
+
+func (m *banManager) load() error {
+	f, err := os.Open(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // first run; the file appears on the first ban
+		}
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(sc.Text()), " ", 4)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		until, err1 := strconv.ParseInt(fields[1], 10, 64)
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		e := &banEntry{IP: fields[0], Until: time.Unix(until, 0), Count: count}
+		if len(fields) == 4 {
+			e.Reason = fields[3]
+		}
+		m.bans[e.IP] = e
+	}
+	m.updateGaugeLocked()
+	return sc.Err()
+}
+
+// saveLocked rewrites the ban file; persistence failures are logged, not
+// fatal — the in-memory state still protects this process.
+func (m *banManager) saveLocked() {
+	if m.path == "" {
+		return
+	}
+	var b strings.Builder
+	for _, e := range m.bans {
+		fmt.Fprintf(&b, "%s %d %d %s\n", e.IP, e.Until.Unix(), e.Count, e.Reason)
+	}
+	if err := os.WriteFile(m.path, []byte(b.String()), 0o600); err != nil {
+		m.log.Error("writing ban file failed", "path", m.path, "error", err)
+	}
+}
+
+// checkBan rejects requests from banned IPs before any further work.
+func (p *ProxyServer) checkBan(w http.ResponseWriter, r *http.Request) bool {
+	if p.bans == nil {
+		return true
+	}
+	banned, left := p.bans.banned(p.clientIP(r))
+	if !banned {
+		return true
+	}
+	p.metrics.Inc(`clawdbot_proxy_banned_requests_total`)
+	w.Header().Set("Retry-After", strconv.Itoa(int(left.Seconds())+1))
+	p.httpError(w, r, http.StatusForbidden, "temporarily banned")
+	return false
+}
+
+// strike records one offense against the request's client IP.
+func (p *ProxyServer) strike(r *http.Request, reason string) {
+	if p.bans == nil {
+		return
+	}
+	p.bans.offense(p.clientIP(r), reason)
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func banConfig(file string) *Config {
+	return &Config{
+		BanThreshold: 3,
+		BanWindow:    time.Minute,
+		BanDuration:  10 * time.Minute,
+		BanFile:      file,
+	}
+}
+
+func TestBanAfterRepeatedOffenses(t *testing.T) {
+	p := newTestProxy(t, banConfig(""))
+	for i := 0; i < 2; i++ {
+		p.bans.offense("10.0.0.9", "rate limit exceeded")
+	}
+	if banned, _ := p.bans.banned("10.0.0.9"); banned {
+		t.Fatal("banned below threshold")
+	}
+	p.bans.offense("10.0.0.9", "rate limit exceeded")
+	banned, left := p.bans.banned("10.0.0.9")
+	if !banned || left <= 0 {
+		t.Fatalf("banned = %v, left = %v", banned, left)
+	}
+
+	// Banned requests are rejected before routing.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.RemoteAddr = "10.0.0.9:5000"
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("banned request status = %d, want 403", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After on ban rejection")
+	}
+}
+
+func TestBanEscalation(t *testing.T) {
+	p := newTestProxy(t, banConfig(""))
+	p.bans.ban("10.0.0.1", "test", 0)
+	first := p.bans.bans["10.0.0.1"].Until
+	p.bans.ban("10.0.0.1", "test", 0)
+	second := p.bans.bans["10.0.0.1"].Until
+	if d := second.Sub(first); d < 9*time.Minute {
+		t.Fatalf("second ban only %v longer, want ~doubled", d)
+	}
+	if p.bans.bans["10.0.0.1"].Count != 2 {
+		t.Fatalf("count = %d", p.bans.bans["10.0.0.1"].Count)
+	}
+}
+
+func TestBanPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bans")
+	p := newTestProxy(t, banConfig(file))
+	p.bans.ban("192.0.2.7", "probing", 0)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "192.0.2.7") {
+		t.Fatalf("ban file = %q", data)
+	}
+
+	p2 := newTestProxy(t, banConfig(file))
+	if banned, _ := p2.bans.banned("192.0.2.7"); !banned {
+		t.Fatal("ban did not survive reload")
+	}
+}
+
+func TestAdminBanEndpoints(t *testing.T) {
+	p := newTestProxy(t, banConfig(""))
+	admin := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/ban?ip=203.0.113.5&duration=1h&reason=abuse", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ban status = %d: %s", rec.Code, rec.Body)
+	}
+	if banned, _ := p.bans.banned("203.0.113.5"); !banned {
+		t.Fatal("admin ban not applied")
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/bans", nil))
+	if !strings.Contains(rec.Body.String(), "203.0.113.5") || !strings.Contains(rec.Body.String(), "abuse") {
+		t.Fatalf("bans list = %q", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/unban?ip=203.0.113.5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unban status = %d", rec.Code)
+	}
+	if banned, _ := p.bans.banned("203.0.113.5"); banned {
+		t.Fatal("still banned after unban")
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/unban?ip=203.0.113.5", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("double unban status = %d, want 404", rec.Code)
+	}
+}
+
+func TestRateLimitOffensesLeadToBan(t *testing.T) {
+	cfg := banConfig("")
+	cfg.RateLimitRPS = 0.001
+	cfg.RateLimitBurst = 1
+	p := newTestProxy(t, cfg)
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		req.RemoteAddr = "10.1.2.3:1234"
+		p.ServeHTTP(rec, req)
+	}
+	if banned, _ := p.bans.banned("10.1.2.3"); !banned {
+		t.Fatal("repeated rate limit hits should ban the IP")
+	}
+}
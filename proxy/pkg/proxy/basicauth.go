@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP Basic auth for small deployments that want a password in front of
+// the Control UI without a full auth stack. Credentials come from an
+// htpasswd file (plain, {SHA}, or apr1 entries — bcrypt needs a
+// non-stdlib package and is rejected at load time with a clear error).
+// The file is re-read on change like the API key file, and repeated
+// failures from one IP trigger a temporary lockout.
+
+const (
+	basicAuthMaxFailures = 5
+	basicAuthLockout     = time.Minute
+)
+
+// HtpasswdStore validates Basic auth credentials against an htpasswd file.
+type HtpasswdStore struct {
+	path string
+
+	mu       sync.Mutex
+	users    map[string]string // user -> stored hash
+	failures map[string]*authFailure
+	lastMod  time.Time
+	lastStat time.Time
+}
+
+type authFailure struct {
+	count       int
+	lockedUntil time.Time
+}
+
+func NewHtpasswdStore(path string) (*HtpasswdStore, error) {
+	s := &HtpasswdStore{path: path, failures: make(map[string]*authFailure)}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *HtpasswdStore) reload() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	users := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" || hash == "" {
+			return fmt.Errorf("htpasswd %s line %d: want user:hash", s.path, line)
+		}
+		if strings.HasPrefix(hash, "$2") {
+			return fmt.Errorf("htpasswd %s line %d: bcrypt entries are not supported by this build; use SHA (-s) or MD5 (-m)", s.path, line)
+		}
+		users[user] = hash
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	s.users = users
+	s.lastMod = info.ModTime()
+	return nil
+}
+
+func (s *HtpasswdStore) maybeReload() {
+	if time.Since(s.lastStat) < time.Second {
+		return
+	}
+	s.lastStat = time.Now()
+	info, err := os.Stat(s.path)
+	if err != nil || info.ModTime().Equal(s.lastMod) {
+		return
+	}
+	s.reload()
+}
+
+// Verify checks one credential pair. Unknown users burn the same hashing
+// work as known ones so timing does not leak which usernames exist.
+func (s *HtpasswdStore) Verify(user, pass string) bool {
+	s.mu.Lock()
+	s.maybeReload()
+	hash, ok := s.users[user]
+	s.mu.Unlock()
+	if !ok {
+		verifyHtpasswdHash("{SHA}AAAAAAAAAAAAAAAAAAAAAAAAAAA=", pass)
+		return false
+	}
+	return verifyHtpasswdHash(hash, pass)
+}
+
+func verifyHtpasswdHash(hash, pass string) bool {
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		encoded := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(encoded)) == 1
+	case strings.HasPrefix(hash, "$apr1$"):
+		rest := strings.TrimPrefix(hash, "$apr1$")
+		salt, _, ok := strings.Cut(rest, "$")
+		if !ok {
+			return false
+		}
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(apr1Crypt(pass, salt))) == 1
+	default:
+		// Plaintext entry (htpasswd -p).
+		return len(hash) == len(pass) && subtle.ConstantTimeCompare([]byte(hash), []byte(pass)) == 1
+	}
+}
+
+// apr1Crypt implements Apache's iterated-MD5 password scheme ($apr1$),
+// the default htpasswd format on many systems.
+func apr1Crypt(pass, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	inner := md5.Sum([]byte(pass + salt + pass))
+	d := md5.New()
+	d.Write([]byte(pass + "$apr1$" + salt))
+	for n := len(pass); n > 0; n -= 16 {
+		if n > 16 {
+			d.Write(inner[:])
+		} else {
+			d.Write(inner[:n])
+		}
+	}
+	for n := len(pass); n > 0; n >>= 1 {
+		if n&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write([]byte(pass[:1]))
+		}
+	}
+	sum := d.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 == 1 {
+			d.Write([]byte(pass))
+		} else {
+			d.Write(sum)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write([]byte(pass))
+		}
+		if i&1 == 1 {
+			d.Write(sum)
+		} else {
+			d.Write([]byte(pass))
+		}
+		sum = d.Sum(nil)
+	}
+	return "$apr1$" + salt + "$" + apr1Encode(sum)
+}
+
+// apr1Encode is crypt's base64 variant (different alphabet and byte order).
+func apr1Encode(sum []byte) string {
+	const alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	order := [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}}
+	var out strings.Builder
+	for _, idx := range order {
+		v := uint(sum[idx[0]])<<16 | uint(sum[idx[1]])<<8 | uint(sum[idx[2]])
+		for i := 0; i < 4; i++ {
+			out.WriteByte(alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	v := uint(sum[11])
+	out.WriteByte(alphabet[v&0x3f])
+	out.WriteByte(alphabet[(v>>6)&0x3f])
+	return out.String()
+}
+
+// locked reports whether an IP is in failure lockout; recordFailure and
+// clearFailures maintain the counter around each attempt.
+func (s *HtpasswdStore) locked(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.failures[ip]
+	if f == nil {
+		return false
+	}
+	if !f.lockedUntil.IsZero() && time.Now().Before(f.lockedUntil) {
+		return true
+	}
+	if !f.lockedUntil.IsZero() {
+		delete(s.failures, ip) // lockout expired
+	}
+	return false
+}
+
+func (s *HtpasswdStore) recordFailure(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.failures) > 10000 {
+		s.failures = make(map[string]*authFailure)
+	}
+	f := s.failures[ip]
+	if f == nil {
+		f = &authFailure{}
+		s.failures[ip] = f
+	}
+	f.count++
+	if f.count >= basicAuthMaxFailures {
+		f.lockedUntil = time.Now().Add(basicAuthLockout)
+	}
+}
+
+func (s *HtpasswdStore) clearFailures(ip string) {
+	s.mu.Lock()
+	delete(s.failures, ip)
+	s.mu.Unlock()
+}
+
+// checkBasicAuth enforces Basic auth on the configured path prefixes.
+// Returns false when the request was answered.
+func (p *ProxyServer) checkBasicAuth(w http.ResponseWriter, r *http.Request) bool {
+	if p.htpasswd == nil || !pathInPrefixes(r.URL.Path, p.cfg.BasicAuthPaths) {
+		return true
+	}
+	ip := p.clientIP(r)
+	if p.htpasswd.locked(ip) {
+		p.metrics.Inc(`clawdbot_proxy_basic_auth_locked_total`)
+		w.Header().Set("Retry-After", "60")
+		p.httpError(w, r, http.StatusTooManyRequests, "too many failed attempts")
+		return false
+	}
+	user, pass, ok := r.BasicAuth()
+	if ok && p.htpasswd.Verify(user, pass) {
+		p.htpasswd.clearFailures(ip)
+		return true
+	}
+	if ok {
+		p.htpasswd.recordFailure(ip)
+		p.strike(r, "basic auth failure")
+		p.log.Warn("basic auth failure", "user", user, "client", ip)
+	}
+	p.metrics.Inc(`clawdbot_proxy_basic_auth_rejected_total`)
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+p.cfg.BasicAuthRealm+`", charset="UTF-8"`)
+	p.httpError(w, r, http.StatusUnauthorized, "authentication required")
+	return false
+}
+
+func pathInPrefixes(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix == "/" || pathPrefixMatches(prefix, path) {
+			return true
+		}
+	}
+	return false
+}
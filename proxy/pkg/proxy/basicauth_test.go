@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeHtpasswd(t *testing.T, lines string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApr1Crypt(t *testing.T) {
+	// Reference vectors from `openssl passwd -apr1`.
+	cases := []struct {
+		pass, salt, want string
+	}{
+		{"secret", "abcdefgh", "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/"},
+		{"mypass", "saltsalt", "$apr1$saltsalt$69jptZ4xPTigRmRcadXIk."},
+	}
+	for _, tc := range cases {
+		if got := apr1Crypt(tc.pass, tc.salt); got != tc.want {
+			t.Errorf("apr1Crypt(%q, %q) = %q, want %q", tc.pass, tc.salt, got, tc.want)
+		}
+	}
+}
+
+func TestHtpasswdFormats(t *testing.T) {
+	// "{SHA}" of "shapass", apr1 of "secret", and one plaintext entry.
+	path := writeHtpasswd(t, `
+sha-user:{SHA}z0jT3TdveclVlHs5WCpg5cPeIe8=
+apr-user:$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/
+plain-user:plaintext
+`)
+	s, err := NewHtpasswdStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		user, pass string
+		want       bool
+	}{
+		{"sha-user", "shapass", true},
+		{"sha-user", "wrong", false},
+		{"apr-user", "secret", true},
+		{"apr-user", "Secret", false},
+		{"plain-user", "plaintext", true},
+		{"plain-user", "plaintex", false},
+		{"nobody", "anything", false},
+	}
+	for _, tc := range cases {
+		if got := s.Verify(tc.user, tc.pass); got != tc.want {
+			t.Errorf("Verify(%q, %q) = %v, want %v", tc.user, tc.pass, got, tc.want)
+		}
+	}
+}
+
+func TestHtpasswdRejectsBcrypt(t *testing.T) {
+	path := writeHtpasswd(t, "u:$2y$05$abcdefghijklmnopqrstuv\n")
+	if _, err := NewHtpasswdStore(path); err == nil {
+		t.Error("bcrypt entries should be rejected at load time")
+	}
+}
+
+func TestBasicAuthChallenge(t *testing.T) {
+	path := writeHtpasswd(t, "admin:letmein\n")
+	p := staticProxy(t, &Config{HtpasswdFile: path, BasicAuthPaths: []string{"/"}, BasicAuthRealm: "Clawdbot"},
+		map[string]string{"index.html": "ui"})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); got == "" {
+		t.Error("challenge missing WWW-Authenticate")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("admin", "letmein")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("authenticated status = %d, want 200", rec.Code)
+	}
+}
+
+func TestBasicAuthPathScoping(t *testing.T) {
+	path := writeHtpasswd(t, "admin:letmein\n")
+	p := staticProxy(t, &Config{HtpasswdFile: path, BasicAuthPaths: []string{"/api"}},
+		map[string]string{"index.html": "ui"})
+
+	// UI outside the protected prefixes stays open.
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("unprotected path status = %d, want 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("protected path status = %d, want 401", rec.Code)
+	}
+}
+
+func TestBasicAuthLockout(t *testing.T) {
+	path := writeHtpasswd(t, "admin:letmein\n")
+	p := staticProxy(t, &Config{HtpasswdFile: path, BasicAuthPaths: []string{"/"}},
+		map[string]string{"index.html": "ui"})
+
+	for i := 0; i < basicAuthMaxFailures; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "192.0.2.9:1000"
+		r.SetBasicAuth("admin", "wrong")
+		p.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// Even the right password is refused while locked out.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.9:1000"
+	r.SetBasicAuth("admin", "letmein")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("locked-out status = %d, want 429", rec.Code)
+	}
+
+	// Other IPs are unaffected.
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.10:1000"
+	r.SetBasicAuth("admin", "letmein")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", rec.Code)
+	}
+
+	// Expired lockouts clear.
+	p.htpasswd.mu.Lock()
+	p.htpasswd.failures["192.0.2.9"].lockedUntil = time.Now().Add(-time.Second)
+	p.htpasswd.mu.Unlock()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.9:1000"
+	r.SetBasicAuth("admin", "letmein")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("post-lockout status = %d, want 200", rec.Code)
+	}
+}
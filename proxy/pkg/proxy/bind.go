@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Bind address resolution: instead of a single -listen string the proxy
+// can bind the same port on several concrete addresses. -listen-interfaces
+// names the interfaces to bind (e.g. "tailscale0,lo" to serve only the
+// tailnet and loopback), with the port taken from -listen;
+// -listen-family restricts binding to ipv4 or ipv6 addresses. Every
+// resolved address is logged at startup so operators can verify exactly
+// where the proxy is reachable.
+
+// listenNetwork maps -listen-family to the net.Listen network.
+func listenNetwork(family string) string {
+	switch family {
+	case "ipv4":
+		return "tcp4"
+	case "ipv6":
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// familyMatches reports whether ip satisfies -listen-family.
+func familyMatches(ip net.IP, family string) bool {
+	switch family {
+	case "ipv4":
+		return ip.To4() != nil
+	case "ipv6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// resolveInterfaceAddrs expands -listen-interfaces into ip:port strings.
+// Link-local IPv6 addresses carry their zone so binding works.
+func resolveInterfaceAddrs(names []string, family, port string) ([]string, error) {
+	var out []string
+	for _, name := range names {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("listen-interfaces: %w", err)
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("listen-interfaces: %s: %w", name, err)
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || !familyMatches(ipnet.IP, family) {
+				continue
+			}
+			host := ipnet.IP.String()
+			if ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				host += "%" + name
+			}
+			out = append(out, net.JoinHostPort(host, port))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("listen-interfaces: no %s addresses on %s", familyLabel(family), strings.Join(names, ", "))
+	}
+	return out, nil
+}
+
+func familyLabel(family string) string {
+	if family == "" || family == "any" {
+		return "usable"
+	}
+	return family
+}
+
+// listenAll opens every main listener. Inherited (SIGUSR2 upgrade),
+// socket-activated, and unix-socket listeners stay single; otherwise the
+// listen configuration may expand to one listener per resolved address.
+func listenAll(cfg *Config) ([]net.Listener, error) {
+	if len(cfg.ListenInterfaces) == 0 && listenNetwork(cfg.ListenFamily) == "tcp" {
+		ln, err := listen(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+	if ln, err := inheritedListener(); err != nil || ln != nil {
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+	if ln, err := activationListener(); err != nil || ln != nil {
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+	addrs := []string{cfg.Listen}
+	if len(cfg.ListenInterfaces) > 0 {
+		_, port, err := net.SplitHostPort(cfg.Listen)
+		if err != nil {
+			return nil, fmt.Errorf("listen-interfaces needs a host:port -listen for the port: %w", err)
+		}
+		if addrs, err = resolveInterfaceAddrs(cfg.ListenInterfaces, cfg.ListenFamily, port); err != nil {
+			return nil, err
+		}
+	}
+	network := listenNetwork(cfg.ListenFamily)
+	var lns []net.Listener
+	for _, addr := range addrs {
+		ln, err := net.Listen(network, addr)
+		if err != nil {
+			for _, open := range lns {
+				open.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestListenNetwork(t *testing.T) {
+	for family, want := range map[string]string{"": "tcp", "any": "tcp", "ipv4": "tcp4", "ipv6": "tcp6"} {
+		if got := listenNetwork(family); got != want {
+			t.Errorf("listenNetwork(%q) = %q, want %q", family, got, want)
+		}
+	}
+}
+
+func TestFamilyMatches(t *testing.T) {
+	v4 := net.ParseIP("192.0.2.1")
+	v6 := net.ParseIP("2001:db8::1")
+	if !familyMatches(v4, "ipv4") || familyMatches(v6, "ipv4") {
+		t.Error("ipv4 filter wrong")
+	}
+	if !familyMatches(v6, "ipv6") || familyMatches(v4, "ipv6") {
+		t.Error("ipv6 filter wrong")
+	}
+	if !familyMatches(v4, "any") || !familyMatches(v6, "") {
+		t.Error("any filter wrong")
+	}
+}
+
+func TestResolveInterfaceAddrs(t *testing.T) {
+	if _, err := net.InterfaceByName("lo"); err != nil {
+		t.Skip("no loopback interface named lo")
+	}
+	addrs, err := resolveInterfaceAddrs([]string{"lo"}, "ipv4", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, a := range addrs {
+		host, _, err := net.SplitHostPort(a)
+		if err != nil {
+			t.Fatalf("bad addr %q: %v", a, err)
+		}
+		if net.ParseIP(host).To4() == nil {
+			t.Errorf("ipv4 filter let %q through", a)
+		}
+		if host == "127.0.0.1" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("loopback v4 address missing from %v", addrs)
+	}
+
+	if _, err := resolveInterfaceAddrs([]string{"does-not-exist0"}, "", "0"); err == nil {
+		t.Error("unknown interface accepted")
+	}
+}
+
+func TestListenAllOnInterfaces(t *testing.T) {
+	if _, err := net.InterfaceByName("lo"); err != nil {
+		t.Skip("no loopback interface named lo")
+	}
+	cfg := &Config{Listen: ":0", ListenInterfaces: []string{"lo"}, ListenFamily: "ipv4"}
+	lns, err := listenAll(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, ln := range lns {
+			ln.Close()
+		}
+	}()
+	if len(lns) == 0 {
+		t.Fatal("no listeners bound")
+	}
+	for _, ln := range lns {
+		if !strings.HasPrefix(ln.Addr().String(), "127.") {
+			t.Errorf("bound %s, want a loopback v4 address", ln.Addr())
+		}
+	}
+}
+
+func TestBindConfigValidation(t *testing.T) {
+	cfg := &Config{Backend: "http://127.0.0.1:0", ListenFamily: "ipv5"}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "listen-family") {
+		t.Errorf("bad family = %v, want error", err)
+	}
+	cfg = &Config{Backend: "http://127.0.0.1:0", Listen: "unix:/tmp/p.sock", ListenInterfaces: []string{"lo"}}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "unix sockets") {
+		t.Errorf("interfaces with unix socket = %v, want error", err)
+	}
+}
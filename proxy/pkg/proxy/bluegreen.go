@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Blue/green deployments: -backend-blue and -backend-green name two gateway
+// instances, and POST /admin/switch?to=<set> atomically points all new
+// traffic at the other one. In-flight HTTP requests on the old set simply
+// finish; its WebSocket sessions are asked to close and force-closed after
+// the -switch-drain timer so long-lived relays do not pin the old gateway
+// forever.
+
+type backendSet struct {
+	name  string
+	url   *url.URL
+	proxy *httputil.ReverseProxy
+}
+
+type blueGreen struct {
+	sets    map[string]*backendSet
+	current atomic.Pointer[backendSet]
+	drain   time.Duration
+	metrics *Metrics
+	log     *slog.Logger
+}
+
+func (p *ProxyServer) newBlueGreen(blue, green *url.URL) (*blueGreen, error) {
+	bg := &blueGreen{
+		sets: map[string]*backendSet{
+			"blue":  {name: "blue", url: blue, proxy: p.newReverseProxy(blue)},
+			"green": {name: "green", url: green, proxy: p.newReverseProxy(green)},
+		},
+		drain:   p.cfg.SwitchDrain,
+		metrics: p.metrics,
+		log:     p.log,
+	}
+	active, ok := bg.sets[p.cfg.ActiveSet]
+	if !ok {
+		return nil, fmt.Errorf("-active-set must be blue or green, got %q", p.cfg.ActiveSet)
+	}
+	bg.current.Store(active)
+	return bg, nil
+}
+
+func (bg *blueGreen) active() *backendSet {
+	return bg.current.Load()
+}
+
+// switchTo activates the named set. It returns the previously active set
+// and whether anything changed.
+func (bg *blueGreen) switchTo(name string) (*backendSet, bool, error) {
+	next, ok := bg.sets[name]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown backend set %q", name)
+	}
+	prev := bg.current.Swap(next)
+	return prev, prev != next, nil
+}
+
+// drainSet winds down WebSocket sessions that were opened against the given
+// set: a close frame right away, then a force close when the timer expires.
+func (p *ProxyServer) drainSet(name string) {
+	victims := 0
+	for _, s := range p.sessions.snapshot() {
+		if s.set == name {
+			s.sendClose(1001, "backend switch")
+			victims++
+		}
+	}
+	p.log.Info("draining old backend set", "set", name, "ws_sessions", victims)
+	if victims == 0 {
+		return
+	}
+	go func() {
+		time.Sleep(p.bg.drain)
+		for _, s := range p.sessions.snapshot() {
+			if s.set == name {
+				s.forceClose()
+			}
+		}
+	}()
+}
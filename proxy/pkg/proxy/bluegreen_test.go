@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func blueGreenProxy(t *testing.T) *ProxyServer {
+	t.Helper()
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "blue")
+	}))
+	t.Cleanup(blue.Close)
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "green")
+	}))
+	t.Cleanup(green.Close)
+	return newTestProxy(t, &Config{
+		BlueBackend:  blue.URL,
+		GreenBackend: green.URL,
+		ActiveSet:    "blue",
+	})
+}
+
+func activeBody(t *testing.T, p *ProxyServer) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestBlueGreenSwitch(t *testing.T) {
+	p := blueGreenProxy(t)
+	admin := p.newAdminHandler()
+
+	if got := activeBody(t, p); got != "blue" {
+		t.Fatalf("startup traffic went to %q, want blue", got)
+	}
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/switch?to=green", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"active":"green"`) {
+		t.Fatalf("switch: %d %q", rec.Code, rec.Body.String())
+	}
+	if got := activeBody(t, p); got != "green" {
+		t.Errorf("post-switch traffic went to %q, want green", got)
+	}
+
+	// Status view and idempotent re-switch.
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/switch", nil))
+	if !strings.Contains(rec.Body.String(), `"active":"green"`) {
+		t.Errorf("status = %q, want active green", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/switch?to=green", nil))
+	if !strings.Contains(rec.Body.String(), `"switched":false`) {
+		t.Errorf("re-switch = %q, want switched:false", rec.Body.String())
+	}
+}
+
+func TestBlueGreenRejectsUnknownSet(t *testing.T) {
+	p := blueGreenProxy(t)
+	rec := httptest.NewRecorder()
+	p.newAdminHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/admin/switch?to=purple", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown set: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestBlueGreenRequiresBothSets(t *testing.T) {
+	_, err := NewProxyServer(&Config{Backend: "http://127.0.0.1:0", BlueBackend: "http://127.0.0.1:1"}, discardLogger())
+	if err == nil {
+		t.Error("-backend-blue without -backend-green should fail")
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Request body limits stop oversized uploads at the proxy instead of letting
+// them stream into the Node gateway. A global cap applies everywhere; path
+// prefix overrides allow exceptions (larger uploads on /api/files/, say, or
+// a tighter cap on a webhook endpoint).
+
+// bodyLimit is one per-prefix override, e.g. "/api/files/=104857600".
+type bodyLimit struct {
+	prefix string
+	max    int64 // bytes; 0 means unlimited
+}
+
+// parseBodyLimits parses "prefix=bytes" entries and orders them longest
+// prefix first so the most specific rule wins.
+func parseBodyLimits(entries []string) ([]bodyLimit, error) {
+	limits := make([]bodyLimit, 0, len(entries))
+	for _, entry := range entries {
+		prefix, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("body limit %q: want /prefix=bytes", entry)
+		}
+		max, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("body limit %q: bad byte count", entry)
+		}
+		limits = append(limits, bodyLimit{prefix: prefix, max: max})
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		return len(limits[i].prefix) > len(limits[j].prefix)
+	})
+	return limits, nil
+}
+
+// bodyLimitFor picks the cap for one path: the longest matching prefix
+// override, else the global limit. 0 disables the check.
+func (p *ProxyServer) bodyLimitFor(path string) int64 {
+	for _, l := range p.bodyLimits {
+		if strings.HasPrefix(path, l.prefix) {
+			return l.max
+		}
+	}
+	return p.cfg.MaxBodyBytes
+}
+
+// limitRequestBody enforces the cap for one request. Declared lengths over
+// the limit are rejected up front; chunked bodies are wrapped in a
+// MaxBytesReader so the transport aborts mid-stream (the proxy error handler
+// turns that into a 413 as well). Returns false when the request was
+// answered.
+func (p *ProxyServer) limitRequestBody(w http.ResponseWriter, r *http.Request) bool {
+	limit := p.bodyLimitFor(r.URL.Path)
+	if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	if r.ContentLength > limit {
+		p.rejectBody(w, r, limit)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+func (p *ProxyServer) rejectBody(w http.ResponseWriter, r *http.Request, limit int64) {
+	p.metrics.Inc(`clawdbot_proxy_body_limited_total`)
+	p.log.Warn("request body over limit", "path", r.URL.Path, "length", r.ContentLength, "limit", limit, "client", p.clientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	fmt.Fprintf(w, `{"error":"request body too large","limit_bytes":%d}`+"\n", limit)
+}
+
+// isBodyLimitError reports whether a backend error was caused by a
+// MaxBytesReader cutting off the request body.
+func isBodyLimitError(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe)
+}
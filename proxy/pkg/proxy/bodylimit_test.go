@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseBodyLimits(t *testing.T) {
+	limits, err := parseBodyLimits([]string{"/api/=1024", "/api/files/=1048576"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Longest prefix must be ordered first.
+	if limits[0].prefix != "/api/files/" || limits[0].max != 1048576 {
+		t.Errorf("limits[0] = %+v, want /api/files/ first", limits[0])
+	}
+
+	for _, bad := range []string{"/api/", "no-slash=10", "/api/=abc", "/api/=-1"} {
+		if _, err := parseBodyLimits([]string{bad}); err == nil {
+			t.Errorf("parseBodyLimits(%q) should fail", bad)
+		}
+	}
+}
+
+func TestBodyLimitFor(t *testing.T) {
+	p := newTestProxy(t, &Config{MaxBodyBytes: 100, BodyLimits: []string{"/api/files/=1000"}})
+	if got := p.bodyLimitFor("/api/files/upload"); got != 1000 {
+		t.Errorf("files limit = %d, want 1000", got)
+	}
+	if got := p.bodyLimitFor("/api/status"); got != 100 {
+		t.Errorf("global limit = %d, want 100", got)
+	}
+}
+
+func TestBodyLimitDeclaredLength(t *testing.T) {
+	p := newTestProxy(t, &Config{MaxBodyBytes: 10, RateLimitRPS: 100, RateLimitBurst: 100})
+	r := httptest.NewRequest("POST", "/api/upload", strings.NewReader(strings.Repeat("x", 50)))
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"limit_bytes":10`) {
+		t.Errorf("body = %q, want JSON error with limit", rec.Body.String())
+	}
+}
+
+func TestBodyLimitUnderLimitPasses(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	p := newTestProxy(t, &Config{Backend: backend.URL, MaxBodyBytes: 100, RateLimitRPS: 100, RateLimitBurst: 100})
+	r := httptest.NewRequest("POST", "/api/upload", strings.NewReader("small"))
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bot and scanner classification. With -bot-detect every request is
+// classified as "scanner", "bot", or left unclassified, based on the
+// User-Agent plus behavior: fetching robots.txt marks an IP as a bot,
+// and probing well-known vulnerability paths marks it as a scanner, both
+// for botSuspectTTL. The class is stamped on the request (X-Claw-Client-Class,
+// stripped first so clients cannot claim to be human) and counted per
+// class in metrics, and -bot-rate / -scanner-rate apply a dedicated
+// per-IP rate limit to each class on top of the normal limits.
+
+const (
+	botClassHeader = "X-Claw-Client-Class"
+	botSuspectTTL  = 10 * time.Minute
+)
+
+// scannerUserAgents are tools that only ever probe.
+var scannerUserAgents = []string{
+	"sqlmap", "nikto", "nmap", "masscan", "zgrab", "nuclei",
+	"dirbuster", "gobuster", "wpscan", "acunetix",
+}
+
+// botUserAgents are automated but not hostile by themselves.
+var botUserAgents = []string{
+	"bot", "crawler", "spider", "curl/", "wget/",
+	"python-requests", "go-http-client", "headlesschrome",
+}
+
+// scannerPaths are endpoints no legitimate client of this proxy requests.
+var scannerPaths = []string{
+	"/wp-login.php", "/wp-admin", "/.env", "/.git/",
+	"/phpmyadmin", "/vendor/phpunit", "/cgi-bin/",
+}
+
+type botClassifier struct {
+	mu       sync.Mutex
+	suspects map[string]botSuspect // keyed by client IP
+}
+
+type botSuspect struct {
+	class string
+	seen  time.Time
+}
+
+func newBotClassifier() *botClassifier {
+	return &botClassifier{suspects: make(map[string]botSuspect)}
+}
+
+// observe records behavior signals for ip and returns the class the
+// current request path itself implies ("" for normal paths).
+func (b *botClassifier) observe(ip, path string) string {
+	class := ""
+	if path == "/robots.txt" {
+		class = "bot"
+	}
+	for _, p := range scannerPaths {
+		if strings.HasPrefix(path, p) {
+			class = "scanner"
+			break
+		}
+	}
+	if class == "" {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.suspects) > 10000 {
+		// Same pragmatic cleanup as the rate limiter: reset wholesale
+		// rather than tracking per-entry expiry.
+		b.suspects = make(map[string]botSuspect)
+	}
+	if cur, ok := b.suspects[ip]; !ok || cur.class != "scanner" {
+		b.suspects[ip] = botSuspect{class: class, seen: time.Now()}
+	}
+	return class
+}
+
+// remembered returns the class previously observed for ip, if still fresh.
+func (b *botClassifier) remembered(ip string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.suspects[ip]
+	if !ok || time.Since(s.seen) > botSuspectTTL {
+		return ""
+	}
+	return s.class
+}
+
+// classify combines User-Agent heuristics with remembered behavior.
+// Scanner outranks bot.
+func classifyUserAgent(r *http.Request) string {
+	ua := strings.ToLower(r.UserAgent())
+	for _, s := range scannerUserAgents {
+		if strings.Contains(ua, s) {
+			return "scanner"
+		}
+	}
+	for _, s := range botUserAgents {
+		if strings.Contains(ua, s) {
+			return "bot"
+		}
+	}
+	// Real browsers always send Accept; its absence alone marks a bot.
+	if ua == "" || r.Header.Get("Accept") == "" {
+		return "bot"
+	}
+	return ""
+}
+
+// classifyClient tags the request and enforces the per-class rate limit.
+// Returns false when the request was answered.
+func (p *ProxyServer) classifyClient(w http.ResponseWriter, r *http.Request) bool {
+	r.Header.Del(botClassHeader)
+	if p.bots == nil {
+		return true
+	}
+	ip := p.clientIP(r)
+	class := p.bots.observe(ip, r.URL.Path)
+	if class != "scanner" {
+		if c := p.bots.remembered(ip); c == "scanner" || (c == "bot" && class == "") {
+			class = c
+		}
+	}
+	if class == "" {
+		class = classifyUserAgent(r)
+	}
+	if class == "" {
+		return true
+	}
+	r.Header.Set(botClassHeader, class)
+	p.metrics.Inc(fmt.Sprintf(`clawdbot_proxy_client_class_total{class=%q}`, class))
+	rps := p.cfg.BotRate
+	if class == "scanner" {
+		rps = p.cfg.ScannerRate
+	}
+	if rps <= 0 {
+		return true
+	}
+	if !p.limiter.AllowRate("class:"+class+":"+ip, rps, rps) {
+		p.metrics.Inc(fmt.Sprintf(`clawdbot_proxy_client_class_limited_total{class=%q}`, class))
+		p.reqLog(r).Warn("client class rate limited", "class", class, "client", ip, "path", r.URL.Path)
+		p.strike(r, class+" rate limit exceeded")
+		p.httpError(w, r, http.StatusTooManyRequests, "rate limit exceeded for "+class+" clients")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func botConfig() *Config {
+	return &Config{BotDetect: true}
+}
+
+func classRequest(ua, accept, path, addr string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = addr
+	if ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return req
+}
+
+func TestClassifyUserAgent(t *testing.T) {
+	cases := []struct {
+		ua, accept, want string
+	}{
+		{"sqlmap/1.7", "*/*", "scanner"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "*/*", "bot"},
+		{"curl/8.0", "*/*", "bot"},
+		{"Mozilla/5.0 (X11; Linux)", "", "bot"}, // browsers always send Accept
+		{"Mozilla/5.0 (X11; Linux)", "text/html", ""},
+	}
+	for _, c := range cases {
+		r := classRequest(c.ua, c.accept, "/api/status", "192.0.2.1:1")
+		if got := classifyUserAgent(r); got != c.want {
+			t.Errorf("classifyUserAgent(%q, accept=%q) = %q, want %q", c.ua, c.accept, got, c.want)
+		}
+	}
+}
+
+func TestBehaviorClassificationSticks(t *testing.T) {
+	p := newTestProxy(t, botConfig())
+	rec := httptest.NewRecorder()
+
+	// Probing a vuln path marks the IP as a scanner for later requests,
+	// even ones with a clean browser User-Agent.
+	probe := classRequest("Mozilla/5.0 (X11; Linux)", "text/html", "/wp-login.php", "192.0.2.7:1")
+	if !p.classifyClient(rec, probe) {
+		t.Fatal("probe request unexpectedly answered")
+	}
+	if got := probe.Header.Get(botClassHeader); got != "scanner" {
+		t.Fatalf("probe class = %q, want scanner", got)
+	}
+
+	clean := classRequest("Mozilla/5.0 (X11; Linux)", "text/html", "/api/status", "192.0.2.7:2")
+	p.classifyClient(httptest.NewRecorder(), clean)
+	if got := clean.Header.Get(botClassHeader); got != "scanner" {
+		t.Fatalf("follow-up class = %q, want scanner", got)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_client_class_total{class="scanner"}`) != 2 {
+		t.Fatal("scanner class not counted")
+	}
+
+	// robots.txt marks a bot, but never downgrades a known scanner.
+	robots := classRequest("something/1.0", "*/*", "/robots.txt", "192.0.2.8:1")
+	p.classifyClient(httptest.NewRecorder(), robots)
+	if got := robots.Header.Get(botClassHeader); got != "bot" {
+		t.Fatalf("robots class = %q, want bot", got)
+	}
+}
+
+func TestClassHeaderCannotBeSpoofed(t *testing.T) {
+	p := newTestProxy(t, botConfig())
+	req := classRequest("Mozilla/5.0 (X11; Linux)", "text/html", "/api/status", "192.0.2.9:1")
+	req.Header.Set(botClassHeader, "human")
+	p.classifyClient(httptest.NewRecorder(), req)
+	if got := req.Header.Get(botClassHeader); got != "" {
+		t.Fatalf("spoofed class survived: %q", got)
+	}
+}
+
+func TestScannerRateLimit(t *testing.T) {
+	cfg := botConfig()
+	cfg.ScannerRate = 1
+	p := newTestProxy(t, cfg)
+
+	limited := false
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		req := classRequest("nikto/2.5", "*/*", "/api/status", "192.0.2.10:1")
+		if !p.classifyClient(rec, req) {
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("rejected with %d, want 429", rec.Code)
+			}
+			limited = true
+		}
+	}
+	if !limited {
+		t.Fatal("scanner never rate limited")
+	}
+	if p.metrics.Counter(`clawdbot_proxy_client_class_limited_total{class="scanner"}`) == 0 {
+		t.Fatal("limited counter not incremented")
+	}
+}
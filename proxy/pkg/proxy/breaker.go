@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker trips after a run of consecutive backend failures so a down
+// gateway gets fast 503s instead of piling up dial timeouts. After the
+// cooldown it half-opens and lets a single probe through.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	metrics   *Metrics
+
+	// onChange, when set, is invoked (with the lock held) on every state
+	// transition; keep it non-blocking.
+	onChange func(from, to breakerState)
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration, metrics *Metrics) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, metrics: metrics}
+}
+
+// Allow reports whether a backend request may proceed, and the seconds to
+// suggest in Retry-After when it may not.
+func (cb *CircuitBreaker) Allow() (bool, int) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case breakerClosed:
+		return true, 0
+	case breakerOpen:
+		if remaining := cb.cooldown - time.Since(cb.openedAt); remaining > 0 {
+			return false, int(remaining/time.Second) + 1
+		}
+		cb.setStateLocked(breakerHalfOpen)
+		cb.probing = true
+		return true, 0
+	default: // half-open: only the in-flight probe
+		if cb.probing {
+			return false, int(cb.cooldown/time.Second) + 1
+		}
+		cb.probing = true
+		return true, 0
+	}
+}
+
+// Record feeds a request outcome back into the breaker.
+func (cb *CircuitBreaker) Record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case breakerHalfOpen:
+		cb.probing = false
+		if success {
+			cb.failures = 0
+			cb.setStateLocked(breakerClosed)
+		} else {
+			cb.openedAt = time.Now()
+			cb.setStateLocked(breakerOpen)
+		}
+	case breakerClosed:
+		if success {
+			cb.failures = 0
+			return
+		}
+		cb.failures++
+		if cb.failures >= cb.threshold {
+			cb.openedAt = time.Now()
+			cb.setStateLocked(breakerOpen)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) State() breakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) setStateLocked(s breakerState) {
+	if cb.state == s {
+		return
+	}
+	from := cb.state
+	cb.state = s
+	if cb.onChange != nil {
+		cb.onChange(from, s)
+	}
+	if cb.metrics != nil {
+		var v float64
+		switch s {
+		case breakerOpen:
+			v = 1
+		case breakerHalfOpen:
+			v = 0.5
+		}
+		cb.metrics.SetGauge(`clawdbot_proxy_breaker_open`, v)
+		if s == breakerOpen {
+			cb.metrics.Inc(`clawdbot_proxy_breaker_trips_total`)
+		}
+	}
+}
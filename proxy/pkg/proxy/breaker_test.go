@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	cb := NewCircuitBreaker(3, time.Minute, NewMetrics())
+	for i := 0; i < 3; i++ {
+		cb.Record(false)
+	}
+	if cb.State() != breakerOpen {
+		t.Fatalf("state = %v, want open", cb.State())
+	}
+	allowed, retryAfter := cb.Allow()
+	if allowed {
+		t.Error("open breaker must reject requests")
+	}
+	if retryAfter <= 0 {
+		t.Errorf("retryAfter = %d, want > 0", retryAfter)
+	}
+}
+
+func TestBreakerSuccessResetsFailureRun(t *testing.T) {
+	cb := NewCircuitBreaker(3, time.Minute, NewMetrics())
+	cb.Record(false)
+	cb.Record(false)
+	cb.Record(true)
+	cb.Record(false)
+	cb.Record(false)
+	if cb.State() != breakerClosed {
+		t.Errorf("state = %v, want closed (failures not consecutive)", cb.State())
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	cb := NewCircuitBreaker(1, 10*time.Millisecond, NewMetrics())
+	cb.Record(false)
+	if cb.State() != breakerOpen {
+		t.Fatal("expected open")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	allowed, _ := cb.Allow()
+	if !allowed {
+		t.Fatal("probe should be allowed after cooldown")
+	}
+	if allowed, _ := cb.Allow(); allowed {
+		t.Error("only one probe may be in flight while half-open")
+	}
+
+	cb.Record(true)
+	if cb.State() != breakerClosed {
+		t.Errorf("state after successful probe = %v, want closed", cb.State())
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	cb := NewCircuitBreaker(1, 10*time.Millisecond, NewMetrics())
+	cb.Record(false)
+	time.Sleep(20 * time.Millisecond)
+	cb.Allow() // probe
+	cb.Record(false)
+	if cb.State() != breakerOpen {
+		t.Errorf("state after failed probe = %v, want open", cb.State())
+	}
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseCache is an LRU cache for backend GET responses. Freshness comes
+// from the upstream Cache-Control max-age when present, otherwise the
+// configured default TTL; no-store/private responses are never cached.
+type ResponseCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // front = most recently used
+	maxEntries int
+	maxBody    int
+	ttl        time.Duration
+	metrics    *Metrics
+}
+
+type cacheEntry struct {
+	key     string
+	path    string
+	status  int
+	header  http.Header
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+func NewResponseCache(maxEntries, maxBody int, ttl time.Duration, metrics *Metrics) *ResponseCache {
+	return &ResponseCache{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBody:    maxBody,
+		ttl:        ttl,
+		metrics:    metrics,
+	}
+}
+
+func cacheKey(r *http.Request) string {
+	return r.URL.Path + "?" + r.URL.RawQuery
+}
+
+// cacheable reports whether the request may be answered from / stored in
+// the cache at all. Credentialed requests bypass it entirely.
+func (c *ResponseCache) cacheable(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return false
+	}
+	// Range responses are partial; caching one would serve truncated
+	// bodies to full-document requests.
+	if r.Header.Get("Range") != "" {
+		return false
+	}
+	return !strings.Contains(strings.ToLower(r.Header.Get("Cache-Control")), "no-cache")
+}
+
+// serve answers from cache when possible, otherwise forwards to next and
+// stores an eligible response.
+func (c *ResponseCache) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if !c.cacheable(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	key := cacheKey(r)
+	if e := c.lookup(key); e != nil {
+		c.metrics.Inc(`clawdbot_proxy_cache_hits_total`)
+		if e.etag != "" && r.Header.Get("If-None-Match") == e.etag {
+			w.Header().Set("ETag", e.etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		copyHeader(w.Header(), e.header)
+		w.Header().Set("X-Cache", "HIT")
+		w.WriteHeader(e.status)
+		w.Write(e.body)
+		return
+	}
+	c.metrics.Inc(`clawdbot_proxy_cache_misses_total`)
+	rec := &cacheRecorder{ResponseWriter: w, maxBody: c.maxBody}
+	next.ServeHTTP(rec, r)
+	c.store(key, r.URL.Path, rec)
+}
+
+func (c *ResponseCache) lookup(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.removeLocked(el)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e
+}
+
+func (c *ResponseCache) store(key, path string, rec *cacheRecorder) {
+	if rec.status != http.StatusOK || rec.overflowed {
+		return
+	}
+	cc := strings.ToLower(rec.Header().Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return
+	}
+	ttl := c.ttl
+	if i := strings.Index(cc, "max-age="); i >= 0 {
+		if secs, err := strconv.Atoi(strings.TrimFunc(cc[i+8:], func(r rune) bool { return r < '0' || r > '9' })); err == nil {
+			ttl = time.Duration(secs) * time.Second
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+	e := &cacheEntry{
+		key:     key,
+		path:    path,
+		status:  rec.status,
+		header:  rec.Header().Clone(),
+		body:    rec.body,
+		etag:    rec.Header().Get("ETag"),
+		expires: time.Now().Add(ttl),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeLocked(el)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.maxEntries {
+		c.removeLocked(c.lru.Back())
+	}
+	c.metrics.SetGauge(`clawdbot_proxy_cache_entries`, float64(c.lru.Len()))
+}
+
+func (c *ResponseCache) removeLocked(el *list.Element) {
+	delete(c.entries, el.Value.(*cacheEntry).key)
+	c.lru.Remove(el)
+	c.metrics.SetGauge(`clawdbot_proxy_cache_entries`, float64(c.lru.Len()))
+}
+
+// Purge removes every entry whose request path starts with prefix and
+// returns how many were dropped.
+func (c *ResponseCache) Purge(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var purged int
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if strings.HasPrefix(el.Value.(*cacheEntry).path, prefix) {
+			c.removeLocked(el)
+			purged++
+		}
+		el = next
+	}
+	return purged
+}
+
+// handleCachePurge implements POST /-/cache/purge?prefix=/api/.
+func (p *ProxyServer) handleCachePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.cache == nil {
+		http.Error(w, "cache disabled", http.StatusNotFound)
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+	purged := p.cache.Purge(prefix)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"purged":%d}`+"\n", purged)
+}
+
+// cacheRecorder tees the response to the client while buffering a copy for
+// the cache, giving up once the body exceeds maxBody.
+type cacheRecorder struct {
+	http.ResponseWriter
+	status     int
+	body       []byte
+	maxBody    int
+	overflowed bool
+}
+
+func (cr *cacheRecorder) WriteHeader(code int) {
+	if cr.status == 0 {
+		cr.status = code
+	}
+	cr.ResponseWriter.WriteHeader(code)
+}
+
+func (cr *cacheRecorder) Write(b []byte) (int, error) {
+	if cr.status == 0 {
+		cr.status = http.StatusOK
+	}
+	if !cr.overflowed {
+		if len(cr.body)+len(b) > cr.maxBody {
+			cr.overflowed = true
+			cr.body = nil
+		} else {
+			cr.body = append(cr.body, b...)
+		}
+	}
+	return cr.ResponseWriter.Write(b)
+}
+
+func (cr *cacheRecorder) Flush() {
+	if f, ok := cr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = append([]string(nil), values...)
+	}
+}
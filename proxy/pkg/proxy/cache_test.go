@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestCache(ttl time.Duration) *ResponseCache {
+	return NewResponseCache(4, 1<<20, ttl, NewMetrics())
+}
+
+func countingBackend(counter *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*counter++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintf(w, `{"n":%d}`, *counter)
+	})
+}
+
+func TestCacheHitServesStoredResponse(t *testing.T) {
+	var calls int
+	c := newTestCache(time.Minute)
+	backend := countingBackend(&calls)
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		c.serve(rec, httptest.NewRequest("GET", "/api/status", nil), backend)
+		if rec.Body.String() != `{"n":1}` {
+			t.Fatalf("request %d body = %q, want cached {\"n\":1}", i, rec.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("backend calls = %d, want 1", calls)
+	}
+}
+
+func TestCacheConditionalRequest(t *testing.T) {
+	var calls int
+	c := newTestCache(time.Minute)
+	backend := countingBackend(&calls)
+
+	c.serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil), backend)
+
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	rec := httptest.NewRecorder()
+	c.serve(rec, req, backend)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want 304", rec.Code)
+	}
+}
+
+func TestCacheRespectsNoStore(t *testing.T) {
+	var calls int
+	c := newTestCache(time.Minute)
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("x"))
+	})
+	for i := 0; i < 2; i++ {
+		c.serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/secret", nil), backend)
+	}
+	if calls != 2 {
+		t.Errorf("backend calls = %d, want 2 (no-store must not be cached)", calls)
+	}
+}
+
+func TestCacheBypassesCredentialedRequests(t *testing.T) {
+	var calls int
+	c := newTestCache(time.Minute)
+	backend := countingBackend(&calls)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		req.Header.Set("Authorization", "Bearer tok")
+		c.serve(httptest.NewRecorder(), req, backend)
+	}
+	if calls != 2 {
+		t.Errorf("backend calls = %d, want 2 for credentialed requests", calls)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	var calls int
+	c := newTestCache(10 * time.Millisecond)
+	backend := countingBackend(&calls)
+	c.serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil), backend)
+	time.Sleep(20 * time.Millisecond)
+	c.serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil), backend)
+	if calls != 2 {
+		t.Errorf("backend calls = %d, want 2 after TTL expiry", calls)
+	}
+}
+
+func TestCachePurgeByPrefix(t *testing.T) {
+	var calls int
+	c := newTestCache(time.Minute)
+	backend := countingBackend(&calls)
+	c.serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil), backend)
+	c.serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/config", nil), backend)
+
+	if purged := c.Purge("/api/status"); purged != 1 {
+		t.Errorf("purged = %d, want 1", purged)
+	}
+	c.serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil), backend)
+	if calls != 3 {
+		t.Errorf("backend calls = %d, want 3 after purge", calls)
+	}
+}
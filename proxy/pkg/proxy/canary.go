@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// Weighted canary routing: -canary-backend receives -canary-percent of the
+// backend traffic while the rest stays on the stable gateway. Clients (and
+// test tooling) can force a version with the X-Clawdbot-Version header or
+// the clawdbot_version cookie. Both versions get their own request/error
+// counters so a misbehaving canary shows up in /metrics immediately.
+
+const (
+	canaryVersionHeader = "X-Clawdbot-Version"
+	canaryVersionCookie = "clawdbot_version"
+)
+
+type canarySplit struct {
+	stable  *httputil.ReverseProxy
+	canary  *httputil.ReverseProxy
+	percent int
+	metrics *Metrics
+}
+
+func (p *ProxyServer) newCanarySplit(target *url.URL) *canarySplit {
+	return &canarySplit{
+		stable:  p.versionedProxy(p.backend, "stable"),
+		canary:  p.versionedProxy(target, "canary"),
+		percent: p.cfg.CanaryPercent,
+		metrics: p.metrics,
+	}
+}
+
+// versionedProxy layers per-version request and error counters on top of
+// the shared reverse proxy behavior.
+func (p *ProxyServer) versionedProxy(target *url.URL, version string) *httputil.ReverseProxy {
+	rp := p.newReverseProxy(target)
+	reqs := fmt.Sprintf(`clawdbot_proxy_version_requests_total{version=%q}`, version)
+	errs := fmt.Sprintf(`clawdbot_proxy_version_errors_total{version=%q}`, version)
+	origMod := rp.ModifyResponse
+	rp.ModifyResponse = func(resp *http.Response) error {
+		p.metrics.Inc(reqs)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			p.metrics.Inc(errs)
+		}
+		return origMod(resp)
+	}
+	origErr := rp.ErrorHandler
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		p.metrics.Inc(errs)
+		origErr(w, r, err)
+	}
+	return rp
+}
+
+// pick chooses the version for this request: an explicit override wins,
+// otherwise the configured weight decides.
+func (c *canarySplit) pick(r *http.Request) *httputil.ReverseProxy {
+	switch c.override(r) {
+	case "canary":
+		return c.canary
+	case "stable":
+		return c.stable
+	}
+	if rand.Intn(100) < c.percent {
+		return c.canary
+	}
+	return c.stable
+}
+
+func (c *canarySplit) override(r *http.Request) string {
+	if v := r.Header.Get(canaryVersionHeader); v != "" {
+		return v
+	}
+	if cookie, err := r.Cookie(canaryVersionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
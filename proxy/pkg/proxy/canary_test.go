@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func canaryProxy(t *testing.T, percent int) *ProxyServer {
+	t.Helper()
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "stable")
+	}))
+	t.Cleanup(stable.Close)
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "canary")
+	}))
+	t.Cleanup(canary.Close)
+	return newTestProxy(t, &Config{
+		Backend:       stable.URL,
+		CanaryBackend: canary.URL,
+		CanaryPercent: percent,
+	})
+}
+
+func canaryGet(t *testing.T, p *ProxyServer, prep func(*http.Request)) string {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	if prep != nil {
+		prep(r)
+	}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestCanaryWeightedSplit(t *testing.T) {
+	p := canaryProxy(t, 50)
+	seen := map[string]int{}
+	for i := 0; i < 200; i++ {
+		seen[canaryGet(t, p, nil)]++
+	}
+	if seen["stable"] == 0 || seen["canary"] == 0 {
+		t.Errorf("50%% split saw stable=%d canary=%d, want both versions", seen["stable"], seen["canary"])
+	}
+	if p.metrics.Counter(`clawdbot_proxy_version_requests_total{version="canary"}`) == 0 {
+		t.Error("canary request counter not incremented")
+	}
+}
+
+func TestCanaryZeroPercentStaysStable(t *testing.T) {
+	p := canaryProxy(t, 0)
+	for i := 0; i < 50; i++ {
+		if got := canaryGet(t, p, nil); got != "stable" {
+			t.Fatalf("0%% canary routed to %q", got)
+		}
+	}
+}
+
+func TestCanaryHeaderOverride(t *testing.T) {
+	p := canaryProxy(t, 0)
+	got := canaryGet(t, p, func(r *http.Request) {
+		r.Header.Set(canaryVersionHeader, "canary")
+	})
+	if got != "canary" {
+		t.Errorf("header override routed to %q, want canary", got)
+	}
+}
+
+func TestCanaryCookieOverride(t *testing.T) {
+	p := canaryProxy(t, 100)
+	got := canaryGet(t, p, func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: canaryVersionCookie, Value: "stable"})
+	})
+	if got != "stable" {
+		t.Errorf("cookie override routed to %q, want stable", got)
+	}
+}
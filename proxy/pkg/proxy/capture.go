@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Request/response capture for debugging. Capture is armed from the admin
+// API (/admin/capture/start) and only records exchanges that opt in: routes
+// marked capture, or requests carrying an X-Claw-Capture header. Bodies are
+// truncated at -capture-max-body bytes. Entries are kept in a bounded
+// in-memory buffer, optionally mirrored to -capture-file as JSON lines, and
+// /admin/capture/download renders the buffer as a HAR archive that browser
+// devtools and most HTTP tooling can open directly.
+
+// captureMaxEntries bounds the in-memory buffer; the oldest entry is
+// dropped when it is full.
+const captureMaxEntries = 500
+
+type captureEntry struct {
+	Time        time.Time   `json:"time"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	Status      int         `json:"status"`
+	DurationMs  float64     `json:"duration_ms"`
+	ReqHeaders  http.Header `json:"req_headers"`
+	ReqBody     string      `json:"req_body,omitempty"`
+	RespHeaders http.Header `json:"resp_headers"`
+	RespBody    string      `json:"resp_body,omitempty"`
+	Truncated   bool        `json:"truncated,omitempty"`
+}
+
+type captureStore struct {
+	mu      sync.Mutex
+	active  bool
+	entries []captureEntry
+	maxBody int
+	path    string // optional JSONL mirror on disk
+	metrics *Metrics
+}
+
+func newCaptureStore(maxBody int, path string, m *Metrics) *captureStore {
+	return &captureStore{maxBody: maxBody, path: path, metrics: m}
+}
+
+// start arms capture with a fresh buffer.
+func (c *captureStore) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.active = true
+}
+
+func (c *captureStore) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = false
+}
+
+func (c *captureStore) status() (bool, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active, len(c.entries)
+}
+
+// maybeCapture wraps the response writer when this exchange should be
+// recorded. The returned finish func (nil when not capturing) must run
+// after the response is complete.
+func (c *captureStore) maybeCapture(w http.ResponseWriter, r *http.Request, rt *route) (http.ResponseWriter, func()) {
+	c.mu.Lock()
+	active := c.active
+	c.mu.Unlock()
+	if !active {
+		return w, nil
+	}
+	if (rt == nil || !rt.capture) && r.Header.Get("X-Claw-Capture") == "" {
+		return w, nil
+	}
+	entry := captureEntry{
+		Time:       time.Now(),
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		ReqHeaders: r.Header.Clone(),
+	}
+	if r.Body != nil && r.ContentLength != 0 {
+		body, truncated := readTruncated(r.Body, c.maxBody)
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		entry.ReqBody = string(body)
+		entry.Truncated = truncated
+	}
+	cw := &captureWriter{ResponseWriter: w, max: c.maxBody, status: http.StatusOK}
+	return cw, func() {
+		entry.DurationMs = float64(time.Since(entry.Time)) / float64(time.Millisecond)
+		entry.Status = cw.status
+		entry.RespHeaders = cw.Header().Clone()
+		entry.RespBody = cw.body.String()
+		entry.Truncated = entry.Truncated || cw.truncated
+		c.record(entry)
+	}
+}
+
+func (c *captureStore) record(entry captureEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.active {
+		return // stopped while the exchange was in flight
+	}
+	if len(c.entries) >= captureMaxEntries {
+		c.entries = c.entries[1:]
+	}
+	c.entries = append(c.entries, entry)
+	c.metrics.Inc(`clawdbot_proxy_captured_requests_total`)
+	if c.path != "" {
+		// Mirror to disk as it happens; failures only cost the mirror.
+		if line, err := json.Marshal(entry); err == nil {
+			if f, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err == nil {
+				f.Write(append(line, '\n'))
+				f.Close()
+			}
+		}
+	}
+}
+
+// captureWriter buffers the response body up to max bytes while passing
+// everything through.
+type captureWriter struct {
+	http.ResponseWriter
+	max       int
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *captureWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if room := w.max - w.body.Len(); room > 0 {
+		if len(b) > room {
+			w.body.Write(b[:room])
+			w.truncated = true
+		} else {
+			w.body.Write(b)
+		}
+	} else if len(b) > 0 {
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// readTruncated reads at most max bytes and reports whether more remained.
+func readTruncated(r io.Reader, max int) ([]byte, bool) {
+	body, _ := io.ReadAll(io.LimitReader(r, int64(max)))
+	var probe [1]byte
+	n, _ := r.Read(probe[:])
+	if n > 0 {
+		return append(body, probe[0]), true
+	}
+	return body, false
+}
+
+// HAR rendering. Only the fields tooling actually reads are emitted.
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func harHeaders(h http.Header) []harHeader {
+	out := []harHeader{}
+	for name, vals := range h {
+		for _, v := range vals {
+			out = append(out, harHeader{Name: name, Value: v})
+		}
+	}
+	return out
+}
+
+// writeHAR renders the captured entries as a HAR 1.2 archive.
+func (c *captureStore) writeHAR(w io.Writer) error {
+	c.mu.Lock()
+	entries := append([]captureEntry{}, c.entries...)
+	c.mu.Unlock()
+
+	type harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+	}
+	type harEntry struct {
+		Started time.Time `json:"startedDateTime"`
+		Time    float64   `json:"time"`
+		Request struct {
+			Method   string      `json:"method"`
+			URL      string      `json:"url"`
+			Headers  []harHeader `json:"headers"`
+			PostData *harContent `json:"postData,omitempty"`
+		} `json:"request"`
+		Response struct {
+			Status  int         `json:"status"`
+			Headers []harHeader `json:"headers"`
+			Content harContent  `json:"content"`
+		} `json:"response"`
+	}
+	out := make([]harEntry, 0, len(entries))
+	for _, e := range entries {
+		var h harEntry
+		h.Started = e.Time
+		h.Time = e.DurationMs
+		h.Request.Method = e.Method
+		h.Request.URL = e.URL
+		h.Request.Headers = harHeaders(e.ReqHeaders)
+		if e.ReqBody != "" {
+			h.Request.PostData = &harContent{
+				Size:     len(e.ReqBody),
+				MimeType: e.ReqHeaders.Get("Content-Type"),
+				Text:     e.ReqBody,
+			}
+		}
+		h.Response.Status = e.Status
+		h.Response.Headers = harHeaders(e.RespHeaders)
+		h.Response.Content = harContent{
+			Size:     len(e.RespBody),
+			MimeType: e.RespHeaders.Get("Content-Type"),
+			Text:     e.RespBody,
+		}
+		out = append(out, h)
+	}
+	return json.NewEncoder(w).Encode(map[string]any{
+		"log": map[string]any{
+			"version": "1.2",
+			"creator": map[string]string{"name": "clawdbot-proxy", "version": "1"},
+			"entries": out,
+		},
+	})
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCaptureRecordsOptedInExchange(t *testing.T) {
+	c := newCaptureStore(1024, "", NewMetrics())
+	c.start()
+
+	r := httptest.NewRequest("POST", "/api/agent/run", strings.NewReader(`{"message":"hi"}`))
+	r.Header.Set("X-Claw-Capture", "1")
+	rec := httptest.NewRecorder()
+	w, finish := c.maybeCapture(rec, r, nil)
+	if finish == nil {
+		t.Fatal("flagged request should be captured while armed")
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"ok":true}`))
+	finish()
+
+	_, entries := c.status()
+	if entries != 1 {
+		t.Fatalf("entries = %d, want 1", entries)
+	}
+	e := c.entries[0]
+	if e.Status != 201 || e.ReqBody != `{"message":"hi"}` || e.RespBody != `{"ok":true}` {
+		t.Errorf("entry = %+v, want full request/response pair", e)
+	}
+}
+
+func TestCaptureRequiresArmAndOptIn(t *testing.T) {
+	c := newCaptureStore(1024, "", NewMetrics())
+
+	// Not armed: even flagged requests are ignored.
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("X-Claw-Capture", "1")
+	if _, finish := c.maybeCapture(httptest.NewRecorder(), r, nil); finish != nil {
+		t.Error("capture must stay off until armed")
+	}
+
+	// Armed but no marker: still ignored.
+	c.start()
+	if _, finish := c.maybeCapture(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil), nil); finish != nil {
+		t.Error("unmarked requests must not be captured")
+	}
+
+	// A capture-marked route opts in without the header.
+	rt := &route{action: actionBackend, capture: true}
+	if _, finish := c.maybeCapture(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil), rt); finish == nil {
+		t.Error("capture-marked route should be recorded")
+	}
+}
+
+func TestCaptureTruncatesBodies(t *testing.T) {
+	c := newCaptureStore(4, "", NewMetrics())
+	c.start()
+
+	r := httptest.NewRequest("POST", "/api/x", strings.NewReader("0123456789"))
+	r.Header.Set("X-Claw-Capture", "1")
+	w, finish := c.maybeCapture(httptest.NewRecorder(), r, nil)
+	w.Write([]byte("abcdefgh"))
+	finish()
+
+	e := c.entries[0]
+	if !e.Truncated {
+		t.Error("entry should be marked truncated")
+	}
+	if len(e.RespBody) > 4 {
+		t.Errorf("resp body len = %d, want <= 4", len(e.RespBody))
+	}
+}
+
+func TestCaptureAdminEndpointsAndHAR(t *testing.T) {
+	p := newTestProxy(t, &Config{CaptureMaxBody: 1024})
+	h := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/capture/start", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("start status = %d", rec.Code)
+	}
+
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("X-Claw-Capture", "1")
+	w, finish := p.capture.maybeCapture(httptest.NewRecorder(), r, nil)
+	w.Write([]byte("ok"))
+	finish()
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/capture/download", nil))
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					URL string `json:"url"`
+				} `json:"request"`
+				Response struct {
+					Status int `json:"status"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &har); err != nil {
+		t.Fatalf("download is not valid JSON: %v", err)
+	}
+	if len(har.Log.Entries) != 1 || har.Log.Entries[0].Request.URL != "/api/status" || har.Log.Entries[0].Response.Status != 200 {
+		t.Errorf("HAR entries = %+v, want the captured exchange", har.Log.Entries)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/capture/stop", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stop status = %d", rec.Code)
+	}
+	if active, _ := p.capture.status(); active {
+		t.Error("capture should be disarmed after stop")
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Hot certificate reload for the default listener pair (-tls-cert/-tls-key).
+// Renewals dropped in place by an external ACME client are picked up on the
+// next TLS handshake via the usual 1-second stat cache; SIGHUP forces an
+// immediate reload. The current leaf's expiry is logged on every load and
+// reported by /health and /metrics so alerting can catch a stuck renewal.
+
+type certWatcher struct {
+	certFile string
+	keyFile  string
+	metrics  *Metrics
+	log      *slog.Logger
+	hooks    *webhookNotifier // nil unless -webhook-urls is set
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	expiry   time.Time
+	lastMod  time.Time
+	lastStat time.Time
+}
+
+func newCertWatcher(certFile, keyFile string, metrics *Metrics, log *slog.Logger, hooks *webhookNotifier) (*certWatcher, error) {
+	cw := &certWatcher{certFile: certFile, keyFile: keyFile, metrics: metrics, log: log, hooks: hooks}
+	if err := cw.reload(); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// reload re-reads the pair from disk. On failure the previous certificate
+// stays in service — a half-written renewal must not take the listener down.
+func (cw *certWatcher) reload() error {
+	cert, err := tls.LoadX509KeyPair(cw.certFile, cw.keyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	mod := cw.newestMod()
+	cw.mu.Lock()
+	cw.cert = &cert
+	cw.expiry = leaf.NotAfter
+	cw.lastMod = mod
+	cw.mu.Unlock()
+	cw.metrics.SetGauge(`clawdbot_proxy_cert_not_after_seconds`, float64(leaf.NotAfter.Unix()))
+	cw.log.Info("listener certificate loaded", "subject", leaf.Subject.CommonName, "expiry", leaf.NotAfter)
+	if left := time.Until(leaf.NotAfter); left < 14*24*time.Hour {
+		cw.hooks.notify("cert_expiring",
+			"subject", leaf.Subject.CommonName,
+			"expiry", leaf.NotAfter.Format(time.RFC3339),
+			"remaining", left.Round(time.Hour).String())
+	}
+	return nil
+}
+
+// newestMod returns the later mtime of the two files (a renewal rewrites
+// both, but not atomically together).
+func (cw *certWatcher) newestMod() time.Time {
+	var mod time.Time
+	for _, f := range []string{cw.certFile, cw.keyFile} {
+		if info, err := os.Stat(f); err == nil && info.ModTime().After(mod) {
+			mod = info.ModTime()
+		}
+	}
+	return mod
+}
+
+// current hands out the certificate for a handshake, reloading when the
+// files changed. Stat results are cached for a second so handshake bursts
+// do not hammer the filesystem.
+func (cw *certWatcher) current() *tls.Certificate {
+	cw.mu.Lock()
+	needsCheck := time.Since(cw.lastStat) >= time.Second
+	if needsCheck {
+		cw.lastStat = time.Now()
+	}
+	cert := cw.cert
+	lastMod := cw.lastMod
+	cw.mu.Unlock()
+	if needsCheck && cw.newestMod().After(lastMod) {
+		if err := cw.reload(); err != nil {
+			cw.log.Error("certificate reload failed; keeping previous", "error", err)
+			return cert
+		}
+		cw.mu.Lock()
+		cert = cw.cert
+		cw.mu.Unlock()
+	}
+	return cert
+}
+
+// expiresAt returns the current leaf's NotAfter for /health.
+func (cw *certWatcher) expiresAt() time.Time {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.expiry
+}
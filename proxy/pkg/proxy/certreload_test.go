@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCertWatcherReloadsRenewedPair(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	cw, err := newCertWatcher(certFile, keyFile, NewMetrics(), discardLogger(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cw.current() == nil {
+		t.Fatal("no certificate after load")
+	}
+	firstExpiry := cw.expiresAt()
+	if !firstExpiry.After(time.Now()) {
+		t.Fatalf("expiry = %v, want in the future", firstExpiry)
+	}
+
+	// Simulate an ACME renewal: new pair dropped over the same paths.
+	renewedCert, renewedKey := writeTestCert(t)
+	for from, to := range map[string]string{renewedCert: certFile, renewedKey: keyFile} {
+		data, err := os.ReadFile(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(to, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(certFile, future, future)
+
+	// Bypass the 1-second stat cache.
+	cw.mu.Lock()
+	cw.lastStat = time.Time{}
+	cw.mu.Unlock()
+
+	before := cw.cert
+	if cw.current() == before {
+		t.Error("renewed certificate was not picked up")
+	}
+}
+
+func TestCertWatcherKeepsServingOnBrokenRenewal(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	cw, err := newCertWatcher(certFile, keyFile, NewMetrics(), discardLogger(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := cw.cert
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(certFile, future, future)
+	cw.mu.Lock()
+	cw.lastStat = time.Time{}
+	cw.mu.Unlock()
+
+	if cw.current() != good {
+		t.Error("broken renewal must keep the previous certificate in service")
+	}
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Chaos/fault injection for resilience testing. The injector is disabled
+// at startup and can only be armed through the admin API (/admin/chaos),
+// never from configuration — a restart always comes up clean. While armed
+// it can delay requests, answer random 5xx, truncate response bodies, and
+// drop WebSocket data frames, each by percentage, optionally restricted to
+// a path prefix, so Control UI behavior under gateway failures can be
+// exercised without touching the gateway.
+
+// chaosTruncateBytes is how much of a truncated response the client still
+// receives before the rest is silently dropped.
+const chaosTruncateBytes = 1024
+
+type chaosInjector struct {
+	mu           sync.Mutex
+	enabled      bool
+	path         string // path prefix filter; empty applies everywhere
+	latency      time.Duration
+	latencyPct   float64
+	errorPct     float64
+	truncatePct  float64
+	dropFramePct float64
+	metrics      *Metrics
+	rnd          func() float64 // rand.Float64, replaceable in tests
+}
+
+func newChaosInjector(m *Metrics) *chaosInjector {
+	return &chaosInjector{metrics: m, rnd: rand.Float64}
+}
+
+// configure arms the injector with the given fault mix.
+func (c *chaosInjector) configure(path string, latency time.Duration, latencyPct, errorPct, truncatePct, dropFramePct float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = true
+	c.path = path
+	c.latency = latency
+	c.latencyPct = latencyPct
+	c.errorPct = errorPct
+	c.truncatePct = truncatePct
+	c.dropFramePct = dropFramePct
+}
+
+func (c *chaosInjector) disable() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = false
+}
+
+func (c *chaosInjector) statusJSON() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf(`{"enabled":%v,"path":%q,"latency":%q,"latency_pct":%g,"error_pct":%g,"truncate_pct":%g,"drop_frame_pct":%g}`,
+		c.enabled, c.path, c.latency, c.latencyPct, c.errorPct, c.truncatePct, c.dropFramePct)
+}
+
+// roll reports whether a fault with the given percentage fires now.
+func (c *chaosInjector) roll(pct float64) bool {
+	return pct > 0 && c.rnd()*100 < pct
+}
+
+// dropDataFrame decides whether the WebSocket relay should swallow the
+// next data frame.
+func (c *chaosInjector) dropDataFrame() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled || !c.roll(c.dropFramePct) {
+		return false
+	}
+	c.metrics.Inc(`clawdbot_proxy_chaos_injected_total{fault="drop_frame"}`)
+	return true
+}
+
+// injectChaos applies the armed HTTP faults to one request: added latency,
+// a synthetic 5xx, or a truncating writer. It returns the (possibly
+// wrapped) writer and false when the request was answered here.
+func (p *ProxyServer) injectChaos(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, bool) {
+	c := p.chaos
+	c.mu.Lock()
+	if !c.enabled || (c.path != "" && !pathPrefixMatches(c.path, r.URL.Path)) {
+		c.mu.Unlock()
+		return w, true
+	}
+	delay := time.Duration(0)
+	if c.roll(c.latencyPct) {
+		delay = c.latency
+	}
+	fail := c.roll(c.errorPct)
+	truncate := !fail && c.roll(c.truncatePct)
+	c.mu.Unlock()
+
+	if delay > 0 {
+		c.metrics.Inc(`clawdbot_proxy_chaos_injected_total{fault="latency"}`)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return w, false
+		}
+	}
+	if fail {
+		c.metrics.Inc(`clawdbot_proxy_chaos_injected_total{fault="error"}`)
+		codes := []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}
+		p.httpError(w, r, codes[rand.Intn(len(codes))], "chaos injection")
+		return w, false
+	}
+	if truncate {
+		c.metrics.Inc(`clawdbot_proxy_chaos_injected_total{fault="truncate"}`)
+		return &truncateChaosWriter{ResponseWriter: w, remaining: chaosTruncateBytes}, true
+	}
+	return w, true
+}
+
+// truncateChaosWriter passes through the first chaosTruncateBytes of the
+// body, then pretends to write the rest. The Content-Length mismatch makes
+// clients see a broken transfer, just like a gateway dying mid-response.
+type truncateChaosWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (w *truncateChaosWriter) Write(b []byte) (int, error) {
+	if w.remaining > 0 {
+		chunk := b
+		if len(chunk) > w.remaining {
+			chunk = chunk[:w.remaining]
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		w.remaining -= n
+		if err != nil {
+			return n, err
+		}
+	}
+	// Report full success so the handler keeps streaming obliviously.
+	return len(b), nil
+}
+
+func (w *truncateChaosWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// handleChaos is the admin control surface: GET reports the current fault
+// mix, POST arms it from query parameters, POST /admin/chaos/disable (see
+// admin.go) turns it off.
+func (p *ProxyServer) handleChaos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, p.chaos.statusJSON())
+		return
+	}
+	q := r.URL.Query()
+	latency := time.Duration(0)
+	if v := q.Get("latency"); v != "" {
+		var err error
+		if latency, err = time.ParseDuration(v); err != nil || latency < 0 {
+			http.Error(w, "invalid latency", http.StatusBadRequest)
+			return
+		}
+	}
+	pcts := make(map[string]float64, 4)
+	for _, name := range []string{"latency-pct", "error-pct", "truncate-pct", "drop-frame-pct"} {
+		pcts[name] = 0
+		if v := q.Get(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 100 {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			pcts[name] = f
+		}
+	}
+	p.chaos.configure(q.Get("path"), latency, pcts["latency-pct"], pcts["error-pct"], pcts["truncate-pct"], pcts["drop-frame-pct"])
+	p.log.Warn("chaos injection armed via admin API",
+		"path", q.Get("path"), "latency", latency, "latency_pct", pcts["latency-pct"],
+		"error_pct", pcts["error-pct"], "truncate_pct", pcts["truncate-pct"], "drop_frame_pct", pcts["drop-frame-pct"])
+	writeJSON(w, p.chaos.statusJSON())
+}
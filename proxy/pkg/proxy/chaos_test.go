@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChaosDisabledByDefault(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	w, ok := p.injectChaos(httptest.NewRecorder(), r)
+	if !ok {
+		t.Fatal("disarmed injector must not answer requests")
+	}
+	if _, wrapped := w.(*truncateChaosWriter); wrapped {
+		t.Error("disarmed injector must not wrap the writer")
+	}
+}
+
+func TestChaosInjectsErrors(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	p.chaos.rnd = func() float64 { return 0 } // every roll fires
+	p.chaos.configure("", 0, 0, 100, 0, 0)
+
+	rec := httptest.NewRecorder()
+	if _, ok := p.injectChaos(rec, httptest.NewRequest("GET", "/api/status", nil)); ok {
+		t.Fatal("error injection should answer the request")
+	}
+	if rec.Code < 500 || rec.Code > 599 {
+		t.Errorf("status = %d, want 5xx", rec.Code)
+	}
+}
+
+func TestChaosInjectsLatency(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	p.chaos.rnd = func() float64 { return 0 }
+	p.chaos.configure("", 30*time.Millisecond, 100, 0, 0, 0)
+
+	start := time.Now()
+	if _, ok := p.injectChaos(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil)); !ok {
+		t.Fatal("latency-only injection should let the request proceed")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("elapsed = %v, want >= injected latency", elapsed)
+	}
+}
+
+func TestChaosPathFilter(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	p.chaos.rnd = func() float64 { return 0 }
+	p.chaos.configure("/api/agent", 0, 0, 100, 0, 0)
+
+	if _, ok := p.injectChaos(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil)); !ok {
+		t.Error("paths outside the filter must be untouched")
+	}
+	if _, ok := p.injectChaos(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/agent/run", nil)); ok {
+		t.Error("paths inside the filter should get the fault")
+	}
+}
+
+func TestChaosTruncatesResponses(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	p.chaos.rnd = func() float64 { return 0 }
+	p.chaos.configure("", 0, 0, 0, 100, 0)
+
+	rec := httptest.NewRecorder()
+	w, ok := p.injectChaos(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if !ok {
+		t.Fatal("truncation should let the request proceed")
+	}
+	big := strings.Repeat("x", 3*chaosTruncateBytes)
+	n, err := w.Write([]byte(big))
+	if err != nil || n != len(big) {
+		t.Fatalf("Write = %d, %v; the handler must not notice the truncation", n, err)
+	}
+	if rec.Body.Len() != chaosTruncateBytes {
+		t.Errorf("client received %d bytes, want %d", rec.Body.Len(), chaosTruncateBytes)
+	}
+}
+
+func TestChaosDropDataFrameRespectsArming(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	p.chaos.rnd = func() float64 { return 0 }
+	if p.chaos.dropDataFrame() {
+		t.Error("disarmed injector must not drop frames")
+	}
+	p.chaos.configure("", 0, 0, 0, 0, 100)
+	if !p.chaos.dropDataFrame() {
+		t.Error("armed injector with drop-frame-pct=100 should drop")
+	}
+}
+
+func TestChaosAdminEndpoint(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	h := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/chaos?error-pct=50&latency=100ms&latency-pct=25&path=/api/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("arm status = %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/chaos", nil))
+	if !strings.Contains(rec.Body.String(), `"enabled":true`) {
+		t.Errorf("status = %s, want enabled", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/chaos?error-pct=200", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bogus percentage status = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/chaos/disable", nil))
+	if !strings.Contains(rec.Body.String(), `"enabled":false`) {
+		t.Errorf("disable = %s, want disabled", rec.Body.String())
+	}
+}
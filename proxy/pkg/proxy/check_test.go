@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPassesOnValidConfig(t *testing.T) {
+	static := t.TempDir()
+	if err := os.WriteFile(filepath.Join(static, "index.html"), []byte("ui"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	code := runCheck([]string{"-backend", "http://127.0.0.1:18080", "-static", static}, &out)
+	if code != 0 {
+		t.Fatalf("exit %d:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "ok: backend http://127.0.0.1:18080") {
+		t.Fatalf("missing backend line:\n%s", out.String())
+	}
+}
+
+func TestCheckFailsOnBrokenReferences(t *testing.T) {
+	routes := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(routes, []byte("path=/api/ bogus-token\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	code := runCheck([]string{"-backend", "http://127.0.0.1:18080", "-routes", routes}, &out)
+	if code != 1 {
+		t.Fatalf("exit %d, want 1:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "error: configuration files") {
+		t.Fatalf("missing error line:\n%s", out.String())
+	}
+
+	out.Reset()
+	if code := runCheck([]string{"-backend", ""}, &out); code != 1 {
+		t.Fatalf("empty backend accepted: %d", code)
+	}
+}
+
+func TestCheckFailsOnEmptyStaticDir(t *testing.T) {
+	var out strings.Builder
+	code := runCheck([]string{"-backend", "http://127.0.0.1:18080", "-static", t.TempDir()}, &out)
+	if code != 1 || !strings.Contains(out.String(), "did the UI build run") {
+		t.Fatalf("exit %d:\n%s", code, out.String())
+	}
+}
+
+func TestPrintConfigShowsEffectiveValues(t *testing.T) {
+	var out strings.Builder
+	code := runPrintConfig([]string{"-backend", "http://127.0.0.1:18080", "-rate-limit", "42"}, &out)
+	if code != 0 {
+		t.Fatalf("exit %d:\n%s", code, out.String())
+	}
+	text := out.String()
+	for _, want := range []string{
+		"Backend = http://127.0.0.1:18080",
+		"RateLimitRPS = 42",
+		"Listen = ", // default still printed
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func clientIPProxy(t *testing.T, trusted ...string) *ProxyServer {
+	t.Helper()
+	nets, err := parseCIDRList(trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ProxyServer{trustedNets: nets}
+}
+
+func xffRequest(remoteAddr string, xff ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/x", nil)
+	r.RemoteAddr = remoteAddr
+	for _, v := range xff {
+		r.Header.Add("X-Forwarded-For", v)
+	}
+	return r
+}
+
+func TestClientIPIgnoresXFFFromUntrustedPeer(t *testing.T) {
+	p := clientIPProxy(t, "10.0.0.0/8")
+	r := xffRequest("203.0.113.5:4444", "198.51.100.1")
+	if got := p.clientIP(r); got != "203.0.113.5" {
+		t.Errorf("clientIP = %q, want peer address 203.0.113.5", got)
+	}
+}
+
+func TestClientIPIgnoresXFFWithNoTrustedProxies(t *testing.T) {
+	p := clientIPProxy(t)
+	r := xffRequest("10.1.2.3:4444", "198.51.100.1")
+	if got := p.clientIP(r); got != "10.1.2.3" {
+		t.Errorf("clientIP = %q, want 10.1.2.3", got)
+	}
+}
+
+func TestClientIPWalksChainPastTrustedHops(t *testing.T) {
+	p := clientIPProxy(t, "10.0.0.0/8")
+	r := xffRequest("10.0.0.1:4444", "198.51.100.1, 10.0.0.2")
+	if got := p.clientIP(r); got != "198.51.100.1" {
+		t.Errorf("clientIP = %q, want 198.51.100.1", got)
+	}
+}
+
+func TestClientIPAllTrustedChainUsesLeftmost(t *testing.T) {
+	p := clientIPProxy(t, "10.0.0.0/8")
+	r := xffRequest("10.0.0.1:4444", "10.0.0.9, 10.0.0.2")
+	if got := p.clientIP(r); got != "10.0.0.9" {
+		t.Errorf("clientIP = %q, want 10.0.0.9", got)
+	}
+}
+
+func TestClientIPGarbageChainFallsBackToPeer(t *testing.T) {
+	p := clientIPProxy(t, "10.0.0.0/8")
+	r := xffRequest("10.0.0.1:4444", "not-an-ip, 10.0.0.2")
+	if got := p.clientIP(r); got != "10.0.0.1" {
+		t.Errorf("clientIP = %q, want peer 10.0.0.1", got)
+	}
+}
+
+func TestClientIPBareIPTrustEntry(t *testing.T) {
+	p := clientIPProxy(t, "127.0.0.1")
+	r := xffRequest("127.0.0.1:5000", "192.0.2.7")
+	if got := p.clientIP(r); got != "192.0.2.7" {
+		t.Errorf("clientIP = %q, want 192.0.2.7", got)
+	}
+}
+
+func TestParseCIDRListRejectsGarbage(t *testing.T) {
+	if _, err := parseCIDRList([]string{"10.0.0.0/8", "bogus"}); err == nil {
+		t.Error("expected error for invalid CIDR entry")
+	}
+}
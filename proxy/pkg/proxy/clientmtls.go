@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+)
+
+// Client mTLS on the public listener: when -client-ca is set, every TLS
+// client must present a certificate signed by that CA. The verified
+// identity (CN, falling back to the first DNS or email SAN) is forwarded
+// to the gateway in X-Client-Identity; the client-supplied header is
+// always stripped so it cannot be spoofed. Revocation is CRL-based
+// (-client-crl); OCSP would need a non-stdlib client and is not supported
+// in this build.
+
+const clientIdentityHeader = "X-Client-Identity"
+
+// loadClientCAs reads the CA bundle client certificates are verified
+// against.
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("client CA bundle %s: no certificates found", path)
+	}
+	return pool, nil
+}
+
+// crlChecker answers revocation lookups from a CRL loaded at startup
+// (DER or PEM).
+type crlChecker struct {
+	revoked map[string]struct{}
+}
+
+func loadCRL(path string) (*crlChecker, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CRL: %w", err)
+	}
+	if block, _ := pem.Decode(raw); block != nil {
+		raw = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL %s: %w", path, err)
+	}
+	c := &crlChecker{revoked: make(map[string]struct{}, len(list.RevokedCertificateEntries))}
+	for _, entry := range list.RevokedCertificateEntries {
+		c.revoked[entry.SerialNumber.String()] = struct{}{}
+	}
+	return c, nil
+}
+
+func (c *crlChecker) isRevoked(serial *big.Int) bool {
+	_, ok := c.revoked[serial.String()]
+	return ok
+}
+
+// applyClientMTLS turns on certificate requirement and revocation checking
+// for one listener TLS config.
+func (p *ProxyServer) applyClientMTLS(tc *tls.Config) {
+	if p.clientCAs == nil {
+		return
+	}
+	tc.ClientCAs = p.clientCAs
+	tc.ClientAuth = tls.RequireAndVerifyClientCert
+	if p.clientCRL == nil {
+		return
+	}
+	tc.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return nil
+		}
+		leaf, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		if p.clientCRL.isRevoked(leaf.SerialNumber) {
+			p.metrics.Inc(`clawdbot_proxy_client_cert_revoked_total`)
+			return fmt.Errorf("client certificate %s is revoked", leaf.SerialNumber)
+		}
+		return nil
+	}
+}
+
+// setClientIdentity stamps the verified certificate identity on the
+// request, removing whatever the client sent in that header.
+func setClientIdentity(r *http.Request) {
+	r.Header.Del(clientIdentityHeader)
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return
+	}
+	if id := certIdentity(r.TLS.PeerCertificates[0]); id != "" {
+		r.Header.Set(clientIdentityHeader, id)
+	}
+}
+
+func certIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	return ""
+}
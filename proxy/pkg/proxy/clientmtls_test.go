@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertIdentity(t *testing.T) {
+	cases := []struct {
+		cert x509.Certificate
+		want string
+	}{
+		{x509.Certificate{Subject: pkix.Name{CommonName: "ops@claw"}}, "ops@claw"},
+		{x509.Certificate{DNSNames: []string{"agent.claw.example"}}, "agent.claw.example"},
+		{x509.Certificate{EmailAddresses: []string{"dev@claw.example"}}, "dev@claw.example"},
+		{x509.Certificate{}, ""},
+	}
+	for _, tc := range cases {
+		if got := certIdentity(&tc.cert); got != tc.want {
+			t.Errorf("certIdentity = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestSetClientIdentityStripsSpoof(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/x", nil)
+	r.Header.Set(clientIdentityHeader, "spoofed")
+	setClientIdentity(r)
+	if got := r.Header.Get(clientIdentityHeader); got != "" {
+		t.Errorf("header = %q, want stripped on non-TLS requests", got)
+	}
+
+	r = httptest.NewRequest("GET", "/api/x", nil)
+	r.Header.Set(clientIdentityHeader, "spoofed")
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+		{Subject: pkix.Name{CommonName: "real-client"}},
+	}}
+	setClientIdentity(r)
+	if got := r.Header.Get(clientIdentityHeader); got != "real-client" {
+		t.Errorf("header = %q, want the verified CN", got)
+	}
+}
+
+func TestLoadCRLAndRevocation(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTmpl, issuerTmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(42), RevocationTime: time.Now()},
+		},
+	}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlFile := filepath.Join(t.TempDir(), "revoked.crl")
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlDER})
+	if err := os.WriteFile(crlFile, crlPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadCRL(crlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.isRevoked(big.NewInt(42)) {
+		t.Error("serial 42 should be revoked")
+	}
+	if c.isRevoked(big.NewInt(7)) {
+		t.Error("serial 7 should not be revoked")
+	}
+}
+
+func TestApplyClientMTLS(t *testing.T) {
+	certFile, _ := writeTestCert(t)
+	p := newTestProxy(t, &Config{ClientCAFile: certFile})
+	tc := &tls.Config{}
+	p.applyClientMTLS(tc)
+	if tc.ClientAuth != tls.RequireAndVerifyClientCert || tc.ClientCAs == nil {
+		t.Errorf("mTLS not applied: auth=%v cas=%v", tc.ClientAuth, tc.ClientCAs != nil)
+	}
+}
+
+func TestClientCRLRequiresCA(t *testing.T) {
+	crl := filepath.Join(t.TempDir(), "x.crl")
+	os.WriteFile(crl, []byte("x"), 0o600)
+	if _, err := NewProxyServer(&Config{Backend: "http://127.0.0.1:0", ClientCRLFile: crl}, discardLogger()); err == nil {
+		t.Error("-client-crl without -client-ca should fail")
+	}
+}
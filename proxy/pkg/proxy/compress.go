@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compression support. gzip is compressed in-process; brotli has no
+// stdlib encoder, so `br` is only negotiated where precompressed content
+// exists (upstream responses that already carry Content-Encoding pass
+// through untouched either way).
+
+var gzipPool = sync.Pool{
+	New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	},
+}
+
+// compress wraps next and gzip-encodes eligible responses based on
+// Accept-Encoding, minimum size, and the content-type allowlist.
+func (p *ProxyServer) compress(next http.Handler) http.Handler {
+	if !p.cfg.Compress {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsEncoding(r, "gzip") || isUpgradeRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{rw: w, minSize: p.cfg.CompressMinSize, types: p.cfg.CompressTypes}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func acceptsEncoding(r *http.Request, enc string) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			name, q, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), enc) {
+				continue
+			}
+			if strings.TrimSpace(q) == "q=0" {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter delays the compress/passthrough decision until the response
+// status, headers, and (when Content-Length is absent) enough body bytes are
+// known to apply the minimum-size threshold.
+type compressWriter struct {
+	rw      http.ResponseWriter
+	minSize int
+	types   []string
+
+	status  int
+	decided bool
+	gz      *gzip.Writer // nil after decide() when passing through
+	buf     []byte       // body bytes held while undecided
+}
+
+func (cw *compressWriter) Header() http.Header { return cw.rw.Header() }
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter { return cw.rw }
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+	h := cw.rw.Header()
+	if !cw.eligible(h) {
+		cw.passthrough()
+		return
+	}
+	// With a known length the decision can be made immediately; otherwise
+	// buffer until minSize bytes have been seen.
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil && n < int64(cw.minSize) {
+			cw.passthrough()
+			return
+		}
+		cw.startGzip()
+	}
+}
+
+func (cw *compressWriter) eligible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+	// Compressing a partial response would break the byte offsets the
+	// Content-Range header promises; resumable downloads stay identity.
+	if cw.status == http.StatusPartialContent || h.Get("Content-Range") != "" {
+		return false
+	}
+	ct, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	ct = strings.TrimSpace(ct)
+	for _, allowed := range cw.types {
+		if strings.EqualFold(ct, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cw *compressWriter) startGzip() {
+	h := cw.rw.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	cw.rw.WriteHeader(cw.status)
+	gz := gzipPool.Get().(*gzip.Writer)
+	gz.Reset(cw.rw)
+	cw.gz = gz
+	cw.decided = true
+}
+
+func (cw *compressWriter) passthrough() {
+	cw.rw.WriteHeader(cw.status)
+	cw.decided = true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		if cw.rw.Header().Get("Content-Type") == "" {
+			cw.rw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.gz != nil {
+			return cw.gz.Write(b)
+		}
+		return cw.rw.Write(b)
+	}
+	// Undecided: length unknown, keep buffering until the threshold.
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		cw.startGzip()
+		if _, err := cw.gz.Write(cw.buf); err != nil {
+			return len(b), err
+		}
+		cw.buf = nil
+	}
+	return len(b), nil
+}
+
+// Close flushes any pending decision: short bodies pass through unencoded.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.rw.WriteHeader(cw.status)
+		cw.decided = true
+		if len(cw.buf) > 0 {
+			cw.rw.Write(cw.buf)
+			cw.buf = nil
+		}
+		return nil
+	}
+	if cw.gz != nil {
+		err := cw.gz.Close()
+		gzipPool.Put(cw.gz)
+		cw.gz = nil
+		return err
+	}
+	return nil
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := cw.rw.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided && cw.status != 0 {
+		// A streaming handler flushed early; stop waiting for minSize.
+		if len(cw.buf) > 0 || cw.minSize == 0 {
+			cw.startGzip()
+			cw.gz.Write(cw.buf)
+			cw.buf = nil
+		} else {
+			cw.passthrough()
+		}
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compressHandler(t *testing.T, inner http.HandlerFunc) http.Handler {
+	t.Helper()
+	p := &ProxyServer{cfg: &Config{
+		Compress:        true,
+		CompressMinSize: 64,
+		CompressTypes:   splitCommaList(defaultCompressTypes),
+	}}
+	return p.compress(inner)
+}
+
+func TestCompressLargeJSON(t *testing.T) {
+	body := strings.Repeat(`{"k":"v"}`, 100)
+	h := compressHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	})
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := io.ReadAll(gr)
+	if string(decoded) != body {
+		t.Error("decompressed body does not match original")
+	}
+}
+
+func TestCompressSkipsSmallBodies(t *testing.T) {
+	h := compressHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	})
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none for small body", got)
+	}
+	if rec.Body.String() != `{"ok":true}` {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
+
+func TestCompressSkipsAlreadyEncoded(t *testing.T) {
+	h := compressHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "br")
+		w.Write(make([]byte, 2048))
+	})
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "br" {
+		t.Errorf("Content-Encoding = %q, want upstream br preserved", got)
+	}
+}
+
+func TestCompressSkipsDisallowedTypes(t *testing.T) {
+	h := compressHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 2048))
+	})
+	req := httptest.NewRequest("GET", "/logo.png", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none for image/png", got)
+	}
+}
+
+func TestCompressSkipsWithoutAcceptEncoding(t *testing.T) {
+	h := compressHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(make([]byte, 2048))
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+}
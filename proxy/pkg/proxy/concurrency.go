@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// concurrencyLimiter bounds in-flight backend requests. When the limit is
+// reached, up to queueDepth requests park in a bounded wait queue for at
+// most queueTimeout; anything beyond that is shed immediately. This keeps a
+// struggling gateway from accumulating an unbounded goroutine pile while
+// still absorbing short bursts.
+type concurrencyLimiter struct {
+	slots        chan struct{} // capacity = max in-flight
+	queue        chan struct{} // capacity = max waiters
+	queueTimeout time.Duration
+	metrics      *Metrics
+}
+
+func newConcurrencyLimiter(maxInflight, queueDepth int, queueTimeout time.Duration, m *Metrics) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots:        make(chan struct{}, maxInflight),
+		queue:        make(chan struct{}, queueDepth),
+		queueTimeout: queueTimeout,
+		metrics:      m,
+	}
+}
+
+// acquire blocks until a slot is free, the queue wait times out, or the
+// request context ends. It reports whether the caller may proceed (and must
+// release afterwards).
+func (c *concurrencyLimiter) acquire(ctx context.Context) bool {
+	select {
+	case c.slots <- struct{}{}:
+		c.metrics.AddGauge(`clawdbot_proxy_inflight`, 1)
+		return true
+	default:
+	}
+	// Saturated: try to park in the queue.
+	select {
+	case c.queue <- struct{}{}:
+	default:
+		c.metrics.Inc(`clawdbot_proxy_queue_full_total`)
+		return false
+	}
+	c.metrics.AddGauge(`clawdbot_proxy_queued`, 1)
+	defer func() {
+		<-c.queue
+		c.metrics.AddGauge(`clawdbot_proxy_queued`, -1)
+	}()
+	timer := time.NewTimer(c.queueTimeout)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		c.metrics.AddGauge(`clawdbot_proxy_inflight`, 1)
+		return true
+	case <-timer.C:
+		c.metrics.Inc(`clawdbot_proxy_queue_timeout_total`)
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *concurrencyLimiter) release() {
+	<-c.slots
+	c.metrics.AddGauge(`clawdbot_proxy_inflight`, -1)
+}
+
+// clientConcurrency caps in-flight backend requests per client IP. Unlike
+// the global concurrencyLimiter there is no queue: a single tab firing
+// hundreds of parallel fetches should fail fast with 429 rather than
+// monopolize the wait slots that other clients need.
+type clientConcurrency struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	max     int
+	metrics *Metrics
+}
+
+func newClientConcurrency(max int, m *Metrics) *clientConcurrency {
+	return &clientConcurrency{counts: make(map[string]int), max: max, metrics: m}
+}
+
+// acquire reports whether key may start another request; on true the caller
+// must pair it with release.
+func (c *clientConcurrency) acquire(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[key] >= c.max {
+		c.metrics.Inc(`clawdbot_proxy_client_inflight_rejected_total`)
+		return false
+	}
+	c.counts[key]++
+	return true
+}
+
+func (c *clientConcurrency) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[key]--; c.counts[key] <= 0 {
+		delete(c.counts, key) // keep the map bounded by active clients
+	}
+}
+
+// limitConcurrency gates one backend request through the per-client cap and
+// the global limiter: 429 when one client hogs, 503 with Retry-After when
+// the whole server had to shed. Returns false when the request was
+// answered; the caller must defer the returned func on true.
+func (p *ProxyServer) limitConcurrency(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	release := func() {}
+	if p.clientInflight != nil {
+		ip := p.clientIP(r)
+		if !p.clientInflight.acquire(ip) {
+			w.Header().Set("Retry-After", "1")
+			p.httpError(w, r, http.StatusTooManyRequests, "too many concurrent requests")
+			return nil, false
+		}
+		release = func() { p.clientInflight.release(ip) }
+	}
+	if p.inflight == nil {
+		return release, true
+	}
+	if !p.inflight.acquire(r.Context()) {
+		release()
+		w.Header().Set("Retry-After", "1")
+		p.httpError(w, r, http.StatusServiceUnavailable, "server is at capacity, retry shortly")
+		return nil, false
+	}
+	return func() { p.inflight.release(); release() }, true
+}
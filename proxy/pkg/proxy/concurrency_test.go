@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterImmediateSlot(t *testing.T) {
+	c := newConcurrencyLimiter(1, 0, time.Second, NewMetrics())
+	if !c.acquire(context.Background()) {
+		t.Fatal("first acquire should succeed")
+	}
+	c.release()
+	if !c.acquire(context.Background()) {
+		t.Fatal("acquire after release should succeed")
+	}
+}
+
+func TestConcurrencyLimiterQueueFull(t *testing.T) {
+	m := NewMetrics()
+	c := newConcurrencyLimiter(1, 0, time.Second, m)
+	c.acquire(context.Background())
+	// Zero queue depth: the second request is shed immediately.
+	start := time.Now()
+	if c.acquire(context.Background()) {
+		t.Fatal("acquire should fail when slot and queue are exhausted")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("queue-full rejection should not block")
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	c := newConcurrencyLimiter(1, 1, 50*time.Millisecond, NewMetrics())
+	c.acquire(context.Background())
+	start := time.Now()
+	if c.acquire(context.Background()) {
+		t.Fatal("queued acquire should time out")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("timed out after %v, want >= queue timeout", elapsed)
+	}
+}
+
+func TestConcurrencyLimiterQueuedRequestProceeds(t *testing.T) {
+	c := newConcurrencyLimiter(1, 1, 2*time.Second, NewMetrics())
+	c.acquire(context.Background())
+	done := make(chan bool, 1)
+	go func() { done <- c.acquire(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	c.release()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("queued request should get the freed slot")
+		}
+	case <-time.After(time.Second):
+		t.Error("queued request never woke up")
+	}
+}
+
+func TestClientConcurrencyCapsPerKey(t *testing.T) {
+	m := NewMetrics()
+	c := newClientConcurrency(2, m)
+	if !c.acquire("192.0.2.1") || !c.acquire("192.0.2.1") {
+		t.Fatal("acquires within the cap should succeed")
+	}
+	if c.acquire("192.0.2.1") {
+		t.Fatal("third concurrent request from one client should be refused")
+	}
+	if !c.acquire("192.0.2.2") {
+		t.Error("other clients must not be affected")
+	}
+	if got := m.Counter(`clawdbot_proxy_client_inflight_rejected_total`); got != 1 {
+		t.Errorf("rejected counter = %d, want 1", got)
+	}
+	c.release("192.0.2.1")
+	if !c.acquire("192.0.2.1") {
+		t.Error("release should free a slot for the same client")
+	}
+}
+
+func TestClientConcurrencyForgetsIdleClients(t *testing.T) {
+	c := newClientConcurrency(1, NewMetrics())
+	c.acquire("192.0.2.1")
+	c.release("192.0.2.1")
+	if len(c.counts) != 0 {
+		t.Errorf("counts has %d entries after release, want 0", len(c.counts))
+	}
+}
+
+func TestLimitConcurrencyPerClient429(t *testing.T) {
+	p := newTestProxy(t, &Config{MaxInflightPerClient: 1})
+	p.clientInflight = newClientConcurrency(1, p.metrics)
+
+	r := httptest.NewRequest("GET", "/api/x", nil)
+	r.RemoteAddr = "192.0.2.1:1000"
+	release, ok := p.limitConcurrency(httptest.NewRecorder(), r)
+	if !ok {
+		t.Fatal("first request should pass the per-client gate")
+	}
+	rec := httptest.NewRecorder()
+	if _, ok := p.limitConcurrency(rec, r); ok {
+		t.Fatal("second concurrent request should be refused")
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 should carry Retry-After")
+	}
+	release()
+	if _, ok := p.limitConcurrency(httptest.NewRecorder(), r); !ok {
+		t.Error("gate should reopen after release")
+	}
+}
@@ -0,0 +1,783 @@
+package proxy
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCompressTypes = "text/html,text/css,text/plain,application/javascript,application/json,image/svg+xml"
+
+func splitCommaList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// Config holds every tunable for the proxy. Values come from flags, with a
+// handful of environment overrides applied on top (see applyEnv).
+type Config struct {
+	Listen    string // address for the public listener; "unix:<path>" for a socket
+	Backend   string // gateway base URL(s), comma-separated, or "unix:<path>"
+	StaticDir string // directory with the built Control UI; empty disables static serving
+
+	// Session affinity when Backend lists several gateways; see lb.go.
+	StickyCookie string
+	StickySecret string
+
+	// DiscoveryInterval is how often dynamic backends (dns:// and friends)
+	// are re-resolved; see dnsdiscovery.go.
+	DiscoveryInterval time.Duration
+
+	// Discovery watches a service registry for gateway instances
+	// ("consul://host:port/service"); see consul.go.
+	Discovery string
+
+	// Traffic mirroring to a shadow backend; see mirror.go.
+	MirrorBackend string
+	MirrorPercent int
+
+	// Weighted canary routing; see canary.go.
+	CanaryBackend string
+	CanaryPercent int
+
+	// Blue/green backend sets switched via the admin API; see bluegreen.go.
+	BlueBackend  string
+	GreenBackend string
+	ActiveSet    string
+	SwitchDrain  time.Duration
+
+	// UnixSocketMode is applied to the listener socket file when Listen is a
+	// unix: address. The socket is unlinked again on shutdown.
+	UnixSocketMode os.FileMode
+
+	// RouteFile configures the routing table (see parseRouteFile). Empty
+	// keeps the built-in /api/ + /ws routes against the default backend.
+	RouteFile string
+
+	// VHostFile configures named sites keyed by Host header (see
+	// parseVHostFile), each with its own backend, static dir, SNI cert, and
+	// rate limits.
+	VHostFile string
+
+	// TLSCert/TLSKey enable TLS on the public listener. With TLS active the
+	// server negotiates HTTP/2 via ALPN; plaintext stays HTTP/1.1 (the Go
+	// client offers no h2c, so cleartext HTTP/2 buys nothing here).
+	TLSCert string
+	TLSKey  string
+
+	// ProxyProtocol requires a PROXY protocol v1/v2 header on every
+	// connection (for deployments behind an L4 load balancer).
+	ProxyProtocol bool
+
+	// AdminListen enables the admin API on a second listener when set.
+	// It should stay bound to localhost.
+	AdminListen string
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// DrainTimeout bounds graceful shutdown: how long to wait for in-flight
+	// requests and WebSocket close handshakes before forcing connections
+	// closed.
+	DrainTimeout time.Duration
+
+	RateLimitRPS        float64
+	RateLimitBurst      int
+	RateLimitMaxEntries int
+	RateLimitIdleTTL    time.Duration
+
+	// Separate policy for authenticated callers (valid API key, JWT, or
+	// OIDC session); zero falls back to the anonymous per-IP limits.
+	RateLimitAuthRPS   float64
+	RateLimitAuthBurst int
+
+	// TrustedProxies lists CIDRs (or bare IPs) of upstream proxies whose
+	// X-Forwarded-For headers may be trusted. Empty means the direct peer
+	// address is always used, so clients cannot spoof their IP.
+	TrustedProxies []string
+
+	// Security response headers. SecurityPreset "strict" injects HSTS (on
+	// TLS), nosniff, frame denial, referrer policy, and a CSP tuned for the
+	// Control UI; SecurityCSP replaces the preset's CSP value.
+	SecurityPreset string
+	SecurityCSP    string
+
+	// CORS handling at the edge. Empty CORSOrigins disables the middleware.
+	CORSOrigins     []string
+	CORSMethods     []string
+	CORSHeaders     []string
+	CORSCredentials bool
+	CORSMaxAge      time.Duration
+
+	// Response compression for proxied and static bodies.
+	Compress        bool
+	CompressMinSize int
+	CompressTypes   []string
+
+	// Built-in middleware names to leave out of the chain; see middleware.go.
+	DisableMiddleware []string
+
+	// API key auth for /api/*. Keys come from the flag and/or a file that
+	// is re-read on change (revocation without restart).
+	APIKeys    []string
+	APIKeyFile string
+
+	// HTTP Basic auth from an htpasswd file, enforced on BasicAuthPaths
+	// (default everything except /health and /metrics).
+	HtpasswdFile   string
+	BasicAuthPaths []string
+	BasicAuthRealm string
+
+	// ACLFile restricts path prefixes to client networks (allow/deny CIDR
+	// rules). The file is re-read on change, like the API key file.
+	ACLFile string
+
+	// Edge JWT validation. Auth is enforced only on JWTAuthPaths prefixes
+	// and only when a secret or JWKS URL is configured.
+	JWTSecret    string
+	JWTJWKSURL   string
+	JWTAuthPaths []string
+
+	// OIDC relying party: unauthenticated browser requests on OIDCPaths are
+	// sent to the IdP, the callback issues an encrypted session cookie, and
+	// verified claims are forwarded to the gateway. See oidc.go.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCCookieSecret string
+	OIDCScopes       string
+	OIDCPaths        []string
+
+	// Client mTLS on the listener: ClientCAFile makes client certificates
+	// mandatory; ClientCRLFile adds CRL-based revocation (no OCSP).
+	ClientCAFile  string
+	ClientCRLFile string
+
+	// TLS toward an HTTPS backend: custom CA bundle, client certificate for
+	// mTLS, and a development-only skip-verify (loudly logged at startup).
+	UpstreamCAFile     string
+	UpstreamClientCert string
+	UpstreamClientKey  string
+	UpstreamSkipVerify bool
+
+	// Backend connection pool tuning; see newBackendTransport.
+	PoolMaxIdle         int
+	PoolMaxIdlePerHost  int
+	PoolMaxPerHost      int // 0 = unlimited
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	DialKeepAlive       time.Duration
+	TLSHandshakeTimeout time.Duration
+
+	// Retry policy for idempotent backend requests. Attempts 0 disables.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+	RetryBudget   time.Duration
+
+	// Circuit breaker for backend requests. Threshold 0 disables.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Backend GET response cache.
+	CacheEnabled    bool
+	CacheTTL        time.Duration
+	CacheMaxEntries int
+	CacheMaxBody    int
+
+	// Slowloris defenses: maximum time to read request headers, minimum
+	// average transfer rate for request bodies (bytes/sec, after a grace
+	// period), and a cap on concurrent connections from one IP. Zero
+	// disables the latter two.
+	ReadHeaderTimeout time.Duration
+	MinBodyRate       float64
+	MaxConnsPerIP     int
+
+	// Static serving extras: URL path prefixes where directory listings are
+	// allowed (e.g. /downloads/) and an optional custom 404 page that
+	// replaces the SPA index.html fallback for unknown paths.
+	StaticListDirs []string
+	NotFoundPage   string
+
+	// StaticCacheControl overrides the built-in per-extension Cache-Control
+	// policy for static files: semicolon-separated "match=value" entries
+	// where match is an extension or exact file name. Empty keeps the
+	// defaults (immutable hashed assets, no-cache HTML).
+	StaticCacheControl string
+
+	// BandwidthRate caps egress bytes/sec per client (API key when present,
+	// IP otherwise) on proxied and static responses. 0 disables shaping.
+	BandwidthRate float64
+
+	// Backend concurrency gate: at most MaxInflight requests proxy at once,
+	// QueueDepth more wait up to QueueTimeout, the rest get 503 +
+	// Retry-After. Zero MaxInflight disables the gate.
+	MaxInflight  int
+	QueueDepth   int
+	QueueTimeout time.Duration
+
+	// MaxInflightPerClient caps concurrent requests per client IP with an
+	// immediate 429 — no queue — independent of the global gate above.
+	MaxInflightPerClient int
+
+	// Request body caps in bytes: MaxBodyBytes applies everywhere (0
+	// disables), BodyLimits holds "/prefix=bytes" overrides with the longest
+	// matching prefix winning.
+	MaxBodyBytes int64
+	BodyLimits   []string
+
+	// Maintenance mode. The admin API toggles it at runtime; MaintenanceFile
+	// is an optional sentinel whose mere existence (e.g. `touch`ed by a
+	// deploy script) also switches it on. MaintenancePage replaces the
+	// default 503 body with the contents of a file (HTML or JSON).
+	MaintenanceFile string
+	MaintenancePage string
+
+	// WSOrigins restricts browser-originated WebSocket upgrades and API
+	// requests to these origins (exact, "*", or *.suffix). Empty allows
+	// everything; requests without an Origin header always pass, since only
+	// browsers send one.
+	WSOrigins []string
+
+	// WebSocket keepalive. The proxy pings both sides of every relayed
+	// session and tears the session down when a side goes silent for
+	// longer than WSIdleTimeout. Deliberately independent from the HTTP
+	// read/write timeouts, which do not apply to hijacked connections.
+	WSPingInterval time.Duration
+	WSIdleTimeout  time.Duration
+
+	// WSMaxMessage caps the payload size of a single client-originated
+	// WebSocket message (fragments included) in bytes. Oversized messages
+	// close the session with status 1009 before the payload reaches the
+	// gateway. Zero disables the cap.
+	WSMaxMessage int64
+
+	// WebSocket reconnect buffering (see wsresume.go): keep the backend
+	// connection alive for WSResumeGrace after a client drops, buffering up
+	// to WSResumeBuffer bytes of backend messages for replay when the client
+	// reconnects with its session token. Zero grace disables the feature.
+	WSResumeGrace  time.Duration
+	WSResumeBuffer int64
+
+	// Per-session WebSocket rate limits on client→backend traffic, separate
+	// from the HTTP limiter (see wsratelimit.go): messages/sec and payload
+	// bytes/sec. Overdraw throttles the relay; egregious frames close the
+	// session with 1008. Zero disables each.
+	WSMsgRate  float64
+	WSByteRate float64
+
+	// WSCompression enables permessage-deflate: the client's offer is
+	// forwarded to the backend (passthrough), and when the backend declines
+	// the proxy terminates the extension itself, recoding frames at
+	// WSCompressionLevel. Off by default since it exempts frame payloads
+	// from verbatim relaying.
+	WSCompression      bool
+	WSCompressionLevel int
+
+	// GeoIP databases in MaxMind .mmdb format (see geoip.go); either may
+	// be empty to skip that kind of tagging.
+	GeoIPDB    string
+	GeoIPASNDB string
+
+	// WAF enables the request-inspection rules in waf.go; WAFRuleFile adds
+	// site-specific rules on top of the bundled scanner ruleset.
+	WAF         bool
+	WAFRuleFile string
+
+	// Automatic IP banning (see banlist.go): BanThreshold offenses within
+	// BanWindow earn a ban of BanDuration, doubling for repeat offenders.
+	// BanFile persists the list across restarts; zero threshold disables
+	// automatic bans (admin bans still work when BanFile is set).
+	BanThreshold int
+	BanWindow    time.Duration
+	BanDuration  time.Duration
+	BanFile      string
+
+	// WaitBackend keeps /ready answering 503 until the gateway responds to
+	// a startup probe (see ready.go).
+	WaitBackend bool
+
+	// ReadyChecks selects the dependency checks /readyz runs (see
+	// healthz.go); empty runs them all.
+	ReadyChecks []string
+
+	// ErrorPageDir overrides the built-in HTML error page with templates
+	// named <status>.html or error.html (see errpages.go).
+	ErrorPageDir string
+
+	// TransformFile declares named JSON body transforms that routes attach
+	// with req-transform=/resp-transform= (see transform.go).
+	TransformFile string
+
+	// WasmPlugins lists WebAssembly filter modules as <path>=<hook>
+	// entries; see wasm.go for the hooks and the plugin ABI.
+	WasmPlugins []string
+
+	// Bind controls for the main listener (see bind.go): interfaces to
+	// bind instead of a single address, and an IP family restriction.
+	ListenInterfaces []string
+	ListenFamily     string
+
+	// Plain-HTTP front door and ACME challenge webroot; see redirect.go.
+	RedirectHTTP string
+	ACMEWebroot  string
+
+	// HSTS policy stamped on TLS responses (see security.go); max-age in
+	// seconds, 0 disables the header entirely.
+	HSTSMaxAge     int
+	HSTSSubdomains bool
+	HSTSPreload    bool
+
+	// Listeners holds extra listener entries ("name=addr/option...");
+	// see listeners.go for options and the policy model.
+	Listeners []string
+
+	// External authorization; see extauthz.go for the check protocol.
+	ExtAuthzURL      string
+	ExtAuthzTimeout  time.Duration
+	ExtAuthzFailOpen bool
+	ExtAuthzCacheTTL time.Duration
+
+	// OpenAPISpec points at the gateway's OpenAPI 3 JSON document; backend
+	// requests not matching a documented operation are rejected at the edge
+	// (see openapi.go). Empty disables validation.
+	OpenAPISpec string
+
+	// Request capture (see capture.go): CaptureMaxBody truncates recorded
+	// bodies, CaptureFile optionally mirrors entries to disk as JSON lines.
+	CaptureMaxBody int
+	CaptureFile    string
+
+	// CSRF protection (see csrf.go): CSRFProtect rejects state-changing
+	// /api/* requests that carry the CSRFCookie session cookie but
+	// originate from a foreign site. CSRFOrigins whitelists extra hosts.
+	CSRFProtect bool
+	CSRFCookie  string
+	CSRFOrigins []string
+
+	// Bot and scanner classification (see botdetect.go): BotDetect tags
+	// requests by client class; BotRate and ScannerRate add per-IP rate
+	// limits for the tagged classes (requests/second, zero disables).
+	BotDetect   bool
+	BotRate     float64
+	ScannerRate float64
+
+	// OutlierDetection sheds traffic from pool targets whose rolling
+	// success rate or latency is a statistical outlier (see outlier.go).
+	OutlierDetection bool
+
+	// FlushInterval is the default ReverseProxy flush cadence for backend
+	// responses; negative flushes after every write, zero keeps the stdlib
+	// behavior. Routes may override it with flush-interval=.
+	FlushInterval time.Duration
+
+	// Server-Sent Events (see sse.go): heartbeat comment interval for quiet
+	// streams and a per-stream idle timeout that replaces the server
+	// WriteTimeout (which is cleared for event streams). Zero disables each.
+	SSEHeartbeat   time.Duration
+	SSEIdleTimeout time.Duration
+
+	LogLevel string
+
+	// Classic init-script management (see daemon.go): detach into the
+	// background, record the pid, and log to a reopenable file.
+	Daemon  bool
+	PidFile string
+	LogFile string
+
+	// Tracing: spans are exported as OTLP/HTTP JSON when an endpoint is
+	// configured. Incoming traceparent headers are honored either way.
+	OTLPEndpoint    string
+	TraceSampleRate float64
+
+	// Dedicated access log (JSON lines). Empty keeps access entries on the
+	// console logger. Rotation is size- and day-based.
+	AccessLogFile     string
+	AccessLogMaxSize  int64 // bytes
+	AccessLogKeep     int
+	AccessLogCompress bool
+	AccessLogSample   int // log 1 in N successful requests; errors always log
+
+	// Audit log (see auditlog.go): security events as JSON lines, with
+	// optional HMAC chaining for tamper evidence.
+	AuditLogFile   string
+	AuditLogSecret string
+
+	// Webhook notifier (see webhook.go): operational events POSTed as
+	// signed JSON to these URLs.
+	WebhookURLs   []string
+	WebhookSecret string
+
+	// StatsD/DogStatsD sink (see statsd.go): mirrors the metric stream over
+	// UDP for deployments without Prometheus. Sampling applies to counters
+	// and timings; gauges always send.
+	StatsDAddr       string
+	StatsDPrefix     string
+	StatsDSampleRate float64
+	StatsDTags       []string
+
+	// sources records where each explicitly-set option came from ("flag"
+	// or "env"); see applyEnvFlags and logSources.
+	sources map[string]configSource
+}
+
+func parseConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	fs := flag.NewFlagSet("clawdbot-proxy", flag.ContinueOnError)
+	fs.StringVar(&cfg.Listen, "listen", ":18789", "listen address (host:port or unix:<path>)")
+	fs.StringVar(&cfg.Backend, "backend", "http://127.0.0.1:18790", "backend gateway base URL(s), comma-separated for a sticky pool, unix:<path>, or echo:// for the built-in mock gateway")
+	fs.StringVar(&cfg.StickyCookie, "sticky-cookie", "clawdbot_backend", "affinity cookie name used with multiple backends")
+	fs.StringVar(&cfg.StickySecret, "sticky-secret", "", "HMAC secret signing the affinity cookie (empty = random per start)")
+	fs.DurationVar(&cfg.DiscoveryInterval, "discovery-interval", 30*time.Second, "re-resolution interval for dynamic backend discovery")
+	fs.StringVar(&cfg.Discovery, "discovery", "", "service registry watch feeding the backend pool (consul://host:port/service)")
+	fs.StringVar(&cfg.MirrorBackend, "mirror-backend", "", "shadow backend URL receiving mirrored requests (responses discarded)")
+	fs.IntVar(&cfg.MirrorPercent, "mirror-percent", 100, "percentage of backend requests to mirror (0-100)")
+	fs.StringVar(&cfg.CanaryBackend, "canary-backend", "", "canary gateway URL receiving a weighted share of traffic")
+	fs.IntVar(&cfg.CanaryPercent, "canary-percent", 5, "percentage of backend requests routed to the canary (0-100)")
+	fs.StringVar(&cfg.BlueBackend, "backend-blue", "", "blue backend set URL (blue/green switching)")
+	fs.StringVar(&cfg.GreenBackend, "backend-green", "", "green backend set URL (blue/green switching)")
+	fs.StringVar(&cfg.ActiveSet, "active-set", "blue", "backend set receiving traffic at startup (blue or green)")
+	fs.DurationVar(&cfg.SwitchDrain, "switch-drain", 30*time.Second, "grace period before old-set WebSocket sessions are force-closed after a switch")
+	socketMode := fs.String("unix-socket-mode", "0660", "permissions for a unix listener socket (octal)")
+	fs.StringVar(&cfg.RouteFile, "routes", "", "routing rules file; empty uses the built-in /api/ and /ws routes")
+	fs.StringVar(&cfg.VHostFile, "vhosts", "", "virtual host (site) definitions file")
+	fs.StringVar(&cfg.StaticDir, "static", "", "static file directory for the Control UI; overrides a UI embedded at build time")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "TLS certificate file; enables HTTPS and HTTP/2 on the listener")
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "TLS private key file")
+	fs.BoolVar(&cfg.ProxyProtocol, "proxy-protocol", false, "require PROXY protocol v1/v2 headers from the load balancer")
+	fs.StringVar(&cfg.AdminListen, "admin-listen", "", "admin API listen address (e.g. 127.0.0.1:18791); empty disables")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", 15*time.Second, "HTTP read timeout")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", 30*time.Second, "HTTP write timeout")
+	fs.DurationVar(&cfg.DrainTimeout, "drain-timeout", 30*time.Second, "graceful shutdown drain period")
+	fs.Float64Var(&cfg.RateLimitRPS, "rate-limit", 50, "per-IP request rate limit (requests/sec)")
+	fs.IntVar(&cfg.RateLimitBurst, "rate-limit-burst", 100, "per-IP rate limit burst")
+	fs.IntVar(&cfg.RateLimitMaxEntries, "rate-limit-max-entries", rateLimitMaxEntries, "max tracked rate limit buckets before LRU eviction")
+	fs.DurationVar(&cfg.RateLimitIdleTTL, "rate-limit-idle-ttl", rateLimitIdleTTL, "drop rate limit buckets idle longer than this")
+	fs.Float64Var(&cfg.RateLimitAuthRPS, "rate-limit-auth", 0, "per-identity rate limit for authenticated requests (0 = same as -rate-limit)")
+	fs.IntVar(&cfg.RateLimitAuthBurst, "rate-limit-auth-burst", 0, "burst for -rate-limit-auth")
+	trustedProxies := fs.String("trusted-proxies", "", "comma-separated CIDRs of proxies whose X-Forwarded-For is trusted")
+	apiKeys := fs.String("api-keys", "", "comma-separated API keys required on /api/*")
+	fs.StringVar(&cfg.APIKeyFile, "api-key-file", "", "file with one API key per line: <key> [rps [burst]]")
+	fs.StringVar(&cfg.HtpasswdFile, "htpasswd", "", "htpasswd file enabling HTTP Basic auth (plain, SHA, or apr1 entries)")
+	basicAuthPaths := fs.String("basic-auth-paths", "/", "comma-separated path prefixes protected by Basic auth")
+	fs.StringVar(&cfg.BasicAuthRealm, "basic-auth-realm", "Clawdbot", "realm announced in Basic auth challenges")
+	fs.StringVar(&cfg.ACLFile, "acl-file", "", "file with allow/deny CIDR rules per path prefix")
+	fs.StringVar(&cfg.JWTSecret, "jwt-secret", "", "shared secret for HS256 JWT validation")
+	fs.StringVar(&cfg.JWTJWKSURL, "jwt-jwks-url", "", "JWKS URL for RS256 JWT validation")
+	jwtPaths := fs.String("jwt-paths", "/api/", "comma-separated path prefixes requiring a valid JWT (when a secret or JWKS URL is set)")
+	fs.StringVar(&cfg.OIDCIssuer, "oidc-issuer", "", "OIDC issuer URL enabling login at the proxy (requires client id/secret and cookie secret)")
+	fs.StringVar(&cfg.OIDCClientID, "oidc-client-id", "", "OIDC client id registered at the IdP")
+	fs.StringVar(&cfg.OIDCClientSecret, "oidc-client-secret", "", "OIDC client secret")
+	fs.StringVar(&cfg.OIDCCookieSecret, "oidc-cookie-secret", "", "secret encrypting the OIDC session cookie")
+	fs.StringVar(&cfg.OIDCScopes, "oidc-scopes", "openid profile email", "scopes requested from the IdP")
+	oidcPaths := fs.String("oidc-paths", "/", "comma-separated path prefixes requiring an OIDC login (when -oidc-issuer is set)")
+	fs.StringVar(&cfg.ClientCAFile, "client-ca", "", "require client certificates signed by this CA bundle (mTLS)")
+	fs.StringVar(&cfg.ClientCRLFile, "client-crl", "", "CRL file (PEM or DER) for client certificate revocation")
+	fs.StringVar(&cfg.UpstreamCAFile, "upstream-ca", "", "CA bundle for verifying an HTTPS backend")
+	fs.StringVar(&cfg.UpstreamClientCert, "upstream-client-cert", "", "client certificate presented to the backend (mTLS)")
+	fs.StringVar(&cfg.UpstreamClientKey, "upstream-client-key", "", "private key for -upstream-client-cert")
+	fs.BoolVar(&cfg.UpstreamSkipVerify, "upstream-insecure-skip-verify", false, "skip backend certificate verification (development only)")
+	fs.IntVar(&cfg.PoolMaxIdle, "pool-max-idle", 100, "maximum idle backend connections across all hosts")
+	fs.IntVar(&cfg.PoolMaxIdlePerHost, "pool-max-idle-per-host", 32, "maximum idle backend connections per host")
+	fs.IntVar(&cfg.PoolMaxPerHost, "pool-max-per-host", 0, "hard cap on backend connections per host (0 = unlimited)")
+	fs.DurationVar(&cfg.IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "how long idle backend connections are kept")
+	fs.DurationVar(&cfg.DialTimeout, "dial-timeout", 10*time.Second, "backend dial timeout")
+	fs.DurationVar(&cfg.DialKeepAlive, "dial-keepalive", 30*time.Second, "TCP keep-alive interval on backend connections")
+	fs.DurationVar(&cfg.TLSHandshakeTimeout, "tls-handshake-timeout", 10*time.Second, "TLS handshake timeout toward the backend")
+	fs.IntVar(&cfg.RetryAttempts, "retry-attempts", 2, "retries for failed idempotent backend requests (0 disables)")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", 100*time.Millisecond, "base backoff between backend retries")
+	fs.DurationVar(&cfg.RetryBudget, "retry-budget", 2*time.Second, "total time budget for retrying one request")
+	fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", 5, "consecutive backend failures before the circuit opens (0 disables)")
+	fs.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", 10*time.Second, "how long the circuit stays open before probing")
+	fs.BoolVar(&cfg.CacheEnabled, "cache", false, "cache backend GET responses in memory")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", 5*time.Second, "default cache TTL when the backend sends no max-age")
+	fs.IntVar(&cfg.CacheMaxEntries, "cache-max-entries", 1024, "maximum number of cached responses")
+	fs.IntVar(&cfg.CacheMaxBody, "cache-max-body", 1<<20, "largest response body to cache, in bytes")
+	corsOrigins := fs.String("cors-origins", "", `comma-separated allowed CORS origins (exact, "*", or *.suffix); empty disables CORS handling`)
+	corsMethods := fs.String("cors-methods", "GET,POST,PUT,PATCH,DELETE", "methods allowed on CORS preflights")
+	corsHeaders := fs.String("cors-headers", "Content-Type,Authorization,X-API-Key,X-Request-ID", "request headers allowed on CORS preflights")
+	fs.BoolVar(&cfg.CORSCredentials, "cors-credentials", false, "allow credentialed CORS requests")
+	fs.DurationVar(&cfg.CORSMaxAge, "cors-max-age", 10*time.Minute, "how long browsers may cache preflight results")
+	fs.StringVar(&cfg.SecurityPreset, "security-headers", "", `security header preset: "strict" or empty to disable`)
+	fs.StringVar(&cfg.SecurityCSP, "security-csp", "", "override the preset Content-Security-Policy value")
+	fs.BoolVar(&cfg.Compress, "compress", true, "compress eligible responses (gzip)")
+	fs.IntVar(&cfg.CompressMinSize, "compress-min-size", 1024, "minimum body size in bytes before compressing")
+	compressTypes := fs.String("compress-types", defaultCompressTypes, "comma-separated content types eligible for compression")
+	disableMiddleware := fs.String("disable-middleware", "", "comma-separated built-in middleware to skip (request-id, access-log, trace, cors, security-headers, compress)")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", 5*time.Second, "maximum time to read a request's headers")
+	fs.Float64Var(&cfg.MinBodyRate, "min-body-rate", 0, "minimum request body transfer rate in bytes/sec (0 disables)")
+	fs.IntVar(&cfg.MaxConnsPerIP, "max-conns-per-ip", 0, "maximum concurrent connections per client IP (0 disables)")
+	staticListDirs := fs.String("static-list-dirs", "", "comma-separated URL path prefixes with directory listings enabled")
+	fs.StringVar(&cfg.NotFoundPage, "static-404", "", "custom 404 page served instead of the index.html fallback")
+	fs.StringVar(&cfg.StaticCacheControl, "static-cache-control", "", `per-extension Cache-Control rules (".js=public, max-age=600;index.html=no-store"); empty uses built-in defaults`)
+	fs.Float64Var(&cfg.BandwidthRate, "bandwidth-limit", 0, "egress bandwidth cap per client in bytes/sec (0 disables)")
+	fs.IntVar(&cfg.MaxInflight, "max-inflight", 0, "maximum concurrent backend requests (0 disables the gate)")
+	fs.IntVar(&cfg.MaxInflightPerClient, "max-inflight-per-client", 0, "maximum concurrent backend requests per client IP (0 disables)")
+	fs.IntVar(&cfg.QueueDepth, "queue-depth", 100, "requests allowed to wait for a free backend slot")
+	fs.DurationVar(&cfg.QueueTimeout, "queue-timeout", 2*time.Second, "longest a queued request waits before 503")
+	fs.Int64Var(&cfg.MaxBodyBytes, "max-body", 0, "maximum request body size in bytes (0 disables)")
+	bodyLimits := fs.String("max-body-paths", "", `comma-separated per-prefix body limits ("/api/files/=104857600"); longest prefix wins`)
+	fs.StringVar(&cfg.MaintenanceFile, "maintenance-file", "", "sentinel file; maintenance mode is on while it exists")
+	fs.StringVar(&cfg.MaintenancePage, "maintenance-page", "", "file served as the 503 body during maintenance (HTML or JSON)")
+	wsOrigins := fs.String("ws-origins", "", "comma-separated allowed origins for WebSocket upgrades and API requests; empty allows all")
+	fs.DurationVar(&cfg.WSPingInterval, "ws-ping-interval", 30*time.Second, "WebSocket keepalive ping interval (0 disables pings)")
+	fs.DurationVar(&cfg.WSIdleTimeout, "ws-idle-timeout", 5*time.Minute, "close WebSocket sessions idle for longer than this")
+	fs.Int64Var(&cfg.WSMaxMessage, "ws-max-message", 0, "maximum WebSocket message size from clients in bytes (0 disables)")
+	fs.StringVar(&cfg.GeoIPDB, "geoip-db", "", "MaxMind country database for request tagging")
+	fs.StringVar(&cfg.GeoIPASNDB, "geoip-asn-db", "", "MaxMind ASN database for request tagging")
+	fs.BoolVar(&cfg.WAF, "waf", false, "inspect requests against the bundled WAF ruleset")
+	fs.StringVar(&cfg.WAFRuleFile, "waf-rules", "", "additional WAF rules, one per line")
+	fs.IntVar(&cfg.BanThreshold, "ban-threshold", 0, "offenses within -ban-window that earn an automatic ban (0 disables)")
+	fs.DurationVar(&cfg.BanWindow, "ban-window", time.Minute, "sliding window for counting offenses")
+	fs.DurationVar(&cfg.BanDuration, "ban-duration", 10*time.Minute, "first ban length; repeat bans double up to 24h")
+	fs.StringVar(&cfg.BanFile, "ban-file", "", "persist the ban list to this file")
+	readyChecks := fs.String("ready-checks", "", "comma-separated /readyz checks: backend, static, cert, conns (empty runs all)")
+	fs.BoolVar(&cfg.WaitBackend, "wait-backend", false, "report not ready on /ready until the backend answers a startup probe")
+	fs.StringVar(&cfg.ErrorPageDir, "error-pages", "", "directory of HTML templates overriding the built-in error page")
+	listenInterfaces := fs.String("listen-interfaces", "", `comma-separated interfaces to bind instead of the -listen host (e.g. "tailscale0,lo"); the -listen port is reused`)
+	fs.StringVar(&cfg.ListenFamily, "listen-family", "any", "restrict main listener binding to an IP family: any, ipv4, or ipv6")
+	fs.StringVar(&cfg.RedirectHTTP, "redirect-http", "", "plain-HTTP listener answering 301s to the TLS side (e.g. :80); empty disables")
+	fs.StringVar(&cfg.ACMEWebroot, "acme-webroot", "", "webroot serving /.well-known/acme-challenge/ files on the redirect listener")
+	fs.IntVar(&cfg.HSTSMaxAge, "hsts-max-age", 63072000, "Strict-Transport-Security max-age in seconds on TLS responses (0 disables)")
+	fs.BoolVar(&cfg.HSTSSubdomains, "hsts-subdomains", true, "include includeSubDomains in the HSTS header")
+	fs.BoolVar(&cfg.HSTSPreload, "hsts-preload", false, "include preload in the HSTS header (requires subdomains and max-age >= 1 year)")
+	listeners := fs.String("listeners", "", `comma-separated extra listeners as name=addr with /tls, /no-auth, /no-ratelimit options (e.g. "lan=127.0.0.1:18791/no-auth")`)
+	fs.StringVar(&cfg.ExtAuthzURL, "ext-authz-url", "", "external HTTP authorization service consulted per backend request")
+	fs.DurationVar(&cfg.ExtAuthzTimeout, "ext-authz-timeout", 2*time.Second, "timeout for external authorization checks")
+	fs.BoolVar(&cfg.ExtAuthzFailOpen, "ext-authz-fail-open", false, "allow requests when the external authorizer is unreachable (default deny with 503)")
+	fs.DurationVar(&cfg.ExtAuthzCacheTTL, "ext-authz-cache-ttl", 10*time.Second, "how long authorization decisions are cached (0 disables caching)")
+	wasmPlugins := fs.String("wasm-plugins", "", "comma-separated WebAssembly filter modules as <path>=<hook> (hooks: on-request, on-response, on-ws-message)")
+	fs.StringVar(&cfg.OpenAPISpec, "openapi-spec", "", "OpenAPI 3 JSON spec; backend requests must match a documented operation")
+	fs.IntVar(&cfg.CaptureMaxBody, "capture-max-body", 64*1024, "truncate captured request/response bodies at this many bytes")
+	fs.StringVar(&cfg.CaptureFile, "capture-file", "", "mirror captured exchanges to this file as JSON lines")
+	fs.StringVar(&cfg.TransformFile, "transform-file", "", "named JSON body transforms for req-transform=/resp-transform= route tokens")
+	fs.BoolVar(&cfg.CSRFProtect, "csrf-protect", false, "reject cross-site state-changing /api/ requests that carry the session cookie")
+	fs.StringVar(&cfg.CSRFCookie, "csrf-cookie", csrfSessionCookieDefault, "session cookie name that marks browser-originated requests")
+	csrfOrigins := fs.String("csrf-origins", "", "comma-separated extra hosts allowed as request origins")
+	fs.BoolVar(&cfg.BotDetect, "bot-detect", false, "classify clients as bots/scanners and tag requests")
+	fs.Float64Var(&cfg.BotRate, "bot-rate", 0, "per-IP requests/second for clients classified as bots (0 disables)")
+	fs.Float64Var(&cfg.ScannerRate, "scanner-rate", 0, "per-IP requests/second for clients classified as scanners (0 disables)")
+	fs.BoolVar(&cfg.OutlierDetection, "outlier-detection", false, "shed traffic from statistically degraded pool targets")
+	fs.DurationVar(&cfg.FlushInterval, "flush-interval", 0, "default response flush cadence (negative = after every write, 0 = stdlib default)")
+	fs.DurationVar(&cfg.SSEHeartbeat, "sse-heartbeat", 15*time.Second, "inject SSE keepalive comments into quiet streams this often (0 disables)")
+	fs.DurationVar(&cfg.SSEIdleTimeout, "sse-idle-timeout", 5*time.Minute, "cancel SSE streams whose backend is silent this long (0 disables)")
+	fs.DurationVar(&cfg.WSResumeGrace, "ws-resume-grace", 0, "keep backend WebSocket connections alive this long after a client drops (0 disables)")
+	fs.Int64Var(&cfg.WSResumeBuffer, "ws-resume-buffer", 256<<10, "bytes of backend WebSocket messages buffered per parked session")
+	fs.Float64Var(&cfg.WSMsgRate, "ws-msg-rate", 0, "maximum client WebSocket messages per second per session (0 disables)")
+	fs.Float64Var(&cfg.WSByteRate, "ws-byte-rate", 0, "maximum client WebSocket payload bytes per second per session (0 disables)")
+	fs.BoolVar(&cfg.WSCompression, "ws-compression", false, "negotiate WebSocket permessage-deflate (passthrough or proxy-terminated)")
+	fs.IntVar(&cfg.WSCompressionLevel, "ws-compression-level", 6, "deflate level for proxy-terminated WebSocket compression (1-9)")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "log level: debug, info, warn, error")
+	fs.BoolVar(&cfg.Daemon, "daemon", false, "detach and run in the background (not on Windows)")
+	fs.StringVar(&cfg.PidFile, "pidfile", "", "write the pid to this file; refuse to start if it names a live process")
+	fs.StringVar(&cfg.LogFile, "log-file", "", "write the process log to this file (reopened on SIGUSR1); empty logs to stdout")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector base URL for trace export (empty disables tracing)")
+	fs.Float64Var(&cfg.TraceSampleRate, "trace-sample", 1.0, "fraction of requests to trace (0..1)")
+	fs.StringVar(&cfg.AccessLogFile, "access-log", "", "write JSON access log to this file (with rotation); empty logs to console")
+	accessLogMaxMB := fs.Int64("access-log-max-size", 100, "rotate the access log after this many MB")
+	fs.IntVar(&cfg.AccessLogKeep, "access-log-keep", 5, "rotated access log files to keep")
+	fs.BoolVar(&cfg.AccessLogCompress, "access-log-compress", true, "gzip rotated access log files")
+	fs.IntVar(&cfg.AccessLogSample, "access-log-sample", 1, "log 1 in N successful (<400) requests; errors are always logged")
+	fs.StringVar(&cfg.AuditLogFile, "audit-log", "", "write security events (admin calls, auth failures, bans) to this JSON file")
+	fs.StringVar(&cfg.AuditLogSecret, "audit-log-secret", "", "HMAC secret chaining audit entries for tamper evidence")
+	webhookURLs := fs.String("webhook-urls", "", "comma-separated URLs receiving operational event webhooks")
+	fs.StringVar(&cfg.WebhookSecret, "webhook-secret", "", "HMAC secret signing webhook payloads (X-Claw-Signature)")
+	fs.StringVar(&cfg.StatsDAddr, "statsd", "", "StatsD/DogStatsD UDP address mirroring all metrics (host:port; empty disables)")
+	fs.StringVar(&cfg.StatsDPrefix, "statsd-prefix", "clawdbot.proxy.", "metric name prefix for the StatsD sink")
+	fs.Float64Var(&cfg.StatsDSampleRate, "statsd-sample", 1.0, "sample rate for StatsD counters and timings (0..1]")
+	statsdTags := fs.String("statsd-tags", "", "comma-separated global tags for the StatsD sink (tag:value)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	// Environment overrides apply before the comma-list flags below are
+	// read, so CLAWDBOT_PROXY_* reaches every option.
+	sources, err := applyEnvFlags(fs)
+	if err != nil {
+		return nil, err
+	}
+	cfg.sources = sources
+	cfg.CompressTypes = splitCommaList(*compressTypes)
+	cfg.DisableMiddleware = splitCommaList(*disableMiddleware)
+	cfg.WasmPlugins = splitCommaList(*wasmPlugins)
+	cfg.Listeners = splitCommaList(*listeners)
+	cfg.ListenInterfaces = splitCommaList(*listenInterfaces)
+	cfg.JWTAuthPaths = splitCommaList(*jwtPaths)
+	cfg.OIDCPaths = splitCommaList(*oidcPaths)
+	cfg.APIKeys = splitCommaList(*apiKeys)
+	cfg.TrustedProxies = splitCommaList(*trustedProxies)
+	cfg.CORSOrigins = splitCommaList(*corsOrigins)
+	cfg.CORSMethods = splitCommaList(*corsMethods)
+	cfg.CORSHeaders = splitCommaList(*corsHeaders)
+	cfg.WSOrigins = splitCommaList(*wsOrigins)
+	cfg.BodyLimits = splitCommaList(*bodyLimits)
+	cfg.StaticListDirs = splitCommaList(*staticListDirs)
+	cfg.BasicAuthPaths = splitCommaList(*basicAuthPaths)
+	cfg.CSRFOrigins = splitCommaList(strings.ToLower(*csrfOrigins))
+	cfg.ReadyChecks = splitCommaList(*readyChecks)
+	cfg.StatsDTags = splitCommaList(*statsdTags)
+	cfg.WebhookURLs = splitCommaList(*webhookURLs)
+	cfg.AccessLogMaxSize = *accessLogMaxMB << 20
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unix-socket-mode %q: %w", *socketMode, err)
+	}
+	cfg.UnixSocketMode = os.FileMode(mode)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configSource records where an option's effective value came from, for
+// the startup log.
+type configSource struct {
+	source string // "flag" or "env"
+	value  string
+}
+
+// applyEnvFlags overrides flags from the environment: every option maps
+// to CLAWDBOT_PROXY_<NAME> with dashes as underscores (-rate-limit →
+// CLAWDBOT_PROXY_RATE_LIMIT). Precedence is defaults < flags <
+// environment, so container and systemd deployments can override a
+// baked-in command line. Returns which source set each non-default value.
+func applyEnvFlags(fs *flag.FlagSet) (map[string]configSource, error) {
+	sources := make(map[string]configSource)
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = configSource{source: "flag"}
+	})
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := "CLAWDBOT_PROXY_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, v); err != nil && envErr == nil {
+			envErr = fmt.Errorf("%s=%q: %v", env, v, err)
+		}
+		sources[f.Name] = configSource{source: "env"}
+	})
+	for name, src := range sources {
+		src.value = fs.Lookup(name).Value.String()
+		sources[name] = src
+	}
+	return sources, envErr
+}
+
+// logSources writes one line per option that was set explicitly, so the
+// startup log shows where the effective configuration came from. Values
+// of secret-bearing options are not logged.
+func (c *Config) logSources(log *slog.Logger) {
+	names := make([]string, 0, len(c.sources))
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		src := c.sources[name]
+		value := src.value
+		if strings.Contains(name, "secret") || name == "api-keys" {
+			value = "[redacted]"
+		}
+		log.Info("config option", "option", name, "value", value, "source", src.source)
+	}
+}
+
+func (c *Config) validate() error {
+	if c.Backend == "" {
+		return fmt.Errorf("backend URL is required")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls-cert and tls-key must be set together")
+	}
+	switch c.ListenFamily {
+	case "", "any", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("listen-family must be any, ipv4, or ipv6")
+	}
+	restricted := c.ListenFamily == "ipv4" || c.ListenFamily == "ipv6"
+	if (len(c.ListenInterfaces) > 0 || restricted) && strings.HasPrefix(c.Listen, "unix:") {
+		return fmt.Errorf("listen-interfaces and listen-family do not apply to unix sockets")
+	}
+	if c.HSTSPreload && (!c.HSTSSubdomains || c.HSTSMaxAge < 31536000) {
+		return fmt.Errorf("hsts-preload requires hsts-subdomains and hsts-max-age >= 31536000 (the preload list rules)")
+	}
+	if c.ExtAuthzURL != "" && (c.ExtAuthzTimeout <= 0 || c.ExtAuthzCacheTTL < 0) {
+		return fmt.Errorf("ext-authz-timeout must be > 0 and ext-authz-cache-ttl >= 0")
+	}
+	for _, name := range c.DisableMiddleware {
+		if !slices.Contains(builtinMiddlewareNames, name) {
+			return fmt.Errorf("disable-middleware: unknown middleware %q (known: %s)", name, strings.Join(builtinMiddlewareNames, ", "))
+		}
+	}
+	if c.WSPingInterval < 0 || c.WSIdleTimeout <= 0 {
+		return fmt.Errorf("ws-ping-interval must be >= 0 and ws-idle-timeout > 0")
+	}
+	if c.WSPingInterval > 0 && c.WSPingInterval >= c.WSIdleTimeout {
+		return fmt.Errorf("ws-ping-interval (%s) must be shorter than ws-idle-timeout (%s)", c.WSPingInterval, c.WSIdleTimeout)
+	}
+	if c.WSMaxMessage < 0 {
+		return fmt.Errorf("ws-max-message must be >= 0")
+	}
+	if c.WSCompressionLevel < 1 || c.WSCompressionLevel > 9 {
+		return fmt.Errorf("ws-compression-level must be between 1 and 9")
+	}
+	if c.WSMsgRate < 0 || c.WSByteRate < 0 {
+		return fmt.Errorf("ws-msg-rate and ws-byte-rate must be >= 0")
+	}
+	if c.WSResumeGrace < 0 || c.WSResumeBuffer <= 0 {
+		return fmt.Errorf("ws-resume-grace must be >= 0 and ws-resume-buffer > 0")
+	}
+	if c.SSEHeartbeat < 0 || c.SSEIdleTimeout < 0 {
+		return fmt.Errorf("sse-heartbeat and sse-idle-timeout must be >= 0")
+	}
+	if c.WAFRuleFile != "" && !c.WAF {
+		return fmt.Errorf("waf-rules requires -waf")
+	}
+	if c.BanThreshold < 0 {
+		return fmt.Errorf("ban-threshold must be >= 0")
+	}
+	if c.BanThreshold > 0 && (c.BanWindow <= 0 || c.BanDuration <= 0) {
+		return fmt.Errorf("ban-window and ban-duration must be > 0")
+	}
+	if c.BotRate < 0 || c.ScannerRate < 0 {
+		return fmt.Errorf("bot-rate and scanner-rate must be >= 0")
+	}
+	if (c.BotRate > 0 || c.ScannerRate > 0) && !c.BotDetect {
+		return fmt.Errorf("bot-rate and scanner-rate require -bot-detect")
+	}
+	if c.CSRFProtect && c.CSRFCookie == "" {
+		return fmt.Errorf("csrf-protect requires a -csrf-cookie name")
+	}
+	for _, name := range c.ReadyChecks {
+		if !readyCheckNames[name] {
+			return fmt.Errorf("unknown ready check %q", name)
+		}
+	}
+	if c.StatsDSampleRate <= 0 || c.StatsDSampleRate > 1 {
+		return fmt.Errorf("statsd-sample must be in (0, 1]")
+	}
+	if c.AccessLogSample < 1 {
+		return fmt.Errorf("access-log-sample must be >= 1")
+	}
+	if c.RateLimitMaxEntries < 1 {
+		return fmt.Errorf("rate-limit-max-entries must be >= 1")
+	}
+	if c.RateLimitIdleTTL <= 0 {
+		return fmt.Errorf("rate-limit-idle-ttl must be positive")
+	}
+	if c.RateLimitAuthRPS > 0 && c.RateLimitAuthBurst < 1 {
+		return fmt.Errorf("rate-limit-auth requires rate-limit-auth-burst >= 1")
+	}
+	return nil
+}
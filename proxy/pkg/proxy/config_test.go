@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func TestEnvOverridesEveryFlag(t *testing.T) {
+	t.Setenv("CLAWDBOT_PROXY_RATE_LIMIT", "99")
+	t.Setenv("CLAWDBOT_PROXY_CORS_ORIGINS", "https://a.example,https://b.example")
+	t.Setenv("CLAWDBOT_PROXY_READ_TIMEOUT", "42s")
+
+	cfg, err := parseConfig([]string{"-backend", "http://127.0.0.1:18080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimitRPS != 99 {
+		t.Fatalf("RateLimitRPS = %v", cfg.RateLimitRPS)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.CORSOrigins[0] != "https://a.example" {
+		t.Fatalf("CORSOrigins = %v", cfg.CORSOrigins)
+	}
+	if cfg.ReadTimeout.Seconds() != 42 {
+		t.Fatalf("ReadTimeout = %v", cfg.ReadTimeout)
+	}
+}
+
+func TestEnvBeatsFlag(t *testing.T) {
+	t.Setenv("CLAWDBOT_PROXY_LISTEN", ":9999")
+	cfg, err := parseConfig([]string{"-backend", "http://127.0.0.1:18080", "-listen", ":1111"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":9999" {
+		t.Fatalf("Listen = %q, want env to win", cfg.Listen)
+	}
+	if src := cfg.sources["listen"]; src.source != "env" || src.value != ":9999" {
+		t.Fatalf("source = %+v", src)
+	}
+	if src := cfg.sources["backend"]; src.source != "flag" {
+		t.Fatalf("backend source = %+v", src)
+	}
+}
+
+func TestEnvRejectsBadValues(t *testing.T) {
+	t.Setenv("CLAWDBOT_PROXY_RATE_LIMIT", "not-a-number")
+	if _, err := parseConfig([]string{"-backend", "http://127.0.0.1:18080"}); err == nil {
+		t.Fatal("bad env value accepted")
+	}
+}
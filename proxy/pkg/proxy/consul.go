@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Registry-based backend discovery: "-discovery consul://host:port/service"
+// watches a Consul service with blocking queries and feeds the instance
+// list into the sticky pool from lb.go. Only passing instances are used,
+// so registry health checks eject bad gateways without proxy config. etcd
+// is not supported — its v3 API is gRPC-only, which would pull in a
+// client dependency this binary deliberately avoids.
+
+// consulWait is the blocking-query hold time; Consul answers earlier the
+// moment the service changes.
+const consulWait = 55 * time.Second
+
+type consulDiscovery struct {
+	base    string // http://host:port of the Consul agent
+	service string
+	pool    *backendPool
+	client  *http.Client
+	metrics *Metrics
+	log     *slog.Logger
+
+	index     string // X-Consul-Index watermark for blocking queries
+	lastHosts string
+}
+
+// parseDiscovery understands the -discovery flag. Unsupported schemes get
+// an actionable error instead of a silent fallback.
+func parseDiscovery(raw string) (agent, service string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing -discovery: %w", err)
+	}
+	switch u.Scheme {
+	case "consul":
+		service = strings.Trim(u.Path, "/")
+		if u.Host == "" || service == "" || strings.Contains(service, "/") {
+			return "", "", fmt.Errorf("-discovery wants consul://host:port/service, got %q", raw)
+		}
+		return "http://" + u.Host, service, nil
+	case "etcd":
+		return "", "", fmt.Errorf("etcd discovery is not supported by this build (v3 API is gRPC-only); use consul:// or dns://")
+	default:
+		return "", "", fmt.Errorf("unsupported discovery scheme %q", u.Scheme)
+	}
+}
+
+func (p *ProxyServer) newConsulDiscovery(agent, service string) *consulDiscovery {
+	return &consulDiscovery{
+		base:    agent,
+		service: service,
+		pool:    p.lb,
+		client:  &http.Client{Timeout: consulWait + 15*time.Second},
+		metrics: p.metrics,
+		log:     p.log,
+	}
+}
+
+// consulEntry is the subset of /v1/health/service output we need.
+type consulEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// fetch runs one (possibly blocking) health query and returns the passing
+// instances. The index watermark makes the next call block until change.
+func (d *consulDiscovery) fetch(ctx context.Context, block bool) ([]*url.URL, error) {
+	q := url.Values{"passing": {"1"}}
+	if block && d.index != "" {
+		q.Set("index", d.index)
+		q.Set("wait", "55s")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		d.base+"/v1/health/service/"+url.PathEscape(d.service)+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul query: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul query: status %d", resp.StatusCode)
+	}
+	d.index = resp.Header.Get("X-Consul-Index")
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("parsing consul response: %w", err)
+	}
+	hosts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address // service registered without an address
+		}
+		if addr == "" || e.Service.Port == 0 {
+			continue
+		}
+		hosts = append(hosts, net.JoinHostPort(addr, strconv.Itoa(e.Service.Port)))
+	}
+	sort.Strings(hosts)
+	urls := make([]*url.URL, 0, len(hosts))
+	for _, h := range hosts {
+		urls = append(urls, &url.URL{Scheme: "http", Host: h})
+	}
+	return urls, nil
+}
+
+// refresh applies one query result to the pool.
+func (d *consulDiscovery) refresh(ctx context.Context, block bool) error {
+	urls, err := d.fetch(ctx, block)
+	if err != nil {
+		d.metrics.Inc(`clawdbot_proxy_discovery_errors_total`)
+		return err
+	}
+	hosts := make([]string, len(urls))
+	for i, u := range urls {
+		hosts[i] = u.Host
+	}
+	joined := strings.Join(hosts, ",")
+	if joined == d.lastHosts {
+		return nil
+	}
+	d.lastHosts = joined
+	d.pool.setTargets(urls)
+	d.metrics.Inc(`clawdbot_proxy_discovery_updates_total`)
+	d.log.Info("backend pool updated from consul", "service", d.service, "targets", len(urls))
+	return nil
+}
+
+// start runs the blocking-query watch loop for the life of the process.
+func (d *consulDiscovery) start() {
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), consulWait+20*time.Second)
+			err := d.refresh(ctx, true)
+			cancel()
+			if err != nil {
+				d.log.Warn("consul watch failed", "service", d.service, "error", err)
+				time.Sleep(5 * time.Second)
+			}
+		}
+	}()
+}
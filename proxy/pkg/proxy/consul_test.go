@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseDiscovery(t *testing.T) {
+	agent, service, err := parseDiscovery("consul://127.0.0.1:8500/clawdbot-gateway")
+	if err != nil {
+		t.Fatalf("parseDiscovery: %v", err)
+	}
+	if agent != "http://127.0.0.1:8500" || service != "clawdbot-gateway" {
+		t.Errorf("parsed %q %q", agent, service)
+	}
+	if _, _, err := parseDiscovery("etcd://127.0.0.1:2379/gateways"); err == nil {
+		t.Error("etcd:// must be rejected with a clear error")
+	}
+	if _, _, err := parseDiscovery("consul://127.0.0.1:8500"); err == nil {
+		t.Error("missing service name must be rejected")
+	}
+}
+
+func TestConsulRefreshUpdatesPool(t *testing.T) {
+	var generation atomic.Int32
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/gw" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("passing") != "1" {
+			t.Error("query should ask for passing instances only")
+		}
+		w.Header().Set("X-Consul-Index", "7")
+		if generation.Load() == 0 {
+			fmt.Fprint(w, `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"10.0.0.1","Port":18790}}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"10.0.0.1","Port":18790}},
+			{"Node":{"Address":"10.0.0.2"},"Service":{"Address":"","Port":18790}}]`)
+	}))
+	defer consul.Close()
+
+	p := newTestProxy(t, &Config{Backend: "http://127.0.0.1:0", StickyCookie: "clawdbot_backend"})
+	p.lb = p.newBackendPool(nil)
+	d := p.newConsulDiscovery(consul.URL, "gw")
+
+	if err := d.refresh(context.Background(), false); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got := len(p.lb.targets()); got != 1 {
+		t.Fatalf("pool size = %d, want 1", got)
+	}
+	if d.index != "7" {
+		t.Errorf("index watermark = %q, want 7", d.index)
+	}
+
+	// Scale-up appears on the next refresh; the node address backs a
+	// service registered without its own.
+	generation.Store(1)
+	if err := d.refresh(context.Background(), false); err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+	ts := p.lb.targets()
+	if len(ts) != 2 {
+		t.Fatalf("pool size after scale-up = %d, want 2", len(ts))
+	}
+	if ts[1].url.Host != "10.0.0.2:18790" {
+		t.Errorf("fallback address = %q, want node address", ts[1].url.Host)
+	}
+}
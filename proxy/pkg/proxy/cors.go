@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// corsPolicy answers cross-origin requests at the proxy so the Node gateway
+// never has to implement CORS itself.
+type corsPolicy struct {
+	origins     []string // exact origins, "*", or "*.suffix" host patterns
+	methods     string   // comma-joined, served verbatim on preflights
+	headers     string
+	credentials bool
+	maxAge      int // seconds
+}
+
+func newCORSPolicy(cfg *Config) *corsPolicy {
+	if len(cfg.CORSOrigins) == 0 {
+		return nil
+	}
+	return &corsPolicy{
+		origins:     cfg.CORSOrigins,
+		methods:     strings.Join(cfg.CORSMethods, ", "),
+		headers:     strings.Join(cfg.CORSHeaders, ", "),
+		credentials: cfg.CORSCredentials,
+		maxAge:      int(cfg.CORSMaxAge.Seconds()),
+	}
+}
+
+func (c *corsPolicy) originAllowed(origin string) bool {
+	return originAllowed(c.origins, origin)
+}
+
+// originAllowed matches an Origin header against allowlist patterns.
+// "*.suffix" patterns compare the origin's hostname, everything else the
+// full origin string.
+func originAllowed(patterns []string, origin string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			if u, err := url.Parse(origin); err == nil && hostMatches(pattern, strings.ToLower(u.Hostname())) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cors handles preflights and decorates responses for allowed origins.
+// Requests from disallowed origins pass through without CORS headers (the
+// browser enforces the block); their preflights are answered with 403 so the
+// failure is visible.
+func (p *ProxyServer) cors(next http.Handler) http.Handler {
+	c := p.corsPolicy
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Responses differ by Origin either way; keep caches honest.
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !c.originAllowed(origin) {
+			if preflight {
+				p.httpError(w, r, http.StatusForbidden, "origin not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if c.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", c.methods)
+		w.Header().Set("Access-Control-Allow-Headers", c.headers)
+		if c.maxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.maxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func corsProxy(t *testing.T, origins string) http.Handler {
+	t.Helper()
+	cfg, err := parseConfig([]string{"-cors-origins", origins, "-cors-credentials"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.CORSMaxAge = 5 * time.Minute
+	p := &ProxyServer{corsPolicy: newCORSPolicy(cfg)}
+	return p.cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestCORSPreflightShortCircuit(t *testing.T) {
+	h := corsProxy(t, "https://app.claw.example")
+	r := httptest.NewRequest(http.MethodOptions, "/api/x", nil)
+	r.Header.Set("Origin", "https://app.claw.example")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d", rec.Code)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.claw.example" {
+		t.Errorf("allow-origin = %q", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec.Header().Get("Access-Control-Allow-Methods") == "" || rec.Header().Get("Access-Control-Max-Age") != "300" {
+		t.Errorf("preflight headers = %v", rec.Header())
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("credentials header missing")
+	}
+}
+
+func TestCORSPreflightDisallowedOrigin(t *testing.T) {
+	h := corsProxy(t, "https://app.claw.example")
+	r := httptest.NewRequest(http.MethodOptions, "/api/x", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("allow-origin must not be set for disallowed origins")
+	}
+}
+
+func TestCORSSimpleRequestDecoration(t *testing.T) {
+	h := corsProxy(t, "*.claw.example")
+	r := httptest.NewRequest(http.MethodGet, "/api/x", nil)
+	r.Header.Set("Origin", "https://beta.claw.example")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://beta.claw.example" {
+		t.Errorf("allow-origin = %q", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+	}
+}
+
+func TestCORSNoOriginPassthrough(t *testing.T) {
+	h := corsProxy(t, "https://app.claw.example")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/x", nil))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Header().Get("Vary") != "" {
+		t.Errorf("same-origin requests must stay untouched, got %v", rec.Header())
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	p := &ProxyServer{
+		cfg:     &Config{WSOrigins: []string{"https://app.claw.example", "*.beta.claw.example"}},
+		metrics: NewMetrics(),
+		log:     discardLogger(),
+	}
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true}, // non-browser clients
+		{"https://app.claw.example", true},
+		{"https://x.beta.claw.example", true},
+		{"https://evil.example", false},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		rec := httptest.NewRecorder()
+		if got := p.checkOrigin(rec, r); got != tc.want {
+			t.Errorf("checkOrigin(origin=%q) = %v, want %v", tc.origin, got, tc.want)
+		}
+		if !tc.want && rec.Code != http.StatusForbidden {
+			t.Errorf("origin %q: status = %d, want 403", tc.origin, rec.Code)
+		}
+	}
+}
+
+func TestCheckOriginDisabledAllowsAll(t *testing.T) {
+	p := &ProxyServer{cfg: &Config{}}
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Origin", "https://anything.example")
+	if !p.checkOrigin(httptest.NewRecorder(), r) {
+		t.Error("empty allowlist must allow every origin")
+	}
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CSRF protection for browser-originated API calls. A cross-site form can
+// POST to /api/* and the browser will attach the UI session cookie, so
+// with -csrf-protect every state-changing request that carries the
+// session cookie must prove it came from our own origin: the Origin (or
+// Referer) host has to match the request host or one of -csrf-origins.
+// Requests without the cookie — CLI clients, API keys — are untouched,
+// and so are safe methods.
+
+// csrfSessionCookieDefault is the OIDC session cookie; -csrf-cookie
+// overrides it for gateways that issue their own.
+const csrfSessionCookieDefault = oidcSessionCookie
+
+// checkCSRF rejects cross-site state changes. Returns false when the
+// request was answered.
+func (p *ProxyServer) checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if !p.cfg.CSRFProtect {
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	if _, err := r.Cookie(p.cfg.CSRFCookie); err != nil {
+		return true // no browser session riding along, nothing to forge
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		if ref := r.Header.Get("Referer"); ref != "" {
+			if u, err := url.Parse(ref); err == nil && u.Host != "" {
+				origin = u.Scheme + "://" + u.Host
+			}
+		}
+	}
+	if origin == "" {
+		// Browsers always send Origin on cross-site state changes; when
+		// both it and Referer are absent, trust Sec-Fetch-Site if present.
+		switch r.Header.Get("Sec-Fetch-Site") {
+		case "", "same-origin", "none":
+			return true
+		}
+		return p.csrfReject(w, r, "cross-site fetch without origin")
+	}
+	if host := originHost(origin); host != "" {
+		if host == requestHost(r) {
+			return true
+		}
+		for _, allowed := range p.cfg.CSRFOrigins {
+			if host == allowed {
+				return true
+			}
+		}
+	}
+	return p.csrfReject(w, r, origin)
+}
+
+func (p *ProxyServer) csrfReject(w http.ResponseWriter, r *http.Request, origin string) bool {
+	p.metrics.Inc(`clawdbot_proxy_csrf_rejected_total`)
+	p.reqLog(r).Warn("cross-site request rejected",
+		"origin", origin, "path", r.URL.Path, "client", p.clientIP(r))
+	p.httpError(w, r, http.StatusForbidden, "cross-site request rejected")
+	return false
+}
+
+// originHost extracts the lowercased host (no port) from an Origin value.
+func originHost(origin string) string {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
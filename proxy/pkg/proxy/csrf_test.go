@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func csrfProxy(t *testing.T, extraOrigins ...string) *ProxyServer {
+	t.Helper()
+	return newTestProxy(t, &Config{
+		CSRFProtect: true,
+		CSRFCookie:  "clawdbot_session",
+		CSRFOrigins: extraOrigins,
+	})
+}
+
+func csrfRequest(method, origin string, withCookie bool) *http.Request {
+	req := httptest.NewRequest(method, "http://gateway.example/api/send", nil)
+	if withCookie {
+		req.AddCookie(&http.Cookie{Name: "clawdbot_session", Value: "s"})
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	return req
+}
+
+func TestCSRFRejectsCrossSitePost(t *testing.T) {
+	p := csrfProxy(t)
+	rec := httptest.NewRecorder()
+	if p.checkCSRF(rec, csrfRequest("POST", "http://evil.example", true)) {
+		t.Fatal("cross-site POST allowed")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_csrf_rejected_total`) != 1 {
+		t.Fatal("rejection not counted")
+	}
+}
+
+func TestCSRFAllowsSameOriginAndWhitelist(t *testing.T) {
+	p := csrfProxy(t, "app.example")
+	cases := []string{
+		"http://gateway.example",      // same host
+		"https://gateway.example:443", // port is ignored
+		"https://app.example",         // whitelisted via -csrf-origins
+	}
+	for _, origin := range cases {
+		if !p.checkCSRF(httptest.NewRecorder(), csrfRequest("POST", origin, true)) {
+			t.Errorf("origin %q rejected", origin)
+		}
+	}
+}
+
+func TestCSRFSkipsNonBrowserAndSafeRequests(t *testing.T) {
+	p := csrfProxy(t)
+	// No session cookie: a CLI client or API key call, not forgeable.
+	if !p.checkCSRF(httptest.NewRecorder(), csrfRequest("POST", "http://evil.example", false)) {
+		t.Fatal("cookieless request rejected")
+	}
+	// Safe method with the cookie is always fine.
+	if !p.checkCSRF(httptest.NewRecorder(), csrfRequest("GET", "http://evil.example", true)) {
+		t.Fatal("GET rejected")
+	}
+	// Non-API paths are out of scope.
+	req := csrfRequest("POST", "http://evil.example", true)
+	req.URL.Path = "/static/form"
+	if !p.checkCSRF(httptest.NewRecorder(), req) {
+		t.Fatal("non-API path rejected")
+	}
+}
+
+func TestCSRFUsesRefererAndSecFetchSite(t *testing.T) {
+	p := csrfProxy(t)
+	// Referer fallback when Origin is absent.
+	req := csrfRequest("POST", "", true)
+	req.Header.Set("Referer", "http://evil.example/form.html")
+	if p.checkCSRF(httptest.NewRecorder(), req) {
+		t.Fatal("cross-site referer allowed")
+	}
+	// Sec-Fetch-Site breaks the tie when both Origin and Referer are gone.
+	req = csrfRequest("POST", "", true)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	if p.checkCSRF(httptest.NewRecorder(), req) {
+		t.Fatal("cross-site fetch without origin allowed")
+	}
+	req = csrfRequest("POST", "", true)
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	if !p.checkCSRF(httptest.NewRecorder(), req) {
+		t.Fatal("same-origin fetch rejected")
+	}
+	// Neither header: an old client; let it through.
+	if !p.checkCSRF(httptest.NewRecorder(), csrfRequest("POST", "", true)) {
+		t.Fatal("headerless request rejected")
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Classic init-script support: -daemon detaches into the background,
+// -pidfile records the pid (refusing to start over a live one), and
+// -log-file sends the process log to a file that SIGUSR1 reopens so
+// logrotate can move it out of the way. Platform-specific pieces
+// (fork/setsid, pid liveness) live in daemon_unix.go / daemon_windows.go.
+
+// daemonEnv marks the detached child so it does not fork again.
+const daemonEnv = "CLAWDBOT_PROXY_DAEMON"
+
+// writePidFile records our pid at path. A pidfile left by a crashed
+// process is overwritten; one belonging to a running process is an error
+// so two proxies never fight over the same listener.
+func writePidFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, perr := strconv.Atoi(strings.TrimSpace(string(data))); perr == nil && pid > 0 && pid != os.Getpid() && pidAlive(pid) {
+			return fmt.Errorf("pidfile %s: process %d is still running", path, pid)
+		}
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+func removePidFile(path string) {
+	// Only remove a pidfile that is still ours; a restarting replacement
+	// may have already claimed it.
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, perr := strconv.Atoi(strings.TrimSpace(string(data))); perr == nil && pid != os.Getpid() {
+			return
+		}
+	}
+	os.Remove(path)
+}
+
+// logFileWriter is an append-only log destination whose file can be
+// reopened at runtime (SIGUSR1), the contract logrotate expects.
+type logFileWriter struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openLogFile(path string) (*logFileWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &logFileWriter{path: path, f: f}, nil
+}
+
+func (w *logFileWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Write(b)
+}
+
+// Reopen closes the current file and opens the path fresh; if the file was
+// renamed away, writes continue into a new file at the original path.
+func (w *logFileWriter) Reopen() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	old := w.f
+	w.f = f
+	w.mu.Unlock()
+	return old.Close()
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPidFileOverwritesStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.pid")
+	// A pid far away from our own is almost certainly stale.
+	os.WriteFile(path, []byte(strconv.Itoa(os.Getpid()+100000)+"\n"), 0o644)
+	if err := writePidFile(path); err != nil {
+		t.Fatalf("stale pidfile should be overwritten: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("pidfile = %q, want own pid", data)
+	}
+}
+
+func TestPidFileRefusesRunningPid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.pid")
+	// Pid 1 is always running; we just must not be it ourselves.
+	if os.Getpid() == 1 {
+		t.Skip("running as pid 1")
+	}
+	os.WriteFile(path, []byte("1\n"), 0o644)
+	if err := writePidFile(path); err == nil {
+		t.Fatal("pidfile naming a live process was accepted")
+	}
+}
+
+func TestRemovePidFileLeavesForeignFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.pid")
+	os.WriteFile(path, []byte("12345\n"), 0o644)
+	removePidFile(path)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("pidfile belonging to another process was removed")
+	}
+}
+
+func TestLogFileWriterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.log")
+	w, err := openLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("before\n"))
+	rotated := path + ".1"
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	// Until the reopen, writes still land in the renamed file.
+	w.Write([]byte("during\n"))
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("after\n"))
+
+	old, _ := os.ReadFile(rotated)
+	if !strings.Contains(string(old), "during") {
+		t.Errorf("rotated file = %q, want pre-reopen writes", old)
+	}
+	fresh, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fresh) != "after\n" {
+		t.Errorf("fresh file = %q, want only post-reopen writes", fresh)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// daemonize re-execs the binary detached in its own session with stdio on
+// /dev/null, then reports child=false so the parent exits. The detached
+// child sees the marker env, skips the fork, and reports child=true.
+func daemonize() (child bool, err error) {
+	if os.Getenv(daemonEnv) == "1" {
+		os.Unsetenv(daemonEnv)
+		return true, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return false, err
+	}
+	devnull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer devnull.Close()
+	proc, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   append(os.Environ(), daemonEnv+"=1"),
+		Files: []*os.File{devnull, devnull, devnull},
+		Sys:   &syscall.SysProcAttr{Setsid: true},
+	})
+	if err != nil {
+		return false, fmt.Errorf("daemonize: starting %s: %w", exe, err)
+	}
+	// The child runs on detached; init scripts only need our exit code.
+	proc.Release()
+	return false, nil
+}
+
+// pidAlive reports whether pid names a running process we could signal.
+func pidAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means it exists but belongs to someone else — still alive.
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package proxy
+
+import (
+	"errors"
+	"os"
+)
+
+// daemonize has no Windows equivalent; background operation goes through
+// the service manager instead (see winservice_windows.go).
+func daemonize() (bool, error) {
+	return false, errors.New("-daemon is not supported on Windows; use `clawdbot-proxy service install` instead")
+}
+
+// pidAlive reports whether pid names a running process. FindProcess opens
+// a real handle on Windows, so an error means the pid is gone.
+func pidAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
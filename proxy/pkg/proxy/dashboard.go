@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Built-in status dashboard. `/proxy-status` on the admin listener serves a
+// single self-contained HTML page whose numbers update live from the
+// `/proxy-status/stream` SSE feed; everything is computed from the metrics
+// registry the proxy already keeps, so there is no extra bookkeeping cost.
+
+const dashboardRefresh = 2 * time.Second
+
+const dashboardHTML = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Clawdbot Proxy Status</title>
+<style>
+body { font: 14px/1.5 system-ui, sans-serif; margin: 2rem; color: #222; }
+h1 { font-size: 1.2rem; }
+table { border-collapse: collapse; margin-top: 1rem; }
+td, th { padding: .3rem .8rem; border-bottom: 1px solid #ddd; text-align: left; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.ok { color: #0a0; } .bad { color: #c00; }
+#state { float: right; color: #888; }
+</style>
+</head>
+<body>
+<span id="state">connecting…</span>
+<h1>Clawdbot Proxy</h1>
+<table>
+<tr><th>Requests/s</th><td class="num" id="rps">–</td></tr>
+<tr><th>Latency p50 / p90 / p99</th><td class="num" id="latency">–</td></tr>
+<tr><th>Active WebSocket sessions</th><td class="num" id="ws">–</td></tr>
+<tr><th>Rate limited (total / tracked IPs)</th><td class="num" id="rl">–</td></tr>
+<tr><th>Backend</th><td id="backend">–</td></tr>
+</table>
+<table id="targets" hidden><tr><th>Target</th><th>Healthy</th></tr></table>
+<script>
+const fmtMs = s => s >= 0.001 ? (s * 1000).toFixed(0) + "ms" : "<1ms";
+const es = new EventSource("/proxy-status/stream");
+es.onopen = () => document.getElementById("state").textContent = "live";
+es.onerror = () => document.getElementById("state").textContent = "disconnected";
+es.onmessage = e => {
+  const d = JSON.parse(e.data);
+  document.getElementById("rps").textContent = d.rps.toFixed(1);
+  document.getElementById("latency").textContent =
+    [d.p50, d.p90, d.p99].map(fmtMs).join(" / ");
+  document.getElementById("ws").textContent = d.ws_active;
+  document.getElementById("rl").textContent = d.rate_limited + " / " + d.rate_limit_entries;
+  const b = document.getElementById("backend");
+  b.textContent = d.ready ? "ready" : "waiting";
+  if (d.breaker) b.textContent += " · breaker " + d.breaker;
+  b.className = d.ready && d.breaker !== "open" ? "ok" : "bad";
+  const t = document.getElementById("targets");
+  t.hidden = !d.targets || d.targets.length === 0;
+  while (t.rows.length > 1) t.deleteRow(1);
+  (d.targets || []).forEach(x => {
+    const row = t.insertRow();
+    row.insertCell().textContent = x.host;
+    const c = row.insertCell();
+    c.textContent = x.healthy ? "up" : "down";
+    c.className = x.healthy ? "ok" : "bad";
+  });
+};
+</script>
+</body>
+</html>
+`
+
+type dashTarget struct {
+	Host    string `json:"host"`
+	Healthy bool   `json:"healthy"`
+}
+
+type dashSnapshot struct {
+	RPS              float64      `json:"rps"`
+	P50              float64      `json:"p50"` // seconds, client-observed
+	P90              float64      `json:"p90"`
+	P99              float64      `json:"p99"`
+	WSActive         int          `json:"ws_active"`
+	RateLimited      int64        `json:"rate_limited"`
+	RateLimitEntries int          `json:"rate_limit_entries"`
+	Ready            bool         `json:"ready"`
+	Breaker          string       `json:"breaker,omitempty"`
+	Targets          []dashTarget `json:"targets,omitempty"`
+}
+
+func (p *ProxyServer) dashboardSnapshot(prevRequests int64, interval time.Duration) (dashSnapshot, int64) {
+	requests := p.metrics.CounterSum(`clawdbot_proxy_requests_total`)
+	s := dashSnapshot{
+		RPS:              float64(requests-prevRequests) / interval.Seconds(),
+		P50:              p.metrics.Quantile(`clawdbot_proxy_request_duration_seconds`, 0.50),
+		P90:              p.metrics.Quantile(`clawdbot_proxy_request_duration_seconds`, 0.90),
+		P99:              p.metrics.Quantile(`clawdbot_proxy_request_duration_seconds`, 0.99),
+		WSActive:         int(p.metrics.Gauge(`clawdbot_proxy_ws_active`)),
+		RateLimited:      p.metrics.Counter(`clawdbot_proxy_rate_limited_total`),
+		RateLimitEntries: p.limiter.Len(),
+		Ready:            p.ready.Load(),
+	}
+	if prevRequests < 0 { // first tick: no rate yet
+		s.RPS = 0
+	}
+	if p.breaker != nil {
+		s.Breaker = p.breaker.State().String()
+	}
+	if p.lb != nil {
+		for _, t := range p.lb.targets() {
+			s.Targets = append(s.Targets, dashTarget{Host: t.url.Host, Healthy: t.healthy()})
+		}
+	}
+	return s, requests
+}
+
+func (p *ProxyServer) handleDashboard(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardHTML)
+}
+
+// handleDashboardStream pushes one snapshot immediately and then every
+// refresh interval until the client disconnects.
+func (p *ProxyServer) handleDashboardStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	prev := int64(-1)
+	send := func() {
+		var s dashSnapshot
+		s, prev = p.dashboardSnapshot(prev, dashboardRefresh)
+		data, _ := json.Marshal(s)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	send()
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			send()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuantileFromBuckets(t *testing.T) {
+	m := NewMetrics()
+	for i := 0; i < 90; i++ {
+		m.Observe("lat_seconds", 0.02) // le=0.025
+	}
+	for i := 0; i < 10; i++ {
+		m.Observe("lat_seconds", 0.9) // le=1
+	}
+	if q := m.Quantile("lat_seconds", 0.5); q != 0.025 {
+		t.Errorf("p50 = %v, want 0.025", q)
+	}
+	if q := m.Quantile("lat_seconds", 0.99); q != 1 {
+		t.Errorf("p99 = %v, want 1", q)
+	}
+	if q := m.Quantile("missing", 0.5); q != 0 {
+		t.Errorf("empty histogram quantile = %v, want 0", q)
+	}
+}
+
+func TestDashboardPageAndStream(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	admin := p.newAdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/proxy-status", nil))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "EventSource") {
+		t.Fatalf("dashboard page = %d, want embedded UI", rec.Code)
+	}
+
+	p.metrics.Inc(`clawdbot_proxy_requests_total{code="2xx"}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/proxy-status/stream", nil).WithContext(ctx))
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "data: {") || !strings.Contains(body, `"rps"`) {
+		t.Fatalf("stream = %q, want SSE snapshot", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
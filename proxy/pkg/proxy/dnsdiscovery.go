@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS-based backend discovery: "-backend dns://gateway.internal:18790"
+// resolves the name to every A/AAAA record and load-balances across them
+// with the sticky pool from lb.go. A name starting with an underscore
+// ("dns://_gateway._tcp.example") is looked up as SRV records instead, so
+// ports come from the registry. The name is re-resolved on an interval and
+// the pool membership updated in place — scaling the gateway up or down
+// needs no proxy restart.
+
+type dnsDiscovery struct {
+	name     string // hostname, or an SRV service name (leading underscore)
+	port     string // ignored for SRV lookups
+	interval time.Duration
+	resolver *net.Resolver
+	pool     *backendPool
+	metrics  *Metrics
+	log      *slog.Logger
+
+	lastHosts string // joined host list from the previous resolution
+}
+
+// parseDNSBackend splits "dns://name[:port]" into name and port.
+func parseDNSBackend(raw string) (name, port string, err error) {
+	rest := strings.TrimPrefix(raw, "dns://")
+	if rest == "" {
+		return "", "", fmt.Errorf("empty dns:// backend")
+	}
+	if host, p, splitErr := net.SplitHostPort(rest); splitErr == nil {
+		return host, p, nil
+	}
+	if strings.HasPrefix(rest, "_") {
+		return rest, "", nil // SRV records carry their own ports
+	}
+	return "", "", fmt.Errorf("dns:// backend %q needs a port (or an SRV name)", rest)
+}
+
+func (p *ProxyServer) newDNSDiscovery(name, port string) *dnsDiscovery {
+	return &dnsDiscovery{
+		name:     name,
+		port:     port,
+		interval: p.cfg.DiscoveryInterval,
+		resolver: net.DefaultResolver,
+		pool:     p.lb,
+		metrics:  p.metrics,
+		log:      p.log,
+	}
+}
+
+// resolve returns the current backend URLs, sorted for a stable comparison.
+func (d *dnsDiscovery) resolve(ctx context.Context) ([]*url.URL, error) {
+	var hosts []string
+	if strings.HasPrefix(d.name, "_") {
+		_, srvs, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			hosts = append(hosts, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+		}
+	} else {
+		ips, err := d.resolver.LookupIP(ctx, "ip", d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			hosts = append(hosts, net.JoinHostPort(ip.String(), d.port))
+		}
+	}
+	sort.Strings(hosts)
+	urls := make([]*url.URL, 0, len(hosts))
+	for _, h := range hosts {
+		urls = append(urls, &url.URL{Scheme: "http", Host: h})
+	}
+	return urls, nil
+}
+
+// refresh re-resolves once and swaps the pool when membership changed.
+func (d *dnsDiscovery) refresh(ctx context.Context) error {
+	urls, err := d.resolve(ctx)
+	if err != nil {
+		d.metrics.Inc(`clawdbot_proxy_discovery_errors_total`)
+		return err
+	}
+	hosts := make([]string, len(urls))
+	for i, u := range urls {
+		hosts[i] = u.Host
+	}
+	joined := strings.Join(hosts, ",")
+	if joined == d.lastHosts {
+		return nil
+	}
+	d.lastHosts = joined
+	d.pool.setTargets(urls)
+	d.metrics.Inc(`clawdbot_proxy_discovery_updates_total`)
+	d.log.Info("backend pool updated from DNS", "name", d.name, "targets", len(urls))
+	return nil
+}
+
+// start runs the re-resolution loop for the life of the process.
+func (d *dnsDiscovery) start() {
+	go func() {
+		for {
+			time.Sleep(d.interval)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := d.refresh(ctx); err != nil {
+				d.log.Warn("dns re-resolution failed", "name", d.name, "error", err)
+			}
+			cancel()
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseDNSBackend(t *testing.T) {
+	cases := []struct {
+		raw, name, port string
+		wantErr         bool
+	}{
+		{"dns://gateway.internal:18790", "gateway.internal", "18790", false},
+		{"dns://_gateway._tcp.claw.example", "_gateway._tcp.claw.example", "", false},
+		{"dns://gateway.internal", "", "", true}, // non-SRV names need a port
+		{"dns://", "", "", true},
+	}
+	for _, tc := range cases {
+		name, port, err := parseDNSBackend(tc.raw)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseDNSBackend(%q) error = %v, wantErr %v", tc.raw, err, tc.wantErr)
+			continue
+		}
+		if name != tc.name || port != tc.port {
+			t.Errorf("parseDNSBackend(%q) = %q:%q, want %q:%q", tc.raw, name, port, tc.name, tc.port)
+		}
+	}
+}
+
+func TestDNSRefreshUpdatesPool(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: "http://127.0.0.1:0", StickyCookie: "clawdbot_backend"})
+	p.lb = p.newBackendPool(nil)
+	d := p.newDNSDiscovery("localhost", "18790")
+
+	if err := d.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	first := p.lb.targets()
+	if len(first) == 0 {
+		t.Fatal("localhost should resolve to at least one target")
+	}
+
+	// A second refresh with unchanged records must not rebuild targets, so
+	// passive health state survives.
+	if err := d.refresh(context.Background()); err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+	second := p.lb.targets()
+	if len(second) != len(first) || second[0] != first[0] {
+		t.Error("unchanged resolution should keep existing targets")
+	}
+}
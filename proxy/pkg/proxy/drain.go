@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// wsSession is one relayed WebSocket connection pair, tracked so shutdown
+// can reach hijacked connections that http.Server.Shutdown never sees and
+// the admin API can inspect or kill individual sessions.
+type wsSession struct {
+	id       string
+	client   *wsConn
+	backend  *wsConn
+	clientIP string
+	path     string
+	started  time.Time
+	// set names the blue/green backend set the session was opened against;
+	// empty outside blue/green deployments. See drainSet.
+	set string
+}
+
+// sendClose notifies both peers that the session is going away. The relay
+// loops exit once the peers complete the close handshake (or the deadline
+// forces the sockets closed).
+func (s *wsSession) sendClose(code uint16, reason string) {
+	payload := closePayload(code, reason)
+	writeControl(s.client, opClose, payload)
+	writeControl(s.backend, opClose, payload)
+}
+
+func (s *wsSession) forceClose() {
+	s.client.Close()
+	s.backend.Close()
+}
+
+type sessionSet struct {
+	mu       sync.Mutex
+	sessions map[*wsSession]struct{}
+}
+
+func newSessionSet() *sessionSet {
+	return &sessionSet{sessions: make(map[*wsSession]struct{})}
+}
+
+func (ss *sessionSet) add(s *wsSession) {
+	ss.mu.Lock()
+	ss.sessions[s] = struct{}{}
+	ss.mu.Unlock()
+}
+
+func (ss *sessionSet) remove(s *wsSession) {
+	ss.mu.Lock()
+	delete(ss.sessions, s)
+	ss.mu.Unlock()
+}
+
+func (ss *sessionSet) len() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return len(ss.sessions)
+}
+
+// find returns the session with the given ID, or nil.
+func (ss *sessionSet) find(id string) *wsSession {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for s := range ss.sessions {
+		if s.id == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func (ss *sessionSet) snapshot() []*wsSession {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	out := make([]*wsSession, 0, len(ss.sessions))
+	for s := range ss.sessions {
+		out = append(out, s)
+	}
+	return out
+}
+
+// beginDrain flips the proxy into draining mode: plain HTTP responses get
+// Connection: close and every WebSocket session is asked to shut down.
+func (p *ProxyServer) beginDrain() {
+	p.draining.Store(true)
+	for _, s := range p.sessions.snapshot() {
+		s.sendClose(1001, "proxy shutting down")
+	}
+}
+
+// awaitSessions waits for WebSocket sessions to finish their close
+// handshakes, force-closing whatever remains when ctx expires.
+func (p *ProxyServer) awaitSessions(ctx context.Context) {
+	for p.sessions.len() > 0 {
+		select {
+		case <-ctx.Done():
+			remaining := p.sessions.snapshot()
+			p.log.Warn("forcing remaining websocket sessions closed", "count", len(remaining))
+			for _, s := range remaining {
+				s.forceClose()
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
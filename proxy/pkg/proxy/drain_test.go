@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestDrainSendsCloseFrameToClients(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+	}
+	p, addr := startProxyServer(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	// Wait for the session to register before draining.
+	deadline := time.Now().Add(time.Second)
+	for p.sessions.len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	p.beginDrain()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	opcode, payload := readFrame(t, br)
+	if opcode != opClose {
+		t.Fatalf("opcode = %#x, want close", opcode)
+	}
+	if len(payload) < 2 || binary.BigEndian.Uint16(payload) != 1001 {
+		t.Errorf("close payload = %v, want code 1001", payload)
+	}
+}
+
+func TestAwaitSessionsForcesCloseOnDeadline(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+	}
+	p, addr := startProxyServer(t, cfg)
+	dialWS(t, addr, "/ws") // client that never answers the close handshake
+
+	deadline := time.Now().Add(time.Second)
+	for p.sessions.len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		p.awaitSessions(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("awaitSessions did not return after deadline")
+	}
+}
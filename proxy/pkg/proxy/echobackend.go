@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Built-in mock gateway for dry runs: -backend echo:// stands up a
+// loopback HTTP server that answers API requests with an echo of what it
+// received and speaks a frame-for-frame WebSocket echo on upgrade
+// requests, so the proxy and Control UI can be developed and load-tested
+// without a running Node gateway. Request knobs for failure drills:
+// ?status=<code> forces a response status and ?delay=<duration> sleeps
+// before answering.
+
+// echoBackendScheme is the -backend value selecting the mock gateway.
+const echoBackendScheme = "echo://"
+
+// startEchoGateway launches the mock gateway on an ephemeral loopback port
+// and returns its base URL.
+func startEchoGateway(log *slog.Logger) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(handleEcho)}
+	go srv.Serve(ln)
+	addr := "http://" + ln.Addr().String()
+	log.Info("echo backend listening", "addr", addr)
+	return addr, nil
+}
+
+func handleEcho(w http.ResponseWriter, r *http.Request) {
+	if isUpgradeRequest(r) {
+		echoWebSocket(w, r)
+		return
+	}
+	if v := r.URL.Query().Get("delay"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			time.Sleep(d)
+		}
+	}
+	status := http.StatusOK
+	if v := r.URL.Query().Get("status"); v != "" {
+		if code, err := strconv.Atoi(v); err == nil && code >= 100 && code <= 599 {
+			status = code
+		}
+	}
+	body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Echo-Backend", "1")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"echo":   true,
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"query":  r.URL.RawQuery,
+		"body":   string(body),
+	})
+}
+
+// echoWebSocket completes the upgrade handshake and echoes every data
+// frame back to the sender; pings are answered with pongs and a close
+// frame ends the session cleanly.
+func echoWebSocket(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking unsupported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " +
+		wsAcceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	rw.Flush()
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		opcode, payload, err := readEchoFrame(rw.Reader)
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opText, opBinary:
+			if writeEchoFrame(conn, opcode, payload) != nil {
+				return
+			}
+		case opPing:
+			if writeEchoFrame(conn, opPong, payload) != nil {
+				return
+			}
+		case opClose:
+			writeEchoFrame(conn, opClose, payload)
+			return
+		}
+	}
+}
+
+// readEchoFrame reads one whole frame and returns the unmasked payload.
+func readEchoFrame(br *bufio.Reader) (byte, []byte, error) {
+	var buf [2]byte
+	if _, err := io.ReadFull(br, buf[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := buf[0] & 0x0f
+	masked := buf[1]&0x80 != 0
+	length := int64(buf[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if length < 0 || length > wsResumeMaxFrame {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(br, key[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+// writeEchoFrame sends one unmasked (server-originated) frame.
+func writeEchoFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n < 1<<16:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
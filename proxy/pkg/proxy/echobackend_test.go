@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEchoBackendAnswersAPIRequests(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: echoBackendScheme})
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/agent/run", strings.NewReader(`{"message":"hi"}`))
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Echo-Backend") != "1" {
+		t.Error("response should be marked as coming from the echo backend")
+	}
+	var body struct {
+		Echo   bool   `json:"echo"`
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Body   string `json:"body"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Echo || body.Method != "POST" || body.Path != "/api/agent/run" || body.Body != `{"message":"hi"}` {
+		t.Errorf("echoed body = %+v, want the request mirrored back", body)
+	}
+}
+
+func TestEchoBackendStatusKnob(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: echoBackendScheme})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status?status=503", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want forced 503", rec.Code)
+	}
+}
+
+func TestEchoBackendWebSocketLoopback(t *testing.T) {
+	addr, err := startEchoGateway(discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialTimeout("tcp", strings.TrimPrefix(addr, "http://"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: echo\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d, want 101", resp.StatusCode)
+	}
+
+	// Send a masked text frame, expect the payload echoed back unmasked.
+	payload := []byte("ping me")
+	frame := []byte{0x81, byte(0x80 | len(payload)), 1, 2, 3, 4}
+	for i, b := range payload {
+		frame = append(frame, b^frame[2+i%4])
+	}
+	conn.Write(frame)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	opcode, echoed, err := readEchoFrame(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != opText || string(echoed) != string(payload) {
+		t.Errorf("echoed frame = op %x payload %q, want text %q", opcode, echoed, payload)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !embedui
+
+package proxy
+
+import "io/fs"
+
+// Default builds carry no embedded UI; -static stays required for serving
+// the Control UI. See embed_ui.go for the embedui build mode.
+func embeddedUIFS() (fs.FS, bool) {
+	return nil, false
+}
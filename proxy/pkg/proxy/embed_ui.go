@@ -0,0 +1,20 @@
+//go:build embedui
+
+package proxy
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Build seam: `go build -tags embedui` bakes the Control UI into the
+// binary. The build script copies the UI dist output into proxy/ui first;
+// the checked-in placeholder only keeps this file compiling.
+//
+//go:embed all:ui
+var embeddedUI embed.FS
+
+func embeddedUIFS() (fs.FS, bool) {
+	sub, err := fs.Sub(embeddedUI, "ui")
+	return sub, err == nil
+}
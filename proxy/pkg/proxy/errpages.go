@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Content-negotiated error responses. Rejections used to be bare
+// http.Error strings; httpError now answers browsers with an HTML page
+// and everyone else with a consistent JSON envelope:
+//
+//	{"code": 502, "message": "...", "request_id": "..."}
+//
+// The built-in HTML page can be replaced per status with -error-pages:
+// templates named <status>.html (502.html, 429.html, ...) plus an
+// optional error.html fallback, executed with {{.Code}}, {{.Status}},
+// {{.Message}}, and {{.RequestID}}.
+
+// defaultErrorPage renders when no template directory overrides a status.
+const defaultErrorPage = `<!doctype html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Code}} {{.Status}}</title>
+<style>
+body{font-family:system-ui,sans-serif;background:#16161e;color:#c9c9d1;
+display:flex;align-items:center;justify-content:center;height:100vh;margin:0}
+main{text-align:center}h1{font-size:4rem;margin:0}p{color:#8a8a96}
+small{color:#55555e}
+</style></head>
+<body><main>
+<h1>{{.Code}}</h1>
+<p>{{.Message}}</p>
+{{if .RequestID}}<small>request {{.RequestID}}</small>{{end}}
+</main></body>
+</html>
+`
+
+// gatewayDownPage is served to browsers when the backend is unreachable
+// (override with gateway-down.html in -error-pages). It polls until the
+// gateway answers again and then reloads.
+const gatewayDownPage = `<!doctype html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Gateway starting</title>
+<style>
+body{font-family:system-ui,sans-serif;background:#16161e;color:#c9c9d1;
+display:flex;align-items:center;justify-content:center;height:100vh;margin:0}
+main{text-align:center}h1{margin:0 0 .5rem}p{color:#8a8a96}
+small{color:#55555e}
+</style></head>
+<body><main>
+<h1>Gateway starting&hellip;</h1>
+<p>{{.Message}} Retrying automatically.</p>
+{{if .RequestID}}<small>request {{.RequestID}}</small>{{end}}
+<script>
+(function poll(){
+  fetch("/health",{cache:"no-store"}).then(function(res){
+    if(res.ok){location.reload();return}
+    setTimeout(poll,{{.RetrySeconds}}*1000)
+  }).catch(function(){setTimeout(poll,{{.RetrySeconds}}*1000)})
+})()
+</script>
+</main></body>
+</html>
+`
+
+// errorPageData is what the templates see.
+type errorPageData struct {
+	Code         int
+	Status       string
+	Message      string
+	RequestID    string
+	RetrySeconds int
+}
+
+type errorPages struct {
+	fallback    *template.Template
+	gatewayDown *template.Template
+	byStatus    map[int]*template.Template
+}
+
+// loadErrorPages parses the built-in page plus any overrides in dir.
+func loadErrorPages(dir string) (*errorPages, error) {
+	ep := &errorPages{
+		fallback:    template.Must(template.New("error").Parse(defaultErrorPage)),
+		gatewayDown: template.Must(template.New("gateway-down").Parse(gatewayDownPage)),
+		byStatus:    make(map[int]*template.Template),
+	}
+	if dir == "" {
+		return ep, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".html") {
+			continue
+		}
+		tmpl, err := template.ParseFiles(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error page %s: %w", name, err)
+		}
+		base := strings.TrimSuffix(name, ".html")
+		if base == "error" {
+			ep.fallback = tmpl
+			continue
+		}
+		if base == "gateway-down" {
+			ep.gatewayDown = tmpl
+			continue
+		}
+		status, err := strconv.Atoi(base)
+		if err != nil || status < 400 || status > 599 {
+			return nil, fmt.Errorf("error page %s: want <status>.html or error.html", name)
+		}
+		ep.byStatus[status] = tmpl
+	}
+	return ep, nil
+}
+
+func (ep *errorPages) lookup(status int) *template.Template {
+	if t, ok := ep.byStatus[status]; ok {
+		return t
+	}
+	return ep.fallback
+}
+
+// wantsHTML reports whether the client is a browser navigation rather
+// than an API caller. Fetch/XHR requests send Accept: */* or
+// application/json and get the JSON envelope.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// httpError answers a request with status, negotiating HTML vs JSON.
+// Callers set any extra headers (Retry-After, WWW-Authenticate) first.
+func (p *ProxyServer) httpError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("X-Content-Type-Options", "nosniff")
+	reqID := requestIDFrom(r.Context())
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		p.audit.record("auth_failure",
+			"status", strconv.Itoa(status),
+			"path", r.URL.Path,
+			"client", p.clientIP(r),
+			"reason", message)
+	}
+	if wantsHTML(r) && p.errPages != nil {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		data := errorPageData{
+			Code:      status,
+			Status:    http.StatusText(status),
+			Message:   message,
+			RequestID: reqID,
+		}
+		if err := p.errPages.lookup(status).Execute(w, data); err != nil {
+			p.log.Error("rendering error page", "status", status, "error", err)
+		}
+		return
+	}
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"code":       status,
+		"message":    message,
+		"request_id": reqID,
+	})
+}
+
+// backendRetrySeconds is the Retry-After hint when the gateway is down;
+// it usually restarts within a few seconds.
+const backendRetrySeconds = 3
+
+// backendErrorCause maps a proxy error to a response status and a metrics
+// label, separating a refused connection (gateway not running) from a
+// timeout (gateway wedged or overloaded).
+func backendErrorCause(err error) (int, string) {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return http.StatusBadGateway, "refused"
+	}
+	var nerr net.Error
+	if (errors.As(err, &nerr) && nerr.Timeout()) || errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, "timeout"
+	}
+	return http.StatusBadGateway, "error"
+}
+
+// backendDown answers for an unreachable gateway: browsers get the
+// auto-retrying "gateway starting" page, API clients a JSON envelope, and
+// both a Retry-After hint.
+func (p *ProxyServer) backendDown(w http.ResponseWriter, r *http.Request, status int) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Retry-After", strconv.Itoa(backendRetrySeconds))
+	message := "The gateway is not reachable right now."
+	if status == http.StatusGatewayTimeout {
+		message = "The gateway did not respond in time."
+	}
+	reqID := requestIDFrom(r.Context())
+	if wantsHTML(r) && p.errPages != nil {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		data := errorPageData{
+			Code:         status,
+			Status:       http.StatusText(status),
+			Message:      message,
+			RequestID:    reqID,
+			RetrySeconds: backendRetrySeconds,
+		}
+		if err := p.errPages.gatewayDown.Execute(w, data); err != nil {
+			p.log.Error("rendering gateway-down page", "error", err)
+		}
+		return
+	}
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"code":        status,
+		"message":     message,
+		"request_id":  reqID,
+		"retry_after": backendRetrySeconds,
+	})
+}
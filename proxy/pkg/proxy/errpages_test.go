@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPErrorJSONEnvelope(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/x", nil)
+	req.Header.Set("Accept", "application/json")
+	p.httpError(rec, req, 502, "the gateway is unreachable")
+
+	if rec.Code != 502 {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, "application/json") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var env map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("body %q: %v", rec.Body.String(), err)
+	}
+	if env["code"] != float64(502) || env["message"] != "the gateway is unreachable" {
+		t.Fatalf("envelope = %v", env)
+	}
+	if _, ok := env["request_id"]; !ok {
+		t.Fatal("envelope missing request_id")
+	}
+}
+
+func TestHTTPErrorHTMLForBrowsers(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/x", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	p.httpError(rec, req, 429, "rate limit exceeded")
+
+	if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, "text/html") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "429") || !strings.Contains(body, "rate limit exceeded") {
+		t.Fatalf("page missing code/message: %q", body)
+	}
+}
+
+func TestHTTPErrorCustomTemplates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "503.html"), []byte("be right back: {{.Message}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "error.html"), []byte("oops {{.Code}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{ErrorPageDir: dir})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html")
+	p.httpError(rec, req, 503, "draining")
+	if got := rec.Body.String(); got != "be right back: draining" {
+		t.Fatalf("503 page = %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	p.httpError(rec, req.Clone(req.Context()), 418, "teapot")
+	if got := rec.Body.String(); got != "oops 418" {
+		t.Fatalf("fallback page = %q", got)
+	}
+}
+
+func TestLoadErrorPagesRejectsBadNames(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fancy.html"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadErrorPages(dir); err == nil {
+		t.Fatal("bad template name accepted")
+	}
+}
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// External authorization in the ext_authz mold: before a backend request
+// is forwarded, the proxy asks a separate HTTP service for a verdict and
+// honors allow/deny plus header mutations. Only the HTTP check protocol
+// is implemented; gRPC would pull in a dependency the proxy does not
+// carry. The check request is a GET to -ext-authz-url carrying the
+// client's headers plus X-Claw-Authz-Method and X-Claw-Authz-Path:
+//
+//   - 2xx allows the request; response headers prefixed
+//     "X-Claw-Authz-Set-" are applied to the upstream request with the
+//     prefix stripped (e.g. X-Claw-Authz-Set-X-Role: admin).
+//   - 401/403 deny with that status; the body and WWW-Authenticate header
+//     are passed through so the authorizer controls the challenge.
+//   - Any other status, a timeout, or a connection error is an authorizer
+//     failure: denied with 503 by default, allowed when
+//     -ext-authz-fail-open is set.
+//
+// Decisions are cached per method+path+credentials for
+// -ext-authz-cache-ttl so the authorizer sees each principal once per
+// window, not once per request.
+
+const extAuthzSetPrefix = "X-Claw-Authz-Set-"
+
+// authzDecision is one cached verdict.
+type authzDecision struct {
+	allowed bool
+	status  int         // deny status
+	deny    http.Header // headers passed through on denial
+	mutate  http.Header // upstream header mutations on allow
+	expires time.Time
+}
+
+type extAuthz struct {
+	url      string
+	client   *http.Client
+	failOpen bool
+	cacheTTL time.Duration
+	metrics  *Metrics
+
+	mu    sync.Mutex
+	cache map[string]authzDecision
+}
+
+func newExtAuthz(cfg *Config, metrics *Metrics) *extAuthz {
+	return &extAuthz{
+		url:      cfg.ExtAuthzURL,
+		client:   &http.Client{Timeout: cfg.ExtAuthzTimeout},
+		failOpen: cfg.ExtAuthzFailOpen,
+		cacheTTL: cfg.ExtAuthzCacheTTL,
+		metrics:  metrics,
+		cache:    make(map[string]authzDecision),
+	}
+}
+
+// cacheKey identifies a decision: same method, path, and credentials mean
+// the same verdict within the TTL. Query strings are deliberately left
+// out so pagination does not defeat the cache.
+func (a *extAuthz) cacheKey(r *http.Request) string {
+	return r.Method + " " + r.URL.Path + "\x00" + r.Header.Get("Authorization") + "\x00" + r.Header.Get("X-API-Key") + "\x00" + r.Header.Get("Cookie")
+}
+
+// check asks the authorizer (or the cache) for a verdict.
+func (a *extAuthz) check(r *http.Request) authzDecision {
+	key := a.cacheKey(r)
+	if a.cacheTTL > 0 {
+		a.mu.Lock()
+		d, ok := a.cache[key]
+		a.mu.Unlock()
+		if ok && time.Now().Before(d.expires) {
+			a.metrics.Inc(`clawdbot_proxy_extauthz_cache_hits_total`)
+			return d
+		}
+	}
+	d := a.ask(r)
+	if a.cacheTTL > 0 {
+		d.expires = time.Now().Add(a.cacheTTL)
+		a.mu.Lock()
+		a.cache[key] = d
+		// Opportunistically drop expired entries so the map tracks the
+		// active principal set instead of growing forever.
+		if len(a.cache) > 10000 {
+			now := time.Now()
+			for k, v := range a.cache {
+				if now.After(v.expires) {
+					delete(a.cache, k)
+				}
+			}
+		}
+		a.mu.Unlock()
+	}
+	return d
+}
+
+func (a *extAuthz) ask(r *http.Request) authzDecision {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, a.url, nil)
+	if err != nil {
+		return a.failDecision()
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Set("X-Claw-Authz-Method", r.Method)
+	req.Header.Set("X-Claw-Authz-Path", r.URL.RequestURI())
+	resp, err := a.client.Do(req)
+	if err != nil {
+		a.metrics.Inc(`clawdbot_proxy_extauthz_decisions_total{decision="error"}`)
+		return a.failDecision()
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		a.metrics.Inc(`clawdbot_proxy_extauthz_decisions_total{decision="allow"}`)
+		mutate := make(http.Header)
+		for name, values := range resp.Header {
+			if stripped, ok := strings.CutPrefix(name, extAuthzSetPrefix); ok && stripped != "" {
+				mutate[http.CanonicalHeaderKey(stripped)] = values
+			}
+		}
+		return authzDecision{allowed: true, mutate: mutate}
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		a.metrics.Inc(`clawdbot_proxy_extauthz_decisions_total{decision="deny"}`)
+		deny := make(http.Header)
+		if v := resp.Header.Get("WWW-Authenticate"); v != "" {
+			deny.Set("WWW-Authenticate", v)
+		}
+		return authzDecision{status: resp.StatusCode, deny: deny}
+	default:
+		// An authorizer answering 500s is as unavailable as one not
+		// answering at all.
+		a.metrics.Inc(`clawdbot_proxy_extauthz_decisions_total{decision="error"}`)
+		return a.failDecision()
+	}
+}
+
+func (a *extAuthz) failDecision() authzDecision {
+	if a.failOpen {
+		return authzDecision{allowed: true}
+	}
+	return authzDecision{status: http.StatusServiceUnavailable}
+}
+
+// checkExtAuthz consults the authorizer and either mutates the request
+// for the upstream or writes the denial. Returns false when the request
+// has been answered.
+func (p *ProxyServer) checkExtAuthz(w http.ResponseWriter, r *http.Request) bool {
+	if p.extAuthz == nil {
+		return true
+	}
+	d := p.extAuthz.check(r)
+	if d.allowed {
+		for name, values := range d.mutate {
+			r.Header[name] = values
+		}
+		return true
+	}
+	for name, values := range d.deny {
+		w.Header()[name] = values
+	}
+	msg := "forbidden by external authorizer"
+	if d.status == http.StatusServiceUnavailable {
+		msg = "external authorizer unavailable"
+	}
+	p.httpError(w, r, d.status, msg)
+	return false
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newAuthzProxy(t *testing.T, authz http.HandlerFunc, cacheTTL time.Duration, failOpen bool) (*ProxyServer, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(authz)
+	t.Cleanup(srv.Close)
+	p := newTestProxy(t, &Config{
+		Backend:          echoBackendScheme,
+		ExtAuthzURL:      srv.URL,
+		ExtAuthzTimeout:  time.Second,
+		ExtAuthzCacheTTL: cacheTTL,
+		ExtAuthzFailOpen: failOpen,
+	})
+	return p, srv
+}
+
+func TestExtAuthzAllowsAndMutatesHeaders(t *testing.T) {
+	p, _ := newAuthzProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Claw-Authz-Method") != "GET" || r.Header.Get("X-Claw-Authz-Path") != "/api/hello?x=1" {
+			t.Errorf("authz saw method %q path %q", r.Header.Get("X-Claw-Authz-Method"), r.Header.Get("X-Claw-Authz-Path"))
+		}
+		w.Header().Set("X-Claw-Authz-Set-X-Role", "admin")
+		w.WriteHeader(http.StatusOK)
+	}, 0, false)
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/hello?x=1", nil)
+	if !p.checkExtAuthz(rec, r) {
+		t.Fatal("allowed request denied")
+	}
+	if r.Header.Get("X-Role") != "admin" {
+		t.Errorf("X-Role = %q, want admin from authorizer mutation", r.Header.Get("X-Role"))
+	}
+}
+
+func TestExtAuthzDeniesWithAuthorizerStatus(t *testing.T) {
+	p, _ := newAuthzProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="claw"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}, 0, false)
+
+	rec := httptest.NewRecorder()
+	if p.checkExtAuthz(rec, httptest.NewRequest("GET", "/api/hello", nil)) {
+		t.Fatal("denied request allowed")
+	}
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("denial = %d %v, want 401 with WWW-Authenticate", rec.Code, rec.Header())
+	}
+}
+
+func TestExtAuthzFailClosedAndOpen(t *testing.T) {
+	broken := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }
+
+	p, _ := newAuthzProxy(t, broken, 0, false)
+	rec := httptest.NewRecorder()
+	if p.checkExtAuthz(rec, httptest.NewRequest("GET", "/api/hello", nil)) || rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("fail-closed = allowed=%v code=%d, want denied 503", rec.Code == 0, rec.Code)
+	}
+
+	p, _ = newAuthzProxy(t, broken, 0, true)
+	if !p.checkExtAuthz(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/hello", nil)) {
+		t.Error("fail-open denied the request")
+	}
+}
+
+func TestExtAuthzCachesDecisions(t *testing.T) {
+	var calls atomic.Int64
+	p, _ := newAuthzProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}, time.Minute, false)
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/api/hello", nil)
+		r.Header.Set("Authorization", "Bearer tok")
+		p.checkExtAuthz(httptest.NewRecorder(), r)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("authorizer called %d times, want 1 (cached)", got)
+	}
+
+	// Different credentials must not share a verdict.
+	r := httptest.NewRequest("GET", "/api/hello", nil)
+	r.Header.Set("Authorization", "Bearer other")
+	p.checkExtAuthz(httptest.NewRecorder(), r)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("authorizer called %d times after new credentials, want 2", got)
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Flush pacing. The stdlib ReverseProxy already flushes immediately for
+// text/event-stream and for responses without a Content-Length (chunked log
+// tails and the like), so streaming endpoints work out of the box. What it
+// does not cover are known-length responses that trickle: those sit in the
+// server's write buffer until it fills. flush-interval= on a backend route
+// (or the global -flush-interval flag) closes that gap by flushing after
+// every write ("immediate") or on a fixed period.
+
+// flushWriter forwards writes and flushes them on the configured cadence.
+// stop must be called when the response is done so the ticker goroutine
+// exits.
+type flushWriter struct {
+	http.ResponseWriter
+	immediate bool
+
+	mu    sync.Mutex
+	dirty bool
+	done  chan struct{}
+}
+
+func newFlushWriter(w http.ResponseWriter, interval time.Duration) *flushWriter {
+	fw := &flushWriter{ResponseWriter: w, immediate: interval < 0}
+	if interval > 0 {
+		fw.done = make(chan struct{})
+		go fw.loop(interval)
+	}
+	return fw
+}
+
+func (fw *flushWriter) Unwrap() http.ResponseWriter { return fw.ResponseWriter }
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	n, err := fw.ResponseWriter.Write(b)
+	if fw.immediate {
+		fw.flushLocked()
+	} else {
+		fw.dirty = true
+	}
+	return n, err
+}
+
+func (fw *flushWriter) Flush() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.flushLocked()
+}
+
+func (fw *flushWriter) flushLocked() {
+	fw.dirty = false
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (fw *flushWriter) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fw.done:
+			return
+		case <-ticker.C:
+		}
+		fw.mu.Lock()
+		if fw.dirty {
+			fw.flushLocked()
+		}
+		fw.mu.Unlock()
+	}
+}
+
+func (fw *flushWriter) stop() {
+	if fw.done != nil {
+		close(fw.done)
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingFlusher records how often the chain below flushWriter is flushed.
+type countingFlusher struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (c *countingFlusher) Flush() { c.flushes++ }
+
+func TestFlushWriterImmediate(t *testing.T) {
+	cf := &countingFlusher{ResponseRecorder: httptest.NewRecorder()}
+	fw := newFlushWriter(cf, -1)
+	defer fw.stop()
+	fw.Write([]byte("a"))
+	fw.Write([]byte("b"))
+	if cf.flushes != 2 {
+		t.Fatalf("flushes = %d, want one per write", cf.flushes)
+	}
+}
+
+func TestFlushWriterInterval(t *testing.T) {
+	cf := &countingFlusher{ResponseRecorder: httptest.NewRecorder()}
+	fw := newFlushWriter(cf, 20*time.Millisecond)
+	defer fw.stop()
+	fw.Write([]byte("trickle"))
+	deadline := time.Now().Add(time.Second)
+	for {
+		fw.mu.Lock()
+		n := cf.flushes
+		fw.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ticker never flushed the dirty writer")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// An explicit Flush clears dirty so the ticker goes quiet again.
+	fw.Flush()
+	fw.mu.Lock()
+	dirty := fw.dirty
+	fw.mu.Unlock()
+	if dirty {
+		t.Fatal("writer still dirty after explicit Flush")
+	}
+}
+
+func TestParseRouteFlushInterval(t *testing.T) {
+	rt, err := parseRouteLine("path=/api/logs backend=http://x:1 flush-interval=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.flushInterval >= 0 {
+		t.Fatalf("flushInterval = %v, want negative for immediate", rt.flushInterval)
+	}
+	rt, err = parseRouteLine("path=/api/logs backend=http://x:1 flush-interval=250ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.flushInterval != 250*time.Millisecond {
+		t.Fatalf("flushInterval = %v, want 250ms", rt.flushInterval)
+	}
+	for _, line := range []string{
+		"path=/api/logs backend=http://x:1 flush-interval=0",
+		"path=/api/logs backend=http://x:1 flush-interval=soon",
+		"path=/ws websocket flush-interval=immediate", // wrong action
+	} {
+		if _, err := parseRouteLine(line); err == nil {
+			t.Errorf("parseRouteLine(%q) succeeded, want error", line)
+		}
+	}
+}
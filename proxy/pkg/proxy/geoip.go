@@ -0,0 +1,336 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// GeoIP tagging and enforcement. -geoip-db (country) and -geoip-asn-db
+// load MaxMind-format .mmdb files; every request is tagged with the
+// client's country and ASN (request headers for the backend, a labelled
+// counter for metrics), and routes can block or rate-limit specific
+// origins with geo-block= / geo-rate=. The reader below implements just
+// enough of the MMDB spec for those two databases — binary search tree,
+// pointers, and the scalar/map/array data types — so no external
+// dependency is needed.
+
+const (
+	geoCountryHeader = "X-Claw-Country"
+	geoASNHeader     = "X-Claw-Asn"
+)
+
+// mmdbMarker separates the data section from the metadata map.
+var mmdbMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+type mmdb struct {
+	data       []byte
+	nodeCount  int
+	recordSize int // bits per record: 24, 28, or 32
+	ipVersion  int
+	treeSize   int // bytes
+	dataStart  int // absolute offset of the data section proper
+}
+
+func openMMDB(path string) (*mmdb, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(data, mmdbMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s: no MaxMind metadata marker", path)
+	}
+	db := &mmdb{data: data}
+	metaAny, _, err := db.decodeAt(i+len(mmdbMarker), 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: metadata: %w", path, err)
+	}
+	meta, ok := metaAny.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: metadata is not a map", path)
+	}
+	db.nodeCount = int(mmdbUint(meta["node_count"]))
+	db.recordSize = int(mmdbUint(meta["record_size"]))
+	db.ipVersion = int(mmdbUint(meta["ip_version"]))
+	if db.nodeCount == 0 || (db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32) {
+		return nil, fmt.Errorf("%s: unsupported layout (nodes=%d record=%d)", path, db.nodeCount, db.recordSize)
+	}
+	db.treeSize = db.nodeCount * db.recordSize / 4 // two records per node
+	db.dataStart = db.treeSize + 16                // 16 zero bytes separate tree and data
+	if db.dataStart >= len(data) {
+		return nil, fmt.Errorf("%s: truncated database", path)
+	}
+	return db, nil
+}
+
+func mmdbUint(v any) uint64 {
+	u, _ := v.(uint64)
+	return u
+}
+
+// lookup walks the search tree for ip and returns the record map, or nil
+// when the address is not in the database.
+func (db *mmdb) lookup(ip net.IP) (map[string]any, error) {
+	bits := 32
+	addr := ip.To4()
+	if db.ipVersion == 6 {
+		bits = 128
+		addr = ip.To16()
+	}
+	if addr == nil {
+		return nil, nil // e.g. IPv6 client against an IPv4-only database
+	}
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := (addr[i/8] >> (7 - i%8)) & 1
+		record := db.record(node, bit)
+		if record == db.nodeCount {
+			return nil, nil
+		}
+		if record < db.nodeCount {
+			node = record
+			continue
+		}
+		// Per spec the record points record-nodeCount bytes past the
+		// start of the separator, which lands in the data section.
+		v, _, err := db.decodeAt(db.treeSize+record-db.nodeCount, 0)
+		if err != nil {
+			return nil, err
+		}
+		m, _ := v.(map[string]any)
+		return m, nil
+	}
+	return nil, nil
+}
+
+func (db *mmdb) record(node int, bit byte) int {
+	switch db.recordSize {
+	case 24:
+		base := node * 6
+		if bit == 1 {
+			base += 3
+		}
+		return int(db.data[base])<<16 | int(db.data[base+1])<<8 | int(db.data[base+2])
+	case 28:
+		base := node * 7
+		if bit == 0 {
+			return int(db.data[base+3]>>4)<<24 | int(db.data[base])<<16 |
+				int(db.data[base+1])<<8 | int(db.data[base+2])
+		}
+		return int(db.data[base+3]&0x0f)<<24 | int(db.data[base+4])<<16 |
+			int(db.data[base+5])<<8 | int(db.data[base+6])
+	default: // 32
+		base := node * 8
+		if bit == 1 {
+			base += 4
+		}
+		return int(binary.BigEndian.Uint32(db.data[base:]))
+	}
+}
+
+// decodeAt decodes one value. depth guards against pointer loops in a
+// corrupt database.
+func (db *mmdb) decodeAt(off, depth int) (any, int, error) {
+	if depth > 32 {
+		return nil, 0, fmt.Errorf("mmdb: pointer loop")
+	}
+	if off >= len(db.data) {
+		return nil, 0, fmt.Errorf("mmdb: offset out of range")
+	}
+	ctrl := db.data[off]
+	off++
+	typ := int(ctrl >> 5)
+	if typ == 0 { // extended type
+		typ = int(db.data[off]) + 7
+		off++
+	}
+	if typ == 1 { // pointer: size bits encode width, low bits join the value
+		ss := int(ctrl>>3) & 0x3
+		v := int(ctrl & 0x7)
+		switch ss {
+		case 0:
+			v = v<<8 | int(db.data[off])
+		case 1:
+			v = (v<<16 | int(db.data[off])<<8 | int(db.data[off+1])) + 2048
+		case 2:
+			v = (v<<24 | int(db.data[off])<<16 | int(db.data[off+1])<<8 | int(db.data[off+2])) + 526336
+		case 3:
+			v = int(binary.BigEndian.Uint32(db.data[off:]))
+		}
+		off += ss + 1
+		val, _, err := db.decodeAt(db.dataStart+v, depth+1)
+		return val, off, err
+	}
+	size := int(ctrl & 0x1f)
+	switch size {
+	case 29:
+		size = 29 + int(db.data[off])
+		off++
+	case 30:
+		size = 285 + int(db.data[off])<<8 + int(db.data[off+1])
+		off += 2
+	case 31:
+		size = 65821 + int(db.data[off])<<16 + int(db.data[off+1])<<8 + int(db.data[off+2])
+		off += 3
+	}
+	if off+size > len(db.data) && typ != 7 && typ != 11 {
+		return nil, 0, fmt.Errorf("mmdb: value overruns data")
+	}
+	switch typ {
+	case 2: // string
+		return string(db.data[off : off+size]), off + size, nil
+	case 4: // bytes
+		return append([]byte(nil), db.data[off:off+size]...), off + size, nil
+	case 5, 6, 9, 10: // unsigned ints of various widths
+		var u uint64
+		for _, b := range db.data[off : off+size] {
+			u = u<<8 | uint64(b)
+		}
+		return u, off + size, nil
+	case 8: // int32
+		var i int32
+		for _, b := range db.data[off : off+size] {
+			i = i<<8 | int32(b)
+		}
+		return i, off + size, nil
+	case 7: // map
+		m := make(map[string]any, size)
+		var err error
+		for n := 0; n < size; n++ {
+			var k, v any
+			if k, off, err = db.decodeAt(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("mmdb: non-string map key")
+			}
+			if v, off, err = db.decodeAt(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, off, nil
+	case 11: // array
+		a := make([]any, 0, size)
+		var err error
+		for n := 0; n < size; n++ {
+			var v any
+			if v, off, err = db.decodeAt(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, off, nil
+	case 14: // bool encodes its value in size
+		return size != 0, off, nil
+	case 3, 15: // double/float; decoded but unused by our lookups
+		var u uint64
+		for _, b := range db.data[off : off+size] {
+			u = u<<8 | uint64(b)
+		}
+		return u, off + size, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdb: unsupported type %d", typ)
+	}
+}
+
+// geoIP bundles the optional country and ASN databases.
+type geoIP struct {
+	country *mmdb
+	asn     *mmdb
+}
+
+func newGeoIP(countryPath, asnPath string) (*geoIP, error) {
+	g := &geoIP{}
+	var err error
+	if countryPath != "" {
+		if g.country, err = openMMDB(countryPath); err != nil {
+			return nil, err
+		}
+	}
+	if asnPath != "" {
+		if g.asn, err = openMMDB(asnPath); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// countryCode returns the ISO code for ip, or "" when unknown.
+func (g *geoIP) countryCode(ip net.IP) string {
+	if g.country == nil || ip == nil {
+		return ""
+	}
+	rec, err := g.country.lookup(ip)
+	if err != nil || rec == nil {
+		return ""
+	}
+	country, _ := rec["country"].(map[string]any)
+	code, _ := country["iso_code"].(string)
+	return code
+}
+
+// asNumber returns the autonomous system number for ip, or 0.
+func (g *geoIP) asNumber(ip net.IP) uint64 {
+	if g.asn == nil || ip == nil {
+		return 0
+	}
+	rec, err := g.asn.lookup(ip)
+	if err != nil || rec == nil {
+		return 0
+	}
+	return mmdbUint(rec["autonomous_system_number"])
+}
+
+// geoTag stamps the request with the client's origin. The headers are
+// always stripped first so clients cannot spoof them.
+func (p *ProxyServer) geoTag(r *http.Request) {
+	r.Header.Del(geoCountryHeader)
+	r.Header.Del(geoASNHeader)
+	if p.geo == nil {
+		return
+	}
+	ip := net.ParseIP(p.clientIP(r))
+	if cc := p.geo.countryCode(ip); cc != "" {
+		r.Header.Set(geoCountryHeader, cc)
+		p.metrics.Inc(fmt.Sprintf(`clawdbot_proxy_geoip_requests_total{country=%q}`, cc))
+	}
+	if asn := p.geo.asNumber(ip); asn != 0 {
+		r.Header.Set(geoASNHeader, fmt.Sprintf("AS%d", asn))
+	}
+}
+
+// checkGeo enforces the matched route's geo-block= and geo-rate= rules
+// against the tags stamped by geoTag. Returns false when the request was
+// answered.
+func (p *ProxyServer) checkGeo(w http.ResponseWriter, r *http.Request, rt *route) bool {
+	if p.geo == nil || (len(rt.geoBlock) == 0 && len(rt.geoRate) == 0) {
+		return true
+	}
+	cc := r.Header.Get(geoCountryHeader)
+	asn := r.Header.Get(geoASNHeader)
+	for _, origin := range rt.geoBlock {
+		if origin == cc || origin == asn {
+			p.metrics.Inc(`clawdbot_proxy_geo_blocked_total`)
+			p.reqLog(r).Warn("geo blocked", "origin", origin, "path", r.URL.Path, "client", p.clientIP(r))
+			p.httpError(w, r, http.StatusForbidden, "access from your region is not allowed")
+			return false
+		}
+	}
+	for origin, rps := range rt.geoRate {
+		if origin != cc && origin != asn {
+			continue
+		}
+		if !p.limiter.AllowRate("geo:"+origin+":"+p.clientIP(r), rps, rps) {
+			p.metrics.Inc(`clawdbot_proxy_geo_rate_limited_total`)
+			p.httpError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+			return false
+		}
+	}
+	return true
+}
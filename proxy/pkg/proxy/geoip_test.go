@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The tests build tiny but spec-correct .mmdb files by hand: a 24-bit
+// search tree, the 16-byte separator, a data section, and the metadata
+// map after the MaxMind marker.
+
+func encTestString(s string) []byte {
+	return append([]byte{0x40 | byte(len(s))}, s...)
+}
+
+func encTestUint(v uint64) []byte {
+	var payload []byte
+	for v > 0 {
+		payload = append([]byte{byte(v)}, payload...)
+		v >>= 8
+	}
+	return append([]byte{0xa0 | byte(len(payload))}, payload...)
+}
+
+// countryRecord encodes {"country":{"iso_code":code}}.
+func countryRecord(code string) []byte {
+	out := []byte{0xe1}
+	out = append(out, encTestString("country")...)
+	out = append(out, 0xe1)
+	out = append(out, encTestString("iso_code")...)
+	out = append(out, encTestString(code)...)
+	return out
+}
+
+// asnRecord encodes {"autonomous_system_number":asn}.
+func asnRecord(asn uint64) []byte {
+	out := []byte{0xe1}
+	out = append(out, encTestString("autonomous_system_number")...)
+	return append(out, encTestUint(asn)...)
+}
+
+type testNet struct {
+	cidr   string
+	record []byte
+}
+
+type trieNode struct {
+	children [2]*trieNode
+	dataIdx  int // -1 = internal node
+}
+
+func buildTestMMDB(t *testing.T, nets []testNet) string {
+	t.Helper()
+	var data []byte
+	offsets := make([]int, len(nets))
+	for i, n := range nets {
+		offsets[i] = len(data)
+		data = append(data, n.record...)
+	}
+	root := &trieNode{dataIdx: -1}
+	for i, n := range nets {
+		_, ipnet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := ipnet.Mask.Size()
+		addr := ipnet.IP.To4()
+		cur := root
+		for b := 0; b < ones; b++ {
+			bit := (addr[b/8] >> (7 - b%8)) & 1
+			if cur.children[bit] == nil {
+				cur.children[bit] = &trieNode{dataIdx: -1}
+			}
+			cur = cur.children[bit]
+		}
+		cur.dataIdx = i
+	}
+	// BFS over internal nodes to assign tree indices.
+	var internal []*trieNode
+	queue := []*trieNode{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		internal = append(internal, n)
+		for _, c := range n.children {
+			if c != nil && c.dataIdx < 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	index := make(map[*trieNode]int, len(internal))
+	for i, n := range internal {
+		index[n] = i
+	}
+	nodeCount := len(internal)
+	record := func(c *trieNode) int {
+		switch {
+		case c == nil:
+			return nodeCount
+		case c.dataIdx >= 0:
+			return nodeCount + 16 + offsets[c.dataIdx]
+		default:
+			return index[c]
+		}
+	}
+	var tree []byte
+	for _, n := range internal {
+		for _, c := range n.children {
+			r := record(c)
+			tree = append(tree, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	file := append(tree, make([]byte, 16)...)
+	file = append(file, data...)
+	file = append(file, mmdbMarker...)
+	file = append(file, 0xe3)
+	file = append(file, encTestString("node_count")...)
+	file = append(file, encTestUint(uint64(nodeCount))...)
+	file = append(file, encTestString("record_size")...)
+	file = append(file, encTestUint(24)...)
+	file = append(file, encTestString("ip_version")...)
+	file = append(file, encTestUint(4)...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testCountryDB(t *testing.T) string {
+	return buildTestMMDB(t, []testNet{
+		{"10.0.0.0/8", countryRecord("CN")},
+		{"192.0.2.0/24", countryRecord("US")},
+	})
+}
+
+func TestMMDBLookup(t *testing.T) {
+	db, err := openMMDB(testCountryDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &geoIP{country: db}
+	if cc := g.countryCode(net.ParseIP("10.1.2.3")); cc != "CN" {
+		t.Fatalf("10.1.2.3 = %q, want CN", cc)
+	}
+	if cc := g.countryCode(net.ParseIP("192.0.2.55")); cc != "US" {
+		t.Fatalf("192.0.2.55 = %q, want US", cc)
+	}
+	if cc := g.countryCode(net.ParseIP("8.8.8.8")); cc != "" {
+		t.Fatalf("8.8.8.8 = %q, want unknown", cc)
+	}
+}
+
+func TestGeoTagStampsHeadersAndMetrics(t *testing.T) {
+	asnDB := buildTestMMDB(t, []testNet{{"10.0.0.0/8", asnRecord(64512)}})
+	p := newTestProxy(t, &Config{GeoIPDB: testCountryDB(t), GeoIPASNDB: asnDB})
+
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.RemoteAddr = "10.9.9.9:1234"
+	req.Header.Set(geoCountryHeader, "XX") // spoof attempt
+	p.geoTag(req)
+	if got := req.Header.Get(geoCountryHeader); got != "CN" {
+		t.Fatalf("country header = %q, want CN", got)
+	}
+	if got := req.Header.Get(geoASNHeader); got != "AS64512" {
+		t.Fatalf("asn header = %q", got)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_geoip_requests_total{country="CN"}`) != 1 {
+		t.Fatal("labelled counter not incremented")
+	}
+}
+
+func TestGeoRouteBlocking(t *testing.T) {
+	routes := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(routes, []byte("path=/api/ backend=http://127.0.0.1:0 geo-block=CN\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{
+		Backend:   "http://127.0.0.1:0",
+		GeoIPDB:   testCountryDB(t),
+		RouteFile: routes,
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.RemoteAddr = "10.1.1.1:5000"
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("blocked country = %d, want 403", rec.Code)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_geo_blocked_total`) != 1 {
+		t.Fatal("geo block not counted")
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/status", nil)
+	req.RemoteAddr = "192.0.2.10:5000"
+	p.ServeHTTP(rec, req)
+	if rec.Code == http.StatusForbidden {
+		t.Fatalf("allowed country got %d", rec.Code)
+	}
+}
+
+func TestParseRouteGeoTokens(t *testing.T) {
+	rt, err := parseRouteLine("path=/api/ backend=http://x:1 geo-block=cn,AS64512 geo-rate=us:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.geoBlock) != 2 || rt.geoBlock[0] != "CN" || rt.geoBlock[1] != "AS64512" {
+		t.Fatalf("geoBlock = %v", rt.geoBlock)
+	}
+	if rt.geoRate["US"] != 5 {
+		t.Fatalf("geoRate = %v", rt.geoRate)
+	}
+	if _, err := parseRouteLine("path=/api/ backend=http://x:1 geo-rate=us"); err == nil {
+		t.Error("geo-rate without rps should fail")
+	}
+}
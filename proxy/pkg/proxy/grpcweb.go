@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// gRPC support. Native gRPC rides on HTTP/2 with trailers, which the
+// stdlib ReverseProxy forwards as-is: a `grpc` backend route only has to
+// insist that both legs actually speak HTTP/2 (TLS listener in front, TLS
+// backend behind; Go offers no cleartext h2c). Browsers cannot produce
+// that — fetch() exposes no trailers — so `grpc-web` routes translate the
+// gRPC-Web wire format to native gRPC instead: the request body is the
+// same length-prefixed framing (base64-wrapped in -text mode), and the
+// backend's trailers are folded into a final frame flagged 0x80.
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// grpcWebTrailerFlag marks the synthesized trailer frame.
+	grpcWebTrailerFlag = 0x80
+
+	// grpcWebMaxFrame bounds one message in text mode, where a whole frame
+	// must be held for base64 re-chunking.
+	grpcWebMaxFrame = 16 << 20
+)
+
+// isGRPCWeb reports whether the request carries a gRPC-Web body.
+func isGRPCWeb(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// grpcWebHopHeaders never cross the translation boundary.
+var grpcWebHopHeaders = []string{
+	"Connection", "Keep-Alive", "Te", "Transfer-Encoding", "Upgrade",
+	"Content-Length", "Content-Type", "Accept", "X-Grpc-Web",
+}
+
+// handleGRPCWeb translates one gRPC-Web request into a native gRPC call
+// against target and folds the response trailers back into the body.
+func (p *ProxyServer) handleGRPCWeb(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	ct := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(ct, grpcWebTextContentType)
+	// Preserve the message encoding suffix (+proto, +json) end to end.
+	suffix := ""
+	if i := strings.IndexByte(ct, '+'); i >= 0 {
+		suffix = ct[i:]
+	}
+	p.metrics.Inc(`clawdbot_proxy_grpc_web_requests_total`)
+
+	var body io.Reader = r.Body
+	if text {
+		body = base64.NewDecoder(base64.StdEncoding, r.Body)
+	}
+	out := *target
+	out.Path = r.URL.Path
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, out.String(), body)
+	if err != nil {
+		p.httpError(w, r, http.StatusBadGateway, "backend request failed")
+		return
+	}
+	for name, vals := range r.Header {
+		if grpcWebSkipHeader(name) {
+			continue
+		}
+		req.Header[name] = vals
+	}
+	req.Header.Set("Content-Type", grpcContentType+suffix)
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("X-Forwarded-For", p.clientIP(r))
+
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		p.metrics.Inc(`clawdbot_proxy_backend_errors_total`)
+		p.reqLog(r).Error("grpc-web upstream failed", "path", r.URL.Path, "error", err)
+		p.httpError(w, r, http.StatusBadGateway, "backend request failed")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor < 2 {
+		p.reqLog(r).Error("grpc-web backend answered over HTTP/1; gRPC needs an HTTP/2 (https) backend")
+		p.httpError(w, r, http.StatusBadGateway, "backend request failed")
+		return
+	}
+
+	h := w.Header()
+	for name, vals := range resp.Header {
+		if grpcWebSkipHeader(name) || name == "Trailer" {
+			continue
+		}
+		h[name] = vals
+	}
+	respCT := grpcWebContentType + suffix
+	if text {
+		respCT = grpcWebTextContentType + suffix
+	}
+	h.Set("Content-Type", respCT)
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	emit := func(b []byte) error {
+		if text {
+			// Each frame becomes its own padded base64 chunk, matching
+			// what grpc-web clients split on.
+			enc := make([]byte, base64.StdEncoding.EncodedLen(len(b)))
+			base64.StdEncoding.Encode(enc, b)
+			b = enc
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	if err := relayGRPCFrames(emit, resp.Body, text); err != nil {
+		// Mid-stream failure: the frame stream is already corrupt, so all
+		// that is left is to stop; the missing trailer frame tells the
+		// client the call died.
+		p.reqLog(r).Warn("grpc-web stream aborted", "path", r.URL.Path, "error", err)
+		return
+	}
+	emit(grpcWebTrailerFrame(resp))
+}
+
+// relayGRPCFrames forwards data frames from the backend. Binary mode can
+// stream raw bytes; text mode must re-chunk on frame boundaries so each
+// base64 segment decodes independently.
+func relayGRPCFrames(emit func([]byte) error, src io.Reader, text bool) error {
+	if !text {
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				if werr := emit(buf[:n]); werr != nil {
+					return werr
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		n := binary.BigEndian.Uint32(header[1:])
+		if n > grpcWebMaxFrame {
+			return fmt.Errorf("grpc frame of %d bytes exceeds limit", n)
+		}
+		frame := make([]byte, 5+n)
+		copy(frame, header)
+		if _, err := io.ReadFull(src, frame[5:]); err != nil {
+			return err
+		}
+		if err := emit(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// grpcWebTrailerFrame folds the response trailers into the 0x80-flagged
+// frame gRPC-Web clients read the call status from. Trailers-only
+// responses carry grpc-status in the headers instead; a backend that
+// provided neither gets the canonical "internal" code so the client does
+// not hang.
+func grpcWebTrailerFrame(resp *http.Response) []byte {
+	trailers := resp.Trailer
+	if len(trailers) == 0 {
+		trailers = make(http.Header)
+		for _, name := range []string{"Grpc-Status", "Grpc-Message"} {
+			if v := resp.Header.Get(name); v != "" {
+				trailers.Set(name, v)
+			}
+		}
+	}
+	if trailers.Get("Grpc-Status") == "" {
+		trailers.Set("Grpc-Status", "2")
+		trailers.Set("Grpc-Message", "missing grpc-status trailer")
+	}
+	names := make([]string, 0, len(trailers))
+	for name := range trailers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		for _, v := range trailers[name] {
+			// Trailer keys go lowercase on the wire, per the gRPC-Web spec.
+			fmt.Fprintf(&b, "%s: %s\r\n", strings.ToLower(name), v)
+		}
+	}
+	frame := make([]byte, 5+b.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(b.Len()))
+	copy(frame[5:], b.String())
+	return frame
+}
+
+func grpcWebSkipHeader(name string) bool {
+	for _, h := range grpcWebHopHeaders {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func grpcFrame(flag byte, payload []byte) []byte {
+	f := make([]byte, 5+len(payload))
+	f[0] = flag
+	binary.BigEndian.PutUint32(f[1:], uint32(len(payload)))
+	copy(f[5:], payload)
+	return f
+}
+
+// startGRPCBackend fakes a unary gRPC server over HTTP/2: it echoes the
+// request message and reports grpc-status 0 via trailers.
+func startGRPCBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType) {
+			http.Error(w, "not grpc", http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body) // echo the data frame untouched
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "ok")
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func grpcWebProxy(t *testing.T, backendURL string) string {
+	t.Helper()
+	routes := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(routes, []byte("path=/echo.Echo/ backend="+backendURL+" grpc-web\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return startProxy(t, &Config{Backend: backendURL, UpstreamSkipVerify: true, RouteFile: routes})
+}
+
+func TestGRPCWebTranslation(t *testing.T) {
+	backend := startGRPCBackend(t)
+	addr := grpcWebProxy(t, backend.URL)
+
+	msg := grpcFrame(0, []byte("ping"))
+	resp, err := http.Post("http://"+addr+"/echo.Echo/Ping", "application/grpc-web+proto", bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, grpcWebContentType) {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.HasPrefix(body, msg) {
+		t.Fatalf("echoed frame missing: %x", body)
+	}
+	rest := body[len(msg):]
+	if len(rest) < 5 || rest[0] != grpcWebTrailerFlag {
+		t.Fatalf("no trailer frame: %x", rest)
+	}
+	trailers := string(rest[5:])
+	if !strings.Contains(trailers, "grpc-status: 0") || !strings.Contains(trailers, "grpc-message: ok") {
+		t.Fatalf("trailer block = %q", trailers)
+	}
+}
+
+func TestGRPCWebTextTranslation(t *testing.T) {
+	backend := startGRPCBackend(t)
+	addr := grpcWebProxy(t, backend.URL)
+
+	msg := grpcFrame(0, []byte("ping"))
+	encoded := base64.StdEncoding.EncodeToString(msg)
+	resp, err := http.Post("http://"+addr+"/echo.Echo/Ping", "application/grpc-web-text+proto", strings.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, grpcWebTextContentType) {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	// Each frame is its own padded base64 chunk; the first decodes to the
+	// echoed message.
+	first := string(raw[:base64.StdEncoding.EncodedLen(len(msg))])
+	got, err := base64.StdEncoding.DecodeString(first)
+	if err != nil {
+		t.Fatalf("decoding first chunk: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("first frame = %x, want %x", got, msg)
+	}
+	second, err := base64.StdEncoding.DecodeString(string(raw[len(first):]))
+	if err != nil {
+		t.Fatalf("decoding trailer chunk: %v", err)
+	}
+	if second[0] != grpcWebTrailerFlag || !strings.Contains(string(second[5:]), "grpc-status: 0") {
+		t.Fatalf("trailer frame = %x", second)
+	}
+}
+
+func TestGRPCWebTrailerFrameFallbacks(t *testing.T) {
+	// Trailers-only response: status lives in the headers.
+	resp := &http.Response{Header: http.Header{"Grpc-Status": {"5"}}}
+	f := grpcWebTrailerFrame(resp)
+	if !strings.Contains(string(f[5:]), "grpc-status: 5") {
+		t.Fatalf("trailer frame = %q", f[5:])
+	}
+	// Neither trailers nor headers: synthesize internal so clients fail fast.
+	f = grpcWebTrailerFrame(&http.Response{Header: http.Header{}})
+	if !strings.Contains(string(f[5:]), "grpc-status: 2") {
+		t.Fatalf("trailer frame = %q", f[5:])
+	}
+}
+
+func TestGRPCRouteRejectsHTTP1(t *testing.T) {
+	routes := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(routes, []byte("path=/echo.Echo/ backend=http://127.0.0.1:0 grpc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	addr := startProxy(t, &Config{Backend: "http://127.0.0.1:0", RouteFile: routes})
+	resp, err := http.Post("http://"+addr+"/echo.Echo/Ping", "application/grpc", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusHTTPVersionNotSupported {
+		t.Fatalf("status = %d, want 505", resp.StatusCode)
+	}
+}
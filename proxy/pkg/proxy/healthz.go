@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Liveness and readiness probes. /livez only proves the process is alive
+// and serving; /readyz additionally runs dependency checks — backend
+// reachable, static dir readable, listener certificate valid, request
+// capacity left — and answers 503 when one fails. -ready-checks selects
+// which checks run; checks for features that are not configured pass
+// automatically. Both endpoints answer terse JSON by default and
+// per-check detail with ?verbose=1. /health and /ready stay for
+// compatibility.
+
+// readyCheckNames are the checks -ready-checks may enable.
+var readyCheckNames = map[string]bool{
+	"backend": true,
+	"static":  true,
+	"cert":    true,
+	"conns":   true,
+}
+
+// runReadyChecks evaluates the configured checks; nil errors mean pass.
+func (p *ProxyServer) runReadyChecks() map[string]error {
+	enabled := p.cfg.ReadyChecks
+	if len(enabled) == 0 {
+		enabled = []string{"backend", "static", "cert", "conns"}
+	}
+	results := make(map[string]error, len(enabled))
+	for _, name := range enabled {
+		switch name {
+		case "backend":
+			results[name] = p.checkBackendReady()
+		case "static":
+			results[name] = p.checkStaticReady()
+		case "cert":
+			results[name] = p.checkCertReady()
+		case "conns":
+			results[name] = p.checkConnsReady()
+		}
+	}
+	return results
+}
+
+func (p *ProxyServer) checkBackendReady() error {
+	if !p.ready.Load() {
+		return fmt.Errorf("waiting for backend startup probe")
+	}
+	if !p.probeReady() {
+		return fmt.Errorf("backend %s not answering", p.cfg.Backend)
+	}
+	return nil
+}
+
+func (p *ProxyServer) checkStaticReady() error {
+	if p.cfg.StaticDir == "" {
+		return nil // embedded UI or API-only deployment
+	}
+	info, err := os.Stat(p.cfg.StaticDir)
+	if err != nil {
+		return fmt.Errorf("static dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("static dir %s is not a directory", p.cfg.StaticDir)
+	}
+	return nil
+}
+
+func (p *ProxyServer) checkCertReady() error {
+	if p.certs == nil {
+		return nil
+	}
+	if expiry := p.certs.expiresAt(); time.Now().After(expiry) {
+		return fmt.Errorf("certificate expired %s", expiry.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (p *ProxyServer) checkConnsReady() error {
+	if p.inflight == nil {
+		return nil
+	}
+	if len(p.inflight.slots) >= cap(p.inflight.slots) {
+		return fmt.Errorf("all %d request slots in use", cap(p.inflight.slots))
+	}
+	return nil
+}
+
+func (p *ProxyServer) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("verbose") == "" {
+		fmt.Fprint(w, "{\"status\":\"ok\"}\n")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":     "ok",
+		"uptime":     time.Since(p.started).Round(time.Second).String(),
+		"goroutines": runtime.NumGoroutine(),
+	})
+}
+
+func (p *ProxyServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	results := p.runReadyChecks()
+	var failed []string
+	detail := make(map[string]string, len(results))
+	for name, err := range results {
+		if err != nil {
+			failed = append(failed, name)
+			detail[name] = err.Error()
+			continue
+		}
+		detail[name] = "ok"
+	}
+	status := "ready"
+	code := http.StatusOK
+	if len(failed) > 0 {
+		status = "unready"
+		code = http.StatusServiceUnavailable
+		p.metrics.Inc(`clawdbot_proxy_readyz_failures_total`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	body := map[string]any{"status": status}
+	if r.URL.Query().Get("verbose") != "" {
+		body["checks"] = detail
+	} else if len(failed) > 0 {
+		body["failed"] = failed
+	}
+	json.NewEncoder(w).Encode(body)
+}
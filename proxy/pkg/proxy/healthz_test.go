@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLivezAlwaysOK(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: "http://127.0.0.1:1"})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/livez?verbose=1", nil))
+	var detail map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail["uptime"] == nil || detail["goroutines"] == nil {
+		t.Fatalf("verbose detail = %v", detail)
+	}
+}
+
+func TestReadyzChecksBackend(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+	p := newTestProxy(t, &Config{Backend: backend.URL})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d body %q", rec.Code, rec.Body.String())
+	}
+
+	backend.Close()
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz?verbose=1", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status with backend down = %d, want 503", rec.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	checks := body["checks"].(map[string]any)
+	if checks["backend"] == "ok" {
+		t.Fatalf("backend check passed with backend down: %v", checks)
+	}
+	if checks["static"] != "ok" || checks["cert"] != "ok" || checks["conns"] != "ok" {
+		t.Fatalf("unconfigured checks should pass: %v", checks)
+	}
+}
+
+func TestReadyzConfigurableChecks(t *testing.T) {
+	// Only the static check is enabled, so an unreachable backend does not
+	// fail readiness.
+	p := newTestProxy(t, &Config{
+		Backend:     "http://127.0.0.1:1",
+		ReadyChecks: []string{"static"},
+	})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d body %q", rec.Code, rec.Body.String())
+	}
+
+	p = newTestProxy(t, &Config{
+		Backend:     "http://127.0.0.1:1",
+		StaticDir:   "/nonexistent-dir",
+		ReadyChecks: []string{"static"},
+	})
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("missing static dir not caught: %d", rec.Code)
+	}
+}
+
+func TestReadyChecksValidation(t *testing.T) {
+	if err := (&Config{Backend: "http://x", ReadyChecks: []string{"bogus"}}).validate(); err == nil {
+		t.Fatal("unknown ready check accepted")
+	}
+}
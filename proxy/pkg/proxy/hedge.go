@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Request hedging. Tail latency on idempotent reads is usually one slow
+// backend instance, not the request itself: firing a second copy after a
+// P99-ish delay and keeping whichever answers first trades a little extra
+// backend load for a much tighter tail. Only GET and HEAD are hedged —
+// anything with side effects must not run twice — and the loser's context
+// is cancelled so it stops burning backend time.
+
+// hedgedTransport races a delayed second attempt against the first. alt
+// picks a different backend for the hedge when a pool is configured; nil
+// (or a nil return) re-dials the same target, which still helps when the
+// slowness is a single bad connection.
+type hedgedTransport struct {
+	base    http.RoundTripper
+	delay   time.Duration
+	alt     func(exclude string) *url.URL
+	metrics *Metrics
+}
+
+type hedgeResult struct {
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+	hedge  bool
+}
+
+func (h *hedgedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return h.base.RoundTrip(req)
+	}
+	results := make(chan hedgeResult, 2)
+	attempt := func(r *http.Request, hedge bool) {
+		ctx, cancel := context.WithCancel(req.Context())
+		go func() {
+			resp, err := h.base.RoundTrip(r.WithContext(ctx))
+			results <- hedgeResult{resp: resp, err: err, cancel: cancel, hedge: hedge}
+		}()
+	}
+	attempt(req, false)
+
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+	outstanding := 1
+	hedged := false
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if hedged {
+				continue
+			}
+			hedged = true
+			outstanding++
+			clone := req.Clone(req.Context())
+			if h.alt != nil {
+				if u := h.alt(req.URL.Host); u != nil {
+					clone.URL.Scheme, clone.URL.Host = u.Scheme, u.Host
+				}
+			}
+			h.metrics.Inc(`clawdbot_proxy_hedged_requests_total`)
+			attempt(clone, true)
+		case res := <-results:
+			outstanding--
+			if res.err != nil {
+				res.cancel()
+				if firstErr == nil {
+					firstErr = res.err
+				}
+				if outstanding > 0 {
+					continue // the other attempt may still win
+				}
+				return nil, firstErr
+			}
+			if res.hedge {
+				h.metrics.Inc(`clawdbot_proxy_hedge_wins_total`)
+			}
+			if outstanding > 0 {
+				// Reap the loser in the background: cancelling alone would
+				// leak its response body if it was already in flight.
+				go func() {
+					lose := <-results
+					lose.cancel()
+					if lose.resp != nil {
+						io.Copy(io.Discard, lose.resp.Body)
+						lose.resp.Body.Close()
+					}
+				}()
+			}
+			// The winner's context must outlive RoundTrip; tie its cancel
+			// to the body so ReverseProxy's Close releases it.
+			res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+			return res.resp, nil
+		}
+	}
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// altBackend returns a pool target other than exclude for the hedged
+// attempt, or nil when there is no pool (or no other healthy target).
+func (p *ProxyServer) altBackend(exclude string) *url.URL {
+	if p.lb == nil {
+		return nil
+	}
+	for _, t := range p.lb.targets() {
+		if t.healthy() && t.url.Host != exclude {
+			return t.url
+		}
+	}
+	return nil
+}
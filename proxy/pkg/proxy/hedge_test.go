@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHedgeSecondAttemptWins(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+			io.WriteString(w, "slow")
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fast")
+	}))
+	defer fast.Close()
+
+	fastURL, _ := url.Parse(fast.URL)
+	ht := &hedgedTransport{
+		base:    http.DefaultTransport,
+		delay:   50 * time.Millisecond,
+		alt:     func(string) *url.URL { return fastURL },
+		metrics: NewMetrics(),
+	}
+	req, _ := http.NewRequest(http.MethodGet, slow.URL+"/thing", nil)
+	start := time.Now()
+	resp, err := ht.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "fast" {
+		t.Fatalf("body = %q, want the hedged response", body)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("hedged request took %v", time.Since(start))
+	}
+	if ht.metrics.Counter(`clawdbot_proxy_hedge_wins_total`) != 1 {
+		t.Fatal("hedge win not counted")
+	}
+}
+
+func TestHedgeFirstAttemptWinsWithoutHedging(t *testing.T) {
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer fast.Close()
+	ht := &hedgedTransport{base: http.DefaultTransport, delay: time.Second, metrics: NewMetrics()}
+	req, _ := http.NewRequest(http.MethodGet, fast.URL, nil)
+	resp, err := ht.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if ht.metrics.Counter(`clawdbot_proxy_hedged_requests_total`) != 0 {
+		t.Fatal("fast request should not have hedged")
+	}
+}
+
+func TestHedgeSkipsNonIdempotentMethods(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		time.Sleep(150 * time.Millisecond)
+	}))
+	defer srv.Close()
+	ht := &hedgedTransport{base: http.DefaultTransport, delay: 10 * time.Millisecond, metrics: NewMetrics()}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("payload"))
+	resp, err := ht.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits != 1 {
+		t.Fatalf("POST hit the backend %d times", hits)
+	}
+}
+
+func TestParseRouteHedge(t *testing.T) {
+	rt, err := parseRouteLine("path=/api/models backend=http://x:1 hedge=200ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.hedgeDelay != 200*time.Millisecond {
+		t.Fatalf("hedgeDelay = %v", rt.hedgeDelay)
+	}
+	for _, line := range []string{
+		"path=/api/ backend=http://x:1 hedge=0",
+		"path=/s static=/tmp hedge=100ms",
+	} {
+		if _, err := parseRouteLine(line); err == nil {
+			t.Errorf("parseRouteLine(%q) succeeded, want error", line)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwtLeeway absorbs small clock skew between the IdP and the proxy host.
+const jwtLeeway = 60 * time.Second
+
+var errJWTInvalid = errors.New("invalid token")
+
+// JWTVerifier validates HS256 tokens against a shared secret and RS256
+// tokens against keys from a JWKS endpoint.
+type JWTVerifier struct {
+	secret []byte
+	jwks   *jwksCache
+}
+
+func NewJWTVerifier(secret string, jwksURL string) *JWTVerifier {
+	v := &JWTVerifier{}
+	if secret != "" {
+		v.secret = []byte(secret)
+	}
+	if jwksURL != "" {
+		v.jwks = &jwksCache{url: jwksURL, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return v
+}
+
+// Verify checks the compact token's signature and time claims, returning the
+// payload claims on success.
+func (v *JWTVerifier) Verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTInvalid
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errJWTInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errJWTInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTInvalid
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if v.secret == nil {
+			return nil, errors.New("HS256 token but no jwt-secret configured")
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if subtle.ConstantTimeCompare(mac.Sum(nil), sig) != 1 {
+			return nil, errJWTInvalid
+		}
+	case "RS256":
+		if v.jwks == nil {
+			return nil, errors.New("RS256 token but no jwt-jwks-url configured")
+		}
+		key, err := v.jwks.key(header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errJWTInvalid
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errJWTInvalid
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+		return nil, errJWTInvalid
+	}
+	now := time.Now()
+	if exp, ok := numericClaim(claims, "exp"); ok && now.After(time.Unix(exp, 0).Add(jwtLeeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(jwtLeeway).Before(time.Unix(nbf, 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	return claims, nil
+}
+
+func numericClaim(claims map[string]any, name string) (int64, bool) {
+	v, ok := claims[name].(float64)
+	return int64(v), ok
+}
+
+// jwksCache fetches and caches RSA keys from a JWKS URL, refreshing at most
+// once a minute when an unknown kid shows up (key rotation).
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	lastFetch time.Time
+}
+
+func (c *jwksCache) key(kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(c.lastFetch) < time.Minute && c.keys != nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if err := c.fetchLocked(); err != nil {
+		return nil, err
+	}
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (c *jwksCache) fetchLocked() error {
+	c.lastFetch = time.Now()
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: status %d", resp.StatusCode)
+	}
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("parsing JWKS: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}
+	}
+	c.keys = keys
+	return nil
+}
+
+// checkJWT enforces bearer-token auth on configured path prefixes. Verified
+// identity claims are forwarded as X-Claw-* headers; inbound X-Claw-*
+// headers are always stripped so clients cannot spoof them.
+func (p *ProxyServer) checkJWT(w http.ResponseWriter, r *http.Request) bool {
+	stripClawHeaders(r.Header)
+	// A verified OIDC session (see checkOIDC) stamps its claims after the
+	// strip and satisfies edge auth for browser API calls.
+	if s := oidcSessionFrom(r); s != nil {
+		s.forwardClaims(r.Header)
+		return true
+	}
+	if p.jwt == nil || !pathHasPrefix(r.URL.Path, p.cfg.JWTAuthPaths) {
+		return true
+	}
+	token, ok := bearerToken(r)
+	if !ok {
+		p.unauthorized(w, r, "missing bearer token")
+		return false
+	}
+	claims, err := p.jwt.Verify(token)
+	if err != nil {
+		p.metrics.Inc(`clawdbot_proxy_auth_failures_total{kind="jwt"}`)
+		p.log.Warn("jwt rejected", "path", r.URL.Path, "client", p.clientIP(r), "error", err)
+		p.unauthorized(w, r, "invalid token")
+		return false
+	}
+	if sub, ok := claims["sub"].(string); ok {
+		r.Header.Set("X-Claw-User", sub)
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		r.Header.Set("X-Claw-Scopes", scope)
+	}
+	return true
+}
+
+// stripClawHeaders drops inbound X-Claw-* headers. It runs even when a
+// listener policy skips auth so identity headers stay unspoofable.
+func stripClawHeaders(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(name, "X-Claw-") {
+			h.Del(name)
+		}
+	}
+}
+
+func (p *ProxyServer) unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="clawdbot"`)
+	p.httpError(w, r, http.StatusUnauthorized, msg)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return auth[len(prefix):], true
+	}
+	return "", false
+}
+
+func pathHasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
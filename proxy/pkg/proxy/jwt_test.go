@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signHS256(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	return buildJWT(t, map[string]any{"alg": "HS256", "typ": "JWT"}, claims, func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	})
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	return buildJWT(t, map[string]any{"alg": "RS256", "kid": kid}, claims, func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	})
+}
+
+func buildJWT(t *testing.T, header, claims map[string]any, sign func([]byte) []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestJWTVerifyHS256(t *testing.T) {
+	v := NewJWTVerifier("topsecret", "")
+	token := signHS256(t, "topsecret", map[string]any{
+		"sub": "peter",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims["sub"] != "peter" {
+		t.Errorf("sub = %v, want peter", claims["sub"])
+	}
+}
+
+func TestJWTRejectsBadSignature(t *testing.T) {
+	v := NewJWTVerifier("topsecret", "")
+	token := signHS256(t, "wrong-secret", map[string]any{"sub": "mallory"})
+	if _, err := v.Verify(token); err == nil {
+		t.Error("token signed with wrong secret must be rejected")
+	}
+}
+
+func TestJWTRejectsExpired(t *testing.T) {
+	v := NewJWTVerifier("topsecret", "")
+	token := signHS256(t, "topsecret", map[string]any{
+		"sub": "peter",
+		"exp": time.Now().Add(-2 * time.Hour).Unix(),
+	})
+	if _, err := v.Verify(token); err == nil {
+		t.Error("expired token must be rejected")
+	}
+}
+
+func TestJWTVerifyRS256ViaJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString([]byte{1, 0, 1}))
+	}))
+	defer jwks.Close()
+
+	v := NewJWTVerifier("", jwks.URL)
+	token := signRS256(t, key, "k1", map[string]any{
+		"sub": "agent-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims["sub"] != "agent-1" {
+		t.Errorf("sub = %v, want agent-1", claims["sub"])
+	}
+
+	if _, err := v.Verify(signRS256(t, key, "unknown-kid", map[string]any{"sub": "x"})); err == nil {
+		t.Error("token with unknown kid must be rejected")
+	}
+}
+
+func TestCheckJWTStripsSpoofedHeaders(t *testing.T) {
+	p := &ProxyServer{cfg: &Config{}, metrics: NewMetrics()}
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("X-Claw-User", "spoofed")
+	if !p.checkJWT(httptest.NewRecorder(), r) {
+		t.Fatal("request should pass when JWT auth is disabled")
+	}
+	if r.Header.Get("X-Claw-User") != "" {
+		t.Error("inbound X-Claw-User must be stripped")
+	}
+}
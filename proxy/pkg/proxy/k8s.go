@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kubernetes backend discovery: "-backend k8s://namespace/service:port"
+// watches the service's EndpointSlices from inside the cluster and routes
+// to ready pod IPs directly, bypassing kube-proxy. Credentials come from
+// the pod's service account; a watch stream keeps membership current and
+// any hiccup falls back to a fresh list. Pods that fail readiness drop out
+// of the slices (and the pool); pods that merely misbehave are ejected
+// passively by the pool's down-marking.
+
+const k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+type k8sDiscovery struct {
+	apiserver string // https://host:port of the API server
+	namespace string
+	service   string
+	port      string
+	client    *http.Client
+	token     string
+	pool      *backendPool
+	metrics   *Metrics
+	log       *slog.Logger
+
+	resourceVersion string
+	lastHosts       string
+}
+
+// parseK8sBackend splits "k8s://namespace/service:port".
+func parseK8sBackend(raw string) (namespace, service, port string, err error) {
+	rest := strings.TrimPrefix(raw, "k8s://")
+	namespace, svcPort, ok := strings.Cut(rest, "/")
+	if !ok || namespace == "" {
+		return "", "", "", fmt.Errorf("-backend wants k8s://namespace/service:port, got %q", raw)
+	}
+	service, port, ok = strings.Cut(svcPort, ":")
+	if !ok || service == "" || port == "" || strings.Contains(port, "/") {
+		return "", "", "", fmt.Errorf("-backend wants k8s://namespace/service:port, got %q", raw)
+	}
+	return namespace, service, port, nil
+}
+
+// newK8sDiscovery wires up in-cluster credentials. It fails when not
+// running inside a pod (no API server env, no service account mount).
+func (p *ProxyServer) newK8sDiscovery(namespace, service, port string) (*k8sDiscovery, error) {
+	host, apiPort := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || apiPort == "" {
+		return nil, fmt.Errorf("k8s:// backends need in-cluster credentials (KUBERNETES_SERVICE_HOST is unset)")
+	}
+	token, err := os.ReadFile(k8sServiceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	caPEM, err := os.ReadFile(k8sServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("service account CA contains no certificates")
+	}
+	d := &k8sDiscovery{
+		apiserver: "https://" + net.JoinHostPort(host, apiPort),
+		namespace: namespace,
+		service:   service,
+		port:      port,
+		token:     strings.TrimSpace(string(token)),
+		client: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: cas, MinVersion: tls.VersionTLS12},
+		}},
+		pool:    p.lb,
+		metrics: p.metrics,
+		log:     p.log,
+	}
+	return d, nil
+}
+
+func (d *k8sDiscovery) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.apiserver+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("apiserver: status %d for %s", resp.StatusCode, path)
+	}
+	return resp, nil
+}
+
+// endpointSlice is the subset of discovery.k8s.io/v1 we consume.
+type endpointSlice struct {
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+}
+
+func (d *k8sDiscovery) slicesPath(watch bool) string {
+	q := url.Values{"labelSelector": {"kubernetes.io/service-name=" + d.service}}
+	if watch {
+		q.Set("watch", "true")
+		if d.resourceVersion != "" {
+			q.Set("resourceVersion", d.resourceVersion)
+		}
+	}
+	return "/apis/discovery.k8s.io/v1/namespaces/" + url.PathEscape(d.namespace) + "/endpointslices?" + q.Encode()
+}
+
+// list fetches all slices for the service and rebuilds the pool from the
+// ready addresses.
+func (d *k8sDiscovery) list(ctx context.Context) error {
+	resp, err := d.get(ctx, d.slicesPath(false))
+	if err != nil {
+		d.metrics.Inc(`clawdbot_proxy_discovery_errors_total`)
+		return err
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []endpointSlice `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		d.metrics.Inc(`clawdbot_proxy_discovery_errors_total`)
+		return fmt.Errorf("parsing endpointslices: %w", err)
+	}
+	d.resourceVersion = doc.Metadata.ResourceVersion
+	var hosts []string
+	for _, slice := range doc.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				hosts = append(hosts, net.JoinHostPort(addr, d.port))
+			}
+		}
+	}
+	sort.Strings(hosts)
+	joined := strings.Join(hosts, ",")
+	if joined == d.lastHosts {
+		return nil
+	}
+	d.lastHosts = joined
+	urls := make([]*url.URL, 0, len(hosts))
+	for _, h := range hosts {
+		urls = append(urls, &url.URL{Scheme: "http", Host: h})
+	}
+	d.pool.setTargets(urls)
+	d.metrics.Inc(`clawdbot_proxy_discovery_updates_total`)
+	d.log.Info("backend pool updated from endpointslices", "service", d.service, "ready_pods", len(urls))
+	return nil
+}
+
+// watchOnce holds a watch stream open and re-lists whenever any slice for
+// the service changes. Re-listing one service is cheap and sidesteps the
+// bookkeeping a full informer cache would need.
+func (d *k8sDiscovery) watchOnce(ctx context.Context) error {
+	resp, err := d.get(ctx, d.slicesPath(true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+			return fmt.Errorf("parsing watch event: %w", err)
+		}
+		if event.Type == "ERROR" {
+			d.resourceVersion = "" // watermark too old; full re-list
+			return fmt.Errorf("watch expired")
+		}
+		if err := d.list(ctx); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// start runs the list+watch loop for the life of the process.
+func (d *k8sDiscovery) start() {
+	go func() {
+		for {
+			ctx := context.Background()
+			if err := d.watchOnce(ctx); err != nil {
+				d.log.Warn("endpointslice watch failed", "service", d.service, "error", err)
+				time.Sleep(5 * time.Second)
+				if err := d.list(ctx); err != nil {
+					d.log.Warn("endpointslice re-list failed", "service", d.service, "error", err)
+				}
+			}
+		}
+	}()
+}
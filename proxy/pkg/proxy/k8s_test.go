@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseK8sBackend(t *testing.T) {
+	ns, svc, port, err := parseK8sBackend("k8s://clawdbot/gateway:18790")
+	if err != nil {
+		t.Fatalf("parseK8sBackend: %v", err)
+	}
+	if ns != "clawdbot" || svc != "gateway" || port != "18790" {
+		t.Errorf("parsed %q/%q:%q", ns, svc, port)
+	}
+	for _, bad := range []string{"k8s://gateway:18790", "k8s://ns/gateway", "k8s://"} {
+		if _, _, _, err := parseK8sBackend(bad); err == nil {
+			t.Errorf("parseK8sBackend(%q) should fail", bad)
+		}
+	}
+}
+
+func TestK8sListFiltersUnreadyPods(t *testing.T) {
+	var generation atomic.Int32
+	apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/clawdbot/endpointslices" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=gateway" {
+			t.Errorf("labelSelector = %q", r.URL.Query().Get("labelSelector"))
+		}
+		if generation.Load() == 0 {
+			fmt.Fprint(w, `{"metadata":{"resourceVersion":"41"},"items":[{"endpoints":[
+				{"addresses":["10.1.0.5"],"conditions":{"ready":true}},
+				{"addresses":["10.1.0.6"],"conditions":{"ready":false}}]}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"metadata":{"resourceVersion":"42"},"items":[{"endpoints":[
+			{"addresses":["10.1.0.5"],"conditions":{"ready":true}},
+			{"addresses":["10.1.0.6"],"conditions":{"ready":true}}]}]}`)
+	}))
+	defer apiserver.Close()
+
+	p := newTestProxy(t, &Config{Backend: "http://127.0.0.1:0", StickyCookie: "clawdbot_backend"})
+	p.lb = p.newBackendPool(nil)
+	d := &k8sDiscovery{
+		apiserver: apiserver.URL,
+		namespace: "clawdbot",
+		service:   "gateway",
+		port:      "18790",
+		client:    apiserver.Client(),
+		pool:      p.lb,
+		metrics:   p.metrics,
+		log:       discardLogger(),
+	}
+
+	if err := d.list(context.Background()); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	ts := p.lb.targets()
+	if len(ts) != 1 || ts[0].url.Host != "10.1.0.5:18790" {
+		t.Fatalf("pool = %v, want only the ready pod", ts)
+	}
+	if d.resourceVersion != "41" {
+		t.Errorf("resourceVersion = %q, want 41", d.resourceVersion)
+	}
+
+	// The second pod becoming ready joins the pool on the next list.
+	generation.Store(1)
+	if err := d.list(context.Background()); err != nil {
+		t.Fatalf("second list: %v", err)
+	}
+	if got := len(p.lb.targets()); got != 2 {
+		t.Errorf("pool size after readiness = %d, want 2", got)
+	}
+}
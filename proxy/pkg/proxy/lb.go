@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Session affinity across multiple gateway backends. -backend accepts a
+// comma-separated list; the first request is assigned round-robin and
+// pinned with an HMAC-signed cookie so later API calls and WebSocket
+// reconnects land on the same instance. Failures mark a target down for a
+// cooldown (passive detection, no active probes) and pinned clients fail
+// over to the next healthy backend. The target list can be swapped at
+// runtime (DNS or registry discovery); pins name the target host, so they
+// survive membership changes as long as the pinned instance is still there.
+
+// stickyDownCooldown is how long a target sits out after a request to it
+// fails before traffic is tried again.
+const stickyDownCooldown = 10 * time.Second
+
+type lbTarget struct {
+	url   *url.URL
+	proxy *httputil.ReverseProxy
+
+	// downUntil holds unix nanos; zero (or the past) means healthy.
+	downUntil atomic.Int64
+
+	// stats is non-nil when outlier detection is on (see outlier.go).
+	stats *outlierStats
+}
+
+func (t *lbTarget) healthy() bool {
+	return time.Now().UnixNano() >= t.downUntil.Load()
+}
+
+type backendPool struct {
+	cur      atomic.Pointer[[]*lbTarget]
+	next     atomic.Uint64
+	cookie   string
+	secret   []byte
+	metrics  *Metrics
+	outliers bool
+
+	// buildProxy comes from the owning ProxyServer so replacement targets
+	// share the tuned transport and error handling.
+	buildProxy func(*url.URL) *httputil.ReverseProxy
+}
+
+// newBackendPool builds per-target proxies that share the tuned transport.
+// An empty secret gets a random one, which means pins do not survive a
+// proxy restart; set -sticky-secret to keep them stable across restarts
+// and proxy replicas.
+func (p *ProxyServer) newBackendPool(targets []*url.URL) *backendPool {
+	b := &backendPool{
+		cookie:     p.cfg.StickyCookie,
+		secret:     []byte(p.cfg.StickySecret),
+		metrics:    p.metrics,
+		outliers:   p.cfg.OutlierDetection,
+		buildProxy: p.newReverseProxy,
+	}
+	if len(b.secret) == 0 {
+		b.secret = make([]byte, 32)
+		rand.Read(b.secret)
+	}
+	b.setTargets(targets)
+	return b
+}
+
+func (b *backendPool) targets() []*lbTarget {
+	if ts := b.cur.Load(); ts != nil {
+		return *ts
+	}
+	return nil
+}
+
+// setTargets atomically replaces the pool membership. Targets that stay
+// keep their health state; new ones get a fresh proxy on the shared
+// transport.
+func (b *backendPool) setTargets(urls []*url.URL) {
+	old := make(map[string]*lbTarget)
+	for _, t := range b.targets() {
+		old[t.url.Host] = t
+	}
+	fresh := make([]*lbTarget, 0, len(urls))
+	for _, u := range urls {
+		if t, ok := old[u.Host]; ok && t.url.Scheme == u.Scheme {
+			fresh = append(fresh, t)
+			continue
+		}
+		fresh = append(fresh, b.newTarget(u))
+	}
+	b.cur.Store(&fresh)
+	b.metrics.SetGauge(`clawdbot_proxy_backend_pool_size`, float64(len(fresh)))
+}
+
+func (b *backendPool) newTarget(u *url.URL) *lbTarget {
+	t := &lbTarget{url: u, proxy: b.buildProxy(u)}
+	if b.outliers {
+		t.stats = newOutlierStats()
+		t.proxy.Transport = &outlierTransport{base: t.proxy.Transport, stats: t.stats}
+	}
+	// Piggyback on the shared error handler for logging and breaker
+	// accounting, but mark the target down first so the next pick steers
+	// around it.
+	orig := t.proxy.ErrorHandler
+	t.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if !isBodyLimitError(err) {
+			b.markDown(t)
+		}
+		orig(w, r, err)
+	}
+	return t
+}
+
+func (b *backendPool) markDown(t *lbTarget) {
+	t.downUntil.Store(time.Now().Add(stickyDownCooldown).UnixNano())
+	b.metrics.Inc(`clawdbot_proxy_backend_marked_down_total`)
+}
+
+// pick returns the target for this request, or nil when the pool is empty.
+// pinned reports whether an existing valid pin was honored; when false the
+// caller should stamp the affinity cookie for the returned target.
+func (b *backendPool) pick(r *http.Request) (t *lbTarget, pinned bool) {
+	ts := b.targets()
+	if len(ts) == 0 {
+		return nil, false
+	}
+	if pt, ok := b.pinnedTarget(r, ts); ok {
+		if pt.healthy() {
+			return pt, true
+		}
+		b.metrics.Inc(`clawdbot_proxy_sticky_failover_total`)
+	}
+	// Two laps: the first may shed statistically degraded targets, the
+	// second takes any healthy one rather than coming up empty.
+	for attempt := 0; attempt < 2*len(ts); attempt++ {
+		i := int(b.next.Add(1)-1) % len(ts)
+		if !ts[i].healthy() {
+			continue
+		}
+		if attempt < len(ts) && !b.acceptTarget(ts[i]) {
+			continue
+		}
+		return ts[i], false
+	}
+	// Everything is marked down; round-robin anyway rather than failing
+	// outright — the cooldown may just not have expired yet.
+	return ts[int(b.next.Add(1)-1)%len(ts)], false
+}
+
+// pinnedTarget validates the affinity cookie ("<host>|<signature>") and
+// looks the named host up in the current membership.
+func (b *backendPool) pinnedTarget(r *http.Request, ts []*lbTarget) (*lbTarget, bool) {
+	c, err := r.Cookie(b.cookie)
+	if err != nil {
+		return nil, false
+	}
+	host, sig, ok := strings.Cut(c.Value, "|")
+	if !ok || subtle.ConstantTimeCompare([]byte(sig), []byte(b.sign(host))) != 1 {
+		return nil, false
+	}
+	for _, t := range ts {
+		if t.url.Host == host {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (b *backendPool) setCookie(w http.ResponseWriter, r *http.Request, t *lbTarget) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     b.cookie,
+		Value:    t.url.Host + "|" + b.sign(t.url.Host),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (b *backendPool) sign(payload string) string {
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
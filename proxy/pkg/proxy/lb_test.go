@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// poolProxy wires two live backends that answer with their own name.
+func poolProxy(t *testing.T) (*ProxyServer, []string) {
+	t.Helper()
+	var urls []string
+	for _, name := range []string{"alpha", "beta"} {
+		name := name
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}))
+		t.Cleanup(srv.Close)
+		urls = append(urls, srv.URL)
+	}
+	p := newTestProxy(t, &Config{
+		Backend:      urls[0] + "," + urls[1],
+		StickyCookie: "clawdbot_backend",
+		StickySecret: "affinity-key",
+	})
+	return p, []string{"alpha", "beta"}
+}
+
+func poolGet(t *testing.T, p *ProxyServer, cookie *http.Cookie) (string, *http.Cookie) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "clawdbot_backend" {
+			return string(body), c
+		}
+	}
+	return string(body), nil
+}
+
+func TestStickyAffinity(t *testing.T) {
+	p, _ := poolProxy(t)
+
+	first, cookie := poolGet(t, p, nil)
+	if cookie == nil {
+		t.Fatal("first response did not set the affinity cookie")
+	}
+	// Pinned requests keep landing on the same backend.
+	for i := 0; i < 5; i++ {
+		body, reissued := poolGet(t, p, cookie)
+		if body != first {
+			t.Fatalf("pinned request landed on %q, want %q", body, first)
+		}
+		if reissued != nil {
+			t.Fatal("valid pin should not be reissued")
+		}
+	}
+}
+
+func TestStickyRejectsForgedCookie(t *testing.T) {
+	p, _ := poolProxy(t)
+
+	forged := &http.Cookie{Name: "clawdbot_backend", Value: "evil.example:80|bogus-signature"}
+	_, cookie := poolGet(t, p, forged)
+	if cookie == nil {
+		t.Error("forged pin should be replaced with a signed one")
+	}
+}
+
+func TestStickyFailover(t *testing.T) {
+	p, _ := poolProxy(t)
+
+	first, cookie := poolGet(t, p, nil)
+	pinReq := &http.Request{Header: http.Header{"Cookie": {cookie.String()}}}
+	target, ok := p.lb.pinnedTarget(pinReq, p.lb.targets())
+	if !ok {
+		t.Fatal("cookie should validate")
+	}
+	p.lb.markDown(target)
+
+	body, reissued := poolGet(t, p, cookie)
+	if body == first {
+		t.Errorf("request stayed on the dead backend %q", body)
+	}
+	if reissued == nil {
+		t.Error("failover should re-pin to the healthy backend")
+	}
+	if p.metrics.Counter(`clawdbot_proxy_sticky_failover_total`) == 0 {
+		t.Error("failover metric not incremented")
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Multi-listener support: besides the main -listen address the proxy can
+// open extra listeners, each with its own policy but sharing the backend
+// pool, routing table, and metrics:
+//
+//	-listeners "lan=127.0.0.1:18791/no-auth,tlspub=:18792/tls"
+//
+// Each entry is name=addr followed by slash-separated options:
+//
+//	tls           serve TLS using the proxy's certificate configuration
+//	no-auth       skip API key and JWT edge auth (inbound X-Claw-* headers
+//	              are still stripped so identities cannot be spoofed)
+//	no-ratelimit  skip request rate limiting
+//
+// The typical split is a public port with full auth and limits, a
+// LAN-only port trusted networks hit without credentials, and a TLS port
+// when the main listener stays plain behind an external terminator.
+
+// listenerPolicy is one parsed -listeners entry.
+type listenerPolicy struct {
+	name        string
+	addr        string
+	tls         bool
+	noAuth      bool
+	noRateLimit bool
+}
+
+// ctxKeyListener carries the policy of the listener a request arrived on;
+// absent for the main listener.
+type ctxKeyListener struct{}
+
+func listenerPolicyFrom(ctx context.Context) *listenerPolicy {
+	lp, _ := ctx.Value(ctxKeyListener{}).(*listenerPolicy)
+	return lp
+}
+
+func parseListeners(entries []string) ([]listenerPolicy, error) {
+	var out []listenerPolicy
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name, rest, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || rest == "" {
+			return nil, fmt.Errorf("listeners: entry %q must be name=addr[/option...]", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("listeners: duplicate name %q", name)
+		}
+		seen[name] = true
+		parts := strings.Split(rest, "/")
+		lp := listenerPolicy{name: name, addr: parts[0]}
+		if lp.addr == "" {
+			return nil, fmt.Errorf("listeners: %s has no address", name)
+		}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "tls":
+				lp.tls = true
+			case "no-auth":
+				lp.noAuth = true
+			case "no-ratelimit":
+				lp.noRateLimit = true
+			default:
+				return nil, fmt.Errorf("listeners: %s: unknown option %q (known: tls, no-auth, no-ratelimit)", name, opt)
+			}
+		}
+		out = append(out, lp)
+	}
+	return out, nil
+}
+
+// startExtraListeners opens every -listeners port. Like the admin
+// listener these are not drained individually on shutdown; they die with
+// the process after the main listener has drained.
+func (p *ProxyServer) startExtraListeners() error {
+	base := p.publicHandler()
+	for i := range p.extraListeners {
+		lp := &p.extraListeners[i]
+		ln, err := net.Listen("tcp", lp.addr)
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", lp.name, err)
+		}
+		srv := &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				base.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyListener{}, lp)))
+			}),
+			ReadTimeout:       p.cfg.ReadTimeout,
+			ReadHeaderTimeout: p.cfg.ReadHeaderTimeout,
+			WriteTimeout:      p.cfg.WriteTimeout,
+		}
+		serve := srv.Serve
+		if lp.tls {
+			if !p.hasTLS() {
+				return fmt.Errorf("listener %s: tls requested but no certificates are configured", lp.name)
+			}
+			if srv.TLSConfig, err = p.tlsServerConfig(); err != nil {
+				return fmt.Errorf("listener %s: %w", lp.name, err)
+			}
+			serve = func(l net.Listener) error { return srv.ServeTLS(l, "", "") }
+		}
+		go func(lp *listenerPolicy) {
+			p.log.Info("extra listener", "name", lp.name, "addr", lp.addr, "tls", lp.tls, "no_auth", lp.noAuth, "no_ratelimit", lp.noRateLimit)
+			serve(ln)
+		}(lp)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseListeners(t *testing.T) {
+	lps, err := parseListeners([]string{"lan=127.0.0.1:18791/no-auth/no-ratelimit", "tlspub=:18792/tls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lps) != 2 || !lps[0].noAuth || !lps[0].noRateLimit || lps[0].tls {
+		t.Errorf("lan policy = %+v", lps[0])
+	}
+	if lps[1].name != "tlspub" || !lps[1].tls || lps[1].noAuth {
+		t.Errorf("tlspub policy = %+v", lps[1])
+	}
+
+	for entry, wantErr := range map[string]string{
+		"noaddr":    "must be name=addr",
+		"x=":        "must be name=addr",
+		"x=:1/frob": "unknown option",
+	} {
+		if _, err := parseListeners([]string{entry}); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("parseListeners(%q) = %v, want %q", entry, err, wantErr)
+		}
+	}
+	if _, err := parseListeners([]string{"x=:1", "x=:2"}); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("duplicate names = %v, want duplicate error", err)
+	}
+}
+
+func withListenerPolicy(r *http.Request, lp *listenerPolicy) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxKeyListener{}, lp))
+}
+
+func TestListenerNoAuthSkipsAPIKeyButStripsIdentity(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: echoBackendScheme, APIKeys: []string{"sekrit"}})
+
+	// Main listener: key required.
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/hello", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("main listener without key = %d, want 401", rec.Code)
+	}
+
+	// no-auth listener: allowed without a key, but spoofed identity dropped.
+	r := httptest.NewRequest("GET", "/api/hello", nil)
+	r.Header.Set("X-Claw-User", "spoofed")
+	r = withListenerPolicy(r, &listenerPolicy{name: "lan", noAuth: true})
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("no-auth listener = %d, want 200", rec.Code)
+	}
+	if r.Header.Get("X-Claw-User") != "" {
+		t.Error("spoofed X-Claw-User survived on a no-auth listener")
+	}
+}
+
+func TestListenerNoRateLimitBypassesLimiter(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: echoBackendScheme, RateLimitRPS: 0.001, RateLimitBurst: 1})
+	lp := &listenerPolicy{name: "lan", noRateLimit: true}
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, withListenerPolicy(httptest.NewRequest("GET", "/api/hello", nil), lp))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d on no-ratelimit listener = %d, want 200", i, rec.Code)
+		}
+	}
+
+	// The main listener still enforces the budget.
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/hello", nil))
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/hello", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("main listener second request = %d, want 429", rec.Code)
+	}
+}
+
+func TestStartExtraListenersRejectsTLSWithoutCerts(t *testing.T) {
+	p := newTestProxy(t, &Config{Listeners: []string{"sec=127.0.0.1:0/tls"}})
+	if err := p.startExtraListeners(); err == nil || !strings.Contains(err.Error(), "no certificates") {
+		t.Fatalf("startExtraListeners = %v, want missing-certificate error", err)
+	}
+}
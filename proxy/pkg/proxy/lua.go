@@ -0,0 +1,761 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Lua scripting for lightweight per-route logic — header munging,
+// conditional redirects, cheap access rules — without reaching for wasm
+// plugins. The proxy carries no third-party dependencies, so this is a
+// hand-rolled interpreter for a small Lua subset rather than a full VM:
+//
+//   - statements: assignment, if/elseif/else/end, calls, return
+//   - expressions: nil/true/false, numbers, strings, and/or/not,
+//     comparisons, .. concatenation, + - * / arithmetic
+//   - no loops, no function definitions, no tables beyond the built-ins
+//
+// The absence of loops makes every script trivially terminating; a step
+// cap guards against pathological expression nesting anyway. Scripts are
+// compiled once at route load, so syntax errors fail startup.
+//
+// Routes attach scripts at three hook points (see the route file doc):
+//
+//	lua-rewrite=<file>        before forwarding; may set_path/set_header
+//	lua-access=<file>         may deny(status, msg) or redirect(url[, code])
+//	lua-header-filter=<file>  sees resp.status and response headers
+//
+// Hook environments expose req (method, path, query, host, remote_addr,
+// header/set_header/del_header, set_path), resp in header filters
+// (status, header/set_header/del_header), redirect and deny in request
+// hooks, and a string table (lower, upper, contains, has_prefix,
+// has_suffix, trim).
+
+// luaMaxSteps bounds evaluation work per script run.
+const luaMaxSteps = 10000
+
+// luaValue is nil, bool, float64, string, luaFunc, or luaTable.
+type luaValue any
+
+type luaFunc func(args []luaValue) (luaValue, error)
+
+type luaTable map[string]luaValue
+
+// luaScript is a compiled script bound to the file it came from.
+type luaScript struct {
+	path  string
+	stmts []luaStmt
+}
+
+func compileLuaFile(path string) (*luaScript, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return compileLua(string(src), path)
+}
+
+func compileLua(src, name string) (*luaScript, error) {
+	toks, err := luaLex(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	p := &luaParser{toks: toks}
+	stmts, err := p.parseBlock("")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &luaScript{path: name, stmts: stmts}, nil
+}
+
+// run executes the script against an environment of globals. Control-flow
+// outcomes (redirect, deny) surface as typed errors the hook unpacks.
+func (s *luaScript) run(globals map[string]luaValue) error {
+	env := &luaEnv{vars: globals}
+	err := execLuaBlock(s.stmts, env)
+	if _, ok := err.(luaReturn); ok {
+		return nil
+	}
+	return err
+}
+
+type luaEnv struct {
+	vars  map[string]luaValue
+	steps int
+}
+
+func (e *luaEnv) step() error {
+	e.steps++
+	if e.steps > luaMaxSteps {
+		return fmt.Errorf("script exceeded %d steps", luaMaxSteps)
+	}
+	return nil
+}
+
+// Control-flow sentinels, delivered through the error return.
+type luaReturn struct{}
+
+func (luaReturn) Error() string { return "return" }
+
+// luaRedirect terminates a request hook with an HTTP redirect.
+type luaRedirect struct {
+	url  string
+	code int
+}
+
+func (luaRedirect) Error() string { return "redirect" }
+
+// luaDeny terminates an access hook with an error response.
+type luaDeny struct {
+	code int
+	msg  string
+}
+
+func (luaDeny) Error() string { return "deny" }
+
+// ---- lexer ----
+
+type luaTok struct {
+	kind string // "name", "number", "string", "op", "eof"
+	text string
+}
+
+var luaKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "if": true, "then": true,
+	"elseif": true, "else": true, "end": true, "return": true,
+	"true": true, "false": true, "nil": true,
+}
+
+func luaLex(src string) ([]luaTok, error) {
+	var toks []luaTok
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(src) && src[i+1] == '-':
+			// comment to end of line
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, luaTok{"number", src[i:j]})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, luaTok{"name", src[i:j]})
+			i = j
+		case c == '"' || c == '\'':
+			quote := c
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(src) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if src[j] == '\\' && j+1 < len(src) {
+					switch src[j+1] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[j+1])
+					}
+					j += 2
+					continue
+				}
+				if src[j] == quote {
+					break
+				}
+				b.WriteByte(src[j])
+				j++
+			}
+			toks = append(toks, luaTok{"string", b.String()})
+			i = j + 1
+		default:
+			op := luaMatchOp(src[i:])
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			toks = append(toks, luaTok{"op", op})
+			i += len(op)
+		}
+	}
+	return append(toks, luaTok{kind: "eof"}), nil
+}
+
+// luaMatchOp returns the longest operator at the start of s, or "".
+func luaMatchOp(s string) string {
+	for _, op := range []string{"==", "~=", "<=", ">=", ".."} {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	if strings.ContainsRune("=<>(),.+-*/", rune(s[0])) {
+		return s[:1]
+	}
+	return ""
+}
+
+// ---- parser ----
+
+type luaParser struct {
+	toks []luaTok
+	pos  int
+}
+
+func (p *luaParser) peek() luaTok { return p.toks[p.pos] }
+
+func (p *luaParser) next() luaTok {
+	t := p.toks[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+func (p *luaParser) accept(kind, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseBlock parses statements until a block terminator (or EOF for the
+// top level). The terminator itself is left for the caller.
+func (p *luaParser) parseBlock(ctx string) ([]luaStmt, error) {
+	var stmts []luaStmt
+	for {
+		t := p.peek()
+		if t.kind == "eof" || t.kind == "name" && (t.text == "end" || t.text == "else" || t.text == "elseif") {
+			if t.kind == "eof" && ctx != "" {
+				return nil, fmt.Errorf("missing end for %s", ctx)
+			}
+			return stmts, nil
+		}
+		st, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, st)
+	}
+}
+
+func (p *luaParser) parseStmt() (luaStmt, error) {
+	t := p.peek()
+	if t.kind == "name" {
+		switch t.text {
+		case "if":
+			return p.parseIf()
+		case "return":
+			p.next()
+			return returnStmt{}, nil
+		}
+	}
+	// assignment or call
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("op", "=") {
+		name, ok := expr.(nameExpr)
+		if !ok {
+			return nil, fmt.Errorf("can only assign to plain variables")
+		}
+		rhs, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return assignStmt{string(name), rhs}, nil
+	}
+	if _, ok := expr.(callExpr); !ok {
+		return nil, fmt.Errorf("expression statements must be calls")
+	}
+	return exprStmt{expr}, nil
+}
+
+func (p *luaParser) parseIf() (luaStmt, error) {
+	p.next() // "if" or "elseif"
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("name", "then") {
+		return nil, fmt.Errorf("expected then after if condition")
+	}
+	body, err := p.parseBlock("if")
+	if err != nil {
+		return nil, err
+	}
+	st := ifStmt{cond: cond, then: body}
+	switch {
+	case p.peek().kind == "name" && p.peek().text == "elseif":
+		els, err := p.parseIf()
+		if err != nil {
+			return nil, err
+		}
+		st.els = []luaStmt{els}
+		return st, nil
+	case p.accept("name", "else"):
+		if st.els, err = p.parseBlock("else"); err != nil {
+			return nil, err
+		}
+	}
+	if !p.accept("name", "end") {
+		return nil, fmt.Errorf("missing end for if")
+	}
+	return st, nil
+}
+
+// Expression precedence, loosest first: or, and, comparison, .., additive,
+// multiplicative, unary, primary.
+func (p *luaParser) parseExpr() (luaExpr, error) { return p.parseOr() }
+
+func (p *luaParser) parseOr() (luaExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("name", "or") {
+		var right luaExpr
+		if right, err = p.parseAnd(); err == nil {
+			left = binExpr{"or", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *luaParser) parseAnd() (luaExpr, error) {
+	left, err := p.parseCmp()
+	for err == nil && p.accept("name", "and") {
+		var right luaExpr
+		if right, err = p.parseCmp(); err == nil {
+			left = binExpr{"and", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *luaParser) parseCmp() (luaExpr, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "~=", "<=", ">=", "<", ">"} {
+		if p.accept("op", op) {
+			right, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			return binExpr{op, left, right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *luaParser) parseConcat() (luaExpr, error) {
+	left, err := p.parseAdd()
+	if err == nil && p.accept("op", "..") {
+		var right luaExpr
+		if right, err = p.parseConcat(); err == nil { // right-associative
+			return binExpr{"..", left, right}, nil
+		}
+	}
+	return left, err
+}
+
+func (p *luaParser) parseAdd() (luaExpr, error) {
+	left, err := p.parseMul()
+	for err == nil {
+		switch {
+		case p.accept("op", "+"):
+			var right luaExpr
+			if right, err = p.parseMul(); err == nil {
+				left = binExpr{"+", left, right}
+			}
+		case p.accept("op", "-"):
+			var right luaExpr
+			if right, err = p.parseMul(); err == nil {
+				left = binExpr{"-", left, right}
+			}
+		default:
+			return left, nil
+		}
+	}
+	return left, err
+}
+
+func (p *luaParser) parseMul() (luaExpr, error) {
+	left, err := p.parseUnary()
+	for err == nil {
+		switch {
+		case p.accept("op", "*"):
+			var right luaExpr
+			if right, err = p.parseUnary(); err == nil {
+				left = binExpr{"*", left, right}
+			}
+		case p.accept("op", "/"):
+			var right luaExpr
+			if right, err = p.parseUnary(); err == nil {
+				left = binExpr{"/", left, right}
+			}
+		default:
+			return left, nil
+		}
+	}
+	return left, err
+}
+
+func (p *luaParser) parseUnary() (luaExpr, error) {
+	if p.accept("name", "not") {
+		e, err := p.parseUnary()
+		return notExpr{e}, err
+	}
+	if p.accept("op", "-") {
+		e, err := p.parseUnary()
+		return negExpr{e}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *luaParser) parsePrimary() (luaExpr, error) {
+	t := p.next()
+	var e luaExpr
+	switch {
+	case t.kind == "number":
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", t.text)
+		}
+		e = litExpr{n}
+	case t.kind == "string":
+		e = litExpr{t.text}
+	case t.kind == "name" && t.text == "nil":
+		e = litExpr{nil}
+	case t.kind == "name" && t.text == "true":
+		e = litExpr{true}
+	case t.kind == "name" && t.text == "false":
+		e = litExpr{false}
+	case t.kind == "name" && !luaKeywords[t.text]:
+		e = nameExpr(t.text)
+	case t.kind == "op" && t.text == "(":
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept("op", ")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		e = inner
+	default:
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	// suffixes: .field and (args)
+	for {
+		switch {
+		case p.accept("op", "."):
+			f := p.next()
+			if f.kind != "name" {
+				return nil, fmt.Errorf("expected field name after .")
+			}
+			e = indexExpr{e, f.text}
+		case p.accept("op", "("):
+			var args []luaExpr
+			if !p.accept("op", ")") {
+				for {
+					a, err := p.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, a)
+					if p.accept("op", ")") {
+						break
+					}
+					if !p.accept("op", ",") {
+						return nil, fmt.Errorf("expected , or ) in call")
+					}
+				}
+			}
+			e = callExpr{e, args}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// ---- evaluation ----
+
+type luaStmt interface{ exec(env *luaEnv) error }
+
+type luaExpr interface {
+	eval(env *luaEnv) (luaValue, error)
+}
+
+func execLuaBlock(stmts []luaStmt, env *luaEnv) error {
+	for _, st := range stmts {
+		if err := st.exec(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type assignStmt struct {
+	name string
+	expr luaExpr
+}
+
+func (s assignStmt) exec(env *luaEnv) error {
+	v, err := s.expr.eval(env)
+	if err != nil {
+		return err
+	}
+	env.vars[s.name] = v
+	return nil
+}
+
+type exprStmt struct{ expr luaExpr }
+
+func (s exprStmt) exec(env *luaEnv) error {
+	_, err := s.expr.eval(env)
+	return err
+}
+
+type returnStmt struct{}
+
+func (returnStmt) exec(*luaEnv) error { return luaReturn{} }
+
+type ifStmt struct {
+	cond luaExpr
+	then []luaStmt
+	els  []luaStmt
+}
+
+func (s ifStmt) exec(env *luaEnv) error {
+	v, err := s.cond.eval(env)
+	if err != nil {
+		return err
+	}
+	if luaTruthy(v) {
+		return execLuaBlock(s.then, env)
+	}
+	return execLuaBlock(s.els, env)
+}
+
+type litExpr struct{ v luaValue }
+
+func (e litExpr) eval(env *luaEnv) (luaValue, error) { return e.v, env.step() }
+
+type nameExpr string
+
+func (e nameExpr) eval(env *luaEnv) (luaValue, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	v, ok := env.vars[string(e)]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %q", string(e))
+	}
+	return v, nil
+}
+
+type indexExpr struct {
+	obj luaExpr
+	key string
+}
+
+func (e indexExpr) eval(env *luaEnv) (luaValue, error) {
+	v, err := e.obj.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := v.(luaTable)
+	if !ok {
+		return nil, fmt.Errorf("cannot index %s", luaTypeName(v))
+	}
+	return t[e.key], nil
+}
+
+type callExpr struct {
+	fn   luaExpr
+	args []luaExpr
+}
+
+func (e callExpr) eval(env *luaEnv) (luaValue, error) {
+	fv, err := e.fn.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := fv.(luaFunc)
+	if !ok {
+		return nil, fmt.Errorf("cannot call %s", luaTypeName(fv))
+	}
+	args := make([]luaValue, len(e.args))
+	for i, a := range e.args {
+		if args[i], err = a.eval(env); err != nil {
+			return nil, err
+		}
+	}
+	return f(args)
+}
+
+type binExpr struct {
+	op   string
+	l, r luaExpr
+}
+
+func (e binExpr) eval(env *luaEnv) (luaValue, error) {
+	lv, err := e.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	// and/or short-circuit with Lua semantics: the operand value itself
+	// is the result, not a coerced boolean.
+	switch e.op {
+	case "and":
+		if !luaTruthy(lv) {
+			return lv, nil
+		}
+		return e.r.eval(env)
+	case "or":
+		if luaTruthy(lv) {
+			return lv, nil
+		}
+		return e.r.eval(env)
+	}
+	rv, err := e.r.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return luaEqual(lv, rv), nil
+	case "~=":
+		return !luaEqual(lv, rv), nil
+	case "..":
+		ls, err1 := luaToString(lv)
+		rs, err2 := luaToString(rv)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("cannot concatenate %s and %s", luaTypeName(lv), luaTypeName(rv))
+		}
+		return ls + rs, nil
+	}
+	if ln, lok := lv.(float64); lok {
+		if rn, rok := rv.(float64); rok {
+			switch e.op {
+			case "<":
+				return ln < rn, nil
+			case "<=":
+				return ln <= rn, nil
+			case ">":
+				return ln > rn, nil
+			case ">=":
+				return ln >= rn, nil
+			case "+":
+				return ln + rn, nil
+			case "-":
+				return ln - rn, nil
+			case "*":
+				return ln * rn, nil
+			case "/":
+				return ln / rn, nil
+			}
+		}
+	}
+	if ls, lok := lv.(string); lok {
+		if rs, rok := rv.(string); rok {
+			switch e.op {
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("operator %s needs matching number or string operands", e.op)
+}
+
+type notExpr struct{ e luaExpr }
+
+func (e notExpr) eval(env *luaEnv) (luaValue, error) {
+	v, err := e.e.eval(env)
+	return !luaTruthy(v), err
+}
+
+type negExpr struct{ e luaExpr }
+
+func (e negExpr) eval(env *luaEnv) (luaValue, error) {
+	v, err := e.e.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %s", luaTypeName(v))
+	}
+	return -n, nil
+}
+
+func luaTruthy(v luaValue) bool { return v != nil && v != false }
+
+// luaEqual compares two values without panicking on uncomparable ones:
+// tables and functions compare by identity, like real Lua.
+func luaEqual(lv, rv luaValue) bool {
+	switch l := lv.(type) {
+	case luaTable:
+		r, ok := rv.(luaTable)
+		return ok && reflect.ValueOf(l).Pointer() == reflect.ValueOf(r).Pointer()
+	case luaFunc:
+		r, ok := rv.(luaFunc)
+		return ok && reflect.ValueOf(l).Pointer() == reflect.ValueOf(r).Pointer()
+	}
+	switch rv.(type) {
+	case luaTable, luaFunc:
+		return false
+	}
+	return lv == rv
+}
+
+func luaToString(v luaValue) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	default:
+		return "", fmt.Errorf("not a string")
+	}
+}
+
+func luaTypeName(v luaValue) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case luaFunc:
+		return "function"
+	case luaTable:
+		return "table"
+	default:
+		return "value"
+	}
+}
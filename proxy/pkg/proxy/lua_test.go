@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeLuaScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.lua")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLuaInterpreterBasics(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want luaValue
+	}{
+		{`x = 1 + 2 * 3`, float64(7)},
+		{`x = "a" .. "b" .. 1`, "ab1"},
+		{`x = 1 < 2 and "yes" or "no"`, "yes"},
+		{`x = not nil`, true},
+		{`if "abc" >= "abd" then x = 1 else x = 2 end`, float64(2)},
+		{`-- comment
+if true then
+  x = string.upper("ok")
+elseif false then
+  x = "nope"
+end`, "OK"},
+		{`x = string.has_prefix("/api/run", "/api/")`, true},
+		{`x = 1
+return
+x = 2`, float64(1)},
+		// Tables and functions compare by identity instead of panicking.
+		{`x = string == string`, true},
+		{`x = string.lower == string.upper`, false},
+		{`x = string.lower == string.lower`, true},
+		{`x = string ~= nil`, true},
+		{`x = string.lower == "lower"`, false},
+	} {
+		s, err := compileLua(tc.src, "test")
+		if err != nil {
+			t.Errorf("compile %q: %v", tc.src, err)
+			continue
+		}
+		globals := map[string]luaValue{"string": luaStringTable}
+		if err := s.run(globals); err != nil {
+			t.Errorf("run %q: %v", tc.src, err)
+			continue
+		}
+		if globals["x"] != tc.want {
+			t.Errorf("%q: x = %v, want %v", tc.src, globals["x"], tc.want)
+		}
+	}
+}
+
+func TestLuaCompileErrors(t *testing.T) {
+	for _, src := range []string{
+		`if true then x = 1`, // missing end
+		`x = `,               // missing expression
+		`x = $`,              // bad character
+		`req.path = "/x"`,    // indexed assignment unsupported
+		`x`,                  // bare name is not a statement
+		`x = "unterminated`,
+	} {
+		if _, err := compileLua(src, "test"); err == nil {
+			t.Errorf("compileLua(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestLuaRuntimeErrors(t *testing.T) {
+	for _, src := range []string{
+		`x = missing`,        // unknown variable
+		`x = 1 .. true`,      // bad concat
+		`x = "a" + 1`,        // bad arithmetic
+		`x = string.lower()`, // missing argument
+	} {
+		s, err := compileLua(src, "test")
+		if err != nil {
+			t.Fatalf("compile %q: %v", src, err)
+		}
+		if err := s.run(map[string]luaValue{"string": luaStringTable}); err == nil {
+			t.Errorf("run(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestLuaRewriteHookMutatesRequest(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	script := writeLuaScript(t, `
+if string.has_prefix(req.path, "/api/v1/") then
+  req.set_path("/api/" .. req.header("X-Api-Version"))
+end
+req.set_header("X-Scripted", req.method)
+`)
+	s, err := compileLuaFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/api/v1/run", nil)
+	r.Header.Set("X-Api-Version", "v2")
+	if !p.runLuaRequestHook(httptest.NewRecorder(), r, s) {
+		t.Fatal("rewrite hook answered the request")
+	}
+	if r.URL.Path != "/api/v2" || r.Header.Get("X-Scripted") != "POST" {
+		t.Errorf("after rewrite: path=%q X-Scripted=%q", r.URL.Path, r.Header.Get("X-Scripted"))
+	}
+}
+
+func TestLuaAccessHookDeniesAndRedirects(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+
+	deny, err := compileLua(`
+if req.header("X-Role") ~= "admin" then
+  deny(403, "admins only")
+end`, "deny.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if p.runLuaRequestHook(rec, httptest.NewRequest("GET", "/api/x", nil), deny) {
+		t.Fatal("deny script allowed the request")
+	}
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "admins only") {
+		t.Errorf("deny = %d %q", rec.Code, rec.Body.String())
+	}
+
+	redir, err := compileLua(`redirect("/login", 302)`, "redir.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	if p.runLuaRequestHook(rec, httptest.NewRequest("GET", "/api/x", nil), redir) {
+		t.Fatal("redirect script allowed the request")
+	}
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login" {
+		t.Errorf("redirect = %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Runtime failures fail closed.
+	broken, err := compileLua(`x = boom`, "broken.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	if p.runLuaRequestHook(rec, httptest.NewRequest("GET", "/api/x", nil), broken) || rec.Code != http.StatusInternalServerError {
+		t.Errorf("broken script = %d, want 500 fail-closed", rec.Code)
+	}
+}
+
+func TestLuaHeaderFilter(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	s, err := compileLua(`
+resp.set_header("X-Status", "code-" .. resp.status)
+resp.del_header("Server")
+`, "headers.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	w := &luaHeaderWriter{ResponseWriter: rec, p: p, r: httptest.NewRequest("GET", "/api/x", nil), script: s}
+	w.Header().Set("Server", "secret")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("ok"))
+	if got := rec.Header().Get("X-Status"); got != "code-201" {
+		t.Errorf("X-Status = %q, want code-201", got)
+	}
+	if rec.Header().Get("Server") != "" {
+		t.Error("Server header survived del_header")
+	}
+}
+
+func TestLuaRouteTokens(t *testing.T) {
+	script := writeLuaScript(t, `req.set_header("X-Hook", "1")`)
+	rt, err := parseRouteLine("path=/api/ lua-rewrite=" + script + " backend=http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.luaRewrite == nil {
+		t.Error("lua-rewrite script not attached")
+	}
+	if _, err := parseRouteLine("path=/x static=/srv lua-access=" + script); err == nil {
+		t.Error("lua hook accepted on a static route")
+	}
+	if _, err := parseRouteLine("path=/api/ lua-access=/does/not/exist.lua backend=http://127.0.0.1:1"); err == nil {
+		t.Error("missing script file accepted")
+	}
+}
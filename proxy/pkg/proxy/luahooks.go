@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Hook plumbing for the Lua interpreter in lua.go: environment tables,
+// the serveBackend entry points, and the response-header filter writer.
+
+var errLuaArg = errors.New("bad argument")
+
+// luaStringTable is the shared, stateless "string" helper table.
+var luaStringTable = luaTable{
+	"lower":      luaStrFunc(func(s string) luaValue { return strings.ToLower(s) }),
+	"upper":      luaStrFunc(func(s string) luaValue { return strings.ToUpper(s) }),
+	"trim":       luaStrFunc(func(s string) luaValue { return strings.TrimSpace(s) }),
+	"contains":   luaStr2Func(func(s, sub string) luaValue { return strings.Contains(s, sub) }),
+	"has_prefix": luaStr2Func(func(s, p string) luaValue { return strings.HasPrefix(s, p) }),
+	"has_suffix": luaStr2Func(func(s, p string) luaValue { return strings.HasSuffix(s, p) }),
+}
+
+func luaStrFunc(f func(string) luaValue) luaFunc {
+	return func(args []luaValue) (luaValue, error) {
+		s, err := luaStringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return f(s), nil
+	}
+}
+
+func luaStr2Func(f func(a, b string) luaValue) luaFunc {
+	return func(args []luaValue) (luaValue, error) {
+		a, err := luaStringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := luaStringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return f(a, b), nil
+	}
+}
+
+func luaStringArg(args []luaValue, i int) (string, error) {
+	if i >= len(args) {
+		return "", errLuaArg
+	}
+	s, ok := args[i].(string)
+	if !ok {
+		return "", errLuaArg
+	}
+	return s, nil
+}
+
+// luaReqTable exposes the request to a script. Mutators write straight to
+// r, so whatever the script does is what the upstream sees.
+func luaReqTable(p *ProxyServer, r *http.Request) luaTable {
+	return luaTable{
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"query":       r.URL.RawQuery,
+		"host":        requestHost(r),
+		"remote_addr": p.clientIP(r),
+		"header": luaStrFunc(func(name string) luaValue {
+			if v := r.Header.Get(name); v != "" {
+				return v
+			}
+			return nil
+		}),
+		"set_header": luaStr2Func(func(name, value string) luaValue {
+			r.Header.Set(name, value)
+			return nil
+		}),
+		"del_header": luaStrFunc(func(name string) luaValue {
+			r.Header.Del(name)
+			return nil
+		}),
+		"set_path": luaStrFunc(func(path string) luaValue {
+			r.URL.Path = path
+			r.URL.RawPath = ""
+			return nil
+		}),
+	}
+}
+
+// runLuaRequestHook executes a rewrite or access script. Returns false
+// when the script answered the request (redirect, deny, or script error).
+func (p *ProxyServer) runLuaRequestHook(w http.ResponseWriter, r *http.Request, s *luaScript) bool {
+	globals := map[string]luaValue{
+		"req":    luaReqTable(p, r),
+		"string": luaStringTable,
+		"redirect": luaFunc(func(args []luaValue) (luaValue, error) {
+			url, err := luaStringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			code := http.StatusFound
+			if len(args) > 1 {
+				n, ok := args[1].(float64)
+				if !ok || n < 300 || n > 399 {
+					return nil, errLuaArg
+				}
+				code = int(n)
+			}
+			return nil, luaRedirect{url: url, code: code}
+		}),
+		"deny": luaFunc(func(args []luaValue) (luaValue, error) {
+			if len(args) == 0 {
+				return nil, errLuaArg
+			}
+			n, ok := args[0].(float64)
+			if !ok || n < 400 || n > 599 {
+				return nil, errLuaArg
+			}
+			msg := "denied by route script"
+			if len(args) > 1 {
+				if s, err := luaStringArg(args, 1); err == nil {
+					msg = s
+				}
+			}
+			return nil, luaDeny{code: int(n), msg: msg}
+		}),
+	}
+	switch err := s.run(globals).(type) {
+	case nil:
+		return true
+	case luaRedirect:
+		http.Redirect(w, r, err.url, err.code)
+		return false
+	case luaDeny:
+		p.httpError(w, r, err.code, err.msg)
+		return false
+	default:
+		// A broken access script must not fail open.
+		p.log.Error("lua hook failed", "script", s.path, "error", err)
+		p.metrics.Inc(`clawdbot_proxy_lua_errors_total`)
+		p.httpError(w, r, http.StatusInternalServerError, "route script failed")
+		return false
+	}
+}
+
+// luaHeaderWriter runs a header_filter script once, just before the
+// response headers are written.
+type luaHeaderWriter struct {
+	http.ResponseWriter
+	p      *ProxyServer
+	r      *http.Request
+	script *luaScript
+	done   bool
+}
+
+func (w *luaHeaderWriter) WriteHeader(code int) {
+	if !w.done {
+		w.done = true
+		h := w.Header()
+		globals := map[string]luaValue{
+			"req":    luaReqTable(w.p, w.r),
+			"string": luaStringTable,
+			"resp": luaTable{
+				"status": float64(code),
+				"header": luaStrFunc(func(name string) luaValue {
+					if v := h.Get(name); v != "" {
+						return v
+					}
+					return nil
+				}),
+				"set_header": luaStr2Func(func(name, value string) luaValue {
+					h.Set(name, value)
+					return nil
+				}),
+				"del_header": luaStrFunc(func(name string) luaValue {
+					h.Del(name)
+					return nil
+				}),
+			},
+		}
+		if err := w.script.run(globals); err != nil {
+			// Headers can still go out; the filter just did not run.
+			w.p.log.Error("lua header filter failed", "script", w.script.path, "error", err)
+			w.p.metrics.Inc(`clawdbot_proxy_lua_errors_total`)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *luaHeaderWriter) Write(b []byte) (int, error) {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *luaHeaderWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
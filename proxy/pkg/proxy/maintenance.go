@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Maintenance mode takes API and WebSocket routes out of service with a 503
+// while the static UI shell keeps being served, so browsers can still render
+// a friendly page. It is switched on either through the admin API or by the
+// existence of a sentinel file (convenient for deploy scripts that cannot
+// reach the admin listener).
+
+// sentinelFile reports whether a file exists, stat-ing at most once per
+// second so the hot path stays cheap (same idea as APIKeyStore reloads).
+type sentinelFile struct {
+	path string
+
+	mu       sync.Mutex
+	lastStat time.Time
+	present  bool
+}
+
+func (s *sentinelFile) exists() bool {
+	if s == nil || s.path == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastStat) < time.Second {
+		return s.present
+	}
+	s.lastStat = time.Now()
+	_, err := os.Stat(s.path)
+	s.present = err == nil
+	return s.present
+}
+
+// maintenanceOn combines the admin toggle with the sentinel file.
+func (p *ProxyServer) maintenanceOn() bool {
+	return p.maintenance.Load() || p.maintSentinel.exists()
+}
+
+// loadMaintenancePage reads the configured 503 body once at startup and
+// picks a Content-Type from its shape.
+func (p *ProxyServer) loadMaintenancePage(path string) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p.maintPage = body
+	switch {
+	case json.Valid(body):
+		p.maintType = "application/json"
+	default:
+		p.maintType = "text/html; charset=utf-8"
+	}
+	return nil
+}
+
+// serveMaintenance answers one request with the maintenance 503.
+func (p *ProxyServer) serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	p.metrics.Inc(`clawdbot_proxy_maintenance_total`)
+	w.Header().Set("Retry-After", "30")
+	if p.maintPage == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"service under maintenance"}` + "\n"))
+		return
+	}
+	w.Header().Set("Content-Type", p.maintType)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(p.maintPage)
+}
+
+// enterMaintenance flips the admin toggle and, on the off→on edge, tells
+// active WebSocket clients to reconnect later (1013 Try Again Later).
+func (p *ProxyServer) enterMaintenance(on bool) {
+	was := p.maintenance.Swap(on)
+	if !on || was {
+		return
+	}
+	for _, s := range p.sessions.snapshot() {
+		s.sendClose(1013, "maintenance")
+	}
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceSentinelFile(t *testing.T) {
+	sentinel := filepath.Join(t.TempDir(), "maintenance")
+	p := newTestProxy(t, &Config{MaintenanceFile: sentinel})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if rec.Code == http.StatusServiceUnavailable {
+		t.Fatal("maintenance must be off while the sentinel is absent")
+	}
+
+	if err := os.WriteFile(sentinel, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Defeat the one-second stat cache.
+	p.maintSentinel.lastStat = time.Time{}
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status with sentinel = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("maintenance responses should carry Retry-After")
+	}
+}
+
+func TestMaintenanceCustomPage(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "down.html")
+	if err := os.WriteFile(page, []byte("<h1>back soon</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{MaintenancePage: page})
+	p.enterMaintenance(true)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "back soon") {
+		t.Errorf("body = %q, want custom page", rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("content type = %q, want text/html", ct)
+	}
+}
+
+func TestMaintenanceJSONPageDetection(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "down.json")
+	if err := os.WriteFile(page, []byte(`{"status":"maintenance"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{MaintenancePage: page})
+	p.enterMaintenance(true)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type = %q, want application/json", ct)
+	}
+}
+
+func TestMaintenanceStaticStillServed(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>ui</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{StaticDir: dir})
+	p.enterMaintenance(true)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("static UI during maintenance = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics is a minimal Prometheus-text-format registry. Counter and gauge
+// names may include a label suffix, e.g. `foo_total{code="2xx"}`.
+type Metrics struct {
+	mu         sync.Mutex
+	counters   map[string]int64
+	gauges     map[string]float64
+	histograms map[string]*histogram
+
+	// sink, when set, mirrors every update to an external aggregator
+	// (StatsD; see statsd.go). Called outside the registry lock.
+	sink metricsSink
+}
+
+// latencyBuckets are the upper bounds (seconds) shared by every latency
+// histogram; the Prometheus defaults cover 5ms to 10s well enough for a
+// local gateway hop.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram accumulates observations into fixed buckets. Each bucket keeps
+// its most recent exemplar (e.g. a trace ID) so a spike in a bucket can be
+// chased down to a concrete trace.
+type histogram struct {
+	counts    []int64 // per-bucket, non-cumulative
+	sum       float64
+	count     int64
+	exemplars []exemplar // parallel to counts
+}
+
+type exemplar struct {
+	labels string // rendered label body, e.g. `trace_id="abc"`
+	value  float64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   make(map[string]int64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]*histogram),
+	}
+}
+
+func (m *Metrics) Inc(name string) {
+	m.Add(name, 1)
+}
+
+func (m *Metrics) Add(name string, delta int64) {
+	m.mu.Lock()
+	m.counters[name] += delta
+	m.mu.Unlock()
+	if m.sink != nil {
+		base, tags := sinkNameTags(name)
+		m.sink.count(base, delta, tags)
+	}
+}
+
+func (m *Metrics) SetGauge(name string, v float64) {
+	m.mu.Lock()
+	m.gauges[name] = v
+	m.mu.Unlock()
+	if m.sink != nil {
+		base, tags := sinkNameTags(name)
+		m.sink.gauge(base, v, tags)
+	}
+}
+
+func (m *Metrics) AddGauge(name string, delta float64) {
+	m.mu.Lock()
+	m.gauges[name] += delta
+	v := m.gauges[name]
+	m.mu.Unlock()
+	if m.sink != nil {
+		base, tags := sinkNameTags(name)
+		m.sink.gauge(base, v, tags)
+	}
+}
+
+// Observe records v (seconds) into the named histogram.
+func (m *Metrics) Observe(name string, v float64) {
+	m.ObserveExemplar(name, v, "")
+}
+
+// ObserveExemplar records v and, when exemplarLabels is non-empty (e.g.
+// `trace_id="abc"`), attaches it to the bucket v lands in.
+func (m *Metrics) ObserveExemplar(name string, v float64, exemplarLabels string) {
+	m.mu.Lock()
+	h := m.histograms[name]
+	if h == nil {
+		h = &histogram{
+			counts:    make([]int64, len(latencyBuckets)+1), // last = +Inf
+			exemplars: make([]exemplar, len(latencyBuckets)+1),
+		}
+		m.histograms[name] = h
+	}
+	i := len(latencyBuckets)
+	for j, le := range latencyBuckets {
+		if v <= le {
+			i = j
+			break
+		}
+	}
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	if exemplarLabels != "" {
+		h.exemplars[i] = exemplar{labels: exemplarLabels, value: v}
+	}
+	m.mu.Unlock()
+	if m.sink != nil {
+		base, tags := sinkNameTags(name)
+		m.sink.timing(base, v, tags)
+	}
+}
+
+// CounterSum totals every labelled variant of a counter, e.g. base
+// `foo_total` matches `foo_total` and `foo_total{code="2xx"}`.
+func (m *Metrics) CounterSum(base string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sum int64
+	for name, v := range m.counters {
+		if name == base || strings.HasPrefix(name, base+"{") {
+			sum += v
+		}
+	}
+	return sum
+}
+
+// Quantile estimates the q-th quantile (0..1) of a histogram from its
+// bucket counts, returning the upper bound of the bucket the quantile
+// falls in (seconds). Labelled variants of base are merged.
+func (m *Metrics) Quantile(base string, q float64) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	merged := make([]int64, len(latencyBuckets)+1)
+	var total int64
+	for name, h := range m.histograms {
+		if name != base && !strings.HasPrefix(name, base+"{") {
+			continue
+		}
+		for i, c := range h.counts {
+			merged[i] += c
+		}
+		total += h.count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(q*float64(total) + 0.5)
+	var cum int64
+	for i, c := range merged {
+		cum += c
+		if cum >= rank {
+			if i < len(latencyBuckets) {
+				return latencyBuckets[i]
+			}
+			break
+		}
+	}
+	return latencyBuckets[len(latencyBuckets)-1]
+}
+
+func (m *Metrics) Counter(name string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+func (m *Metrics) Gauge(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gauges[name]
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.counters)+len(m.gauges))
+	for name := range m.counters {
+		names = append(names, name)
+	}
+	for name := range m.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v, ok := m.counters[name]; ok {
+			fmt.Fprintf(w, "%s %d\n", name, v)
+		} else {
+			fmt.Fprintf(w, "%s %g\n", name, m.gauges[name])
+		}
+	}
+	hnames := make([]string, 0, len(m.histograms))
+	for name := range m.histograms {
+		hnames = append(hnames, name)
+	}
+	sort.Strings(hnames)
+	for _, name := range hnames {
+		m.histograms[name].render(w, name)
+	}
+}
+
+// render writes one histogram in Prometheus text form. Exemplars use the
+// OpenMetrics `# {labels} value` suffix, which Prometheus accepts when
+// exemplar storage is enabled and other scrapers ignore.
+func (h *histogram) render(w io.Writer, name string) {
+	base, labels := splitMetricName(name)
+	bucketLabels := func(le string) string {
+		if labels == "" {
+			return `{le="` + le + `"}`
+		}
+		return "{" + labels + `,le="` + le + `"}`
+	}
+	cum := int64(0)
+	for i, le := range latencyBuckets {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket%s %d", base, bucketLabels(formatBucket(le)), cum)
+		if ex := h.exemplars[i]; ex.labels != "" {
+			fmt.Fprintf(w, " # {%s} %g", ex.labels, ex.value)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d", base, bucketLabels("+Inf"), h.count)
+	if ex := h.exemplars[len(latencyBuckets)]; ex.labels != "" {
+		fmt.Fprintf(w, " # {%s} %g", ex.labels, ex.value)
+	}
+	fmt.Fprintln(w)
+	suffix := ""
+	if labels != "" {
+		suffix = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", base, suffix, h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", base, suffix, h.count)
+}
+
+// splitMetricName separates `foo{a="b"}` into `foo` and `a="b"`.
+func splitMetricName(name string) (base, labels string) {
+	i := strings.IndexByte(name, '{')
+	if i < 0 {
+		return name, ""
+	}
+	return name[:i], strings.TrimSuffix(name[i+1:], "}")
+}
+
+func formatBucket(le float64) string {
+	return strconv.FormatFloat(le, 'g', -1, 64)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	m := NewMetrics()
+	m.Observe("h_seconds", 0.003) // le=0.005
+	m.Observe("h_seconds", 0.07)  // le=0.1
+	m.Observe("h_seconds", 0.08)  // le=0.1
+	m.Observe("h_seconds", 99)    // +Inf
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`h_seconds_bucket{le="0.005"} 1`,
+		`h_seconds_bucket{le="0.1"} 3`,
+		`h_seconds_bucket{le="10"} 3`,
+		`h_seconds_bucket{le="+Inf"} 4`,
+		`h_seconds_count 4`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestHistogramLabelsAndExemplars(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveExemplar(`up_seconds{backend="b1:80"}`, 0.02, `trace_id="abc123"`)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `up_seconds_bucket{backend="b1:80",le="0.025"} 1 # {trace_id="abc123"} 0.02`) {
+		t.Errorf("exemplar not rendered on its bucket:\n%s", body)
+	}
+	if !strings.Contains(body, `up_seconds_sum{backend="b1:80"} 0.02`) {
+		t.Errorf("labelled sum missing:\n%s", body)
+	}
+}
+
+func TestUpstreamLatencyHistograms(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	p := newTestProxy(t, &Config{Backend: backend.URL})
+
+	rec := httptest.NewRecorder()
+	p.accessLog(p).ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	mrec := httptest.NewRecorder()
+	p.metrics.ServeHTTP(mrec, httptest.NewRequest("GET", "/metrics", nil))
+	body := mrec.Body.String()
+	host := strings.TrimPrefix(backend.URL, "http://")
+	for _, want := range []string{
+		`clawdbot_proxy_request_duration_seconds_count{code="2xx"} 1`,
+		`clawdbot_proxy_upstream_ttfb_seconds_count{backend="` + host + `"} 1`,
+		`clawdbot_proxy_upstream_duration_seconds_count{backend="` + host + `"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
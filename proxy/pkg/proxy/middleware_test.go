@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareDisableViaConfig(t *testing.T) {
+	p := newTestProxy(t, &Config{DisableMiddleware: []string{"request-id"}})
+	rec := httptest.NewRecorder()
+	p.publicHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Header().Get("X-Request-Id") != "" {
+		t.Error("request-id middleware ran despite being disabled")
+	}
+	if strings.Contains(strings.Join(p.MiddlewareNames(), ","), "request-id") {
+		t.Error("disabled middleware still listed in chain")
+	}
+
+	p = newTestProxy(t, &Config{})
+	rec = httptest.NewRecorder()
+	p.publicHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Header().Get("X-Request-Id") == "" {
+		t.Error("request-id middleware missing from default chain")
+	}
+}
+
+func TestMiddlewareDisableUnknownName(t *testing.T) {
+	cfg := &Config{Backend: "http://127.0.0.1:0", DisableMiddleware: []string{"frobnicate"}}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "frobnicate") {
+		t.Fatalf("validate = %v, want unknown middleware error", err)
+	}
+}
+
+func TestMiddlewareUseAndOrder(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	tag := func(v string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Chain", v)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	if err := p.Use("inner", tag("inner")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UseBefore("cors", "outer", tag("outer")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Use("inner", tag("dup")); err == nil {
+		t.Error("duplicate name accepted")
+	}
+	if err := p.UseBefore("nope", "x", tag("x")); err == nil {
+		t.Error("unknown target accepted")
+	}
+
+	rec := httptest.NewRecorder()
+	p.publicHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if got := strings.Join(rec.Header().Values("X-Chain"), ","); got != "outer,inner" {
+		t.Errorf("chain order = %q, want outer,inner", got)
+	}
+
+	names := strings.Join(p.MiddlewareNames(), ",")
+	if !strings.Contains(names, "outer,cors") || !strings.HasSuffix(names, "inner") {
+		t.Errorf("MiddlewareNames = %q, want outer before cors and inner last", names)
+	}
+}
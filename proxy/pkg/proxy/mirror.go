@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Traffic mirroring: a sampled share of backend requests is duplicated to a
+// shadow backend whose responses are discarded, so a new gateway build can
+// be exercised with production traffic. Copies are sent from a bounded set
+// of goroutines after the real request has its body buffered, so the
+// shadow never adds to client latency — at worst a mirror is dropped.
+
+const (
+	// mirrorMaxBody caps how much request body is buffered for the copy;
+	// larger bodies are simply not mirrored rather than held in memory.
+	mirrorMaxBody = 1 << 20
+
+	// mirrorMaxInflight bounds concurrent shadow requests; beyond it
+	// mirrors are dropped (and counted) instead of queueing.
+	mirrorMaxInflight = 32
+)
+
+type requestMirror struct {
+	target  *url.URL
+	percent int
+	client  *http.Client
+	sem     chan struct{}
+	metrics *Metrics
+	log     *slog.Logger
+}
+
+func newRequestMirror(target *url.URL, percent int, metrics *Metrics, log *slog.Logger) *requestMirror {
+	return &requestMirror{
+		target:  target,
+		percent: percent,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		sem:     make(chan struct{}, mirrorMaxInflight),
+		metrics: metrics,
+		log:     log,
+	}
+}
+
+// maybeMirror samples the request and, when selected, buffers its body
+// (restoring it for the real proxy pass) and ships a copy asynchronously.
+func (m *requestMirror) maybeMirror(r *http.Request) {
+	if m.percent < 100 && rand.Intn(100) >= m.percent {
+		return
+	}
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength > mirrorMaxBody {
+			m.metrics.Inc(`clawdbot_proxy_mirror_skipped_total`)
+			return
+		}
+		buf, err := io.ReadAll(io.LimitReader(r.Body, mirrorMaxBody+1))
+		r.Body.Close()
+		if err != nil || len(buf) > mirrorMaxBody {
+			// Restore what we have; the real request will surface the
+			// read error (or the body limit) on its own.
+			r.Body = io.NopCloser(bytes.NewReader(buf))
+			m.metrics.Inc(`clawdbot_proxy_mirror_skipped_total`)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(buf))
+		body = buf
+	}
+
+	select {
+	case m.sem <- struct{}{}:
+	default:
+		m.metrics.Inc(`clawdbot_proxy_mirror_dropped_total`)
+		return
+	}
+	copyReq := r.Clone(context.Background())
+	copyReq.URL.Scheme = m.target.Scheme
+	copyReq.URL.Host = m.target.Host
+	copyReq.Host = m.target.Host
+	copyReq.RequestURI = ""
+	copyReq.Body = io.NopCloser(bytes.NewReader(body))
+	copyReq.ContentLength = int64(len(body))
+	// Let the shadow tell mirrored traffic apart from the real thing.
+	copyReq.Header.Set("X-Clawdbot-Mirror", "1")
+
+	go func() {
+		defer func() { <-m.sem }()
+		resp, err := m.client.Do(copyReq)
+		if err != nil {
+			m.metrics.Inc(`clawdbot_proxy_mirror_errors_total`)
+			m.log.Debug("mirror request failed", "path", copyReq.URL.Path, "error", err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		m.metrics.Inc(`clawdbot_proxy_mirror_sent_total`)
+	}()
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mirrorHit struct {
+	body   string
+	header string
+}
+
+func mirrorProxy(t *testing.T, percent int) (*ProxyServer, chan mirrorHit) {
+	t.Helper()
+	main := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "real")
+	}))
+	t.Cleanup(main.Close)
+	hits := make(chan mirrorHit, 16)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		hits <- mirrorHit{body: string(body), header: r.Header.Get("X-Clawdbot-Mirror")}
+	}))
+	t.Cleanup(shadow.Close)
+	p := newTestProxy(t, &Config{
+		Backend:       main.URL,
+		MirrorBackend: shadow.URL,
+		MirrorPercent: percent,
+	})
+	return p, hits
+}
+
+func TestMirrorDuplicatesRequests(t *testing.T) {
+	p, hits := mirrorProxy(t, 100)
+
+	r := httptest.NewRequest("POST", "/api/send", strings.NewReader(`{"msg":"hi"}`))
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || rec.Body.String() != "real" {
+		t.Fatalf("client got %d %q, want the real backend's answer", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case hit := <-hits:
+		if hit.body != `{"msg":"hi"}` {
+			t.Errorf("shadow body = %q, want the original body", hit.body)
+		}
+		if hit.header != "1" {
+			t.Error("mirrored request missing X-Clawdbot-Mirror marker")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow backend never received the mirror")
+	}
+}
+
+func TestMirrorZeroPercentSendsNothing(t *testing.T) {
+	p, hits := mirrorProxy(t, 0)
+
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d", rec.Code)
+		}
+	}
+	select {
+	case <-hits:
+		t.Error("0%% mirroring still hit the shadow backend")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMirrorSkipsOversizedBodies(t *testing.T) {
+	p, hits := mirrorProxy(t, 100)
+
+	big := strings.Repeat("x", mirrorMaxBody+1)
+	r := httptest.NewRequest("POST", "/api/send", strings.NewReader(big))
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want the real request unaffected", rec.Code)
+	}
+	select {
+	case <-hits:
+		t.Error("oversized body should not be mirrored")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if p.metrics.Counter(`clawdbot_proxy_mirror_skipped_total`) == 0 {
+		t.Error("skip metric not incremented")
+	}
+}
@@ -0,0 +1,487 @@
+package proxy
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenID Connect relying party in front of the Control UI. Unauthenticated
+// browser requests on the configured prefixes are redirected to the IdP's
+// authorization endpoint; the callback exchanges the code, verifies the ID
+// token against the IdP's JWKS, and stores the identity in an AES-GCM
+// encrypted cookie. Verified claims ride to the gateway as X-Claw-* headers
+// (stamped in checkJWT after the spoof strip). /oidc/logout clears the
+// session and /oidc/refresh renews it via the refresh token.
+
+const (
+	oidcCallbackPath = "/oidc/callback"
+	oidcLogoutPath   = "/oidc/logout"
+	oidcRefreshPath  = "/oidc/refresh"
+
+	oidcSessionCookie = "clawdbot_oidc_session"
+	oidcStateCookie   = "clawdbot_oidc_state"
+	oidcStateTTL      = 10 * time.Minute
+)
+
+// oidcRP holds the relying-party configuration plus the lazily fetched
+// provider metadata.
+type oidcRP struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       string
+	key          [32]byte // AES-256 cookie key derived from -oidc-cookie-secret
+	client       *http.Client
+	metrics      *Metrics
+	log          *slog.Logger
+
+	mu        sync.Mutex
+	disc      *oidcDiscovery
+	verifier  *JWTVerifier
+	lastFetch time.Time
+}
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcSession is the sealed cookie payload.
+type oidcSession struct {
+	Subject      string `json:"sub"`
+	Email        string `json:"email,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Expiry       int64  `json:"exp"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// oidcState is the sealed login-state cookie (CSRF state, replay nonce, and
+// where to land after the callback).
+type oidcState struct {
+	State  string `json:"state"`
+	Nonce  string `json:"nonce"`
+	Return string `json:"return"`
+	Expiry int64  `json:"exp"`
+}
+
+func newOIDCRP(cfg *Config, metrics *Metrics, log *slog.Logger) (*oidcRP, error) {
+	if cfg.OIDCClientID == "" || cfg.OIDCClientSecret == "" {
+		return nil, errors.New("-oidc-issuer requires -oidc-client-id and -oidc-client-secret")
+	}
+	if cfg.OIDCCookieSecret == "" {
+		return nil, errors.New("-oidc-issuer requires -oidc-cookie-secret")
+	}
+	return &oidcRP{
+		issuer:       strings.TrimSuffix(cfg.OIDCIssuer, "/"),
+		clientID:     cfg.OIDCClientID,
+		clientSecret: cfg.OIDCClientSecret,
+		scopes:       cfg.OIDCScopes,
+		key:          sha256.Sum256([]byte(cfg.OIDCCookieSecret)),
+		client:       &http.Client{Timeout: 10 * time.Second},
+		metrics:      metrics,
+		log:          log,
+	}, nil
+}
+
+// discovery fetches the provider metadata once, retrying at most once a
+// minute while the IdP is unreachable.
+func (o *oidcRP) discovery() (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.disc != nil {
+		return o.disc, nil
+	}
+	if time.Since(o.lastFetch) < time.Minute {
+		return nil, errors.New("identity provider unavailable")
+	}
+	o.lastFetch = time.Now()
+	resp, err := o.client.Get(o.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("fetching OIDC discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching OIDC discovery: status %d", resp.StatusCode)
+	}
+	var disc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&disc); err != nil {
+		return nil, fmt.Errorf("parsing OIDC discovery: %w", err)
+	}
+	if disc.AuthorizationEndpoint == "" || disc.TokenEndpoint == "" {
+		return nil, errors.New("OIDC discovery missing authorization or token endpoint")
+	}
+	o.disc = &disc
+	o.verifier = NewJWTVerifier("", disc.JWKSURI)
+	return o.disc, nil
+}
+
+// seal encrypts a cookie payload with AES-256-GCM (random nonce prepended).
+func (o *oidcRP) seal(v any) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(o.key[:])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func (o *oidcRP) open(sealed string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return errJWTInvalid
+	}
+	block, err := aes.NewCipher(o.key[:])
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return errJWTInvalid
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return errJWTInvalid
+	}
+	return json.Unmarshal(plain, v)
+}
+
+// session returns the request's decrypted OIDC session, or nil when the
+// cookie is missing, tampered with, or expired.
+func (o *oidcRP) session(r *http.Request) *oidcSession {
+	c, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil
+	}
+	var s oidcSession
+	if o.open(c.Value, &s) != nil || s.Subject == "" {
+		return nil
+	}
+	if time.Now().After(time.Unix(s.Expiry, 0)) {
+		return nil
+	}
+	return &s
+}
+
+func (o *oidcRP) setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// redirectURI rebuilds the callback URL as the client saw the request.
+func (o *oidcRP) redirectURI(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + requestHost(r) + oidcCallbackPath
+}
+
+// beginLogin sends the browser to the IdP, stashing state in a sealed
+// short-lived cookie so the callback can validate it.
+func (o *oidcRP) beginLogin(w http.ResponseWriter, r *http.Request) {
+	disc, err := o.discovery()
+	if err != nil {
+		o.log.Error("oidc discovery failed", "error", err)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	st := oidcState{
+		State:  randomToken(),
+		Nonce:  randomToken(),
+		Return: r.URL.RequestURI(),
+		Expiry: time.Now().Add(oidcStateTTL).Unix(),
+	}
+	sealed, err := o.seal(st)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	o.setCookie(w, r, oidcStateCookie, sealed, int(oidcStateTTL.Seconds()))
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.clientID},
+		"redirect_uri":  {o.redirectURI(r)},
+		"scope":         {o.scopes},
+		"state":         {st.State},
+		"nonce":         {st.Nonce},
+	}
+	http.Redirect(w, r, disc.AuthorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+}
+
+// tokenResponse is the subset of the token endpoint reply we use.
+type tokenResponse struct {
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (o *oidcRP) exchange(form url.Values) (*tokenResponse, error) {
+	disc, err := o.discovery()
+	if err != nil {
+		return nil, err
+	}
+	form.Set("client_id", o.clientID)
+	form.Set("client_secret", o.clientSecret)
+	resp, err := o.client.PostForm(disc.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange: status %d", resp.StatusCode)
+	}
+	var tok tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("token exchange: no id_token in response")
+	}
+	return &tok, nil
+}
+
+// sessionFromToken verifies the ID token and distills it into a session.
+// wantNonce is empty on refresh, where the IdP does not echo a nonce.
+func (o *oidcRP) sessionFromToken(tok *tokenResponse, wantNonce string) (*oidcSession, error) {
+	o.mu.Lock()
+	verifier := o.verifier
+	o.mu.Unlock()
+	claims, err := verifier.Verify(tok.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("id_token: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != o.issuer {
+		return nil, fmt.Errorf("id_token: issuer %q does not match", iss)
+	}
+	if !audienceMatches(claims["aud"], o.clientID) {
+		return nil, errors.New("id_token: audience does not match client id")
+	}
+	if wantNonce != "" {
+		if nonce, _ := claims["nonce"].(string); nonce != wantNonce {
+			return nil, errors.New("id_token: nonce mismatch")
+		}
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("id_token: missing sub claim")
+	}
+	s := &oidcSession{Subject: sub, RefreshToken: tok.RefreshToken}
+	s.Email, _ = claims["email"].(string)
+	s.Name, _ = claims["name"].(string)
+	if exp, ok := numericClaim(claims, "exp"); ok {
+		s.Expiry = exp
+	} else {
+		s.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second).Unix()
+	}
+	return s, nil
+}
+
+// audienceMatches handles both the string and array forms of "aud".
+func audienceMatches(aud any, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o *oidcRP) handleCallback(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		http.Error(w, "login expired, retry", http.StatusBadRequest)
+		return
+	}
+	var st oidcState
+	if o.open(c.Value, &st) != nil || time.Now().After(time.Unix(st.Expiry, 0)) {
+		http.Error(w, "login expired, retry", http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("state") != st.State {
+		o.metrics.Inc(`clawdbot_proxy_oidc_failures_total`)
+		http.Error(w, "state mismatch", http.StatusBadRequest)
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "missing code", http.StatusBadRequest)
+		return
+	}
+	tok, err := o.exchange(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.redirectURI(r)},
+	})
+	if err == nil {
+		var s *oidcSession
+		if s, err = o.sessionFromToken(tok, st.Nonce); err == nil {
+			var sealed string
+			if sealed, err = o.seal(s); err == nil {
+				o.setCookie(w, r, oidcStateCookie, "", -1)
+				o.setCookie(w, r, oidcSessionCookie, sealed, int(time.Until(time.Unix(s.Expiry, 0)).Seconds()))
+				o.metrics.Inc(`clawdbot_proxy_oidc_logins_total`)
+				// Only send the browser back to a local path; an absolute
+				// URL in the state would be an open redirect.
+				ret := st.Return
+				if !strings.HasPrefix(ret, "/") || strings.HasPrefix(ret, "//") {
+					ret = "/"
+				}
+				http.Redirect(w, r, ret, http.StatusFound)
+				return
+			}
+		}
+	}
+	o.metrics.Inc(`clawdbot_proxy_oidc_failures_total`)
+	o.log.Warn("oidc callback failed", "error", err)
+	http.Error(w, "login failed", http.StatusBadGateway)
+}
+
+func (o *oidcRP) handleLogout(w http.ResponseWriter, r *http.Request) {
+	o.setCookie(w, r, oidcSessionCookie, "", -1)
+	if disc, err := o.discovery(); err == nil && disc.EndSessionEndpoint != "" {
+		q := url.Values{"client_id": {o.clientID}}
+		http.Redirect(w, r, disc.EndSessionEndpoint+"?"+q.Encode(), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (o *oidcRP) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		http.Error(w, "no session", http.StatusUnauthorized)
+		return
+	}
+	// The session may be expired — that is exactly when a refresh is
+	// needed — so decrypt directly instead of going through session().
+	var s oidcSession
+	if o.open(c.Value, &s) != nil || s.RefreshToken == "" {
+		http.Error(w, "no refresh token", http.StatusUnauthorized)
+		return
+	}
+	tok, err := o.exchange(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.RefreshToken},
+	})
+	if err == nil {
+		var fresh *oidcSession
+		if fresh, err = o.sessionFromToken(tok, ""); err == nil {
+			if fresh.RefreshToken == "" {
+				fresh.RefreshToken = s.RefreshToken // IdP did not rotate it
+			}
+			var sealed string
+			if sealed, err = o.seal(fresh); err == nil {
+				o.setCookie(w, r, oidcSessionCookie, sealed, int(time.Until(time.Unix(fresh.Expiry, 0)).Seconds()))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+	}
+	o.log.Warn("oidc refresh failed", "error", err)
+	o.setCookie(w, r, oidcSessionCookie, "", -1)
+	http.Error(w, "refresh failed", http.StatusUnauthorized)
+}
+
+// ctxKeyOIDC carries the verified session so checkJWT can stamp the
+// identity headers after its spoof strip.
+type ctxKeyOIDC struct{}
+
+func oidcSessionFrom(r *http.Request) *oidcSession {
+	s, _ := r.Context().Value(ctxKeyOIDC{}).(*oidcSession)
+	return s
+}
+
+// forwardClaims stamps the gateway-facing identity headers.
+func (s *oidcSession) forwardClaims(h http.Header) {
+	h.Set("X-Claw-User", s.Subject)
+	if s.Email != "" {
+		h.Set("X-Claw-Email", s.Email)
+	}
+	if s.Name != "" {
+		h.Set("X-Claw-Name", s.Name)
+	}
+}
+
+// checkOIDC serves the /oidc/* endpoints and enforces login on the
+// configured prefixes. It returns the request (possibly annotated with the
+// session) and false when the request was answered.
+func (p *ProxyServer) checkOIDC(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if p.oidc == nil {
+		return r, true
+	}
+	switch r.URL.Path {
+	case oidcCallbackPath:
+		p.oidc.handleCallback(w, r)
+		return r, false
+	case oidcLogoutPath:
+		p.oidc.handleLogout(w, r)
+		return r, false
+	case oidcRefreshPath:
+		p.oidc.handleRefresh(w, r)
+		return r, false
+	}
+	s := p.oidc.session(r)
+	if s != nil {
+		return r.WithContext(context.WithValue(r.Context(), ctxKeyOIDC{}, s)), true
+	}
+	if !pathHasPrefix(r.URL.Path, p.cfg.OIDCPaths) {
+		return r, true
+	}
+	// Browsers get bounced to the IdP; API clients get a plain 401 so
+	// they do not chase redirects.
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		p.oidc.beginLogin(w, r)
+		return r, false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error":"authentication required"}` + "\n"))
+	return r, false
+}
@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIdP runs a minimal OIDC provider: discovery, JWKS, and a token
+// endpoint that signs ID tokens with its own RSA key.
+type fakeIdP struct {
+	srv   *httptest.Server
+	key   *rsa.PrivateKey
+	nonce string // echoed into the next issued id_token
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": idp.srv.URL + "/auth",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString([]byte{1, 0, 1}))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idToken := signRS256(t, key, "k1", map[string]any{
+			"iss":   idp.srv.URL,
+			"aud":   "claw-ui",
+			"sub":   "peter",
+			"email": "peter@claw.example",
+			"nonce": idp.nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		json.NewEncoder(w).Encode(map[string]any{
+			"id_token": idToken, "refresh_token": "r1", "expires_in": 3600,
+		})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func oidcProxy(t *testing.T, idp *fakeIdP) *ProxyServer {
+	t.Helper()
+	return staticProxy(t, &Config{
+		OIDCIssuer:       idp.srv.URL,
+		OIDCClientID:     "claw-ui",
+		OIDCClientSecret: "s3cret",
+		OIDCCookieSecret: "cookie-key",
+		OIDCScopes:       "openid email",
+		OIDCPaths:        []string{"/"},
+	}, map[string]string{"index.html": "ui"})
+}
+
+func TestOIDCSealOpenRejectsTampering(t *testing.T) {
+	o := &oidcRP{}
+	copy(o.key[:], []byte("0123456789abcdef0123456789abcdef"))
+	sealed, err := o.seal(&oidcSession{Subject: "peter", Expiry: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s oidcSession
+	if err := o.open(sealed, &s); err != nil || s.Subject != "peter" {
+		t.Fatalf("round trip: %v, sub=%q", err, s.Subject)
+	}
+	if err := o.open(sealed[:len(sealed)-2]+"xx", &s); err == nil {
+		t.Error("tampered cookie must not decrypt")
+	}
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := oidcProxy(t, idp)
+
+	// Unauthenticated browser request is bounced to the IdP.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want 302 to IdP", rec.Code)
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(loc.String(), idp.srv.URL+"/auth") {
+		t.Fatalf("Location = %q, want IdP authorization endpoint", rec.Header().Get("Location"))
+	}
+	if loc.Query().Get("client_id") != "claw-ui" || loc.Query().Get("state") == "" {
+		t.Fatalf("auth redirect missing client_id/state: %q", loc.RawQuery)
+	}
+	stateCookie := rec.Result().Cookies()[0]
+	idp.nonce = loc.Query().Get("nonce")
+
+	// Callback exchanges the code and issues the session cookie.
+	r = httptest.NewRequest("GET", oidcCallbackPath+"?code=abc&state="+loc.Query().Get("state"), nil)
+	r.AddCookie(stateCookie)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Fatalf("callback: status=%d location=%q, want 302 /", rec.Code, rec.Header().Get("Location"))
+	}
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcSessionCookie && c.Value != "" {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("callback did not set a session cookie")
+	}
+
+	// The session cookie now opens the UI without a redirect.
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(session)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("authenticated request: status = %d, want 200", rec.Code)
+	}
+
+	// Refresh re-issues the cookie via the refresh token.
+	r = httptest.NewRequest("POST", oidcRefreshPath, nil)
+	r.AddCookie(session)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("refresh: status = %d, want 204", rec.Code)
+	}
+
+	// Logout clears the session.
+	r = httptest.NewRequest("GET", oidcLogoutPath, nil)
+	r.AddCookie(session)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusFound {
+		t.Errorf("logout: status = %d, want 302", rec.Code)
+	}
+	cleared := false
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcSessionCookie && c.MaxAge < 0 {
+			cleared = true
+		}
+	}
+	if !cleared {
+		t.Error("logout did not clear the session cookie")
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := oidcProxy(t, idp)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	stateCookie := rec.Result().Cookies()[0]
+
+	r = httptest.NewRequest("GET", oidcCallbackPath+"?code=abc&state=forged", nil)
+	r.AddCookie(stateCookie)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("forged state: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestOIDCAPIClientsGet401(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := oidcProxy(t, idp)
+
+	r := httptest.NewRequest("GET", "/api/status", nil) // no text/html Accept
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("API client: status = %d, want 401 not a redirect", rec.Code)
+	}
+}
+
+func TestOIDCSessionForwardsClaims(t *testing.T) {
+	p := &ProxyServer{cfg: &Config{}, metrics: NewMetrics()}
+	s := &oidcSession{Subject: "peter", Email: "peter@claw.example"}
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("X-Claw-User", "spoofed")
+	r = r.WithContext(context.WithValue(r.Context(), ctxKeyOIDC{}, s))
+	if !p.checkJWT(httptest.NewRecorder(), r) {
+		t.Fatal("OIDC session should satisfy edge auth")
+	}
+	if r.Header.Get("X-Claw-User") != "peter" || r.Header.Get("X-Claw-Email") != "peter@claw.example" {
+		t.Errorf("claims headers = %q/%q, want verified session identity",
+			r.Header.Get("X-Claw-User"), r.Header.Get("X-Claw-Email"))
+	}
+}
@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OpenAPI-driven input validation. With -openapi-spec pointing at the
+// gateway's OpenAPI 3 document (JSON), requests are checked against the
+// documented operations before they reach Node: unknown paths get 404,
+// unknown methods 405, and missing or mistyped parameters and bodies 400.
+// Validation is deliberately shallow — path templates, query/path parameter
+// types, body presence, and required top-level body properties — a cheap
+// shield, not a full schema engine.
+
+type openapiValidator struct {
+	ops     []*openapiOp
+	metrics *Metrics
+}
+
+// openapiOp is one documented method+path, with its template split into
+// segments ("{id}" entries match any single segment).
+type openapiOp struct {
+	method   string
+	segments []string
+	params   []oaParam
+	body     *oaBody
+}
+
+type oaParam struct {
+	Name     string   `json:"name"`
+	In       string   `json:"in"`
+	Required bool     `json:"required"`
+	Schema   oaSchema `json:"schema"`
+}
+
+type oaBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema oaSchema `json:"schema"`
+	} `json:"content"`
+}
+
+type oaSchema struct {
+	Type       string              `json:"type"`
+	Required   []string            `json:"required"`
+	Properties map[string]oaSchema `json:"properties"`
+}
+
+var oaMethods = []string{"get", "post", "put", "patch", "delete", "head", "options"}
+
+func newOpenAPIValidator(path string, m *Metrics) (*openapiValidator, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI spec: %w", err)
+	}
+	if len(spec.Paths) == 0 {
+		return nil, fmt.Errorf("OpenAPI spec %s has no paths", path)
+	}
+	v := &openapiValidator{metrics: m}
+	for tmpl, item := range spec.Paths {
+		// Path-level parameters apply to every operation on the path.
+		var shared []oaParam
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("path %s parameters: %w", tmpl, err)
+			}
+		}
+		for _, method := range oaMethods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op struct {
+				Parameters  []oaParam `json:"parameters"`
+				RequestBody *oaBody   `json:"requestBody"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("operation %s %s: %w", method, tmpl, err)
+			}
+			v.ops = append(v.ops, &openapiOp{
+				method:   strings.ToUpper(method),
+				segments: strings.Split(strings.Trim(tmpl, "/"), "/"),
+				params:   append(append([]oaParam{}, shared...), op.Parameters...),
+				body:     op.RequestBody,
+			})
+		}
+	}
+	return v, nil
+}
+
+// check validates the request against the spec. It returns a status code
+// and message for rejections, or 0 when the request is documented and
+// well-formed.
+func (v *openapiValidator) check(r *http.Request) (int, string) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	pathKnown := false
+	for _, op := range v.ops {
+		if !segmentsMatch(op.segments, segments) {
+			continue
+		}
+		pathKnown = true
+		if op.method != r.Method {
+			continue
+		}
+		return v.checkOperation(op, r, segments)
+	}
+	if pathKnown {
+		return http.StatusMethodNotAllowed, "method not documented for this path"
+	}
+	return http.StatusNotFound, "path not in API specification"
+}
+
+func (v *openapiValidator) checkOperation(op *openapiOp, r *http.Request, segments []string) (int, string) {
+	query := r.URL.Query()
+	for _, p := range op.params {
+		switch p.In {
+		case "query":
+			vals, ok := query[p.Name]
+			if !ok {
+				if p.Required {
+					return http.StatusBadRequest, "missing required query parameter " + p.Name
+				}
+				continue
+			}
+			if !valueMatchesType(vals[0], p.Schema.Type) {
+				return http.StatusBadRequest, "query parameter " + p.Name + " must be " + p.Schema.Type
+			}
+		case "path":
+			for i, seg := range op.segments {
+				if seg == "{"+p.Name+"}" && !valueMatchesType(segments[i], p.Schema.Type) {
+					return http.StatusBadRequest, "path parameter " + p.Name + " must be " + p.Schema.Type
+				}
+			}
+		}
+	}
+	if op.body == nil {
+		return 0, ""
+	}
+	return v.checkBody(op.body, r)
+}
+
+// checkBody validates a JSON request body in place, restoring r.Body so the
+// proxy can still forward it.
+func (v *openapiValidator) checkBody(spec *oaBody, r *http.Request) (int, string) {
+	if r.ContentLength == 0 {
+		if spec.Required {
+			return http.StatusBadRequest, "request body required"
+		}
+		return 0, ""
+	}
+	content, ok := spec.Content["application/json"]
+	if !ok {
+		return 0, "" // only JSON bodies are inspected
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
+		return http.StatusBadRequest, "request body must be application/json"
+	}
+	raw, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return http.StatusBadRequest, "reading request body failed"
+	}
+	var body map[string]any
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return http.StatusBadRequest, "request body is not valid JSON"
+	}
+	for _, name := range content.Schema.Required {
+		if _, ok := body[name]; !ok {
+			return http.StatusBadRequest, "missing required body property " + name
+		}
+	}
+	for name, prop := range content.Schema.Properties {
+		val, ok := body[name]
+		if ok && !jsonMatchesType(val, prop.Type) {
+			return http.StatusBadRequest, "body property " + name + " must be " + prop.Type
+		}
+	}
+	return 0, ""
+}
+
+// segmentsMatch compares a path template against request segments;
+// "{param}" entries match any single segment.
+func segmentsMatch(tmpl, got []string) bool {
+	if len(tmpl) != len(got) {
+		return false
+	}
+	for i, seg := range tmpl {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			continue
+		}
+		if seg != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// valueMatchesType checks a string parameter against a primitive OpenAPI
+// type; unknown or empty types accept anything.
+func valueMatchesType(val, typ string) bool {
+	switch typ {
+	case "integer":
+		_, err := strconv.ParseInt(val, 10, 64)
+		return err == nil
+	case "number":
+		_, err := strconv.ParseFloat(val, 64)
+		return err == nil
+	case "boolean":
+		return val == "true" || val == "false"
+	default:
+		return true
+	}
+}
+
+// jsonMatchesType checks a decoded JSON value against an OpenAPI type.
+func jsonMatchesType(val any, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "integer":
+		f, ok := val.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "object":
+		_, ok := val.(map[string]any)
+		return ok
+	case "array":
+		_, ok := val.([]any)
+		return ok
+	default:
+		return true
+	}
+}
+
+// validateOpenAPI rejects requests that do not match a documented
+// operation; it runs after rate limiting so invalid floods still pay.
+func (p *ProxyServer) validateOpenAPI(w http.ResponseWriter, r *http.Request) bool {
+	if p.openapi == nil {
+		return true
+	}
+	code, msg := p.openapi.check(r)
+	if code == 0 {
+		return true
+	}
+	p.metrics.Inc(`clawdbot_proxy_openapi_rejected_total{code="` + strconv.Itoa(code) + `"}`)
+	p.httpError(w, r, code, msg)
+	return false
+}
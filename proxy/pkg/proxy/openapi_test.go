@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSpec = `{
+  "openapi": "3.0.0",
+  "paths": {
+    "/api/status": {
+      "get": {}
+    },
+    "/api/agents/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "get": {
+        "parameters": [{"name": "verbose", "in": "query", "schema": {"type": "boolean"}}]
+      }
+    },
+    "/api/agent/run": {
+      "post": {
+        "parameters": [{"name": "trace", "in": "query", "required": true, "schema": {"type": "string"}}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["message"],
+                "properties": {"message": {"type": "string"}, "timeout": {"type": "integer"}}
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func newTestOpenAPI(t *testing.T) *openapiValidator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	if err := os.WriteFile(path, []byte(testSpec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := newOpenAPIValidator(path, NewMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	v := newTestOpenAPI(t)
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"documented operation", "GET", "/api/status", "", 0},
+		{"unknown path", "GET", "/api/bogus", "", 404},
+		{"unknown method", "DELETE", "/api/status", "", 405},
+		{"path template match", "GET", "/api/agents/7", "", 0},
+		{"mistyped path parameter", "GET", "/api/agents/seven", "", 400},
+		{"typed query parameter", "GET", "/api/agents/7?verbose=true", "", 0},
+		{"mistyped query parameter", "GET", "/api/agents/7?verbose=maybe", "", 400},
+		{"missing required query parameter", "POST", "/api/agent/run", `{"message":"hi"}`, 400},
+		{"missing required body", "POST", "/api/agent/run?trace=t1", "", 400},
+		{"invalid body JSON", "POST", "/api/agent/run?trace=t1", "{broken", 400},
+		{"missing required body property", "POST", "/api/agent/run?trace=t1", `{"timeout":5}`, 400},
+		{"mistyped body property", "POST", "/api/agent/run?trace=t1", `{"message":"hi","timeout":1.5}`, 400},
+		{"valid body", "POST", "/api/agent/run?trace=t1", `{"message":"hi","timeout":5}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			r := httptest.NewRequest(tt.method, tt.url, body)
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			if code, msg := v.check(r); code != tt.want {
+				t.Errorf("check() = %d %q, want %d", code, msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAPIBodyRestoredAfterValidation(t *testing.T) {
+	v := newTestOpenAPI(t)
+	payload := `{"message":"hi"}`
+	r := httptest.NewRequest("POST", "/api/agent/run?trace=t1", strings.NewReader(payload))
+	r.Header.Set("Content-Type", "application/json")
+	if code, msg := v.check(r); code != 0 {
+		t.Fatalf("check() = %d %q, want pass", code, msg)
+	}
+	got, err := io.ReadAll(r.Body)
+	if err != nil || string(got) != payload {
+		t.Errorf("body after validation = %q (%v), want original payload", got, err)
+	}
+}
+
+func TestOpenAPIRejectsSpecWithoutPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	if err := os.WriteFile(path, []byte(`{"openapi":"3.0.0"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newOpenAPIValidator(path, NewMetrics()); err == nil {
+		t.Error("spec without paths should be rejected at startup")
+	}
+}
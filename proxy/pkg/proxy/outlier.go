@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Outlier detection for the backend pool. markDown only catches hard
+// failures; a backend that answers slowly or throws intermittent 5xx keeps
+// its full round-robin share. With -outlier-detection each target tracks a
+// rolling success rate and latency, and pick() sheds traffic from targets
+// that are statistical outliers against the rest of the pool. The shed is
+// probabilistic with a floor, so a degraded target keeps receiving a
+// trickle of probes and earns its weight back as the EWMAs recover — no
+// explicit restore timer needed.
+
+const (
+	// outlierAlpha is the EWMA smoothing factor; ~1/alpha recent requests
+	// dominate the estimate.
+	outlierAlpha = 0.05
+	// outlierMinSamples holds new targets at full weight until the EWMAs
+	// mean something.
+	outlierMinSamples = 20
+	// outlierLatencyFactor: a target this many times slower than the pool
+	// average starts losing weight.
+	outlierLatencyFactor = 2.0
+	// outlierMinWeight keeps probe traffic flowing so recovery is possible.
+	outlierMinWeight = 0.05
+)
+
+// outlierStats is one target's rolling view; all access goes through the
+// mutex since requests land from many goroutines.
+type outlierStats struct {
+	mu      sync.Mutex
+	success float64 // EWMA of 0/1 outcomes, starts optimistic
+	latency float64 // EWMA seconds to response headers
+	samples int64
+}
+
+func newOutlierStats() *outlierStats {
+	return &outlierStats{success: 1}
+}
+
+func (s *outlierStats) record(ok bool, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples++
+	v := 0.0
+	if ok {
+		v = 1.0
+	}
+	s.success += outlierAlpha * (v - s.success)
+	sec := d.Seconds()
+	if s.latency == 0 {
+		s.latency = sec
+	} else {
+		s.latency += outlierAlpha * (sec - s.latency)
+	}
+}
+
+func (s *outlierStats) snapshot() (success, latency float64, samples int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.success, s.latency, s.samples
+}
+
+// weight maps the rolling stats to a share of full traffic in [minWeight,
+// 1]. poolLatency is the average latency EWMA of the pool's seasoned
+// targets, used as the baseline for the slowness penalty.
+func (s *outlierStats) weight(poolLatency float64) float64 {
+	success, latency, samples := s.snapshot()
+	if samples < outlierMinSamples {
+		return 1
+	}
+	// Squaring makes the penalty bite: 90% success keeps 81% weight,
+	// 50% keeps a quarter.
+	w := success * success
+	if poolLatency > 0 && latency > outlierLatencyFactor*poolLatency {
+		w *= outlierLatencyFactor * poolLatency / latency
+	}
+	if w < outlierMinWeight {
+		return outlierMinWeight
+	}
+	if w > 1 {
+		return 1
+	}
+	return w
+}
+
+// outlierTransport times each attempt and feeds the target's stats; 5xx
+// counts as a failure even though the transport call succeeded.
+type outlierTransport struct {
+	base  http.RoundTripper
+	stats *outlierStats
+}
+
+func (o *outlierTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := o.base.RoundTrip(req)
+	ok := err == nil && resp.StatusCode < http.StatusInternalServerError
+	o.stats.record(ok, time.Since(start))
+	return resp, err
+}
+
+// poolLatency averages the latency EWMAs of targets with enough samples.
+func (b *backendPool) poolLatency() float64 {
+	sum, n := 0.0, 0
+	for _, t := range b.targets() {
+		if t.stats == nil {
+			continue
+		}
+		_, latency, samples := t.stats.snapshot()
+		if samples >= outlierMinSamples {
+			sum += latency
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// acceptTarget rolls against the target's current weight; a rejection is a
+// shed, not a failure.
+func (b *backendPool) acceptTarget(t *lbTarget) bool {
+	if t.stats == nil {
+		return true
+	}
+	w := t.stats.weight(b.poolLatency())
+	if w >= 1 || rand.Float64() < w {
+		return true
+	}
+	b.metrics.Inc(`clawdbot_proxy_outlier_sheds_total`)
+	return false
+}
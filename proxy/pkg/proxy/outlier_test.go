@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func seedStats(s *outlierStats, ok int, fail int, d time.Duration) {
+	for i := 0; i < ok; i++ {
+		s.record(true, d)
+	}
+	for i := 0; i < fail; i++ {
+		s.record(false, d)
+	}
+}
+
+func TestOutlierWeightNewTargetFullShare(t *testing.T) {
+	s := newOutlierStats()
+	seedStats(s, 5, 5, 10*time.Millisecond) // below min samples
+	if w := s.weight(0.01); w != 1 {
+		t.Fatalf("weight = %v, want 1 before min samples", w)
+	}
+}
+
+func TestOutlierWeightDropsOnFailures(t *testing.T) {
+	healthy := newOutlierStats()
+	seedStats(healthy, 100, 0, 10*time.Millisecond)
+	failing := newOutlierStats()
+	seedStats(failing, 50, 50, 10*time.Millisecond)
+	if w := healthy.weight(0.01); w < 0.95 {
+		t.Fatalf("healthy weight = %v, want ~1", w)
+	}
+	w := failing.weight(0.01)
+	if w >= healthy.weight(0.01) || w < outlierMinWeight {
+		t.Fatalf("failing weight = %v", w)
+	}
+}
+
+func TestOutlierWeightDropsOnLatency(t *testing.T) {
+	slow := newOutlierStats()
+	seedStats(slow, 100, 0, 500*time.Millisecond)
+	// Pool average of 50ms: 10x slower should be shed hard.
+	if w := slow.weight(0.05); w > 0.5 {
+		t.Fatalf("slow target weight = %v, want well below 1", w)
+	}
+	// A target tracking the pool average keeps full weight.
+	normal := newOutlierStats()
+	seedStats(normal, 100, 0, 50*time.Millisecond)
+	if w := normal.weight(0.05); w < 0.95 {
+		t.Fatalf("normal target weight = %v, want ~1", w)
+	}
+}
+
+func TestOutlierWeightRecovers(t *testing.T) {
+	s := newOutlierStats()
+	seedStats(s, 0, 100, 10*time.Millisecond)
+	floor := s.weight(0.01)
+	seedStats(s, 200, 0, 10*time.Millisecond)
+	if w := s.weight(0.01); w <= floor || w < 0.9 {
+		t.Fatalf("weight after recovery = %v (was %v)", w, floor)
+	}
+}
+
+func TestPoolPickShedsOutlier(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: "http://a:1,http://b:1", OutlierDetection: true})
+	if p.lb == nil {
+		t.Fatal("pool not built")
+	}
+	ts := p.lb.targets()
+	if len(ts) != 2 || ts[0].stats == nil {
+		t.Fatalf("targets = %v, stats missing", len(ts))
+	}
+	seedStats(ts[0].stats, 100, 0, 10*time.Millisecond)
+	seedStats(ts[1].stats, 0, 100, 10*time.Millisecond)
+	picks := map[string]int{}
+	for i := 0; i < 500; i++ {
+		tgt, _ := p.lb.pick(httptest.NewRequest("GET", "/", nil))
+		picks[tgt.url.Host]++
+	}
+	if picks["a:1"] <= picks["b:1"]*2 {
+		t.Fatalf("picks = %v, want the healthy target heavily favored", picks)
+	}
+	if picks["b:1"] == 0 {
+		t.Fatal("degraded target should still get probe traffic")
+	}
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol support (v1 text and v2 binary) for deployments behind
+// HAProxy or an L4 load balancer. When enabled, every connection must start
+// with a valid header; anything else is rejected so spoofed direct
+// connections can't fake their source address.
+
+var proxyV2Signature = []byte{0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a}
+
+type proxyProtoListener struct {
+	net.Listener
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtoConn{Conn: conn, br: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtoConn parses the PROXY header lazily on first use so a slow
+// client can't stall the accept loop.
+type proxyProtoConn struct {
+	net.Conn
+	br     *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyProtoConn) ensureHeader() {
+	c.once.Do(func() {
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		defer c.SetReadDeadline(time.Time{})
+		addr, err := readProxyHeader(c.br)
+		if err != nil {
+			c.err = err
+			c.Conn.Close()
+			return
+		}
+		if addr != nil {
+			c.remote = addr
+		}
+	})
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	c.ensureHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.ensureHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader consumes a v1 or v2 PROXY header and returns the real
+// client address (nil for LOCAL/UNKNOWN, meaning "keep the socket address").
+func readProxyHeader(br *bufio.Reader) (net.Addr, error) {
+	peek, err := br.Peek(12)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	if bytes.Equal(peek, proxyV2Signature) {
+		return readProxyV2(br)
+	}
+	if bytes.HasPrefix(peek, []byte("PROXY ")) {
+		return readProxyV1(br)
+	}
+	return nil, errors.New("proxy protocol: connection missing PROXY header")
+}
+
+func readProxyV1(br *bufio.Reader) (net.Addr, error) {
+	line, err := br.ReadString('\n')
+	if err != nil || !strings.HasSuffix(line, "\r\n") || len(line) > 107 {
+		return nil, errors.New("proxy protocol: malformed v1 header")
+	}
+	fields := strings.Fields(strings.TrimSuffix(line, "\r\n"))
+	// PROXY <TCP4|TCP6|UNKNOWN> <src> <dst> <sport> <dport>
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("proxy protocol: malformed v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil {
+		return nil, errors.New("proxy protocol: bad v1 source address")
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyV2(br *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	verCmd := header[12]
+	family := header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	if verCmd>>4 != 2 {
+		return nil, errors.New("proxy protocol: unsupported v2 version")
+	}
+	if verCmd&0x0f == 0 { // LOCAL (health checks): keep socket address
+		return nil, nil
+	}
+	switch family >> 4 {
+	case 1: // AF_INET
+		if length < 12 {
+			return nil, errors.New("proxy protocol: short v2 IPv4 payload")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}, nil
+	case 2: // AF_INET6
+		if length < 36 {
+			return nil, errors.New("proxy protocol: short v2 IPv6 payload")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}, nil
+	default: // AF_UNSPEC/AF_UNIX
+		return nil, nil
+	}
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyV1(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("PROXY TCP4 203.0.113.7 10.0.0.1 51234 18789\r\nGET / HTTP/1.1\r\n"))
+	addr, err := readProxyHeader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != "203.0.113.7:51234" {
+		t.Errorf("addr = %s, want 203.0.113.7:51234", addr)
+	}
+	rest, _ := br.ReadString('\n')
+	if rest != "GET / HTTP/1.1\r\n" {
+		t.Errorf("remaining stream = %q, header must be fully consumed", rest)
+	}
+}
+
+func TestReadProxyV1Unknown(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n"))
+	addr, err := readProxyHeader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != nil {
+		t.Errorf("addr = %v, want nil for UNKNOWN", addr)
+	}
+}
+
+func TestReadProxyV2IPv4(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+	buf.WriteByte(0x21) // v2, PROXY
+	buf.WriteByte(0x11) // TCP over IPv4
+	payload := []byte{203, 0, 113, 9, 10, 0, 0, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(payload[8:10], 40000)
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(payload)))
+	buf.Write(length[:])
+	buf.Write(payload)
+	buf.WriteString("GET")
+
+	br := bufio.NewReader(&buf)
+	addr, err := readProxyHeader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != "203.0.113.9:40000" {
+		t.Errorf("addr = %s, want 203.0.113.9:40000", addr)
+	}
+	rest := make([]byte, 3)
+	br.Read(rest)
+	if string(rest) != "GET" {
+		t.Errorf("remaining stream = %q", rest)
+	}
+}
+
+func TestReadProxyHeaderRejectsPlainHTTP(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	if _, err := readProxyHeader(br); err == nil {
+		t.Error("connection without PROXY header must be rejected")
+	}
+}
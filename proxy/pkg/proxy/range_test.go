@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStaticRangeRequests(t *testing.T) {
+	p := staticProxy(t, &Config{}, map[string]string{"logs.txt": "0123456789"})
+
+	r := httptest.NewRequest("GET", "/logs.txt", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+	if rec.Body.String() != "2345" {
+		t.Errorf("body = %q, want the requested slice", rec.Body.String())
+	}
+	if cr := rec.Header().Get("Content-Range"); cr != "bytes 2-5/10" {
+		t.Errorf("Content-Range = %q", cr)
+	}
+}
+
+func TestStaticRangeUnsatisfiable(t *testing.T) {
+	p := staticProxy(t, &Config{}, map[string]string{"logs.txt": "0123456789"})
+
+	r := httptest.NewRequest("GET", "/logs.txt", nil)
+	r.Header.Set("Range", "bytes=100-200")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("status = %d, want 416", rec.Code)
+	}
+	if cr := rec.Header().Get("Content-Range"); cr != "bytes */10" {
+		t.Errorf("Content-Range = %q, want bytes */10", cr)
+	}
+}
+
+func TestProxiedRangePassthrough(t *testing.T) {
+	full := "abcdefghij"
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rg := r.Header.Get("Range")
+		if rg != "bytes=0-3" {
+			t.Errorf("backend saw Range = %q", rg)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-3/%d", len(full)))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(full[:4]))
+	}))
+	defer backend.Close()
+
+	p := newTestProxy(t, &Config{Backend: backend.URL, RateLimitRPS: 100, RateLimitBurst: 100, Compress: true, CompressMinSize: 1, CompressTypes: []string{"text/plain"}})
+	h := p.compress(p)
+
+	r := httptest.NewRequest("GET", "/api/export", nil)
+	r.Header.Set("Range", "bytes=0-3")
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+	// Partial bodies must never be re-encoded: offsets would stop matching
+	// Content-Range.
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("partial response got Content-Encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Body.String() != "abcd" {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
+
+func TestCacheSkipsRangeRequests(t *testing.T) {
+	hits := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", "bytes 0-0/10")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("a"))
+			return
+		}
+		w.Write([]byte(strings.Repeat("a", 10)))
+	}))
+	defer backend.Close()
+
+	p := newTestProxy(t, &Config{
+		Backend: backend.URL, RateLimitRPS: 100, RateLimitBurst: 100,
+		CacheEnabled: true, CacheTTL: 60, CacheMaxEntries: 10, CacheMaxBody: 1 << 20,
+	})
+
+	r := httptest.NewRequest("GET", "/api/export", nil)
+	r.Header.Set("Range", "bytes=0-0")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+
+	// The partial answer must not have been cached for the full request.
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/export", nil))
+	if rec.Body.Len() != 10 {
+		t.Errorf("full body after range = %d bytes, want 10", rec.Body.Len())
+	}
+	if hits != 2 {
+		t.Errorf("backend hits = %d, want 2 (range request bypasses cache)", hits)
+	}
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Defaults for the bucket table bounds; -rate-limit-max-entries and
+// -rate-limit-idle-ttl override them.
+const (
+	rateLimitMaxEntries = 10000
+	rateLimitIdleTTL    = 10 * time.Minute
+)
+
+// RateLimiter is a per-key token bucket limiter. The bucket table is an
+// LRU: each access moves the key to the front, the least recently seen key
+// is evicted once the table is full, and a sweeper drops buckets idle past
+// the TTL. Evicting only the coldest entries matters — a wholesale reset
+// would hand every active abuser a fresh burst allowance.
+type RateLimiter struct {
+	mu         sync.Mutex
+	buckets    map[string]*list.Element
+	order      *list.List // front = most recently used
+	rps        float64
+	burst      float64
+	maxEntries int
+	idleTTL    time.Duration
+	metrics    *Metrics // optional; reports table size and evictions
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		buckets:    make(map[string]*list.Element),
+		order:      list.New(),
+		rps:        rps,
+		burst:      float64(burst),
+		maxEntries: rateLimitMaxEntries,
+		idleTTL:    rateLimitIdleTTL,
+	}
+	go rl.cleanupLoop()
+	return rl
+}
+
+// Allow reports whether the caller identified by key may proceed, consuming
+// one token if so.
+func (rl *RateLimiter) Allow(key string) bool {
+	return rl.AllowRate(key, rl.rps, rl.burst)
+}
+
+// AllowRate is Allow with per-call rate overrides, used for API keys that
+// carry their own limits.
+func (rl *RateLimiter) AllowRate(key string, rps, burst float64) bool {
+	allowed, _ := rl.allowInfo(key, rps, burst, 1)
+	return allowed
+}
+
+// rateLimitInfo is a snapshot of a bucket after a limiting decision, used
+// to fill the RateLimit-* response headers.
+type rateLimitInfo struct {
+	limit     float64 // configured burst (the advertised quota)
+	remaining float64 // tokens left after this decision
+	retry     float64 // seconds until the next token; zero when allowed
+	reset     float64 // seconds until the bucket is completely full
+}
+
+// allowInfo makes the limiting decision, charging cost tokens (routes may
+// declare cost= > 1 for expensive operations), and reports the resulting
+// bucket state.
+func (rl *RateLimiter) allowInfo(key string, rps, burst, cost float64) (bool, rateLimitInfo) {
+	if rps <= 0 {
+		return true, rateLimitInfo{}
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	el, ok := rl.buckets[key]
+	if !ok {
+		el = rl.order.PushFront(&bucket{key: key, tokens: burst, last: now})
+		rl.buckets[key] = el
+		if len(rl.buckets) > rl.maxEntries {
+			rl.evictLocked(rl.order.Back())
+		}
+		rl.gaugeLocked()
+	} else {
+		rl.order.MoveToFront(el)
+	}
+	b := el.Value.(*bucket)
+	b.tokens += now.Sub(b.last).Seconds() * rps
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < cost {
+		return false, bucketInfo(b.tokens, rps, burst, cost, false)
+	}
+	b.tokens -= cost
+	return true, bucketInfo(b.tokens, rps, burst, cost, true)
+}
+
+func bucketInfo(tokens, rps, burst, cost float64, allowed bool) rateLimitInfo {
+	info := rateLimitInfo{
+		limit:     burst,
+		remaining: tokens,
+		reset:     (burst - tokens) / rps,
+	}
+	if !allowed {
+		info.retry = (cost - tokens) / rps
+	}
+	return info
+}
+
+// Len returns the number of tracked buckets.
+func (rl *RateLimiter) Len() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return len(rl.buckets)
+}
+
+// Flush drops all buckets and returns how many were tracked.
+func (rl *RateLimiter) Flush() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	n := len(rl.buckets)
+	rl.buckets = make(map[string]*list.Element)
+	rl.order.Init()
+	rl.gaugeLocked()
+	return n
+}
+
+func (rl *RateLimiter) evictLocked(el *list.Element) {
+	if el == nil {
+		return
+	}
+	rl.order.Remove(el)
+	delete(rl.buckets, el.Value.(*bucket).key)
+	if rl.metrics != nil {
+		rl.metrics.Inc(`clawdbot_proxy_ratelimit_evictions_total`)
+	}
+}
+
+func (rl *RateLimiter) gaugeLocked() {
+	if rl.metrics != nil {
+		rl.metrics.SetGauge(`clawdbot_proxy_ratelimit_entries`, float64(len(rl.buckets)))
+	}
+}
+
+// sweepIdle drops buckets whose last access is older than the idle TTL. An
+// idle bucket has refilled to full burst anyway, so forgetting it changes
+// nothing for that client.
+func (rl *RateLimiter) sweepIdle(now time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	cutoff := now.Add(-rl.idleTTL)
+	for {
+		el := rl.order.Back()
+		if el == nil || el.Value.(*bucket).last.After(cutoff) {
+			break
+		}
+		rl.evictLocked(el)
+	}
+	rl.gaugeLocked()
+}
+
+func (rl *RateLimiter) cleanupLoop() {
+	for range time.Tick(time.Minute) {
+		rl.sweepIdle(time.Now())
+	}
+}
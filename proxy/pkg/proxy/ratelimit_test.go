@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstThenDeny(t *testing.T) {
+	rl := NewRateLimiter(1, 3)
+	for i := 0; i < 3; i++ {
+		if !rl.Allow("10.0.0.1") {
+			t.Fatalf("request %d within burst should be allowed", i)
+		}
+	}
+	if rl.Allow("10.0.0.1") {
+		t.Error("request beyond burst should be denied")
+	}
+	if !rl.Allow("10.0.0.2") {
+		t.Error("other clients should not be affected")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	rl := NewRateLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if !rl.Allow("10.0.0.1") {
+			t.Fatal("rps=0 should disable limiting")
+		}
+	}
+}
+
+func TestRateLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	rl := NewRateLimiter(1, 3)
+	rl.maxEntries = 3
+	rl.metrics = NewMetrics()
+	rl.Allow("10.0.0.1")
+	rl.Allow("10.0.0.2")
+	rl.Allow("10.0.0.3")
+	rl.Allow("10.0.0.1") // refresh: .2 is now the coldest
+	rl.Allow("10.0.0.4") // overflows the table
+	if rl.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3 after eviction", rl.Len())
+	}
+	if _, ok := rl.buckets["10.0.0.2"]; ok {
+		t.Error("coldest entry 10.0.0.2 should have been evicted")
+	}
+	if _, ok := rl.buckets["10.0.0.1"]; !ok {
+		t.Error("recently used 10.0.0.1 must survive eviction pressure")
+	}
+	if got := rl.metrics.Counter(`clawdbot_proxy_ratelimit_evictions_total`); got != 1 {
+		t.Errorf("evictions counter = %d, want 1", got)
+	}
+}
+
+func TestRateLimiterKeepsDenyingUnderEvictionPressure(t *testing.T) {
+	rl := NewRateLimiter(0.001, 2)
+	rl.maxEntries = 5
+	abuser := "203.0.113.66"
+	rl.Allow(abuser)
+	rl.Allow(abuser)
+	if rl.Allow(abuser) {
+		t.Fatal("abuser should be out of tokens")
+	}
+	// A crowd of new clients must not reset the abuser's bucket: each denial
+	// counts as an access, keeping the hot entry at the front of the LRU.
+	for i := 0; i < 20; i++ {
+		rl.Allow("198.51.100." + string(rune('a'+i)))
+		if rl.Allow(abuser) {
+			t.Fatal("eviction pressure must not refill an active abuser's burst")
+		}
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	rl := NewRateLimiter(1, 3)
+	rl.idleTTL = time.Minute
+	rl.Allow("10.0.0.1")
+	rl.Allow("10.0.0.2")
+	rl.sweepIdle(time.Now()) // nothing is idle yet
+	if rl.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2 before TTL expires", rl.Len())
+	}
+	rl.sweepIdle(time.Now().Add(2 * time.Minute))
+	if rl.Len() != 0 {
+		t.Errorf("Len() = %d, want 0 after idle sweep", rl.Len())
+	}
+}
+
+func TestRateLimitIDPrefersIdentity(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+
+	r := httptest.NewRequest("GET", "/api/x", nil)
+	r.RemoteAddr = "192.0.2.1:1000"
+	if id, authed := p.rateLimitID(r, "k1"); id != "key:k1" || !authed {
+		t.Errorf("rateLimitID with key = %q/%v, want key:k1/true", id, authed)
+	}
+	r.Header.Set("X-Claw-User", "alice")
+	if id, authed := p.rateLimitID(r, ""); id != "user:alice" || !authed {
+		t.Errorf("rateLimitID with verified user = %q/%v, want user:alice/true", id, authed)
+	}
+	r.Header.Del("X-Claw-User")
+	if id, authed := p.rateLimitID(r, ""); id != "ip:192.0.2.1" || authed {
+		t.Errorf("rateLimitID anonymous = %q/%v, want ip:192.0.2.1/false", id, authed)
+	}
+}
+
+func TestRateLimitAuthenticatedPolicyFollowsIdentity(t *testing.T) {
+	p := newTestProxy(t, &Config{RateLimitRPS: 0.001, RateLimitBurst: 100, RateLimitAuthRPS: 0.001, RateLimitAuthBurst: 2})
+
+	// The same verified user shares one bucket across IPs.
+	for i, addr := range []string{"192.0.2.1:1000", "198.51.100.7:1000"} {
+		r := httptest.NewRequest("GET", "/api/x", nil)
+		r.RemoteAddr = addr
+		r.Header.Set("X-Claw-User", "alice")
+		if !p.allowRequest(httptest.NewRecorder(), r, "", apiKeyEntry{}, nil, 1) {
+			t.Fatalf("request %d within auth burst should be allowed", i)
+		}
+	}
+	r := httptest.NewRequest("GET", "/api/x", nil)
+	r.RemoteAddr = "203.0.113.5:1000"
+	r.Header.Set("X-Claw-User", "alice")
+	if p.allowRequest(httptest.NewRecorder(), r, "", apiKeyEntry{}, nil, 1) {
+		t.Error("rotating IPs must not refill an authenticated user's burst")
+	}
+
+	// A different user and an anonymous client on the same IP are unaffected.
+	r = httptest.NewRequest("GET", "/api/x", nil)
+	r.RemoteAddr = "203.0.113.5:1000"
+	r.Header.Set("X-Claw-User", "bob")
+	if !p.allowRequest(httptest.NewRecorder(), r, "", apiKeyEntry{}, nil, 1) {
+		t.Error("other identities should not share alice's bucket")
+	}
+	r = httptest.NewRequest("GET", "/api/x", nil)
+	r.RemoteAddr = "203.0.113.5:1000"
+	if !p.allowRequest(httptest.NewRecorder(), r, "", apiKeyEntry{}, nil, 1) {
+		t.Error("anonymous client on the same IP falls under the per-IP policy")
+	}
+}
+
+func TestRateLimitResponseHeaders(t *testing.T) {
+	p := newTestProxy(t, &Config{RateLimitRPS: 0.5, RateLimitBurst: 2})
+
+	send := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/x", nil)
+		r.RemoteAddr = "192.0.2.1:1000"
+		p.allowRequest(rec, r, "", apiKeyEntry{}, nil, 1)
+		return rec
+	}
+
+	rec := send()
+	h := rec.Header()
+	if h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Remaining") != "1" {
+		t.Errorf("first request headers = limit %q remaining %q, want 2/1",
+			h.Get("RateLimit-Limit"), h.Get("RateLimit-Remaining"))
+	}
+	if h.Get("RateLimit-Reset") != "2" {
+		t.Errorf("RateLimit-Reset = %q, want 2 (one token at 0.5/s)", h.Get("RateLimit-Reset"))
+	}
+	if h.Get("Retry-After") != "" {
+		t.Error("allowed request must not carry Retry-After")
+	}
+
+	send() // drains the bucket
+	h = send().Header()
+	if h.Get("RateLimit-Remaining") != "0" {
+		t.Errorf("denied RateLimit-Remaining = %q, want 0", h.Get("RateLimit-Remaining"))
+	}
+	if h.Get("Retry-After") != "2" {
+		t.Errorf("denied Retry-After = %q, want 2 (next token at 0.5/s)", h.Get("Retry-After"))
+	}
+}
+
+func TestRateLimitRouteCost(t *testing.T) {
+	rl := NewRateLimiter(0.001, 10)
+	if ok, _ := rl.allowInfo("ip:192.0.2.1", 0.001, 10, 10); !ok {
+		t.Fatal("first cost-10 request should fit the burst exactly")
+	}
+	if ok, info := rl.allowInfo("ip:192.0.2.1", 0.001, 10, 10); ok {
+		t.Fatal("second cost-10 request should be denied")
+	} else if info.retry <= 0 {
+		t.Errorf("denied info.retry = %v, want > 0", info.retry)
+	}
+	// Other clients' budgets are untouched by the expensive calls.
+	if ok, _ := rl.allowInfo("ip:192.0.2.2", 0.001, 10, 1); !ok {
+		t.Error("cost-1 request from another client should be allowed")
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Startup readiness gating. Orchestrators probe /ready to decide when to
+// route traffic here; without -wait-backend the proxy is ready as soon as
+// it listens. With it, /ready answers 503 until a probe of the gateway
+// succeeds (any HTTP answer below 500 counts — the gateway is up even if
+// the probed path 404s), probing with exponential backoff so a slow
+// gateway start does not get hammered. Once ready, the proxy stays ready;
+// runtime backend failures are the circuit breaker's job.
+
+const (
+	readyProbeInitial = 250 * time.Millisecond
+	readyProbeMax     = 10 * time.Second
+	readyProbeTimeout = 5 * time.Second
+)
+
+// probeReady makes one backend probe and reports whether it succeeded.
+func (p *ProxyServer) probeReady() bool {
+	client := &http.Client{Transport: p.transport, Timeout: readyProbeTimeout}
+	req, err := http.NewRequest(http.MethodGet, p.backend.JoinPath("/").String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 500
+}
+
+// waitBackend probes until the gateway answers, then flips readiness.
+// Runs in its own goroutine; started from main when -wait-backend is set.
+func (p *ProxyServer) waitBackend() {
+	go func() {
+		delay := readyProbeInitial
+		start := time.Now()
+		for {
+			if p.probeReady() {
+				p.ready.Store(true)
+				p.metrics.SetGauge(`clawdbot_proxy_ready`, 1)
+				p.log.Info("backend ready", "backend", p.cfg.Backend, "waited", time.Since(start).Round(time.Millisecond))
+				return
+			}
+			p.metrics.Inc(`clawdbot_proxy_ready_probes_failed_total`)
+			p.log.Debug("backend not ready yet", "backend", p.cfg.Backend, "next_probe_in", delay)
+			time.Sleep(delay)
+			if delay *= 2; delay > readyProbeMax {
+				delay = readyProbeMax
+			}
+		}
+	}()
+}
+
+func (p *ProxyServer) handleReady(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !p.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "{\"status\":\"waiting\",\"backend\":%q}\n", p.cfg.Backend)
+		return
+	}
+	fmt.Fprint(w, "{\"status\":\"ready\"}\n")
+}
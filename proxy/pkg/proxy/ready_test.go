@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadyImmediatelyWithoutWaitBackend(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestWaitBackendGatesReadiness(t *testing.T) {
+	var up atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	p := newTestProxy(t, &Config{Backend: backend.URL, WaitBackend: true})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status before probing = %d, want 503", rec.Code)
+	}
+
+	p.waitBackend()
+	time.Sleep(400 * time.Millisecond) // let a failed probe land first
+	if p.ready.Load() {
+		t.Fatal("ready while backend answers 503")
+	}
+
+	up.Store(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.ready.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("never became ready")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status after ready = %d, want 200", rec.Code)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_ready_probes_failed_total`) == 0 {
+		t.Fatal("failed probes not counted")
+	}
+}
+
+func TestProbeReadyTreatsAnyAnswerBelow500AsUp(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+	p := newTestProxy(t, &Config{Backend: backend.URL, WaitBackend: true})
+	if !p.probeReady() {
+		t.Fatal("404 from the gateway should count as up")
+	}
+}
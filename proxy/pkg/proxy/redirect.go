@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTP→HTTPS front door: -redirect-http opens a plain listener (typically
+// :80) that answers everything with a 301 to the TLS side, except ACME
+// http-01 challenges, which are served from -acme-webroot so an external
+// ACME client can keep renewing certificates without stopping the proxy.
+// The redirect target keeps the request host and appends the main
+// listener's port when it is TLS on a non-standard port.
+
+// redirectHandler answers a plain-HTTP request: challenge files when an
+// ACME webroot is configured, a permanent redirect otherwise.
+func (p *ProxyServer) redirectHandler() http.Handler {
+	var challenges http.Handler
+	if p.cfg.ACMEWebroot != "" {
+		challenges = http.FileServer(http.Dir(p.cfg.ACMEWebroot))
+	}
+	port := ""
+	if p.hasTLS() {
+		if _, lp, err := net.SplitHostPort(p.cfg.Listen); err == nil && lp != "443" {
+			port = ":" + lp
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if challenges != nil && strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+			challenges.ServeHTTP(w, r)
+			return
+		}
+		p.metrics.Inc(`clawdbot_proxy_http_redirects_total`)
+		target := "https://" + requestHost(r) + port + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// startRedirectListener opens the -redirect-http listener. Like the admin
+// listener it is fire-and-forget: it dies with the process.
+func (p *ProxyServer) startRedirectListener(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           p.redirectHandler(),
+		ReadHeaderTimeout: p.cfg.ReadHeaderTimeout,
+	}
+	go func() {
+		p.log.Info("http redirect listener", "addr", addr, "acme_webroot", p.cfg.ACMEWebroot)
+		srv.Serve(ln)
+	}()
+	return nil
+}
+
+// hstsHeader renders the Strict-Transport-Security value, or "" when HSTS
+// is disabled (-hsts-max-age=0).
+func hstsHeader(maxAge int, subdomains, preload bool) string {
+	if maxAge <= 0 {
+		return ""
+	}
+	v := "max-age=" + strconv.Itoa(maxAge)
+	if subdomains {
+		v += "; includeSubDomains"
+	}
+	if preload {
+		v += "; preload"
+	}
+	return v
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedirectHandlerRedirectsToTLS(t *testing.T) {
+	p := newTestProxy(t, &Config{Listen: ":8443", TLSCert: "x", TLSKey: "y"})
+	h := p.redirectHandler()
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://claw.example/api/run?x=1", nil)
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusMovedPermanently {
+		t.Fatalf("status = %d, want 301", rec.Code)
+	}
+	if got := rec.Header().Get("Location"); got != "https://claw.example:8443/api/run?x=1" {
+		t.Errorf("Location = %q", got)
+	}
+}
+
+func TestRedirectHandlerOmitsStandardPort(t *testing.T) {
+	p := newTestProxy(t, &Config{Listen: ":443", TLSCert: "x", TLSKey: "y"})
+	rec := httptest.NewRecorder()
+	p.redirectHandler().ServeHTTP(rec, httptest.NewRequest("GET", "http://claw.example/", nil))
+	if got := rec.Header().Get("Location"); got != "https://claw.example/" {
+		t.Errorf("Location = %q", got)
+	}
+}
+
+func TestRedirectHandlerServesACMEChallenges(t *testing.T) {
+	webroot := t.TempDir()
+	dir := filepath.Join(webroot, ".well-known", "acme-challenge")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "token123"), []byte("proof"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{ACMEWebroot: webroot})
+	h := p.redirectHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/.well-known/acme-challenge/token123", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "proof" {
+		t.Errorf("challenge = %d %q, want 200 proof", rec.Code, rec.Body.String())
+	}
+
+	// Non-challenge paths still redirect even with a webroot configured.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://claw.example/other", nil))
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("non-challenge path = %d, want 301", rec.Code)
+	}
+}
+
+func TestHSTSHeader(t *testing.T) {
+	for _, tc := range []struct {
+		maxAge   int
+		sub, pre bool
+		want     string
+	}{
+		{0, true, false, ""},
+		{300, false, false, "max-age=300"},
+		{63072000, true, false, "max-age=63072000; includeSubDomains"},
+		{63072000, true, true, "max-age=63072000; includeSubDomains; preload"},
+	} {
+		if got := hstsHeader(tc.maxAge, tc.sub, tc.pre); got != tc.want {
+			t.Errorf("hstsHeader(%d, %v, %v) = %q, want %q", tc.maxAge, tc.sub, tc.pre, got, tc.want)
+		}
+	}
+}
+
+func TestHSTSPreloadValidation(t *testing.T) {
+	cfg := &Config{Backend: "http://127.0.0.1:0", HSTSPreload: true, HSTSSubdomains: true, HSTSMaxAge: 300}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "hsts-preload") {
+		t.Errorf("short max-age with preload = %v, want error", err)
+	}
+	cfg = &Config{Backend: "http://127.0.0.1:0", HSTSPreload: true, HSTSMaxAge: 63072000}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "hsts-preload") {
+		t.Errorf("preload without subdomains = %v, want error", err)
+	}
+}
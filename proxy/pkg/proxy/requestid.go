@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+type ctxKeyRequestID struct{}
+
+// requestID ensures every request carries an X-Request-ID: an incoming,
+// well-formed one is reused (so IDs minted by an outer load balancer
+// survive), otherwise a fresh one is generated. The ID is forwarded to the
+// backend, echoed to the client, and attached to the request context for
+// logging.
+func (p *ProxyServer) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set("X-Request-ID", id)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyRequestID{}, id)))
+	})
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID guards against log injection via a hostile header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID{}).(string)
+	return id
+}
+
+// reqLog returns the proxy logger scoped to the request's ID so every line
+// about this request can be correlated with the Node gateway's logs.
+func (p *ProxyServer) reqLog(r *http.Request) *slog.Logger {
+	if id := requestIDFrom(r.Context()); id != "" {
+		return p.log.With("request_id", id)
+	}
+	return p.log
+}
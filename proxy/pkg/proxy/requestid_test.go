@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDGenerated(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	var forwarded string
+	h := p.requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Request-ID")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+
+	if forwarded == "" {
+		t.Fatal("request ID should be generated and forwarded")
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != forwarded {
+		t.Errorf("response X-Request-ID = %q, want %q", got, forwarded)
+	}
+}
+
+func TestRequestIDReused(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	h := p.requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := requestIDFrom(r.Context()); got != "lb-abc.123" {
+			t.Errorf("context request ID = %q, want lb-abc.123", got)
+		}
+	}))
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("X-Request-ID", "lb-abc.123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got != "lb-abc.123" {
+		t.Errorf("response X-Request-ID = %q, want the incoming one", got)
+	}
+}
+
+func TestRequestIDRejectsHostileHeader(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	h := p.requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("X-Request-ID", "evil\nvalue")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got == "evil\nvalue" || got == "" {
+		t.Errorf("hostile request ID must be replaced, got %q", got)
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// retryTransport retries idempotent requests when the backend connection
+// fails or it answers 502/503. Only GET/HEAD requests without a body are
+// retried — anything else could be replayed with side effects — and the
+// whole attempt series shares one time budget.
+type retryTransport struct {
+	base     http.RoundTripper
+	attempts int // retries after the first try
+	backoff  time.Duration
+	budget   time.Duration
+	metrics  *Metrics
+}
+
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || req.Body != nil {
+		return rt.base.RoundTrip(req)
+	}
+	deadline := time.Now().Add(rt.budget)
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = rt.base.RoundTrip(req)
+		wait := rt.backoff * time.Duration(attempt+1)
+		if !retryableResult(resp, err) || attempt >= rt.attempts || time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		rt.metrics.Inc(`clawdbot_proxy_backend_retries_total`)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func retryableResult(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRetryTransport(attempts int) *retryTransport {
+	return &retryTransport{
+		base:     http.DefaultTransport,
+		attempts: attempts,
+		backoff:  time.Millisecond,
+		budget:   time.Second,
+		metrics:  NewMetrics(),
+	}
+}
+
+func TestRetryRecoversFrom502(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	rt := newRetryTransport(3)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200 after retries", resp.StatusCode)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("backend calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestRetryGivesUpAfterAttempts(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	rt := newRetryTransport(2)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503 passed through", resp.StatusCode)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("backend calls = %d, want 1 + 2 retries", calls.Load())
+	}
+}
+
+func TestRetryNeverRepeatsNonIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	rt := newRetryTransport(3)
+	req, _ := http.NewRequest("POST", srv.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("backend calls = %d, want 1 (POST must not be retried)", calls.Load())
+	}
+}
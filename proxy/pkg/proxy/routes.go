@@ -0,0 +1,583 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route actions. A route either forwards to a backend pool, relays a
+// WebSocket upgrade, serves a static directory, or answers with a redirect.
+const (
+	actionBackend   = "backend"
+	actionWebSocket = "websocket"
+	actionStatic    = "static"
+	actionRedirect  = "redirect"
+)
+
+// route is one entry of the routing table. All configured matchers must hold
+// for the route to apply; the first matching route in file order wins.
+type route struct {
+	host    string            // exact host or "*.suffix"; empty matches any
+	prefix  string            // path prefix matcher
+	pathRE  *regexp.Regexp    // regex path matcher (alternative to prefix)
+	methods map[string]bool   // allowed methods; nil matches any
+	headers map[string]string // required header values
+
+	action string
+	target string                 // backend URL, static dir, or redirect URL
+	code   int                    // redirect status
+	proxy  *httputil.ReverseProxy // built for backend routes with a target
+
+	// Path rewrites, applied in order: strip-prefix, add-prefix, regex
+	// substitution. Location headers on backend redirects get the prefix
+	// steps undone; regex substitutions have no inverse.
+	stripPrefix string
+	addPrefix   string
+	rewriteRE   *regexp.Regexp
+	rewriteRepl string
+
+	// Header manipulation: reqHeaders run against the request before
+	// forwarding, respHeaders against the response before the client sees
+	// its headers.
+	reqHeaders  headerOpList
+	respHeaders headerOpList
+
+	// wsFrames restricts which data frame types clients may send on
+	// websocket routes: "text", "binary", or empty for both.
+	wsFrames string
+
+	// flushInterval paces response flushes on backend routes: negative
+	// flushes after every write, positive flushes on that period, zero
+	// leaves flushing to the server defaults.
+	flushInterval time.Duration
+
+	// Timeout overrides for backend routes (see timeouts.go); zero means
+	// the server-wide defaults apply.
+	timeout       time.Duration
+	headerTimeout time.Duration
+	idleTimeout   time.Duration
+
+	// GeoIP enforcement (see geoip.go): geoBlock lists country codes or
+	// AS numbers ("AS123") to reject; geoRate maps an origin to its own
+	// requests-per-second budget.
+	geoBlock []string
+	geoRate  map[string]float64
+
+	// Body transforms (see transform.go): req-transform= / resp-transform=
+	// name entries in -transform-file; the names resolve to pointers when
+	// the server starts.
+	reqTransform  string
+	respTransform string
+	reqT          *bodyTransform
+	respT         *bodyTransform
+
+	// hedgeDelay fires a second attempt for GET/HEAD requests whose first
+	// attempt has not produced headers in time (see hedge.go).
+	hedgeDelay time.Duration
+
+	// cost is how many rate limit tokens a request on this route consumes;
+	// zero means the default of one. Expensive gateway operations declare a
+	// higher cost so they drain a client's budget faster.
+	cost int
+
+	// capture opts the route into request/response recording whenever the
+	// admin API has armed capture (see capture.go).
+	capture bool
+
+	// Lua hooks (see lua.go): compiled scripts run at the rewrite and
+	// access phases before forwarding, and against response headers.
+	luaRewrite *luaScript
+	luaAccess  *luaScript
+	luaHeaders *luaScript
+
+	// grpc insists both legs speak HTTP/2 so trailers survive; grpcWeb
+	// additionally translates gRPC-Web bodies from browsers (grpcweb.go).
+	grpc    bool
+	grpcWeb bool
+
+	// targetURL is the parsed form of target for backend routes, kept for
+	// handlers that issue their own upstream requests.
+	targetURL *url.URL
+}
+
+// headerOp is one set/add/del header manipulation.
+type headerOp struct {
+	op    string // "set", "add", or "del"
+	name  string
+	value string
+}
+
+type headerOpList []headerOp
+
+func (ops headerOpList) apply(h http.Header) {
+	for _, o := range ops {
+		switch o.op {
+		case "set":
+			h.Set(o.name, o.value)
+		case "add":
+			h.Add(o.name, o.value)
+		case "del":
+			h.Del(o.name)
+		}
+	}
+}
+
+// ctxKeyRoute carries the matched route to ModifyResponse for Location
+// rewriting.
+type ctxKeyRoute struct{}
+
+// routeTable holds routes in match order.
+type routeTable struct {
+	routes []*route
+}
+
+// Route file format, one route per line, first match wins:
+//
+//	path=/api/ backend=http://127.0.0.1:18790
+//	host=*.claw.example path=/ws websocket
+//	path~^/v[0-9]+/ method=GET,HEAD header=X-Canary:1 backend=http://10.0.0.2:18790
+//	path=/legacy redirect=https://docs.example/ code=308
+//	path=/assets/ static=/srv/assets
+//
+// Matchers: host=, path= (prefix), path~ (regex), method=, header=Name:Value.
+// Actions: backend=, websocket, static=, redirect= (+ optional code=).
+// Rewrites (backend/websocket routes): strip-prefix=, add-prefix=,
+// rewrite=<regex>=><replacement>, e.g.
+//
+//	path=/gateway/api/ strip-prefix=/gateway backend=http://127.0.0.1:18790
+//
+// Header rules: req-header-set/add=Name:Value, req-header-del=Name, and the
+// resp-header-* equivalents. Quote the token when the value contains spaces.
+// WebSocket routes additionally accept ws-frames=text|binary to reject the
+// other data frame type. Backend routes accept flush-interval=<duration> or
+// flush-interval=immediate to pace response flushing (see flush.go),
+// grpc / grpc-web for gRPC backends (see grpcweb.go), timeout= /
+// response-header-timeout= / idle-timeout= overrides (see timeouts.go),
+// hedge=<duration> for idempotent-read hedging (see hedge.go),
+// cost=<n> to charge n rate limit tokens per request instead of one,
+// capture to opt into admin-armed request recording (see capture.go), and
+// lua-rewrite= / lua-access= / lua-header-filter= script hooks (see
+// lua.go). Any
+// route may carry geo-block=US,AS123 / geo-rate=CN:5 (see geoip.go).
+func parseRouteFile(path string) (*routeTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &routeTable{}
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rt, err := parseRouteLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		t.routes = append(t.routes, rt)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// splitRouteTokens splits a route line on whitespace, honoring double quotes
+// so header values may contain spaces:
+//
+//	resp-header-set="Strict-Transport-Security:max-age=63072000; includeSubDomains"
+func splitRouteTokens(line string) []string {
+	var out []string
+	var cur strings.Builder
+	inQuote := false
+	flush := func() {
+		if cur.Len() > 0 {
+			out = append(out, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+		case (c == ' ' || c == '\t') && !inQuote:
+			flush()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	flush()
+	return out
+}
+
+func parseHeaderOp(op, value string) (headerOp, error) {
+	if op == "del" {
+		return headerOp{op: op, name: http.CanonicalHeaderKey(value)}, nil
+	}
+	name, v, ok := strings.Cut(value, ":")
+	if !ok {
+		return headerOp{}, fmt.Errorf("header rule %q: want Name:Value", value)
+	}
+	return headerOp{op: op, name: http.CanonicalHeaderKey(name), value: strings.TrimSpace(v)}, nil
+}
+
+func parseRouteLine(line string) (*route, error) {
+	rt := &route{}
+	for _, tok := range splitRouteTokens(line) {
+		key, value, hasValue := strings.Cut(tok, "=")
+		switch {
+		case key == "host" && hasValue:
+			rt.host = strings.ToLower(value)
+		case key == "path" && hasValue:
+			rt.prefix = value
+		case strings.HasPrefix(tok, "path~"):
+			re, err := regexp.Compile(strings.TrimPrefix(tok, "path~"))
+			if err != nil {
+				return nil, fmt.Errorf("path regex: %w", err)
+			}
+			rt.pathRE = re
+		case key == "method" && hasValue:
+			rt.methods = make(map[string]bool)
+			for _, m := range splitCommaList(value) {
+				rt.methods[strings.ToUpper(m)] = true
+			}
+		case key == "header" && hasValue:
+			name, want, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("header matcher %q: want Name:Value", value)
+			}
+			if rt.headers == nil {
+				rt.headers = make(map[string]string)
+			}
+			rt.headers[http.CanonicalHeaderKey(name)] = want
+		case key == "backend" && hasValue:
+			rt.action, rt.target = actionBackend, value
+		case tok == "websocket":
+			rt.action = actionWebSocket
+		case key == "static" && hasValue:
+			rt.action, rt.target = actionStatic, value
+		case key == "redirect" && hasValue:
+			rt.action, rt.target = actionRedirect, value
+		case (key == "req-header-set" || key == "req-header-add" || key == "req-header-del") && hasValue:
+			op, err := parseHeaderOp(strings.TrimPrefix(key, "req-header-"), value)
+			if err != nil {
+				return nil, err
+			}
+			rt.reqHeaders = append(rt.reqHeaders, op)
+		case (key == "resp-header-set" || key == "resp-header-add" || key == "resp-header-del") && hasValue:
+			op, err := parseHeaderOp(strings.TrimPrefix(key, "resp-header-"), value)
+			if err != nil {
+				return nil, err
+			}
+			rt.respHeaders = append(rt.respHeaders, op)
+		case key == "strip-prefix" && hasValue:
+			rt.stripPrefix = value
+		case key == "add-prefix" && hasValue:
+			rt.addPrefix = value
+		case key == "rewrite" && hasValue:
+			pattern, repl, ok := strings.Cut(value, "=>")
+			if !ok {
+				return nil, fmt.Errorf("rewrite %q: want <regex>=><replacement>", value)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rewrite regex: %w", err)
+			}
+			rt.rewriteRE, rt.rewriteRepl = re, repl
+		case (key == "timeout" || key == "response-header-timeout" || key == "idle-timeout") && hasValue:
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("%s %q: want a positive duration", key, value)
+			}
+			switch key {
+			case "timeout":
+				rt.timeout = d
+			case "response-header-timeout":
+				rt.headerTimeout = d
+			case "idle-timeout":
+				rt.idleTimeout = d
+			}
+		case key == "geo-block" && hasValue:
+			for _, origin := range splitCommaList(value) {
+				rt.geoBlock = append(rt.geoBlock, strings.ToUpper(origin))
+			}
+		case key == "geo-rate" && hasValue:
+			rt.geoRate = make(map[string]float64)
+			for _, pair := range splitCommaList(value) {
+				origin, rate, ok := strings.Cut(pair, ":")
+				rps, err := strconv.ParseFloat(rate, 64)
+				if !ok || err != nil || rps <= 0 {
+					return nil, fmt.Errorf("geo-rate %q: want CC:rps", pair)
+				}
+				rt.geoRate[strings.ToUpper(origin)] = rps
+			}
+		case key == "req-transform" && hasValue:
+			rt.reqTransform = value
+		case key == "resp-transform" && hasValue:
+			rt.respTransform = value
+		case key == "hedge" && hasValue:
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("hedge %q: want a positive duration", value)
+			}
+			rt.hedgeDelay = d
+		case (key == "lua-rewrite" || key == "lua-access" || key == "lua-header-filter") && hasValue:
+			s, err := compileLuaFile(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			switch key {
+			case "lua-rewrite":
+				rt.luaRewrite = s
+			case "lua-access":
+				rt.luaAccess = s
+			case "lua-header-filter":
+				rt.luaHeaders = s
+			}
+		case key == "cost" && hasValue:
+			cost, err := strconv.Atoi(value)
+			if err != nil || cost < 1 {
+				return nil, fmt.Errorf("cost %q: want an integer >= 1", value)
+			}
+			rt.cost = cost
+		case tok == "capture":
+			rt.capture = true
+		case tok == "grpc":
+			rt.grpc = true
+		case tok == "grpc-web":
+			rt.grpcWeb = true
+		case key == "flush-interval" && hasValue:
+			if value == "immediate" {
+				rt.flushInterval = -1
+				break
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("flush-interval %q: want a positive duration or \"immediate\"", value)
+			}
+			rt.flushInterval = d
+		case key == "ws-frames" && hasValue:
+			if value != "text" && value != "binary" {
+				return nil, fmt.Errorf("ws-frames %q: want text or binary", value)
+			}
+			rt.wsFrames = value
+		case key == "code" && hasValue:
+			code, err := strconv.Atoi(value)
+			if err != nil || code < 300 || code > 399 {
+				return nil, fmt.Errorf("invalid redirect code %q", value)
+			}
+			rt.code = code
+		default:
+			return nil, fmt.Errorf("unknown token %q", tok)
+		}
+	}
+	if rt.action == "" {
+		return nil, fmt.Errorf("route has no action (backend=, websocket, static=, redirect=)")
+	}
+	if rt.prefix == "" && rt.pathRE == nil && rt.host == "" {
+		return nil, fmt.Errorf("route has no matcher")
+	}
+	if rt.code != 0 && rt.action != actionRedirect {
+		return nil, fmt.Errorf("code= is only valid with redirect=")
+	}
+	if rt.action == actionRedirect && rt.code == 0 {
+		rt.code = http.StatusFound
+	}
+	if rt.hasRewrite() && rt.action != actionBackend && rt.action != actionWebSocket {
+		return nil, fmt.Errorf("path rewrites only apply to backend and websocket routes")
+	}
+	if rt.wsFrames != "" && rt.action != actionWebSocket {
+		return nil, fmt.Errorf("ws-frames= is only valid on websocket routes")
+	}
+	if rt.flushInterval != 0 && rt.action != actionBackend {
+		return nil, fmt.Errorf("flush-interval= is only valid on backend routes")
+	}
+	if (rt.grpc || rt.grpcWeb) && rt.action != actionBackend {
+		return nil, fmt.Errorf("grpc and grpc-web are only valid on backend routes")
+	}
+	if rt.hasTimeouts() && rt.action != actionBackend {
+		return nil, fmt.Errorf("timeout overrides are only valid on backend routes")
+	}
+	if rt.hedgeDelay != 0 && rt.action != actionBackend {
+		return nil, fmt.Errorf("hedge= is only valid on backend routes")
+	}
+	if (rt.reqTransform != "" || rt.respTransform != "") && rt.action != actionBackend {
+		return nil, fmt.Errorf("transforms are only valid on backend routes")
+	}
+	if rt.cost != 0 && rt.action != actionBackend {
+		return nil, fmt.Errorf("cost= is only valid on backend routes")
+	}
+	if rt.capture && rt.action != actionBackend {
+		return nil, fmt.Errorf("capture is only valid on backend routes")
+	}
+	if (rt.luaRewrite != nil || rt.luaAccess != nil || rt.luaHeaders != nil) && rt.action != actionBackend {
+		return nil, fmt.Errorf("lua hooks are only valid on backend routes")
+	}
+	return rt, nil
+}
+
+func (rt *route) hasRewrite() bool {
+	return rt.stripPrefix != "" || rt.addPrefix != "" || rt.rewriteRE != nil
+}
+
+// rewritePath maps a public path to the backend path.
+func (rt *route) rewritePath(path string) string {
+	if rt.stripPrefix != "" {
+		if rest, ok := strings.CutPrefix(path, rt.stripPrefix); ok {
+			path = rest
+			if !strings.HasPrefix(path, "/") {
+				path = "/" + path
+			}
+		}
+	}
+	if rt.addPrefix != "" {
+		path = rt.addPrefix + path
+	}
+	if rt.rewriteRE != nil {
+		path = rt.rewriteRE.ReplaceAllString(path, rt.rewriteRepl)
+	}
+	return path
+}
+
+// unrewriteLocation maps a backend redirect target back into public path
+// space by undoing the prefix steps of rewritePath. Absolute URLs pointing at
+// other hosts pass through untouched.
+func (rt *route) unrewriteLocation(loc string) string {
+	u, err := url.Parse(loc)
+	if err != nil || u.Host != "" || u.Scheme != "" {
+		return loc
+	}
+	path := u.Path
+	if rt.addPrefix != "" {
+		if rest, ok := strings.CutPrefix(path, rt.addPrefix); ok {
+			path = rest
+			if !strings.HasPrefix(path, "/") {
+				path = "/" + path
+			}
+		}
+	}
+	if rt.stripPrefix != "" {
+		path = rt.stripPrefix + path
+	}
+	u.Path = path
+	return u.String()
+}
+
+// defaultRoutes reproduces the routing the proxy shipped with before the
+// table existed: /ws relayed, /api/ proxied, everything else static.
+func defaultRoutes() *routeTable {
+	return &routeTable{routes: []*route{
+		{prefix: "/ws", action: actionWebSocket},
+		{prefix: "/api/", action: actionBackend},
+	}}
+}
+
+// match returns the first route matching the request, or nil.
+func (t *routeTable) match(r *http.Request) *route {
+	host := requestHost(r)
+	for _, rt := range t.routes {
+		if rt.matches(r, host) {
+			return rt
+		}
+	}
+	return nil
+}
+
+func (rt *route) matches(r *http.Request, host string) bool {
+	if rt.host != "" && !hostMatches(rt.host, host) {
+		return false
+	}
+	if rt.prefix != "" && !pathPrefixMatches(rt.prefix, r.URL.Path) {
+		return false
+	}
+	if rt.pathRE != nil && !rt.pathRE.MatchString(r.URL.Path) {
+		return false
+	}
+	if rt.methods != nil && !rt.methods[r.Method] {
+		return false
+	}
+	for name, want := range rt.headers {
+		if r.Header.Get(name) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// pathPrefixMatches treats the prefix as a path segment boundary: "/ws"
+// matches "/ws" and "/ws/x" but not "/wsx".
+func pathPrefixMatches(prefix, path string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	if strings.HasSuffix(prefix, "/") || len(path) == len(prefix) {
+		return true
+	}
+	return path[len(prefix)] == '/'
+}
+
+// hostMatches compares a route host pattern against the request host.
+// "*.suffix" patterns match any subdomain of suffix.
+func hostMatches(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+// requestHost returns the lowercased Host header without any port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// buildRouteProxies creates a ReverseProxy for every backend route with its
+// own target, sharing the default transport and error handling.
+func (p *ProxyServer) buildRouteProxies() error {
+	for _, rt := range p.routes.routes {
+		if rt.action != actionBackend {
+			continue
+		}
+		target := p.backend
+		if rt.target != "" {
+			var err error
+			if target, err = url.Parse(rt.target); err != nil {
+				return fmt.Errorf("route backend %q: %w", rt.target, err)
+			}
+		} else if rt.hedgeDelay == 0 {
+			// No explicit target and nothing to customize: the shared
+			// default proxy (and its pool/canary logic) handles the route.
+			continue
+		}
+		rt.targetURL = target
+		rt.proxy = p.newReverseProxy(target)
+		if rt.hedgeDelay > 0 {
+			rt.proxy.Transport = &hedgedTransport{
+				base:    p.transport,
+				delay:   rt.hedgeDelay,
+				alt:     p.altBackend,
+				metrics: p.metrics,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func parseRoutes(t *testing.T, content string) *routeTable {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.conf")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	table, err := parseRouteFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func routeRequest(method, host, path string, headers ...string) *http.Request {
+	r := httptest.NewRequest(method, "http://placeholder"+path, nil)
+	r.Host = host
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	return r
+}
+
+func TestRouteFirstMatchWins(t *testing.T) {
+	table := parseRoutes(t, `
+path=/api/v2/ backend=http://second:1
+path=/api/ backend=http://first:1
+`)
+	rt := table.match(routeRequest("GET", "x", "/api/v2/ping"))
+	if rt == nil || rt.target != "http://second:1" {
+		t.Errorf("match = %+v, want the /api/v2/ route", rt)
+	}
+}
+
+func TestRouteHostMatching(t *testing.T) {
+	table := parseRoutes(t, `
+host=admin.claw.example path=/api/ backend=http://admin:1
+host=*.claw.example path=/api/ backend=http://wildcard:1
+`)
+	if rt := table.match(routeRequest("GET", "admin.claw.example:443", "/api/x")); rt == nil || rt.target != "http://admin:1" {
+		t.Errorf("exact host: got %+v", rt)
+	}
+	if rt := table.match(routeRequest("GET", "beta.claw.example", "/api/x")); rt == nil || rt.target != "http://wildcard:1" {
+		t.Errorf("wildcard host: got %+v", rt)
+	}
+	if rt := table.match(routeRequest("GET", "claw.example", "/api/x")); rt != nil {
+		t.Errorf("bare domain must not match *.claw.example, got %+v", rt)
+	}
+}
+
+func TestRouteMethodAndHeaderMatchers(t *testing.T) {
+	table := parseRoutes(t, `
+path=/api/ method=GET,HEAD header=X-Canary:1 backend=http://canary:1
+path=/api/ backend=http://main:1
+`)
+	if rt := table.match(routeRequest("GET", "x", "/api/y", "X-Canary", "1")); rt.target != "http://canary:1" {
+		t.Errorf("canary GET: got %q", rt.target)
+	}
+	if rt := table.match(routeRequest("POST", "x", "/api/y", "X-Canary", "1")); rt.target != "http://main:1" {
+		t.Errorf("canary POST must fall through: got %q", rt.target)
+	}
+	if rt := table.match(routeRequest("GET", "x", "/api/y")); rt.target != "http://main:1" {
+		t.Errorf("no canary header must fall through: got %q", rt.target)
+	}
+}
+
+func TestRouteRegexMatcher(t *testing.T) {
+	table := parseRoutes(t, "path~^/v[0-9]+/ backend=http://versioned:1\n")
+	if rt := table.match(routeRequest("GET", "x", "/v2/status")); rt == nil {
+		t.Error("regex route must match /v2/status")
+	}
+	if rt := table.match(routeRequest("GET", "x", "/vx/status")); rt != nil {
+		t.Error("regex route must not match /vx/status")
+	}
+}
+
+func TestRoutePrefixSegmentBoundary(t *testing.T) {
+	table := defaultRoutes()
+	if rt := table.match(routeRequest("GET", "x", "/ws")); rt == nil || rt.action != actionWebSocket {
+		t.Error("/ws must match the websocket route")
+	}
+	if rt := table.match(routeRequest("GET", "x", "/ws/session")); rt == nil || rt.action != actionWebSocket {
+		t.Error("/ws/session must match the websocket route")
+	}
+	if rt := table.match(routeRequest("GET", "x", "/wsx")); rt != nil {
+		t.Error("/wsx must not match the websocket route")
+	}
+}
+
+func TestRouteRedirectAndStaticActions(t *testing.T) {
+	table := parseRoutes(t, `
+path=/old redirect=https://docs.example/ code=308
+path=/assets/ static=/srv/assets
+`)
+	rt := table.match(routeRequest("GET", "x", "/old"))
+	if rt == nil || rt.action != actionRedirect || rt.code != 308 {
+		t.Errorf("redirect route: got %+v", rt)
+	}
+	rt = table.match(routeRequest("GET", "x", "/assets/app.js"))
+	if rt == nil || rt.action != actionStatic || rt.target != "/srv/assets" {
+		t.Errorf("static route: got %+v", rt)
+	}
+}
+
+func TestParseRouteLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"path=/api/",                        // no action
+		"backend=http://x:1",                // no matcher
+		"path=/a backend=http://x:1 code=1", // code without redirect
+		"path=/a bogus=1 backend=http://x:1",
+	} {
+		if _, err := parseRouteLine(line); err == nil {
+			t.Errorf("parseRouteLine(%q) succeeded, want error", line)
+		}
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	cases := []struct {
+		line, in, want string
+	}{
+		{"path=/gateway/ strip-prefix=/gateway backend=http://x:1", "/gateway/api/ping", "/api/ping"},
+		{"path=/gateway strip-prefix=/gateway backend=http://x:1", "/gateway", "/"},
+		{"path=/api/ add-prefix=/internal backend=http://x:1", "/api/ping", "/internal/api/ping"},
+		{"path=/v1/ rewrite=^/v1/(.*)=>/api/$1 backend=http://x:1", "/v1/status", "/api/status"},
+	}
+	for _, tc := range cases {
+		rt, err := parseRouteLine(tc.line)
+		if err != nil {
+			t.Fatalf("parseRouteLine(%q): %v", tc.line, err)
+		}
+		if got := rt.rewritePath(tc.in); got != tc.want {
+			t.Errorf("%q: rewritePath(%q) = %q, want %q", tc.line, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestUnrewriteLocation(t *testing.T) {
+	rt, err := parseRouteLine("path=/gateway/ strip-prefix=/gateway backend=http://x:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rt.unrewriteLocation("/api/login?next=1"); got != "/gateway/api/login?next=1" {
+		t.Errorf("strip-prefix inverse = %q", got)
+	}
+	if got := rt.unrewriteLocation("https://other.example/api/x"); got != "https://other.example/api/x" {
+		t.Errorf("absolute Location must pass through, got %q", got)
+	}
+
+	rt, err = parseRouteLine("path=/api/ add-prefix=/internal backend=http://x:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rt.unrewriteLocation("/internal/api/x"); got != "/api/x" {
+		t.Errorf("add-prefix inverse = %q", got)
+	}
+}
+
+func TestRewriteRejectedForNonForwardingRoutes(t *testing.T) {
+	if _, err := parseRouteLine("path=/a strip-prefix=/a static=/srv"); err == nil {
+		t.Error("rewrite on a static route must be rejected")
+	}
+}
+
+func TestRouteHeaderRules(t *testing.T) {
+	line := `path=/api/ req-header-set=X-Forwarded-Proto:https req-header-del=Cookie ` +
+		`resp-header-del=Server resp-header-set="Strict-Transport-Security:max-age=63072000; includeSubDomains" backend=http://x:1`
+	rt, err := parseRouteLine(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := routeRequest("GET", "x", "/api/y", "Cookie", "secret")
+	rt.reqHeaders.apply(req.Header)
+	if req.Header.Get("Cookie") != "" {
+		t.Error("Cookie must be removed")
+	}
+	if got := req.Header.Get("X-Forwarded-Proto"); got != "https" {
+		t.Errorf("X-Forwarded-Proto = %q", got)
+	}
+
+	h := http.Header{"Server": {"node"}}
+	rt.respHeaders.apply(h)
+	if h.Get("Server") != "" {
+		t.Error("Server must be stripped")
+	}
+	if got := h.Get("Strict-Transport-Security"); got != "max-age=63072000; includeSubDomains" {
+		t.Errorf("HSTS = %q", got)
+	}
+}
+
+func TestHeaderOpsWriterAppliesOnWriteHeader(t *testing.T) {
+	rec := httptest.NewRecorder()
+	hw := &headerOpsWriter{ResponseWriter: rec, ops: headerOpList{
+		{op: "set", name: "X-Frame-Options", value: "DENY"},
+		{op: "del", name: "X-Powered-By"},
+	}}
+	hw.Header().Set("X-Powered-By", "Express")
+	hw.WriteHeader(http.StatusTeapot)
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("code = %d", rec.Code)
+	}
+	if rec.Header().Get("X-Frame-Options") != "DENY" || rec.Header().Get("X-Powered-By") != "" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+}
+
+func TestRouteCostParsing(t *testing.T) {
+	table := parseRoutes(t, `
+path=/api/agent/run backend=http://127.0.0.1:18790 cost=10
+path=/api/ backend=http://127.0.0.1:18790
+`)
+	if table.routes[0].cost != 10 {
+		t.Errorf("cost = %d, want 10", table.routes[0].cost)
+	}
+	if table.routes[1].cost != 0 {
+		t.Errorf("unannotated route cost = %d, want 0 (default one token)", table.routes[1].cost)
+	}
+	if _, err := parseRouteLine("path=/x backend=http://b cost=0"); err == nil {
+		t.Error("cost=0 should be rejected")
+	}
+	if _, err := parseRouteLine("path=/x static=/srv cost=2"); err == nil {
+		t.Error("cost= on a static route should be rejected")
+	}
+}
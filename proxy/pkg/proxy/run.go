@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serviceStop lets an external supervisor (the Windows service control
+// handler) request a graceful drain without a Unix signal.
+var serviceStop = make(chan struct{}, 1)
+
+// run is the proxy proper; the cmd wrapper and the Windows service entry
+// point both land here. The return value is the process exit code.
+func run(args []string) int {
+	cfg, err := parseConfig(args)
+	if err != nil {
+		return 2
+	}
+	if cfg.Daemon {
+		child, err := daemonize()
+		if err != nil {
+			os.Stderr.WriteString("daemonize failed: " + err.Error() + "\n")
+			return 1
+		}
+		if !child {
+			return 0 // parent: the detached child carries on
+		}
+	}
+	var logDest io.Writer = os.Stdout
+	var logFile *logFileWriter
+	if cfg.LogFile != "" {
+		logFile, err = openLogFile(cfg.LogFile)
+		if err != nil {
+			os.Stderr.WriteString("opening log file failed: " + err.Error() + "\n")
+			return 1
+		}
+		logDest = logFile
+	}
+	log, logLevel := newLogger(cfg.LogLevel, logDest)
+	cfg.logSources(log)
+
+	if cfg.PidFile != "" {
+		if err := writePidFile(cfg.PidFile); err != nil {
+			log.Error("pidfile check failed", "error", err)
+			return 1
+		}
+		defer removePidFile(cfg.PidFile)
+	}
+
+	p, err := NewProxyServer(cfg, log)
+	if err != nil {
+		log.Error("invalid configuration", "error", err)
+		return 1
+	}
+	p.logLevel = logLevel // /admin/loglevel adjusts it at runtime
+
+	if p.dns != nil {
+		p.dns.start()
+	}
+	if p.consul != nil {
+		p.consul.start()
+	}
+	if p.k8s != nil {
+		p.k8s.start()
+	}
+	if cfg.WaitBackend {
+		p.waitBackend()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, shutdownSignals()...)
+	p.onDrain = func() { stop <- drainSignal() }
+	go func() {
+		<-serviceStop
+		stop <- drainSignal()
+	}()
+
+	if cfg.AdminListen != "" {
+		if err := p.startAdminServer(cfg.AdminListen); err != nil {
+			log.Error("admin listener failed", "error", err)
+			return 1
+		}
+	}
+
+	if err := p.startExtraListeners(); err != nil {
+		log.Error("extra listener failed", "error", err)
+		return 1
+	}
+
+	if cfg.RedirectHTTP != "" {
+		if err := p.startRedirectListener(cfg.RedirectHTTP); err != nil {
+			log.Error("redirect listener failed", "error", err)
+			return 1
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           p.publicHandler(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	lns, err := listenAll(cfg)
+	if err != nil {
+		log.Error("listener failed", "error", err)
+		return 1
+	}
+	for i := range lns {
+		if cfg.ProxyProtocol {
+			lns[i] = &proxyProtoListener{Listener: lns[i]}
+		}
+		if cfg.MaxConnsPerIP > 0 {
+			lns[i] = newConnLimitListener(lns[i], cfg.MaxConnsPerIP, p.metrics)
+		}
+		log.Info("listener bound", "addr", lns[i].Addr().String())
+	}
+	// The SIGUSR2 upgrade hand-off carries the first listener; extra bind
+	// addresses are reopened by the new binary.
+	ln := lns[0]
+
+	useTLS := p.hasTLS()
+	if useTLS {
+		tc, err := p.tlsServerConfig()
+		if err != nil {
+			log.Error("loading TLS configuration failed", "error", err)
+			return 1
+		}
+		srv.TLSConfig = tc
+	}
+
+	log.Info("proxy listening", "addr", cfg.Listen, "listeners", len(lns), "backend", cfg.Backend, "tls", useTLS, "proxy_protocol", cfg.ProxyProtocol)
+	for _, l := range lns {
+		go func(l net.Listener) {
+			var err error
+			if useTLS {
+				// ServeTLS wires up ALPN so HTTP/2 is negotiated automatically;
+				// certificates come from TLSConfig (SNI-aware).
+				err = srv.ServeTLS(l, "", "")
+			} else {
+				err = srv.Serve(l)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.Error("listener failed", "error", err)
+				os.Exit(1)
+			}
+		}(l)
+	}
+
+	upgrading := false
+	for {
+		sig := <-stop
+		if isLogReopenSignal(sig) {
+			// SIGUSR1: reopen -log-file after logrotate renamed it away.
+			if logFile != nil {
+				if err := logFile.Reopen(); err != nil {
+					log.Error("log reopen failed; keeping previous file", "error", err)
+				}
+			}
+			continue
+		}
+		if isReloadSignal(sig) {
+			// SIGHUP: reload the listener certificate (renewed by an
+			// external ACME client) without dropping connections.
+			if p.certs != nil {
+				if err := p.certs.reload(); err != nil {
+					log.Error("certificate reload failed; keeping previous", "error", err)
+				} else {
+					p.audit.record("cert_reload", "trigger", "SIGHUP")
+				}
+			}
+			continue
+		}
+		if !isUpgradeSignal(sig) {
+			break
+		}
+		// SIGUSR2: hand the listener to a freshly exec'd binary and drain
+		// this process. A failed fork keeps the current binary serving.
+		proc, err := forkUpgrade(ln)
+		if err != nil {
+			log.Error("binary upgrade failed", "error", err)
+			continue
+		}
+		log.Info("upgrade child started, draining parent", "child_pid", proc.Pid)
+		upgrading = true
+		break
+	}
+
+	log.Info("shutting down", "drain_timeout", cfg.DrainTimeout, "upgrade", upgrading)
+	p.hooks.notify("shutdown", "upgrade", strconv.FormatBool(upgrading))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	defer cancel()
+	// Shutdown stops the listener and waits for plain HTTP requests, but
+	// never sees hijacked WebSocket connections; those get close frames
+	// and a bounded wait of their own. During an upgrade the sessions are
+	// left to finish on their own so clients are not kicked off.
+	if upgrading {
+		p.draining.Store(true)
+	} else {
+		p.beginDrain()
+	}
+	srv.Shutdown(ctx)
+	p.awaitSessions(ctx)
+	srv.Close()
+	return 0
+}
+
+func newLogger(level string, out io.Writer) (*slog.Logger, *slog.LevelVar) {
+	lv := &slog.LevelVar{}
+	lv.Set(parseLogLevel(level))
+	return slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: lv})), lv
+}
+
+func parseLogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// listen opens the public listener. A socket inherited from a SIGUSR2
+// upgrade or passed by systemd socket activation takes precedence over the
+// -listen address. A "unix:<path>"
+// address replaces any stale socket file, applies the configured permissions,
+// and relies on the unix listener unlinking the socket again when it is
+// closed on shutdown.
+func listen(cfg *Config) (net.Listener, error) {
+	if ln, err := inheritedListener(); err != nil || ln != nil {
+		return ln, err
+	}
+	if ln, err := activationListener(); err != nil || ln != nil {
+		return ln, err
+	}
+	path, ok := strings.CutPrefix(cfg.Listen, "unix:")
+	if !ok {
+		return net.Listen("tcp", cfg.Listen)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, cfg.UnixSocketMode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func backendHostPort(u *url.URL) string {
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "https", "wss":
+			host += ":443"
+		default:
+			host += ":80"
+		}
+	}
+	return host
+}
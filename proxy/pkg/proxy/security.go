@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// strictCSP is tuned for the Control UI build: same-origin everything, with
+// WebSocket connections, inline styles, and data: images allowed.
+const strictCSP = "default-src 'self'; connect-src 'self' ws: wss:; img-src 'self' data:; style-src 'self' 'unsafe-inline'"
+
+// securityPreset returns the response headers for a named preset.
+func securityPreset(name, csp string) (map[string]string, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "strict":
+		if csp == "" {
+			csp = strictCSP
+		}
+		return map[string]string{
+			"X-Content-Type-Options":  "nosniff",
+			"X-Frame-Options":         "DENY",
+			"Referrer-Policy":         "no-referrer",
+			"Content-Security-Policy": csp,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown security preset %q", name)
+	}
+}
+
+// securityHeaders injects the configured security headers on every response,
+// static and proxied alike. Headers are set before the inner handler runs, so
+// per-route resp-header-set/del rules can still override or drop them. HSTS
+// has its own -hsts-* knobs and is only sent on TLS responses; HSTS over
+// plain HTTP is ignored by browsers and would be misleading in the config.
+func (p *ProxyServer) securityHeaders(next http.Handler) http.Handler {
+	if len(p.secHeaders) == 0 && p.hsts == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for name, value := range p.secHeaders {
+			h.Set(name, value)
+		}
+		if r.TLS != nil && p.hsts != "" {
+			h.Set("Strict-Transport-Security", p.hsts)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
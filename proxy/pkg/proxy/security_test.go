@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeadersStrictPreset(t *testing.T) {
+	headers, err := securityPreset("strict", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &ProxyServer{secHeaders: headers, hsts: hstsHeader(63072000, true, false)}
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	p.securityHeaders(inner).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("nosniff missing")
+	}
+	if rec.Header().Get("Content-Security-Policy") != strictCSP {
+		t.Errorf("CSP = %q", rec.Header().Get("Content-Security-Policy"))
+	}
+	if rec.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS must not be sent over plain HTTP")
+	}
+
+	rec = httptest.NewRecorder()
+	tlsReq := httptest.NewRequest("GET", "/", nil)
+	tlsReq.TLS = &tls.ConnectionState{}
+	p.securityHeaders(inner).ServeHTTP(rec, tlsReq)
+	if rec.Header().Get("Strict-Transport-Security") != "max-age=63072000; includeSubDomains" {
+		t.Error("HSTS must be sent on TLS responses")
+	}
+}
+
+func TestSecurityHeadersCSPOverride(t *testing.T) {
+	headers, err := securityPreset("strict", "default-src 'none'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers["Content-Security-Policy"] != "default-src 'none'" {
+		t.Errorf("CSP override = %q", headers["Content-Security-Policy"])
+	}
+}
+
+func TestSecurityPresetValidation(t *testing.T) {
+	if headers, err := securityPreset("", ""); err != nil || headers != nil {
+		t.Errorf("empty preset: got (%v, %v)", headers, err)
+	}
+	if _, err := securityPreset("paranoid", ""); err == nil {
+		t.Error("unknown preset must be rejected")
+	}
+}
+
+func TestSecurityHeadersDisabledPassthrough(t *testing.T) {
+	p := &ProxyServer{}
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if got := p.securityHeaders(inner); got == nil {
+		t.Fatal("nil handler")
+	}
+	rec := httptest.NewRecorder()
+	p.securityHeaders(inner).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if len(rec.Header()) != 0 {
+		t.Errorf("disabled preset must add no headers, got %v", rec.Header())
+	}
+}
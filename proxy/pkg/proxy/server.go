@@ -0,0 +1,1281 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ProxyServer routes Control UI traffic through a configurable routing
+// table. By default /api/* goes to the Node gateway, /ws is relayed, and
+// everything else is served from the static UI build.
+type ProxyServer struct {
+	cfg     *Config
+	backend *url.URL
+	proxy   *httputil.ReverseProxy
+	// lb is nil unless -backend lists several gateways; see lb.go.
+	lb *backendPool
+	// mirror is nil unless -mirror-backend is set; see mirror.go.
+	mirror *requestMirror
+	// dns drives pool membership for dns:// backends; see dnsdiscovery.go.
+	dns *dnsDiscovery
+	// consul drives pool membership for -discovery consul://; see consul.go.
+	consul *consulDiscovery
+	// k8s drives pool membership for k8s:// backends; see k8s.go.
+	k8s *k8sDiscovery
+	// canary is nil unless -canary-backend is set; see canary.go.
+	canary *canarySplit
+	// bg is nil unless -backend-blue/-backend-green are set; see bluegreen.go.
+	bg *blueGreen
+	// resume parks backend connections for dropped clients; nil unless
+	// -ws-resume-grace is set. See wsresume.go.
+	resume *resumeRegistry
+	// bans is nil unless -ban-threshold (or -ban-file) is set; see banlist.go.
+	bans *banManager
+	// waf is nil unless -waf is set; see waf.go.
+	waf *wafEngine
+	// geo is nil unless -geoip-db or -geoip-asn-db is set; see geoip.go.
+	geo *geoIP
+	// bots is nil unless -bot-detect is set; see botdetect.go.
+	bots *botClassifier
+	// transforms is nil unless -transform-file is set; see transform.go.
+	transforms map[string]*bodyTransform
+	// errPages renders content-negotiated error responses; see errpages.go.
+	errPages *errorPages
+	limiter  *RateLimiter
+	cache    *ResponseCache
+	jwt      *JWTVerifier
+	apiKeys  *APIKeyStore
+
+	// htpasswd is nil unless -htpasswd is set; see checkBasicAuth.
+	htpasswd *HtpasswdStore
+	// oidc is nil unless -oidc-issuer is set; see checkOIDC.
+	oidc   *oidcRP
+	acl    *ACLStore
+	routes *routeTable
+	vhosts *vhostTable
+
+	// defaultCert backs SNI fallback when vhost certs are configured.
+	defaultCert *tls.Certificate
+	// certs hot-reloads the -tls-cert/-tls-key pair; see certreload.go.
+	certs *certWatcher
+
+	// secHeaders come from the -security-headers preset; see securityHeaders.
+	secHeaders map[string]string
+	// hsts is the rendered Strict-Transport-Security value, "" when disabled.
+	hsts string
+
+	// corsPolicy is nil unless -cors-origins is configured.
+	corsPolicy *corsPolicy
+
+	// transport is shared by the default proxy and every per-route proxy so
+	// retry and pool behavior stay uniform.
+	transport http.RoundTripper
+
+	// backendSocket is set when the backend is a unix: address; requests
+	// then dial the socket while keeping plain HTTP on the wire.
+	backendSocket string
+	tracer        *Tracer
+	breaker       *CircuitBreaker
+
+	// trustedNets gates X-Forwarded-For handling; see clientIP.
+	trustedNets []*net.IPNet
+
+	// upstreamTLS is nil unless -upstream-* TLS options are set.
+	upstreamTLS *tls.Config
+
+	// Client mTLS on the listener (-client-ca / -client-crl).
+	clientCAs *x509.CertPool
+	clientCRL *crlChecker
+
+	// bodyLimits are per-prefix request body caps, longest prefix first.
+	bodyLimits []bodyLimit
+
+	// inflight is nil unless -max-inflight is set; see concurrencyLimiter.
+	inflight *concurrencyLimiter
+	// clientInflight is nil unless -max-inflight-per-client is set.
+	clientInflight *clientConcurrency
+	// openapi is nil unless -openapi-spec is set; see openapi.go.
+	openapi *openapiValidator
+	// wasm is nil unless -wasm-plugins is set; see wasm.go.
+	wasm *wasmEngine
+	// extAuthz is nil unless -ext-authz-url is set; see extauthz.go.
+	extAuthz *extAuthz
+	// extraListeners holds the parsed -listeners entries; see listeners.go.
+	extraListeners []listenerPolicy
+	// capture records opted-in exchanges while armed via the admin API.
+	capture *captureStore
+	// chaos injects faults while armed via the admin API; see chaos.go.
+	chaos *chaosInjector
+	// chain is the public middleware chain, outermost-first; see middleware.go.
+	chain []namedMiddleware
+
+	// shaper is nil unless -bandwidth-limit is set; see bwShaper.
+	shaper *bwShaper
+
+	// Static serving policy: content-hash ETags plus per-extension
+	// Cache-Control rules.
+	staticETags *etagCache
+	staticRules []staticCacheRule
+
+	// staticFS is the embedded Control UI (embedui builds); a -static dir
+	// overrides it for development.
+	staticFS fs.FS
+
+	// notFoundPage replaces the SPA fallback when -static-404 is set.
+	notFoundPage []byte
+
+	// ready gates the /ready endpoint; see ready.go.
+	ready atomic.Bool
+	// started feeds the /livez uptime field.
+	started       time.Time
+	maintenance   atomic.Bool
+	maintSentinel *sentinelFile
+	maintPage     []byte // custom 503 body; nil uses the default JSON
+	maintType     string
+	draining      atomic.Bool
+	sessions      *sessionSet
+	onDrain       func() // set by main; initiates graceful shutdown
+	metrics       *Metrics
+	log           *slog.Logger
+	accessLogger  *slog.Logger     // dedicated access entries; defaults to log
+	audit         *auditLog        // security events; nil unless -audit-log is set
+	hooks         *webhookNotifier // operational alerts; nil unless -webhook-urls is set
+	logLevel      *slog.LevelVar   // set by main; /admin/loglevel adjusts it
+	logSampleN    atomic.Uint64    // round-robin counter for access log sampling
+}
+
+// upstreamTiming is threaded through the request context so the access log
+// can report time spent waiting on the backend separately from total time,
+// and so the upstream latency histograms know which backend served the
+// request and which trace to attach as an exemplar.
+type upstreamTiming struct {
+	start     time.Time
+	firstByte time.Time
+	backend   string // rewritten target host, for the per-backend label
+	traceID   string // from the outgoing traceparent, for exemplars
+}
+
+type ctxKeyUpstream struct{}
+
+func NewProxyServer(cfg *Config, log *slog.Logger) (*ProxyServer, error) {
+	if cfg.Backend == echoBackendScheme {
+		// Dry-run mode: stand up the built-in mock gateway and front that.
+		addr, err := startEchoGateway(log)
+		if err != nil {
+			return nil, fmt.Errorf("starting echo backend: %w", err)
+		}
+		cfg.Backend = addr
+	}
+	backendURL := cfg.Backend
+	if list := splitCommaList(cfg.Backend); len(list) > 1 {
+		backendURL = list[0] // the pool targets are parsed further down
+	}
+	backendSocket := ""
+	if path, ok := strings.CutPrefix(cfg.Backend, "unix:"); ok {
+		backendSocket = path
+		// The socket carries plain HTTP; the host is only a placeholder.
+		backendURL = "http://unix"
+	}
+	backend, err := url.Parse(backendURL)
+	if err != nil {
+		return nil, err
+	}
+	p := &ProxyServer{
+		cfg:      cfg,
+		backend:  backend,
+		limiter:  NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst),
+		sessions: newSessionSet(),
+		metrics:  NewMetrics(),
+		log:      log,
+		started:  time.Now(),
+	}
+	p.backendSocket = backendSocket
+	p.limiter.metrics = p.metrics
+	if cfg.RateLimitMaxEntries > 0 {
+		p.limiter.maxEntries = cfg.RateLimitMaxEntries
+	}
+	if cfg.RateLimitIdleTTL > 0 {
+		p.limiter.idleTTL = cfg.RateLimitIdleTTL
+	}
+	if cfg.StatsDAddr != "" {
+		sink, err := newStatsDSink(cfg.StatsDAddr, cfg.StatsDPrefix, cfg.StatsDSampleRate, cfg.StatsDTags)
+		if err != nil {
+			return nil, err
+		}
+		p.metrics.sink = sink
+	}
+	if p.trustedNets, err = parseCIDRList(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("parsing trusted-proxies: %w", err)
+	}
+	if p.secHeaders, err = securityPreset(cfg.SecurityPreset, cfg.SecurityCSP); err != nil {
+		return nil, err
+	}
+	p.hsts = hstsHeader(cfg.HSTSMaxAge, cfg.HSTSSubdomains, cfg.HSTSPreload)
+	p.corsPolicy = newCORSPolicy(cfg)
+	if p.errPages, err = loadErrorPages(cfg.ErrorPageDir); err != nil {
+		return nil, fmt.Errorf("loading error pages: %w", err)
+	}
+	if cfg.OpenAPISpec != "" {
+		if p.openapi, err = newOpenAPIValidator(cfg.OpenAPISpec, p.metrics); err != nil {
+			return nil, fmt.Errorf("loading OpenAPI spec: %w", err)
+		}
+	}
+	if len(cfg.WasmPlugins) > 0 {
+		if p.wasm, err = loadWasmPlugins(cfg.WasmPlugins); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ExtAuthzURL != "" {
+		p.extAuthz = newExtAuthz(cfg, p.metrics)
+	}
+	if p.extraListeners, err = parseListeners(cfg.Listeners); err != nil {
+		return nil, err
+	}
+	p.capture = newCaptureStore(cfg.CaptureMaxBody, cfg.CaptureFile, p.metrics)
+	p.chaos = newChaosInjector(p.metrics)
+	if p.bodyLimits, err = parseBodyLimits(cfg.BodyLimits); err != nil {
+		return nil, fmt.Errorf("parsing body limits: %w", err)
+	}
+	p.staticETags = newETagCache()
+	if fsys, ok := embeddedUIFS(); ok {
+		p.staticFS = fsys
+	}
+	if p.staticRules, err = parseStaticCacheRules(cfg.StaticCacheControl); err != nil {
+		return nil, fmt.Errorf("parsing static cache rules: %w", err)
+	}
+	if cfg.NotFoundPage != "" {
+		if p.notFoundPage, err = os.ReadFile(cfg.NotFoundPage); err != nil {
+			return nil, fmt.Errorf("loading 404 page: %w", err)
+		}
+	}
+	if cfg.BandwidthRate > 0 {
+		p.shaper = newBWShaper(cfg.BandwidthRate)
+	}
+	if cfg.MaxInflight > 0 {
+		p.inflight = newConcurrencyLimiter(cfg.MaxInflight, cfg.QueueDepth, cfg.QueueTimeout, p.metrics)
+	}
+	if cfg.MaxInflightPerClient > 0 {
+		p.clientInflight = newClientConcurrency(cfg.MaxInflightPerClient, p.metrics)
+	}
+	p.maintSentinel = &sentinelFile{path: cfg.MaintenanceFile}
+	if cfg.MaintenancePage != "" {
+		if err := p.loadMaintenancePage(cfg.MaintenancePage); err != nil {
+			return nil, fmt.Errorf("loading maintenance page: %w", err)
+		}
+	}
+	if len(cfg.WebhookURLs) > 0 {
+		p.hooks = newWebhookNotifier(cfg.WebhookURLs, cfg.WebhookSecret, p.metrics, log)
+	}
+	if cfg.AuditLogFile != "" {
+		if p.audit, err = newAuditLog(cfg.AuditLogFile, cfg.AuditLogSecret); err != nil {
+			return nil, fmt.Errorf("opening audit log: %w", err)
+		}
+	}
+	p.accessLogger = log
+	if cfg.AccessLogFile != "" {
+		w := newRotatingWriter(cfg.AccessLogFile, cfg.AccessLogMaxSize, cfg.AccessLogKeep, cfg.AccessLogCompress)
+		p.accessLogger = slog.New(slog.NewJSONHandler(w, nil))
+	}
+	if cfg.HtpasswdFile != "" {
+		store, err := NewHtpasswdStore(cfg.HtpasswdFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading htpasswd: %w", err)
+		}
+		p.htpasswd = store
+	}
+	if len(cfg.APIKeys) > 0 || cfg.APIKeyFile != "" {
+		store, err := NewAPIKeyStore(cfg.APIKeys, cfg.APIKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading API keys: %w", err)
+		}
+		p.apiKeys = store
+	}
+	if cfg.ACLFile != "" {
+		acl, err := NewACLStore(cfg.ACLFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading ACL rules: %w", err)
+		}
+		p.acl = acl
+	}
+	if cfg.JWTSecret != "" || cfg.JWTJWKSURL != "" {
+		p.jwt = NewJWTVerifier(cfg.JWTSecret, cfg.JWTJWKSURL)
+	}
+	if cfg.OIDCIssuer != "" {
+		rp, err := newOIDCRP(cfg, p.metrics, log)
+		if err != nil {
+			return nil, fmt.Errorf("configuring OIDC: %w", err)
+		}
+		p.oidc = rp
+	}
+	if cfg.BreakerThreshold > 0 {
+		p.breaker = NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, p.metrics)
+		p.breaker.onChange = func(from, to breakerState) {
+			switch to {
+			case breakerOpen:
+				p.hooks.notify("backend_down", "breaker", "open", "previous", from.String())
+			case breakerClosed:
+				p.hooks.notify("backend_up", "breaker", "closed", "previous", from.String())
+			}
+		}
+	}
+	if cfg.OTLPEndpoint != "" {
+		p.tracer = NewTracer(cfg.OTLPEndpoint, cfg.TraceSampleRate, log)
+	}
+	if cfg.CacheEnabled {
+		p.cache = NewResponseCache(cfg.CacheMaxEntries, cfg.CacheMaxBody, cfg.CacheTTL, p.metrics)
+	}
+	if p.upstreamTLS, err = upstreamTLSConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.ClientCAFile != "" {
+		if p.clientCAs, err = loadClientCAs(cfg.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ClientCRLFile != "" {
+		if cfg.ClientCAFile == "" {
+			return nil, fmt.Errorf("-client-crl requires -client-ca")
+		}
+		if p.clientCRL, err = loadCRL(cfg.ClientCRLFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.UpstreamSkipVerify {
+		log.Warn("backend certificate verification is DISABLED (-upstream-insecure-skip-verify); do not run this in production")
+	}
+	var transport http.RoundTripper = p.newBackendTransport(backendSocket)
+	if cfg.RetryAttempts > 0 {
+		transport = &retryTransport{
+			base:     transport,
+			attempts: cfg.RetryAttempts,
+			backoff:  cfg.RetryBackoff,
+			budget:   cfg.RetryBudget,
+			metrics:  p.metrics,
+		}
+	}
+	p.transport = transport
+	p.proxy = p.newReverseProxy(backend)
+	if list := splitCommaList(cfg.Backend); len(list) > 1 {
+		var targets []*url.URL
+		for _, raw := range list {
+			if strings.HasPrefix(raw, "unix:") {
+				return nil, fmt.Errorf("unix: backends cannot be part of a backend pool")
+			}
+			u, err := url.Parse(raw)
+			if err != nil {
+				return nil, fmt.Errorf("parsing backend %q: %w", raw, err)
+			}
+			targets = append(targets, u)
+		}
+		p.lb = p.newBackendPool(targets)
+	}
+	if strings.HasPrefix(cfg.Backend, "dns://") {
+		name, dnsPort, err := parseDNSBackend(cfg.Backend)
+		if err != nil {
+			return nil, err
+		}
+		p.lb = p.newBackendPool(nil)
+		p.dns = p.newDNSDiscovery(name, dnsPort)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := p.dns.refresh(ctx); err != nil {
+			return nil, fmt.Errorf("resolving backend %q: %w", cfg.Backend, err)
+		}
+	}
+	if strings.HasPrefix(cfg.Backend, "k8s://") {
+		namespace, service, k8sPort, err := parseK8sBackend(cfg.Backend)
+		if err != nil {
+			return nil, err
+		}
+		p.lb = p.newBackendPool(nil)
+		if p.k8s, err = p.newK8sDiscovery(namespace, service, k8sPort); err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := p.k8s.list(ctx); err != nil {
+			return nil, fmt.Errorf("listing endpointslices for %q: %w", cfg.Backend, err)
+		}
+	}
+	if cfg.Discovery != "" {
+		agent, service, err := parseDiscovery(cfg.Discovery)
+		if err != nil {
+			return nil, err
+		}
+		if p.lb == nil {
+			p.lb = p.newBackendPool(nil)
+		}
+		p.consul = p.newConsulDiscovery(agent, service)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := p.consul.refresh(ctx, false); err != nil {
+			return nil, fmt.Errorf("initial discovery query: %w", err)
+		}
+	}
+	if cfg.MirrorBackend != "" {
+		if cfg.MirrorPercent < 0 || cfg.MirrorPercent > 100 {
+			return nil, fmt.Errorf("-mirror-percent must be between 0 and 100")
+		}
+		u, err := url.Parse(cfg.MirrorBackend)
+		if err != nil {
+			return nil, fmt.Errorf("parsing mirror backend: %w", err)
+		}
+		p.mirror = newRequestMirror(u, cfg.MirrorPercent, p.metrics, log)
+	}
+	if cfg.CanaryBackend != "" {
+		if p.lb != nil {
+			return nil, fmt.Errorf("-canary-backend cannot be combined with a backend pool")
+		}
+		if cfg.CanaryPercent < 0 || cfg.CanaryPercent > 100 {
+			return nil, fmt.Errorf("-canary-percent must be between 0 and 100")
+		}
+		u, err := url.Parse(cfg.CanaryBackend)
+		if err != nil {
+			return nil, fmt.Errorf("parsing canary backend: %w", err)
+		}
+		p.canary = p.newCanarySplit(u)
+	}
+	if cfg.BlueBackend != "" || cfg.GreenBackend != "" {
+		if cfg.BlueBackend == "" || cfg.GreenBackend == "" {
+			return nil, fmt.Errorf("-backend-blue and -backend-green must be set together")
+		}
+		if p.lb != nil || p.canary != nil {
+			return nil, fmt.Errorf("blue/green sets cannot be combined with a backend pool or canary")
+		}
+		blue, err := url.Parse(cfg.BlueBackend)
+		if err != nil {
+			return nil, fmt.Errorf("parsing blue backend: %w", err)
+		}
+		green, err := url.Parse(cfg.GreenBackend)
+		if err != nil {
+			return nil, fmt.Errorf("parsing green backend: %w", err)
+		}
+		if p.bg, err = p.newBlueGreen(blue, green); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.WSResumeGrace > 0 {
+		if cfg.WSCompression {
+			// Resumable relays re-send buffered frames verbatim; recoding
+			// them for proxy-terminated compression is not supported.
+			return nil, fmt.Errorf("-ws-resume-grace cannot be combined with -ws-compression")
+		}
+		p.resume = newResumeRegistry(cfg.WSResumeGrace, cfg.WSResumeBuffer, p.metrics, log)
+	}
+	if cfg.BanThreshold > 0 || cfg.BanFile != "" {
+		if p.bans, err = newBanManager(cfg, p.metrics, log); err != nil {
+			return nil, err
+		}
+		p.bans.audit = p.audit
+		p.bans.hooks = p.hooks
+	}
+	if cfg.WAF {
+		if p.waf, err = newWAFEngine(cfg.WAFRuleFile); err != nil {
+			return nil, fmt.Errorf("loading waf rules: %w", err)
+		}
+	}
+	if cfg.GeoIPDB != "" || cfg.GeoIPASNDB != "" {
+		if p.geo, err = newGeoIP(cfg.GeoIPDB, cfg.GeoIPASNDB); err != nil {
+			return nil, fmt.Errorf("loading geoip: %w", err)
+		}
+	}
+	if cfg.BotDetect {
+		p.bots = newBotClassifier()
+	}
+	if cfg.TransformFile != "" {
+		if p.transforms, err = parseTransformFile(cfg.TransformFile); err != nil {
+			return nil, fmt.Errorf("loading transforms: %w", err)
+		}
+	}
+	if cfg.RouteFile != "" {
+		routes, err := parseRouteFile(cfg.RouteFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading routes: %w", err)
+		}
+		p.routes = routes
+	} else {
+		p.routes = defaultRoutes()
+	}
+	for _, rt := range p.routes.routes {
+		// Link req-transform=/resp-transform= names to their definitions.
+		if rt.reqTransform != "" {
+			if rt.reqT = p.transforms[rt.reqTransform]; rt.reqT == nil {
+				return nil, fmt.Errorf("route references unknown transform %q", rt.reqTransform)
+			}
+		}
+		if rt.respTransform != "" {
+			if rt.respT = p.transforms[rt.respTransform]; rt.respT == nil {
+				return nil, fmt.Errorf("route references unknown transform %q", rt.respTransform)
+			}
+		}
+	}
+	if err := p.buildRouteProxies(); err != nil {
+		return nil, err
+	}
+	if !cfg.WaitBackend {
+		// Ready immediately; -wait-backend defers this to the prober.
+		p.ready.Store(true)
+		p.metrics.SetGauge(`clawdbot_proxy_ready`, 1)
+	}
+	if cfg.VHostFile != "" {
+		vhosts, err := parseVHostFile(cfg.VHostFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading vhosts: %w", err)
+		}
+		p.vhosts = vhosts
+		p.buildVHostProxies()
+	}
+	p.buildChain()
+	return p, nil
+}
+
+// newReverseProxy builds a proxy for one backend pool, sharing the tuned
+// transport, upstream timing, breaker accounting, and error handling.
+func (p *ProxyServer) newReverseProxy(target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport:     p.transport,
+		FlushInterval: p.cfg.FlushInterval,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if t, ok := resp.Request.Context().Value(ctxKeyUpstream{}).(*upstreamTiming); ok {
+				t.firstByte = time.Now()
+				t.backend = resp.Request.URL.Host
+				if id, _, _, ok := parseTraceparent(resp.Request.Header.Get("Traceparent")); ok {
+					t.traceID = id
+				}
+			}
+			// Headers made it in time; disarm any route header timeout.
+			if t, ok := resp.Request.Context().Value(ctxKeyHeaderTimer{}).(*time.Timer); ok {
+				t.Stop()
+			}
+			if loc := resp.Header.Get("Location"); loc != "" {
+				if rt, ok := resp.Request.Context().Value(ctxKeyRoute{}).(*route); ok {
+					resp.Header.Set("Location", rt.unrewriteLocation(loc))
+				}
+			}
+			if p.breaker != nil {
+				p.breaker.Record(resp.StatusCode < http.StatusInternalServerError)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// A MaxBytesReader tripping mid-stream is the client's fault,
+			// not the backend's; answer 413 and leave the breaker alone.
+			if isBodyLimitError(err) {
+				p.rejectBody(w, r, p.bodyLimitFor(r.URL.Path))
+				return
+			}
+			if errors.Is(err, errSlowBody) {
+				p.metrics.Inc(`clawdbot_proxy_slow_body_dropped_total`)
+				p.reqLog(r).Warn("dropped slow request body", "path", r.URL.Path, "client", p.clientIP(r))
+				p.httpError(w, r, http.StatusRequestTimeout, "request body arrived too slowly")
+				return
+			}
+			if isRouteTimeout(r, err) {
+				p.metrics.Inc(`clawdbot_proxy_upstream_timeouts_total`)
+				p.reqLog(r).Warn("route timeout exceeded", "path", r.URL.Path, "error", err)
+				p.httpError(w, r, http.StatusGatewayTimeout, "the gateway did not respond in time")
+				return
+			}
+			status, cause := backendErrorCause(err)
+			p.reqLog(r).Error("backend request failed", "path", r.URL.Path, "cause", cause, "error", err)
+			p.metrics.Inc(fmt.Sprintf(`clawdbot_proxy_backend_errors_total{cause=%q}`, cause))
+			if p.breaker != nil {
+				p.breaker.Record(false)
+			}
+			p.backendDown(w, r, status)
+		},
+	}
+}
+
+// newBackendTransport tunes the connection pool for a single-backend proxy:
+// the stdlib defaults cap idle connections per host at 2, which serializes
+// bursts. All knobs come from the -pool-* / -dial-* flags. HTTP/2 is
+// attempted when the backend is HTTPS; the Go client offers no cleartext
+// h2c, so plain http backends stay on HTTP/1.1 keep-alives. A non-empty
+// socket path redirects all dials to that unix socket. Dials are counted so
+// /metrics and /admin/pool can report pool behavior.
+func (p *ProxyServer) newBackendTransport(socket string) *http.Transport {
+	cfg := p.cfg
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.DialKeepAlive,
+	}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if socket != "" {
+			network, addr = "unix", socket
+		}
+		p.metrics.Inc(`clawdbot_proxy_backend_dials_total`)
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			p.metrics.Inc(`clawdbot_proxy_backend_dial_errors_total`)
+			return nil, err
+		}
+		p.metrics.AddGauge(`clawdbot_proxy_backend_conns_open`, 1)
+		return &backendConn{Conn: conn, metrics: p.metrics}, nil
+	}
+	t := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dial,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        cfg.PoolMaxIdle,
+		MaxIdleConnsPerHost: cfg.PoolMaxIdlePerHost,
+		MaxConnsPerHost:     cfg.PoolMaxPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TLSHandshakeTimeout: cfg.TLSHandshakeTimeout,
+		TLSClientConfig:     p.upstreamTLS,
+	}
+	if socket != "" {
+		t.Proxy = nil
+	}
+	return t
+}
+
+// backendConn decrements the open-connections gauge exactly once on close.
+type backendConn struct {
+	net.Conn
+	metrics *Metrics
+	closed  atomic.Bool
+}
+
+func (c *backendConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.metrics.AddGauge(`clawdbot_proxy_backend_conns_open`, -1)
+	}
+	return c.Conn.Close()
+}
+
+// dialGateway opens a raw connection to a gateway for WebSocket relaying,
+// wrapping TLS (with the upstream TLS options) for wss/https backends.
+func (p *ProxyServer) dialGateway(backend *url.URL, socket string, timeout time.Duration) (net.Conn, error) {
+	if socket != "" {
+		return net.DialTimeout("unix", socket, timeout)
+	}
+	conn, err := net.DialTimeout("tcp", backendHostPort(backend), timeout)
+	if err != nil || (backend.Scheme != "wss" && backend.Scheme != "https") {
+		return conn, err
+	}
+	tc := p.upstreamTLS
+	if tc == nil {
+		tc = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		tc = tc.Clone()
+	}
+	tc.ServerName = backend.Hostname()
+	tlsConn := tls.Client(conn, tc)
+	if err := tlsConn.HandshakeContext(context.Background()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (p *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.draining.Load() {
+		w.Header().Set("Connection", "close")
+	}
+	// Always strip/stamp the mTLS identity header, even on non-TLS
+	// listeners, so clients cannot inject it.
+	setClientIdentity(r)
+	if !p.checkACL(w, r) {
+		return
+	}
+	if !p.checkBan(w, r) {
+		return
+	}
+	if !p.checkWAF(w, r) {
+		return
+	}
+	p.geoTag(r)
+	if !p.classifyClient(w, r) {
+		return
+	}
+	switch r.URL.Path {
+	case "/health":
+		p.handleHealth(w, r)
+		return
+	case "/ready":
+		p.handleReady(w, r)
+		return
+	case "/livez":
+		p.handleLivez(w, r)
+		return
+	case "/readyz":
+		p.handleReadyz(w, r)
+		return
+	case "/metrics":
+		p.metrics.ServeHTTP(w, r)
+		return
+	}
+	if !p.checkBasicAuth(w, r) {
+		return
+	}
+	r, ok := p.checkOIDC(w, r)
+	if !ok {
+		return
+	}
+	if !p.checkCSRF(w, r) {
+		return
+	}
+	vh := p.vhosts.match(requestHost(r))
+	rt := p.routes.match(r)
+	if rt == nil {
+		if vh != nil && vh.staticDir != "" {
+			p.handleStaticDir(w, r, vh.staticDir)
+			return
+		}
+		p.handleStatic(w, r)
+		return
+	}
+	if !p.checkGeo(w, r, rt) {
+		return
+	}
+	if rt.hasRewrite() {
+		r.URL.Path = rt.rewritePath(r.URL.Path)
+		r.URL.RawPath = ""
+		// ModifyResponse needs the route to map Location headers back.
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyRoute{}, rt))
+	}
+	if len(rt.reqHeaders) > 0 {
+		rt.reqHeaders.apply(r.Header)
+	}
+	if len(rt.respHeaders) > 0 {
+		w = &headerOpsWriter{ResponseWriter: w, ops: rt.respHeaders}
+	}
+	switch rt.action {
+	case actionWebSocket:
+		if rt.wsFrames != "" {
+			// The relay reads the frame policy off the matched route.
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyRoute{}, rt))
+		}
+		if p.maintenanceOn() {
+			p.serveMaintenance(w, r)
+			return
+		}
+		if !p.checkOrigin(w, r) {
+			return
+		}
+		if !p.checkJWT(w, r) {
+			return
+		}
+		if vh != nil && vh.backend != nil {
+			p.handleWebSocketVia(w, r, vh.backend, vh.socket)
+			return
+		}
+		if p.bg != nil {
+			p.handleWebSocketVia(w, r, p.bg.active().url, "")
+			return
+		}
+		if p.lb != nil {
+			// Honor an existing pin so reconnects reach the same gateway;
+			// the 101 response cannot carry a fresh cookie, so new pins
+			// come from regular API calls.
+			t, _ := p.lb.pick(r)
+			if t == nil {
+				p.httpError(w, r, http.StatusServiceUnavailable, "no healthy gateway available")
+				return
+			}
+			p.handleWebSocketVia(w, r, t.url, "")
+			return
+		}
+		p.handleWebSocket(w, r)
+	case actionBackend:
+		if rt.grpc && r.ProtoMajor < 2 {
+			// Trailers cannot survive an HTTP/1 hop; reject early rather
+			// than let the call hang without a grpc-status.
+			p.httpError(w, r, http.StatusHTTPVersionNotSupported, "gRPC requires HTTP/2")
+			return
+		}
+		if rt.grpcWeb && isGRPCWeb(r) {
+			target := rt.targetURL
+			if target == nil {
+				target = p.backend
+			}
+			p.handleGRPCWeb(w, r, target)
+			return
+		}
+		if rt.hasTimeouts() {
+			var stop func()
+			w, r, stop = p.applyRouteTimeouts(w, r, rt)
+			defer stop()
+		}
+		if rt.flushInterval != 0 {
+			fw := newFlushWriter(w, rt.flushInterval)
+			defer fw.stop()
+			w = fw
+		}
+		if rt.reqT != nil {
+			p.transformRequestBody(r, rt.reqT)
+		}
+		if rt.respT != nil {
+			tw := &transformWriter{ResponseWriter: w, tr: rt.respT, metrics: p.metrics}
+			defer tw.finish()
+			w = tw
+		}
+		rp := rt.proxy
+		if rp == nil && vh != nil && vh.proxy != nil {
+			rp = vh.proxy
+		}
+		if rp == nil {
+			rp = p.proxy
+			if p.bg != nil {
+				rp = p.bg.active().proxy
+			}
+			if p.canary != nil {
+				rp = p.canary.pick(r)
+			}
+			if p.lb != nil {
+				t, pinned := p.lb.pick(r)
+				if t == nil {
+					p.httpError(w, r, http.StatusServiceUnavailable, "no healthy gateway available")
+					return
+				}
+				rp = t.proxy
+				if !pinned {
+					p.lb.setCookie(w, r, t)
+				}
+			}
+		}
+		p.serveBackend(w, r, rp, rt, vh)
+	case actionStatic:
+		p.handleStaticDir(w, r, rt.target)
+	case actionRedirect:
+		http.Redirect(w, r, rt.target, rt.code)
+	}
+}
+
+// serveBackend runs the full forwarding pipeline (maintenance, auth, rate
+// limiting, circuit breaking, caching) in front of the given backend proxy.
+// The matched route supplies the rate limit cost; a non-nil vhost supplies
+// per-site rate limits.
+func (p *ProxyServer) serveBackend(w http.ResponseWriter, r *http.Request, rp *httputil.ReverseProxy, rt *route, vh *vhost) {
+	if p.maintenanceOn() {
+		p.serveMaintenance(w, r)
+		return
+	}
+	var ok bool
+	if w, ok = p.injectChaos(w, r); !ok {
+		return
+	}
+	if !p.checkOrigin(w, r) {
+		return
+	}
+	if !p.limitRequestBody(w, r) {
+		return
+	}
+	p.enforceBodyRate(&r.Body)
+	pol := listenerPolicyFrom(r.Context())
+	var key string
+	var entry apiKeyEntry
+	if pol != nil && pol.noAuth {
+		// Trusted listener: no credentials required, but identity headers
+		// must still not pass through from the client.
+		stripClawHeaders(r.Header)
+	} else {
+		if key, entry, ok = p.checkAPIKey(w, r); !ok {
+			return
+		}
+		if !p.checkJWT(w, r) {
+			return
+		}
+	}
+	if !p.checkExtAuthz(w, r) {
+		return
+	}
+	if rt != nil {
+		if rt.luaRewrite != nil && !p.runLuaRequestHook(w, r, rt.luaRewrite) {
+			return
+		}
+		if rt.luaAccess != nil && !p.runLuaRequestHook(w, r, rt.luaAccess) {
+			return
+		}
+		if rt.luaHeaders != nil {
+			w = &luaHeaderWriter{ResponseWriter: w, p: p, r: r, script: rt.luaHeaders}
+		}
+	}
+	if len(p.wasm.filters(wasmHookRequest)) > 0 && !p.runWasmRequestHooks(w, r) {
+		return
+	}
+	if len(p.wasm.filters(wasmHookResponse)) > 0 {
+		w = &wasmResponseWriter{ResponseWriter: w, p: p}
+	}
+	w = p.throttleWriter(w, r, key)
+	cost := 1.0
+	if rt != nil && rt.cost > 1 {
+		cost = float64(rt.cost)
+	}
+	if (pol == nil || !pol.noRateLimit) && !p.allowRequest(w, r, key, entry, vh, cost) {
+		p.metrics.Inc(`clawdbot_proxy_rate_limited_total`)
+		p.strike(r, "rate limit exceeded")
+		p.httpError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	if !p.validateOpenAPI(w, r) {
+		return
+	}
+	if cw, finish := p.capture.maybeCapture(w, r, rt); finish != nil {
+		defer finish()
+		w = cw
+	}
+	release, ok := p.limitConcurrency(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	if p.breaker != nil {
+		if allowed, retryAfter := p.breaker.Allow(); !allowed {
+			p.metrics.Inc(`clawdbot_proxy_breaker_rejected_total`)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			p.httpError(w, r, http.StatusServiceUnavailable, "no healthy gateway available")
+			return
+		}
+	}
+	if p.mirror != nil {
+		p.mirror.maybeMirror(r)
+	}
+	if t, ok := r.Context().Value(ctxKeyUpstream{}).(*upstreamTiming); ok {
+		t.start = time.Now()
+	}
+	// Event streams need the write deadline lifted and their own idle
+	// handling; see sse.go.
+	w, r, sseFinish := p.sseAware(w, r)
+	defer sseFinish()
+	if p.cache != nil {
+		p.cache.serve(w, r, rp)
+		return
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// rateLimitID returns the limiter key for the request and whether it names
+// an authenticated principal. It must run after checkAPIKey/checkJWT: by
+// then the inbound X-Claw-* headers have been stripped, so X-Claw-User can
+// only come from a verified token or OIDC session. Keying on identity lets
+// a NATed office share an IP without sharing a bucket, and stops a single
+// user from escaping the limit by rotating IPs.
+func (p *ProxyServer) rateLimitID(r *http.Request, key string) (string, bool) {
+	if key != "" {
+		return "key:" + key, true
+	}
+	if user := r.Header.Get("X-Claw-User"); user != "" {
+		return "user:" + user, true
+	}
+	return "ip:" + p.clientIP(r), false
+}
+
+// allowRequest applies the rate limit policy: API key entries with their
+// own rates win, then per-site vhost limits, then the authenticated policy
+// (-rate-limit-auth) for identified principals, then the anonymous per-IP
+// default. Routes may charge more than one token per request via cost=. It
+// also stamps the draft IETF RateLimit-* headers (and a Retry-After on
+// denial) so well-behaved clients can pace themselves.
+func (p *ProxyServer) allowRequest(w http.ResponseWriter, r *http.Request, key string, entry apiKeyEntry, vh *vhost, cost float64) bool {
+	id, authed := p.rateLimitID(r, key)
+	rps, burst := p.limiter.rps, p.limiter.burst
+	switch {
+	case key != "" && entry.rps > 0:
+		rps, burst = entry.rps, float64(entry.burst)
+	case vh != nil && vh.rps > 0:
+		id = "site:" + vh.name + ":" + id
+		rps, burst = vh.rps, float64(vh.burst)
+	case authed && p.cfg.RateLimitAuthRPS > 0:
+		rps, burst = p.cfg.RateLimitAuthRPS, float64(p.cfg.RateLimitAuthBurst)
+	}
+	allowed, info := p.limiter.allowInfo(id, rps, burst, cost)
+	if rps > 0 {
+		setRateLimitHeaders(w.Header(), info)
+	}
+	return allowed
+}
+
+// setRateLimitHeaders emits the draft IETF rate limit headers
+// (draft-ietf-httpapi-ratelimit-headers): quota, tokens left, and seconds
+// until the bucket is full again. A zero remaining count also gets a
+// Retry-After so 429 responses state exactly when to come back.
+func setRateLimitHeaders(h http.Header, info rateLimitInfo) {
+	h.Set("RateLimit-Limit", strconv.Itoa(int(info.limit)))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(info.remaining)))
+	h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(info.reset))))
+	if info.retry > 0 {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(info.retry))))
+	}
+}
+
+// checkOrigin rejects browser requests from origins outside the -ws-origins
+// allowlist, guarding against cross-site WebSocket hijacking. Requests
+// without an Origin header (CLI tools, server-to-server) always pass.
+func (p *ProxyServer) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if len(p.cfg.WSOrigins) == 0 {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || originAllowed(p.cfg.WSOrigins, origin) {
+		return true
+	}
+	p.metrics.Inc(`clawdbot_proxy_origin_rejected_total`)
+	p.log.Warn("origin rejected", "path", r.URL.Path, "origin", origin, "client", p.clientIP(r))
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+func (p *ProxyServer) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fields := `"status":"ok"`
+	if p.breaker != nil {
+		fields += fmt.Sprintf(`,"breaker":%q`, p.breaker.State())
+	}
+	if p.certs != nil {
+		fields += fmt.Sprintf(`,"cert_expiry":%q`, p.certs.expiresAt().Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "{%s}\n", fields)
+}
+
+// clientIP returns the originating client address. X-Forwarded-For is only
+// consulted when the direct peer is a trusted proxy; otherwise clients could
+// spoof their IP and dodge rate limiting. The chain is walked right to left,
+// and the first hop not in the trusted set is the client.
+func (p *ProxyServer) clientIP(r *http.Request) string {
+	peer := remoteHost(r.RemoteAddr)
+	if len(p.trustedNets) == 0 || !ipInNets(peer, p.trustedNets) {
+		return peer
+	}
+	var chain []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				chain = append(chain, part)
+			}
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if net.ParseIP(chain[i]) == nil {
+			break // garbage in the chain: fall back to the peer address
+		}
+		if !ipInNets(chain[i], p.trustedNets) {
+			return chain[i]
+		}
+	}
+	if len(chain) > 0 && net.ParseIP(chain[0]) != nil {
+		// Every hop is trusted; the leftmost entry is the origin.
+		return chain[0]
+	}
+	return peer
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func ipInNets(host string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRList accepts CIDRs and bare IPs (treated as /32 or /128).
+func parseCIDRList(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil {
+				bits := 32
+				if ip.To4() == nil {
+					bits = 128
+				}
+				v = fmt.Sprintf("%s/%d", v, bits)
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// headerOpsWriter applies response header rules just before the header is
+// written, so they can override whatever the backend or static handler set.
+type headerOpsWriter struct {
+	http.ResponseWriter
+	ops     headerOpList
+	applied bool
+}
+
+func (hw *headerOpsWriter) WriteHeader(code int) {
+	if !hw.applied {
+		hw.applied = true
+		hw.ops.apply(hw.Header())
+	}
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *headerOpsWriter) Write(b []byte) (int, error) {
+	if !hw.applied {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+func (hw *headerOpsWriter) Unwrap() http.ResponseWriter { return hw.ResponseWriter }
+
+func (hw *headerOpsWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+func (hw *headerOpsWriter) Flush() {
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// statusRecorder captures the response code and size for access logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter { return sr.ResponseWriter }
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+// Hijack and Flush pass through so WebSocket upgrades and streaming keep
+// working behind the logging wrapper.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// accessLog wraps the main handler and emits one structured line per request.
+func (p *ProxyServer) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		// Seeded here so the backend branch can fill in upstream timing
+		// visible to this wrapper.
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyUpstream{}, &upstreamTiming{}))
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			// Hijacked (WebSocket) connections log from the relay.
+			return
+		}
+		p.metrics.Inc(`clawdbot_proxy_requests_total{code="` + statusClass(rec.status) + `"}`)
+		p.observeLatency(r, rec.status, start)
+		// Sampling keeps 1 in N successful entries; errors (4xx/5xx) are
+		// always logged so incidents stay fully visible. Metrics above are
+		// unaffected.
+		if rec.status < 400 && p.cfg.AccessLogSample > 1 &&
+			p.logSampleN.Add(1)%uint64(p.cfg.AccessLogSample) != 1 {
+			p.metrics.Inc(`clawdbot_proxy_access_log_sampled_total`)
+			return
+		}
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client", p.clientIP(r),
+			"user_agent", r.UserAgent(),
+		}
+		if id := requestIDFrom(r.Context()); id != "" {
+			attrs = append(attrs, "request_id", id)
+		}
+		if t, ok := r.Context().Value(ctxKeyUpstream{}).(*upstreamTiming); ok && !t.firstByte.IsZero() {
+			attrs = append(attrs, "upstream_ms", t.firstByte.Sub(t.start).Milliseconds())
+		}
+		p.accessLogger.Info("request", attrs...)
+	})
+}
+
+// observeLatency feeds the latency histograms: client-observed duration for
+// every request, plus per-backend time-to-first-byte and total upstream time
+// when the request was proxied. Keeping the upstream pair separate from the
+// client view is what lets a slow gateway be told apart from a slow client.
+func (p *ProxyServer) observeLatency(r *http.Request, status int, start time.Time) {
+	t, ok := r.Context().Value(ctxKeyUpstream{}).(*upstreamTiming)
+	exemplar := ""
+	if ok && t.traceID != "" {
+		exemplar = `trace_id="` + t.traceID + `"`
+	}
+	p.metrics.ObserveExemplar(
+		`clawdbot_proxy_request_duration_seconds{code="`+statusClass(status)+`"}`,
+		time.Since(start).Seconds(), exemplar)
+	if !ok || t.firstByte.IsZero() || t.backend == "" {
+		return
+	}
+	label := `{backend=` + strconv.Quote(t.backend) + `}`
+	p.metrics.ObserveExemplar(`clawdbot_proxy_upstream_ttfb_seconds`+label,
+		t.firstByte.Sub(t.start).Seconds(), exemplar)
+	p.metrics.ObserveExemplar(`clawdbot_proxy_upstream_duration_seconds`+label,
+		time.Since(t.start).Seconds(), exemplar)
+}
+
+func statusClass(code int) string {
+	switch {
+	case code >= 500:
+		return "5xx"
+	case code >= 400:
+		return "4xx"
+	case code >= 300:
+		return "3xx"
+	default:
+		return "2xx"
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signal handling differs per platform: Unix has the full set (SIGTERM to
+// drain, SIGHUP to reload certificates, SIGUSR2 for binary upgrades),
+// Windows only delivers an interrupt — service control requests arrive
+// through the SCM instead (see winservice_windows.go).
+
+// shutdownSignals are the signals the main loop listens for.
+func shutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP}
+}
+
+// drainSignal is what internal shutdown requests inject into the loop.
+func drainSignal() os.Signal { return syscall.SIGTERM }
+
+// isReloadSignal reports whether sig asks for a certificate reload.
+func isReloadSignal(sig os.Signal) bool { return sig == syscall.SIGHUP }
+
+// isUpgradeSignal reports whether sig asks for a zero-downtime binary
+// upgrade.
+func isUpgradeSignal(sig os.Signal) bool { return sig == syscall.SIGUSR2 }
+
+// isLogReopenSignal reports whether sig asks for the -log-file to be
+// reopened (logrotate's postrotate hook).
+func isLogReopenSignal(sig os.Signal) bool { return sig == syscall.SIGUSR1 }
@@ -0,0 +1,20 @@
+//go:build windows
+
+package proxy
+
+import "os"
+
+// Windows has no SIGHUP or SIGUSR2; certificate reloads happen via the
+// admin endpoint and binary upgrades by restarting the service. Stop
+// requests from the service manager are translated to an interrupt by
+// the control handler in winservice_windows.go.
+
+func shutdownSignals() []os.Signal { return []os.Signal{os.Interrupt} }
+
+func drainSignal() os.Signal { return os.Interrupt }
+
+func isReloadSignal(os.Signal) bool { return false }
+
+func isUpgradeSignal(os.Signal) bool { return false }
+
+func isLogReopenSignal(os.Signal) bool { return false }
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Slowloris defenses: the header read timeout lives on http.Server
+// (ReadHeaderTimeout); this file adds the two protections the std library
+// does not offer — a minimum transfer rate for request bodies and a per-IP
+// cap on concurrent connections enforced before HTTP parsing even starts.
+
+// errSlowBody marks a request body that fell below the minimum transfer
+// rate; the proxy error handler maps it to 408.
+var errSlowBody = errors.New("request body below minimum transfer rate")
+
+// minRateReader aborts a body that averages below min bytes/sec. The grace
+// period keeps legitimate clients with a slow first packet alive.
+type minRateReader struct {
+	rc    io.ReadCloser
+	min   float64 // bytes/sec
+	grace time.Duration
+	start time.Time
+	read  int64
+}
+
+func newMinRateReader(rc io.ReadCloser, min float64, grace time.Duration) *minRateReader {
+	return &minRateReader{rc: rc, min: min, grace: grace, start: time.Now()}
+}
+
+func (m *minRateReader) Read(p []byte) (int, error) {
+	n, err := m.rc.Read(p)
+	m.read += int64(n)
+	if err == nil {
+		if elapsed := time.Since(m.start); elapsed > m.grace && float64(m.read)/elapsed.Seconds() < m.min {
+			return n, errSlowBody
+		}
+	}
+	return n, err
+}
+
+func (m *minRateReader) Close() error { return m.rc.Close() }
+
+// enforceBodyRate wraps the request body when -min-body-rate is set.
+func (p *ProxyServer) enforceBodyRate(r *io.ReadCloser) {
+	if p.cfg.MinBodyRate <= 0 || *r == nil {
+		return
+	}
+	*r = newMinRateReader(*r, p.cfg.MinBodyRate, 5*time.Second)
+}
+
+// connLimitListener drops new connections from IPs that already hold the
+// maximum number of open ones. Accounting is by remote IP, decremented when
+// the connection closes.
+type connLimitListener struct {
+	net.Listener
+	max     int
+	metrics *Metrics
+
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+func newConnLimitListener(ln net.Listener, max int, m *Metrics) *connLimitListener {
+	return &connLimitListener{Listener: ln, max: max, metrics: m, perIP: make(map[string]int)}
+}
+
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := remoteHost(conn.RemoteAddr().String())
+		l.mu.Lock()
+		over := l.perIP[ip] >= l.max
+		if !over {
+			l.perIP[ip]++
+		}
+		l.mu.Unlock()
+		if over {
+			l.metrics.Inc(`clawdbot_proxy_conn_limited_total`)
+			conn.Close()
+			continue
+		}
+		return &countedConn{Conn: conn, ln: l, ip: ip}, nil
+	}
+}
+
+func (l *connLimitListener) release(ip string) {
+	l.mu.Lock()
+	if l.perIP[ip] <= 1 {
+		delete(l.perIP, ip)
+	} else {
+		l.perIP[ip]--
+	}
+	l.mu.Unlock()
+}
+
+type countedConn struct {
+	net.Conn
+	ln   *connLimitListener
+	ip   string
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.ln.release(c.ip) })
+	return c.Conn.Close()
+}
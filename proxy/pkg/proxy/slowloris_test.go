@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMinRateReaderSlowBody(t *testing.T) {
+	r := newMinRateReader(io.NopCloser(strings.NewReader("abcdef")), 1000, 0)
+	// Backdate the start so the average rate computes as far too slow.
+	r.start = time.Now().Add(-10 * time.Second)
+	buf := make([]byte, 3)
+	if _, err := r.Read(buf); err != errSlowBody {
+		t.Errorf("Read error = %v, want errSlowBody", err)
+	}
+}
+
+func TestMinRateReaderFastBody(t *testing.T) {
+	r := newMinRateReader(io.NopCloser(strings.NewReader("abcdef")), 1, time.Minute)
+	if b, err := io.ReadAll(r); err != nil || string(b) != "abcdef" {
+		t.Errorf("ReadAll = %q, %v", b, err)
+	}
+}
+
+func TestConnLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetrics()
+	ln := newConnLimitListener(inner, 1, m)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	first, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	c1 := <-accepted
+
+	// Second connection from the same IP must be dropped at accept time.
+	second, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Error("second connection should have been closed by the listener")
+	}
+
+	// Closing the first frees the slot for a third.
+	c1.Close()
+	third, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(2 * time.Second):
+		t.Error("third connection was not accepted after the first closed")
+	}
+}
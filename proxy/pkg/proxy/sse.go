@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server-Sent Events support. The server's WriteTimeout is sized for API
+// calls and kills long-lived streams, so when a backend response turns out
+// to be text/event-stream the write deadline is cleared for that response
+// only. A per-stream idle timeout replaces it: a backend that stops
+// producing events gets the stream cancelled instead of holding the
+// connection forever. Optional heartbeat comments (": keepalive") keep
+// intermediaries from timing out quiet streams; SSE clients ignore comment
+// lines by spec.
+
+// sseWriter watches the response headers and switches into streaming mode
+// when the backend starts an event stream.
+type sseWriter struct {
+	http.ResponseWriter
+	rc        *http.ResponseController
+	cancel    context.CancelFunc // aborts the upstream request on idle timeout
+	metrics   *Metrics
+	log       *slog.Logger
+	heartbeat time.Duration
+	idle      time.Duration
+
+	mu        sync.Mutex
+	streaming bool
+	lastData  time.Time // last byte from the backend
+	lastWrite time.Time // last byte to the client, heartbeats included
+	done      chan struct{}
+}
+
+func (s *sseWriter) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+func (s *sseWriter) WriteHeader(code int) {
+	ct, _, _ := strings.Cut(s.Header().Get("Content-Type"), ";")
+	if strings.EqualFold(strings.TrimSpace(ct), "text/event-stream") {
+		s.start()
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *sseWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.lastData, s.lastWrite = now, now
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush takes the lock so the copy loop's Write+Flush pairs cannot
+// interleave with the heartbeat goroutine flushing mid-event.
+func (s *sseWriter) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *sseWriter) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streaming = true
+	s.lastData = time.Now()
+	s.lastWrite = s.lastData
+	s.done = make(chan struct{})
+	// Streams outlive the server-wide WriteTimeout; recorders in tests do
+	// not support deadlines, which is fine to ignore.
+	if err := s.rc.SetWriteDeadline(time.Time{}); err == nil {
+		s.log.Debug("sse stream detected; write deadline cleared")
+	}
+	s.metrics.AddGauge(`clawdbot_proxy_sse_active`, 1)
+	s.metrics.Inc(`clawdbot_proxy_sse_streams_total`)
+	if s.heartbeat > 0 || s.idle > 0 {
+		go s.tick()
+	}
+}
+
+// tick injects heartbeat comments into quiet streams and cancels the
+// upstream request once the backend has been silent past the idle timeout.
+func (s *sseWriter) tick() {
+	interval := s.heartbeat
+	if interval <= 0 || (s.idle > 0 && s.idle < interval) {
+		interval = s.idle
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		if s.idle > 0 && time.Since(s.lastData) > s.idle {
+			s.mu.Unlock()
+			s.log.Info("sse stream idle timeout; cancelling upstream")
+			s.cancel()
+			return
+		}
+		if s.heartbeat > 0 && time.Since(s.lastWrite) >= s.heartbeat {
+			s.lastWrite = time.Now()
+			if _, err := io.WriteString(s.ResponseWriter, ": keepalive\n\n"); err != nil {
+				s.mu.Unlock()
+				s.cancel()
+				return
+			}
+			s.rc.Flush()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// finish tears down the stream bookkeeping once the handler returns.
+func (s *sseWriter) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.streaming {
+		return
+	}
+	s.streaming = false
+	close(s.done)
+	s.metrics.AddGauge(`clawdbot_proxy_sse_active`, -1)
+}
+
+// sseAware wraps a backend response so event streams are detected and
+// managed; finish must be deferred by the caller.
+func (p *ProxyServer) sseAware(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+	s := &sseWriter{
+		ResponseWriter: w,
+		rc:             http.NewResponseController(w),
+		cancel:         cancel,
+		metrics:        p.metrics,
+		log:            p.reqLog(r),
+		heartbeat:      p.cfg.SSEHeartbeat,
+		idle:           p.cfg.SSEIdleTimeout,
+	}
+	return s, r.WithContext(ctx), s.finish
+}
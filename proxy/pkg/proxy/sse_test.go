@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startProxyServerWith starts the proxy behind a caller-supplied http.Server
+// so tests can set server-level timeouts.
+func startProxyServerWith(t *testing.T, cfg *Config, srv *http.Server) (*ProxyServer, string) {
+	t.Helper()
+	p, err := NewProxyServer(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Handler = p.accessLog(p)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return p, ln.Addr().String()
+}
+
+func TestSSEStreamOutlivesWriteTimeoutAndHeartbeats(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "data: one\n\n")
+		w.(http.Flusher).Flush()
+		// Longer than the server WriteTimeout below: without deadline
+		// clearing the second event never arrives.
+		time.Sleep(700 * time.Millisecond)
+		io.WriteString(w, "data: two\n\n")
+	}))
+	defer backend.Close()
+
+	cfg := &Config{Backend: backend.URL, SSEHeartbeat: 100 * time.Millisecond}
+	p, addr := startProxyServerWith(t, cfg, &http.Server{WriteTimeout: 300 * time.Millisecond})
+
+	resp, err := http.Get("http://" + addr + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	s := string(body)
+	if !strings.Contains(s, "data: one") || !strings.Contains(s, "data: two") {
+		t.Fatalf("stream missing events: %q", s)
+	}
+	if !strings.Contains(s, ": keepalive") {
+		t.Fatalf("no heartbeat comment injected: %q", s)
+	}
+	// Bookkeeping must settle once the stream ends.
+	deadline := time.Now().Add(time.Second)
+	for p.metrics.Gauge(`clawdbot_proxy_sse_active`) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sse_active gauge stuck at %v", p.metrics.Gauge(`clawdbot_proxy_sse_active`))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_sse_streams_total`) != 1 {
+		t.Fatalf("sse_streams_total = %d, want 1", p.metrics.Counter(`clawdbot_proxy_sse_streams_total`))
+	}
+}
+
+func TestSSEIdleTimeoutCancelsUpstream(t *testing.T) {
+	backendDone := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "data: only\n\n")
+		w.(http.Flusher).Flush()
+		// Go silent; the proxy's idle timeout should cancel this request.
+		<-r.Context().Done()
+		close(backendDone)
+	}))
+	defer backend.Close()
+
+	cfg := &Config{Backend: backend.URL, SSEIdleTimeout: 200 * time.Millisecond}
+	_, addr := startProxyServerWith(t, cfg, &http.Server{})
+
+	resp, err := http.Get("http://" + addr + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body) // ends when the proxy cancels upstream
+	if !strings.Contains(string(body), "data: only") {
+		t.Fatalf("missing initial event: %q", body)
+	}
+	select {
+	case <-backendDone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("backend request was never cancelled")
+	}
+}
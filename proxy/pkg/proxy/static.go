@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// handleStatic serves the built Control UI: a -static dir when configured
+// (development override), else the UI embedded at build time (-tags
+// embedui), else 404.
+func (p *ProxyServer) handleStatic(w http.ResponseWriter, r *http.Request) {
+	if p.cfg.StaticDir == "" && p.staticFS != nil {
+		p.handleStaticFS(w, r, p.staticFS)
+		return
+	}
+	p.handleStaticDir(w, r, p.cfg.StaticDir)
+}
+
+// handleStaticFS mirrors handleStaticDir for an embedded filesystem: SPA
+// index.html fallback, Cache-Control policy, strong ETags, precompressed
+// sibling selection. Embedded content is immutable, so ETags are cached
+// forever and Last-Modified is omitted.
+func (p *ProxyServer) handleStaticFS(w http.ResponseWriter, r *http.Request, fsys fs.FS) {
+	w = p.throttleWriter(w, r, "")
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || !fsFileExists(fsys, name) {
+		name = "index.html"
+	}
+	if cc := p.cacheControlFor(name); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	serveName := name
+	for _, c := range []struct{ enc, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if acceptsEncoding(r, c.enc) && fsFileExists(fsys, name+c.ext) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			w.Header().Set("Content-Encoding", c.enc)
+			serveName = name + c.ext
+			break
+		}
+	}
+	body, err := fs.ReadFile(fsys, serveName)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("ETag", p.staticETags.getBytes("embed:"+serveName, body))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+func fsFileExists(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// handleStaticDir serves files from dir. Unknown paths fall back to
+// index.html so client-side routing works. Responses carry a strong ETag
+// and a per-extension Cache-Control so browsers revalidate cheaply instead
+// of re-downloading the whole UI on every load (http.ServeFile handles
+// If-None-Match/If-Modified-Since once the headers are set).
+func (p *ProxyServer) handleStaticDir(w http.ResponseWriter, r *http.Request, dir string) {
+	if dir == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		p.httpError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w = p.throttleWriter(w, r, "")
+	name := filepath.Join(dir, filepath.Clean("/"+r.URL.Path))
+	info, err := os.Stat(name)
+	if err == nil && info.IsDir() && p.listingAllowed(r.URL.Path) {
+		p.serveDirListing(w, r, name)
+		return
+	}
+	if err != nil || info.IsDir() {
+		// Missing (or an unlistable directory): a configured 404 page wins,
+		// otherwise fall back to index.html for client-side routing.
+		if p.notFoundPage != nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(p.notFoundPage)
+			return
+		}
+		name = filepath.Join(dir, "index.html")
+		info, err = os.Stat(name)
+	}
+	if err != nil {
+		http.ServeFile(w, r, name)
+		return
+	}
+	if cc := p.cacheControlFor(name); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	// A sibling .br/.gz produced at build time beats compressing on the
+	// fly. The response stays keyed on the original name (Content-Type,
+	// Cache-Control) but body and ETag come from the variant.
+	enc, variant, vinfo := precompressedVariant(r, name)
+	if enc == "" && (fileExists(name+".br") || fileExists(name+".gz")) {
+		// Variants exist but this client can't take them; caches still
+		// need to know the representation varies.
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if enc != "" {
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Set("Content-Encoding", enc)
+		if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		name, info = variant, vinfo
+	}
+	if etag := p.staticETags.get(name, info); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeFile(w, r, name)
+}
+
+// precompressedVariant picks the best sibling variant the client accepts,
+// preferring brotli over gzip.
+func precompressedVariant(r *http.Request, name string) (string, string, os.FileInfo) {
+	for _, c := range []struct{ enc, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !acceptsEncoding(r, c.enc) {
+			continue
+		}
+		if info, err := os.Stat(name + c.ext); err == nil && !info.IsDir() {
+			return c.enc, name + c.ext, info
+		}
+	}
+	return "", "", nil
+}
+
+func fileExists(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && !info.IsDir()
+}
+
+// listingAllowed reports whether directory listings are enabled for a URL
+// path (segment-boundary prefix match, like route matching).
+func (p *ProxyServer) listingAllowed(urlPath string) bool {
+	for _, prefix := range p.cfg.StaticListDirs {
+		if pathPrefixMatches(prefix, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveDirListing renders a minimal HTML index of one directory. Only
+// reachable for paths under -static-list-dirs, so the Control UI's SPA
+// fallback is unaffected.
+func (p *ProxyServer) serveDirListing(w http.ResponseWriter, r *http.Request, dir string) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "<!doctype html>\n<title>Index of %s</title>\n<h1>Index of %s</h1>\n<ul>\n",
+		html.EscapeString(r.URL.Path), html.EscapeString(r.URL.Path))
+	fmt.Fprintln(w, `<li><a href="../">../</a></li>`)
+	for _, entry := range entries {
+		href := url.PathEscape(entry.Name())
+		label := entry.Name()
+		if entry.IsDir() {
+			href += "/"
+			label += "/"
+		}
+		size := ""
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			size = fmt.Sprintf(" (%d bytes)", info.Size())
+		}
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a>%s</li>\n", href, html.EscapeString(label), size)
+	}
+	fmt.Fprintln(w, "</ul>")
+}
+
+// staticCacheRule maps a file extension (".js") or exact base name
+// ("index.html") to a Cache-Control value.
+type staticCacheRule struct {
+	match string
+	value string
+}
+
+// defaultStaticCacheRules assume a typical bundler output: hashed assets
+// are immutable, HTML must always revalidate so a deploy is picked up.
+var defaultStaticCacheRules = []staticCacheRule{
+	{"index.html", "no-cache"},
+	{".html", "no-cache"},
+	{".js", "public, max-age=31536000, immutable"},
+	{".css", "public, max-age=31536000, immutable"},
+	{".woff2", "public, max-age=31536000, immutable"},
+	{".svg", "public, max-age=86400"},
+	{".png", "public, max-age=86400"},
+	{".ico", "public, max-age=86400"},
+}
+
+// parseStaticCacheRules parses "match=value" entries separated by
+// semicolons (values themselves contain commas), e.g.
+// ".js=public, max-age=600;index.html=no-store".
+func parseStaticCacheRules(spec string) ([]staticCacheRule, error) {
+	if spec == "" {
+		return defaultStaticCacheRules, nil
+	}
+	var rules []staticCacheRule
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		match, value, ok := strings.Cut(entry, "=")
+		if !ok || match == "" || value == "" {
+			return nil, fmt.Errorf("static cache rule %q: want match=value", entry)
+		}
+		rules = append(rules, staticCacheRule{match: match, value: strings.TrimSpace(value)})
+	}
+	return rules, nil
+}
+
+// cacheControlFor picks the first rule matching the base name (exact) or
+// extension; order in the rule list decides precedence.
+func (p *ProxyServer) cacheControlFor(name string) string {
+	base := filepath.Base(name)
+	ext := filepath.Ext(name)
+	for _, rule := range p.staticRules {
+		if rule.match == base || rule.match == ext {
+			return rule.value
+		}
+	}
+	return ""
+}
+
+// etagCache memoizes content hashes per path, invalidated by size or mtime
+// changes, so the UI bundle is hashed once instead of per request.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	size    int64
+	modTime int64
+	etag    string
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{entries: make(map[string]etagEntry)}
+}
+
+func (c *etagCache) get(name string, info os.FileInfo) string {
+	c.mu.Lock()
+	cached, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime == info.ModTime().UnixNano() {
+		return cached.etag
+	}
+	etag, err := hashFile(name)
+	if err != nil {
+		return ""
+	}
+	c.mu.Lock()
+	c.entries[name] = etagEntry{size: info.Size(), modTime: info.ModTime().UnixNano(), etag: etag}
+	c.mu.Unlock()
+	return etag
+}
+
+// getBytes serves immutable content (the embedded UI): the hash is keyed
+// by name alone and never invalidated.
+func (c *etagCache) getBytes(key string, body []byte) string {
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return cached.etag
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.mu.Lock()
+	c.entries[key] = etagEntry{etag: etag}
+	c.mu.Unlock()
+	return etag
+}
+
+// hashFile returns a strong ETag from the file's SHA-256 (truncated; 128
+// bits is plenty for cache validation).
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func staticProxy(t *testing.T, cfg *Config, files map[string]string) *ProxyServer {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.StaticDir = dir
+	return newTestProxy(t, cfg)
+}
+
+func TestStaticETagRevalidation(t *testing.T) {
+	p := staticProxy(t, &Config{}, map[string]string{"app.js": "console.log(1)"})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/app.js", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("static response missing ETag")
+	}
+
+	r := httptest.NewRequest("GET", "/app.js", nil)
+	r.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want 304", rec.Code)
+	}
+}
+
+func TestStaticCacheControlDefaults(t *testing.T) {
+	p := staticProxy(t, &Config{}, map[string]string{
+		"index.html": "<html></html>",
+		"app.js":     "x",
+	})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/app.js", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("asset Cache-Control = %q", cc)
+	}
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("index Cache-Control = %q", cc)
+	}
+
+	// SPA fallback paths serve index.html and must inherit its policy.
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/settings/advanced", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("fallback Cache-Control = %q", cc)
+	}
+}
+
+func TestStaticCacheControlOverride(t *testing.T) {
+	cfg := &Config{StaticCacheControl: ".js=public, max-age=600;index.html=no-store"}
+	p := staticProxy(t, cfg, map[string]string{"index.html": "x", "app.js": "y"})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/app.js", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=600" {
+		t.Errorf("override Cache-Control = %q", cc)
+	}
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("index override Cache-Control = %q", cc)
+	}
+}
+
+func TestParseStaticCacheRulesErrors(t *testing.T) {
+	for _, bad := range []string{"noequals", ".js=", "=value"} {
+		if _, err := parseStaticCacheRules(bad); err == nil {
+			t.Errorf("parseStaticCacheRules(%q) should fail", bad)
+		}
+	}
+}
+
+func TestETagCacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(name, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newETagCache()
+	info, _ := os.Stat(name)
+	first := c.get(name, info)
+	if first == "" {
+		t.Fatal("no etag computed")
+	}
+	if again := c.get(name, info); again != first {
+		t.Error("unchanged file must keep its etag")
+	}
+	if err := os.WriteFile(name, []byte("two!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = os.Stat(name)
+	if changed := c.get(name, info); changed == first {
+		t.Error("changed file must get a new etag")
+	}
+}
+
+func TestStaticPrecompressedGzip(t *testing.T) {
+	p := staticProxy(t, &Config{}, map[string]string{
+		"app.js":    "uncompressed",
+		"app.js.gz": "gzip-bytes",
+		"app.js.br": "br-bytes",
+	})
+
+	r := httptest.NewRequest("GET", "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Body.String() != "gzip-bytes" {
+		t.Errorf("body = %q, want the .gz sibling", rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+		t.Errorf("Content-Type = %q, want the original file's type", ct)
+	}
+	if rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+	}
+}
+
+func TestStaticPrecompressedPrefersBrotli(t *testing.T) {
+	p := staticProxy(t, &Config{}, map[string]string{
+		"app.js":    "uncompressed",
+		"app.js.gz": "gzip-bytes",
+		"app.js.br": "br-bytes",
+	})
+	r := httptest.NewRequest("GET", "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Header().Get("Content-Encoding") != "br" || rec.Body.String() != "br-bytes" {
+		t.Errorf("encoding = %q body = %q, want brotli sibling", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+}
+
+func TestStaticPrecompressedFallback(t *testing.T) {
+	cfg := &Config{} // compression middleware off in direct ServeHTTP tests
+	p := staticProxy(t, cfg, map[string]string{
+		"app.js":    "uncompressed",
+		"app.js.gz": "gzip-bytes",
+	})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/app.js", nil))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "uncompressed" {
+		t.Errorf("plain client got encoding %q body %q", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+	if rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding even without negotiation", rec.Header().Get("Vary"))
+	}
+}
+
+func TestHandleStaticFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte("<html>embedded</html>")},
+		"app.js":     {Data: []byte("js")},
+		"app.js.gz":  {Data: []byte("gz")},
+	}
+	p := newTestProxy(t, &Config{})
+	p.staticFS = fsys
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), "embedded") {
+		t.Errorf("index body = %q", rec.Body.String())
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Error("embedded responses should carry an ETag")
+	}
+
+	// SPA fallback.
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/settings", nil))
+	if !strings.Contains(rec.Body.String(), "embedded") {
+		t.Errorf("fallback body = %q", rec.Body.String())
+	}
+
+	// Precompressed sibling.
+	r := httptest.NewRequest("GET", "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Body.String() != "gz" {
+		t.Errorf("encoding = %q body = %q, want gzip sibling", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+}
+
+func TestStaticDirOverridesEmbedded(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("from disk"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{StaticDir: dir})
+	p.staticFS = fstest.MapFS{"index.html": {Data: []byte("from embed")}}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), "from disk") {
+		t.Errorf("body = %q, disk dir must win over embedded UI", rec.Body.String())
+	}
+}
+
+func TestStaticDirectoryListing(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "downloads", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "downloads", "logs.tar.gz"), []byte("archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{StaticDir: dir, StaticListDirs: []string{"/downloads"}})
+
+	// Listing paths need a trailing slash; redirect like http.FileServer.
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/downloads", nil))
+	if rec.Code != http.StatusMovedPermanently {
+		t.Fatalf("no-slash status = %d, want 301", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/downloads/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("listing status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "logs.tar.gz") || !strings.Contains(body, "sub/") {
+		t.Errorf("listing body = %q, want entries", body)
+	}
+
+	// Directories outside the allowlist keep the SPA fallback behavior.
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/other/", nil))
+	if strings.Contains(rec.Body.String(), "Index of") {
+		t.Error("unlisted directory should not render a listing")
+	}
+}
+
+func TestStaticCustom404(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "404.html")
+	if err := os.WriteFile(page, []byte("<h1>lost claw</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := staticProxy(t, &Config{NotFoundPage: page}, map[string]string{"index.html": "<html>ui</html>"})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/missing.txt", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "lost claw") {
+		t.Errorf("body = %q, want custom 404 page", rec.Body.String())
+	}
+}
+
+func TestStaticMethodNotAllowed(t *testing.T) {
+	p := staticProxy(t, &Config{}, map[string]string{"index.html": "x"})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("DELETE", "/index.html", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+	if rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("Allow = %q", rec.Header().Get("Allow"))
+	}
+}
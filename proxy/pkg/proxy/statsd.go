@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// StatsD/DogStatsD sink: for deployments without Prometheus the registry
+// mirrors every update over UDP in DogStatsD line format, with the embedded
+// Prometheus labels translated to tags. The in-process /metrics endpoint
+// keeps working either way; the sink is purely additive.
+
+// metricsSink receives every metric update alongside the registry. Values
+// keep registry semantics: counts are deltas, gauges absolute, timings
+// seconds.
+type metricsSink interface {
+	count(name string, delta int64, tags []string)
+	gauge(name string, v float64, tags []string)
+	timing(name string, seconds float64, tags []string)
+}
+
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+	rate   float64 // sample rate for counts and timings; gauges always send
+	tags   []string
+}
+
+func newStatsDSink(addr, prefix string, rate float64, tags []string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return &statsdSink{conn: conn, prefix: prefix, rate: rate, tags: tags}, nil
+}
+
+func (s *statsdSink) count(name string, delta int64, tags []string) {
+	s.send(name, strconv.FormatInt(delta, 10), "c", tags, true)
+}
+
+func (s *statsdSink) gauge(name string, v float64, tags []string) {
+	s.send(name, strconv.FormatFloat(v, 'g', -1, 64), "g", tags, false)
+}
+
+func (s *statsdSink) timing(name string, seconds float64, tags []string) {
+	s.send(name, strconv.FormatFloat(seconds*1000, 'f', 3, 64), "ms", tags, true)
+}
+
+// send emits one DogStatsD line: name:value|type[|@rate][|#tag:v,...].
+// UDP writes are best-effort; a dropped datagram must never slow a request.
+func (s *statsdSink) send(name, value, typ string, tags []string, sampled bool) {
+	var b strings.Builder
+	b.WriteString(s.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(typ)
+	if sampled && s.rate < 1 {
+		if rand.Float64() >= s.rate {
+			return
+		}
+		b.WriteString("|@")
+		b.WriteString(strconv.FormatFloat(s.rate, 'g', -1, 64))
+	}
+	if all := append(append([]string(nil), s.tags...), tags...); len(all) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(all, ","))
+	}
+	s.conn.Write([]byte(b.String()))
+}
+
+// sinkNameTags converts a registry name like `foo_total{code="2xx"}` into
+// the bare name and DogStatsD tags ("code:2xx").
+func sinkNameTags(name string) (string, []string) {
+	base, labels := splitMetricName(name)
+	if labels == "" {
+		return base, nil
+	}
+	var tags []string
+	for _, kv := range strings.Split(labels, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		if uq, err := strconv.Unquote(v); err == nil {
+			v = uq
+		}
+		tags = append(tags, k+":"+v)
+	}
+	return base, tags
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStatsD(t *testing.T) (*Metrics, func() []string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	sink, err := newStatsDSink(pc.LocalAddr().String(), "clawdbot.proxy.", 1, []string{"env:test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetrics()
+	m.sink = sink
+	recv := func() []string {
+		var lines []string
+		buf := make([]byte, 1500)
+		for {
+			pc.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			lines = append(lines, string(buf[:n]))
+		}
+	}
+	return m, recv
+}
+
+func TestStatsDSinkMirrorsRegistry(t *testing.T) {
+	m, recv := newTestStatsD(t)
+	m.Inc(`clawdbot_proxy_requests_total{code="2xx"}`)
+	m.SetGauge("clawdbot_proxy_ready", 1)
+	m.Observe("clawdbot_proxy_request_duration_seconds", 0.25)
+
+	lines := recv()
+	want := []string{
+		"clawdbot.proxy.clawdbot_proxy_requests_total:1|c|#env:test,code:2xx",
+		"clawdbot.proxy.clawdbot_proxy_ready:1|g|#env:test",
+		"clawdbot.proxy.clawdbot_proxy_request_duration_seconds:250.000|ms|#env:test",
+	}
+	for _, w := range want {
+		found := false
+		for _, l := range lines {
+			if l == w {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing datagram %q in %q", w, lines)
+		}
+	}
+	// The Prometheus registry must be unaffected by the mirror.
+	if m.Counter(`clawdbot_proxy_requests_total{code="2xx"}`) != 1 {
+		t.Error("registry counter not updated")
+	}
+}
+
+func TestStatsDSamplingDropsAndAnnotates(t *testing.T) {
+	m, recv := newTestStatsD(t)
+	m.sink.(*statsdSink).rate = 0.5
+	for i := 0; i < 50; i++ {
+		m.Inc("sampled_total")
+	}
+	lines := recv()
+	if len(lines) == 50 {
+		t.Error("sampling sent every datagram") // p = 2^-50 false failure
+	}
+	for _, l := range lines {
+		if !strings.Contains(l, "|@0.5") {
+			t.Fatalf("sampled line missing rate annotation: %q", l)
+		}
+	}
+}
+
+func TestSinkNameTags(t *testing.T) {
+	base, tags := sinkNameTags(`foo_total{code="2xx",backend="b:80"}`)
+	if base != "foo_total" || len(tags) != 2 || tags[0] != "code:2xx" || tags[1] != "backend:b:80" {
+		t.Fatalf("sinkNameTags = %q %v", base, tags)
+	}
+}
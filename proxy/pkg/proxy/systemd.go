@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is where systemd places activated sockets (fd 3, after
+// stdin/stdout/stderr).
+const listenFDsStart = 3
+
+// activationListener returns the socket passed by systemd socket activation,
+// or nil when the process was not socket-activated. LISTEN_PID must match our
+// own pid, otherwise the variables were inherited from a parent and are not
+// meant for us. The env vars are unset after use so children do not see them.
+func activationListener() (net.Listener, error) {
+	pidStr, fdsStr := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if pidStr == "" || fdsStr == "" {
+		return nil, nil
+	}
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(fdsStr)
+	if err != nil || fds < 1 {
+		return nil, fmt.Errorf("socket activation: invalid LISTEN_FDS %q", fdsStr)
+	}
+	if fds > 1 {
+		return nil, fmt.Errorf("socket activation: got %d sockets, expected 1", fds)
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	ln, err := net.FileListener(f)
+	// FileListener dups the fd; the original is no longer needed either way.
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestActivationListenerNotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	ln, err := activationListener()
+	if ln != nil || err != nil {
+		t.Errorf("got (%v, %v), want (nil, nil) without activation env", ln, err)
+	}
+}
+
+func TestActivationListenerIgnoresForeignPID(t *testing.T) {
+	// Variables inherited from a parent process (wrong pid) must be ignored,
+	// not treated as an error.
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	ln, err := activationListener()
+	if ln != nil || err != nil {
+		t.Errorf("got (%v, %v), want (nil, nil) for foreign LISTEN_PID", ln, err)
+	}
+}
+
+func TestActivationListenerRejectsMultipleFDs(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	if _, err := activationListener(); err == nil {
+		t.Error("expected error for more than one activated socket")
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Egress bandwidth shaping: one client pulling a huge log archive should
+// not starve the Control UI for everyone else. A token bucket per client
+// key (API key when present, client IP otherwise) is shared by all of that
+// client's concurrent responses, so opening extra connections buys nothing.
+
+// throttleChunk bounds how many bytes one write reserves at a time; smaller
+// chunks smooth the pacing, larger ones cost fewer bucket round trips.
+const throttleChunk = 32 << 10
+
+type bwBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bwShaper hands out send budget at a fixed rate per key. Buckets may go
+// negative; the deficit translates into how long the writer must sleep.
+type bwShaper struct {
+	rate float64 // bytes/sec per key
+
+	mu      sync.Mutex
+	buckets map[string]*bwBucket
+}
+
+func newBWShaper(rate float64) *bwShaper {
+	return &bwShaper{rate: rate, buckets: make(map[string]*bwBucket)}
+}
+
+// reserve books n bytes against key's bucket and returns how long the
+// caller must wait before sending them.
+func (s *bwShaper) reserve(key string, n int) time.Duration {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.buckets[key]
+	if b == nil {
+		// Same pragmatic cleanup as the rate limiter: reset wholesale when
+		// the map grows unreasonably.
+		if len(s.buckets) > 10000 {
+			s.buckets = make(map[string]*bwBucket)
+		}
+		b = &bwBucket{tokens: s.rate, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * s.rate
+	if b.tokens > s.rate {
+		b.tokens = s.rate // at most one second of burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / s.rate * float64(time.Second))
+}
+
+// throttledWriter paces writes through the shared shaper. Hijack and Flush
+// pass through so WebSocket upgrades and streaming stay intact.
+type throttledWriter struct {
+	http.ResponseWriter
+	shaper *bwShaper
+	key    string
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunk {
+			chunk = chunk[:throttleChunk]
+		}
+		if d := t.shaper.reserve(t.key, len(chunk)); d > 0 {
+			time.Sleep(d)
+		}
+		n, err := t.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (t *throttledWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
+
+func (t *throttledWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *throttledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := t.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// throttleWriter wraps w when bandwidth shaping is enabled; key falls back
+// to the client IP when the request carries no API key.
+func (p *ProxyServer) throttleWriter(w http.ResponseWriter, r *http.Request, apiKey string) http.ResponseWriter {
+	if p.shaper == nil {
+		return w
+	}
+	key := "ip:" + p.clientIP(r)
+	if apiKey != "" {
+		key = "key:" + apiKey
+	}
+	return &throttledWriter{ResponseWriter: w, shaper: p.shaper, key: key}
+}
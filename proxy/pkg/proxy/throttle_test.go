@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBWShaperPacing(t *testing.T) {
+	s := newBWShaper(1000)
+	// First second of burst is free.
+	if d := s.reserve("ip:10.0.0.1", 1000); d != 0 {
+		t.Errorf("initial burst delayed by %v, want 0", d)
+	}
+	// The next kilobyte must wait about a second.
+	d := s.reserve("ip:10.0.0.1", 1000)
+	if d < 500*time.Millisecond || d > 2*time.Second {
+		t.Errorf("second reserve delay = %v, want ~1s", d)
+	}
+	// Other clients are unaffected.
+	if d := s.reserve("ip:10.0.0.2", 1000); d != 0 {
+		t.Errorf("independent client delayed by %v, want 0", d)
+	}
+}
+
+func TestThrottledWriterDelivery(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &throttledWriter{ResponseWriter: rec, shaper: newBWShaper(1 << 30), key: "ip:t"}
+	payload := make([]byte, 3*throttleChunk+17)
+	n, err := w.Write(payload)
+	if err != nil || n != len(payload) {
+		t.Fatalf("Write = %d, %v, want full payload", n, err)
+	}
+	if rec.Body.Len() != len(payload) {
+		t.Errorf("delivered %d bytes, want %d", rec.Body.Len(), len(payload))
+	}
+}
+
+func TestThrottleWriterKeying(t *testing.T) {
+	p := newTestProxy(t, &Config{BandwidthRate: 100})
+	r := httptest.NewRequest("GET", "/api/logs", nil)
+	r.RemoteAddr = "192.0.2.1:4444"
+	tw, ok := p.throttleWriter(httptest.NewRecorder(), r, "secret").(*throttledWriter)
+	if !ok {
+		t.Fatal("shaping enabled, want a throttledWriter")
+	}
+	if tw.key != "key:secret" {
+		t.Errorf("key = %q, want key:secret", tw.key)
+	}
+	tw, _ = p.throttleWriter(httptest.NewRecorder(), r, "").(*throttledWriter)
+	if tw.key != "ip:192.0.2.1" {
+		t.Errorf("key = %q, want ip:192.0.2.1", tw.key)
+	}
+}
+
+func TestThrottleWriterDisabled(t *testing.T) {
+	p := newTestProxy(t, &Config{})
+	rec := httptest.NewRecorder()
+	if w := p.throttleWriter(rec, httptest.NewRequest("GET", "/", nil), ""); w != rec {
+		t.Error("shaping disabled, writer must pass through unchanged")
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Per-route timeout overrides. The server-wide Read/Write timeouts are sized
+// for ordinary API calls and cut off long-running ones (model invocations
+// through the gateway routinely exceed them). Backend routes can override
+// them instead of forcing the global knobs wide open:
+//
+//	timeout=                 whole-request deadline; also extends the
+//	                         connection read/write deadlines to match
+//	response-header-timeout= how long the backend may think before headers
+//	idle-timeout=            cancel once the response body stalls this long
+//
+// All three propagate as context cancellation so the backend request is
+// torn down, not just abandoned.
+
+// errUpstreamTimeout marks cancellations caused by a route timeout so the
+// error handler can answer 504 instead of the generic 502.
+var errUpstreamTimeout = errors.New("route timeout exceeded")
+
+// routeTimeoutGrace pads the connection deadlines past the route timeout so
+// the 504 (or the final body flush) is not itself cut off.
+const routeTimeoutGrace = 10 * time.Second
+
+// ctxKeyHeaderTimer carries the response-header timer to ModifyResponse,
+// which stops it once headers arrive.
+type ctxKeyHeaderTimer struct{}
+
+func (rt *route) hasTimeouts() bool {
+	return rt.timeout > 0 || rt.headerTimeout > 0 || rt.idleTimeout > 0
+}
+
+// applyRouteTimeouts arms the route's deadlines around one request. The
+// returned stop function must run once the response is done.
+func (p *ProxyServer) applyRouteTimeouts(w http.ResponseWriter, r *http.Request, rt *route) (http.ResponseWriter, *http.Request, func()) {
+	ctx := r.Context()
+	var stops []func()
+	if rt.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rt.timeout)
+		stops = append(stops, cancel)
+		// Stretch the per-connection deadlines too, with slack so the
+		// timeout response itself still gets written; recorders in tests
+		// do not support deadlines, which is fine to ignore.
+		deadline := time.Now().Add(rt.timeout + routeTimeoutGrace)
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(deadline)
+		rc.SetReadDeadline(deadline)
+	}
+	if rt.headerTimeout > 0 || rt.idleTimeout > 0 {
+		cause, cancel := context.WithCancelCause(ctx)
+		ctx = cause
+		expire := func() { cancel(errUpstreamTimeout) }
+		stops = append(stops, func() { cancel(nil) })
+		if rt.headerTimeout > 0 {
+			t := time.AfterFunc(rt.headerTimeout, expire)
+			ctx = context.WithValue(ctx, ctxKeyHeaderTimer{}, t)
+			stops = append(stops, func() { t.Stop() })
+		}
+		if rt.idleTimeout > 0 {
+			iw := &idleWriter{ResponseWriter: w, idle: rt.idleTimeout}
+			iw.timer = time.AfterFunc(rt.idleTimeout, expire)
+			stops = append(stops, func() { iw.timer.Stop() })
+			w = iw
+		}
+	}
+	stop := func() {
+		for _, f := range stops {
+			f()
+		}
+	}
+	return w, r.WithContext(ctx), stop
+}
+
+// idleWriter pushes the idle deadline forward every time response bytes
+// actually flow.
+type idleWriter struct {
+	http.ResponseWriter
+	idle  time.Duration
+	timer *time.Timer
+}
+
+func (iw *idleWriter) Unwrap() http.ResponseWriter { return iw.ResponseWriter }
+
+func (iw *idleWriter) Write(b []byte) (int, error) {
+	iw.timer.Reset(iw.idle)
+	return iw.ResponseWriter.Write(b)
+}
+
+func (iw *idleWriter) Flush() {
+	if f, ok := iw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// isRouteTimeout reports whether the failed request died to a route
+// deadline rather than a backend fault.
+func isRouteTimeout(r *http.Request, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(context.Cause(r.Context()), errUpstreamTimeout)
+}
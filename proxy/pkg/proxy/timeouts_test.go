@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func timeoutProxy(t *testing.T, backendURL, tokens string) string {
+	t.Helper()
+	routes := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(routes, []byte("path=/api/ backend="+backendURL+" "+tokens+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return startProxy(t, &Config{Backend: backendURL, RouteFile: routes})
+}
+
+func TestRouteTimeoutAnswers504(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+	addr := timeoutProxy(t, backend.URL, "timeout=100ms")
+
+	start := time.Now()
+	resp, err := http.Get("http://" + addr + "/api/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", resp.StatusCode)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("timeout took %v, want ~100ms", time.Since(start))
+	}
+}
+
+func TestRouteResponseHeaderTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+	addr := timeoutProxy(t, backend.URL, "response-header-timeout=100ms")
+
+	resp, err := http.Get("http://" + addr + "/api/slow-headers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", resp.StatusCode)
+	}
+}
+
+func TestRouteIdleTimeoutCutsStalledBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "first chunk")
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, "never delivered")
+	}))
+	defer backend.Close()
+	addr := timeoutProxy(t, backend.URL, "idle-timeout=150ms")
+
+	resp, err := http.Get("http://" + addr + "/api/stall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	done := make(chan []byte, 1)
+	go func() {
+		b, _ := io.ReadAll(resp.Body)
+		done <- b
+	}()
+	select {
+	case body := <-done:
+		if string(body) != "first chunk" {
+			t.Fatalf("body = %q, want just the first chunk", body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("stalled body was never cut off")
+	}
+}
+
+func TestParseRouteTimeoutTokens(t *testing.T) {
+	rt, err := parseRouteLine("path=/api/ backend=http://x:1 timeout=90s response-header-timeout=10s idle-timeout=30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.timeout != 90*time.Second || rt.headerTimeout != 10*time.Second || rt.idleTimeout != 30*time.Second {
+		t.Fatalf("timeouts = %v/%v/%v", rt.timeout, rt.headerTimeout, rt.idleTimeout)
+	}
+	for _, line := range []string{
+		"path=/api/ backend=http://x:1 timeout=0",
+		"path=/api/ backend=http://x:1 timeout=fast",
+		"path=/s static=/tmp timeout=1s", // wrong action
+	} {
+		if _, err := parseRouteLine(line); err == nil {
+			t.Errorf("parseRouteLine(%q) succeeded, want error", line)
+		}
+	}
+}
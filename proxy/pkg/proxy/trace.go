@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Tracing support: spans follow the W3C Trace Context model and are shipped
+// as OTLP/HTTP JSON, which any OpenTelemetry collector accepts. Keeping the
+// encoder in-tree avoids pulling the whole SDK into a single-purpose proxy.
+
+type span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]string
+}
+
+// Tracer samples requests and batches finished spans to an OTLP endpoint.
+type Tracer struct {
+	endpoint   string
+	sampleRate float64
+	client     *http.Client
+	spans      chan *span
+	log        interface{ Warn(string, ...any) }
+}
+
+func NewTracer(endpoint string, sampleRate float64, log interface{ Warn(string, ...any) }) *Tracer {
+	t := &Tracer{
+		endpoint:   strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		sampleRate: sampleRate,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		spans:      make(chan *span, 256),
+		log:        log,
+	}
+	go t.exportLoop()
+	return t
+}
+
+func (t *Tracer) finish(s *span) {
+	s.End = time.Now()
+	select {
+	case t.spans <- s:
+	default: // never block request handling on a slow exporter
+	}
+}
+
+func (t *Tracer) exportLoop() {
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+	var batch []*span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			t.log.Warn("trace export failed", "error", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= 64 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// export encodes the batch in OTLP/HTTP JSON form.
+func (t *Tracer) export(batch []*span) error {
+	type kv struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	type otlpSpan struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId,omitempty"`
+		Name         string `json:"name"`
+		Kind         int    `json:"kind"`
+		Start        string `json:"startTimeUnixNano"`
+		End          string `json:"endTimeUnixNano"`
+		Attributes   []kv   `json:"attributes"`
+	}
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		os := otlpSpan{
+			TraceID:      s.TraceID,
+			SpanID:       s.SpanID,
+			ParentSpanID: s.ParentID,
+			Name:         s.Name,
+			Kind:         2, // SPAN_KIND_SERVER
+			Start:        fmt.Sprintf("%d", s.Start.UnixNano()),
+			End:          fmt.Sprintf("%d", s.End.UnixNano()),
+		}
+		for k, v := range s.Attrs {
+			attr := kv{Key: k}
+			attr.Value.StringValue = v
+			os.Attributes = append(os.Attributes, attr)
+		}
+		spans = append(spans, os)
+	}
+	payload := map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{
+				"attributes": []map[string]any{{
+					"key":   "service.name",
+					"value": map[string]string{"stringValue": "clawdbot-proxy"},
+				}},
+			},
+			"scopeSpans": []map[string]any{{"spans": spans}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (t *Tracer) sampled(incomingFlags string) bool {
+	if incomingFlags == "01" {
+		return true
+	}
+	if t.sampleRate >= 1 {
+		return true
+	}
+	if t.sampleRate <= 0 {
+		return false
+	}
+	n, _ := rand.Int(rand.Reader, big.NewInt(math.MaxInt32))
+	return float64(n.Int64()) < t.sampleRate*math.MaxInt32
+}
+
+// parseTraceparent extracts trace ID, parent span ID and flags from a W3C
+// traceparent header ("00-<trace>-<span>-<flags>").
+func parseTraceparent(header string) (traceID, parentID, flags string, ok bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", "", false
+	}
+	return parts[1], parts[2], parts[3], true
+}
+
+func newHexID(bytes int) string {
+	b := make([]byte, bytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSpan begins a span for r, wiring the outgoing traceparent so the Node
+// gateway joins the same trace. Returns nil when the request is not sampled.
+func (t *Tracer) startSpan(r *http.Request, name string) *span {
+	traceID, parentID, flags, hasParent := parseTraceparent(r.Header.Get("Traceparent"))
+	if !t.sampled(flags) {
+		return nil
+	}
+	if !hasParent {
+		traceID = newHexID(16)
+		parentID = ""
+	}
+	s := &span{
+		TraceID:  traceID,
+		SpanID:   newHexID(8),
+		ParentID: parentID,
+		Name:     name,
+		Start:    time.Now(),
+		Attrs: map[string]string{
+			"http.method": r.Method,
+			"url.path":    r.URL.Path,
+		},
+	}
+	r.Header.Set("Traceparent", fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID))
+	return s
+}
+
+// trace wraps next with a server span per sampled request.
+func (p *ProxyServer) trace(next http.Handler) http.Handler {
+	if p.tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := p.tracer.startSpan(r, "proxy "+r.Method)
+		if s == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if id := requestIDFrom(r.Context()); id != "" {
+			s.Attrs["clawdbot.request_id"] = id
+		}
+		rec, isRecorder := w.(*statusRecorder)
+		next.ServeHTTP(w, r)
+		if isRecorder {
+			if rec.status == 0 {
+				s.Name = "proxy websocket"
+			} else {
+				s.Attrs["http.status_code"] = fmt.Sprintf("%d", rec.status)
+			}
+		}
+		p.tracer.finish(s)
+	})
+}
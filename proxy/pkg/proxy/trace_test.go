@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestStartSpanJoinsIncomingTrace(t *testing.T) {
+	tr := NewTracer("http://127.0.0.1:0", 1, discardLogger())
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	s := tr.startSpan(r, "proxy GET")
+	if s == nil {
+		t.Fatal("span should be sampled")
+	}
+	if s.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace ID = %s, want incoming trace preserved", s.TraceID)
+	}
+	if s.ParentID != "b7ad6b7169203331" {
+		t.Errorf("parent ID = %s, want incoming span", s.ParentID)
+	}
+	out := r.Header.Get("Traceparent")
+	if !strings.HasPrefix(out, "00-0af7651916cd43dd8448eb211c80319c-") || !strings.HasSuffix(out, "-01") {
+		t.Errorf("outgoing traceparent = %q, want same trace with new span", out)
+	}
+	if strings.Contains(out, "b7ad6b7169203331") {
+		t.Error("outgoing traceparent must carry the proxy's own span ID")
+	}
+}
+
+func TestStartSpanGeneratesNewTrace(t *testing.T) {
+	tr := NewTracer("http://127.0.0.1:0", 1, discardLogger())
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	s := tr.startSpan(r, "proxy GET")
+	if s == nil {
+		t.Fatal("span should be sampled")
+	}
+	if len(s.TraceID) != 32 || len(s.SpanID) != 16 || s.ParentID != "" {
+		t.Errorf("ids = trace %q span %q parent %q", s.TraceID, s.SpanID, s.ParentID)
+	}
+}
+
+func TestTracerExportsOTLP(t *testing.T) {
+	got := make(chan map[string]any, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("export path = %s", r.URL.Path)
+		}
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		got <- payload
+	}))
+	defer collector.Close()
+
+	tr := NewTracer(collector.URL, 1, discardLogger())
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	s := tr.startSpan(r, "proxy GET")
+	tr.finish(s)
+
+	select {
+	case payload := <-got:
+		if _, ok := payload["resourceSpans"]; !ok {
+			t.Error("payload missing resourceSpans")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export received")
+	}
+}
+
+func TestSampleRateZeroDropsSpans(t *testing.T) {
+	tr := NewTracer("http://127.0.0.1:0", 0, discardLogger())
+	if s := tr.startSpan(httptest.NewRequest("GET", "/", nil), "x"); s != nil {
+		t.Error("sample rate 0 should not sample new traces")
+	}
+}
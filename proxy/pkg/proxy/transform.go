@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// JSON body transformation. -transform-file declares named transforms,
+// one per line:
+//
+//	<name> redact=<key,...> drop=<key,...> set=<key>:<value> max-body=<bytes>
+//
+// redact= replaces matching fields (anywhere in the document) with
+// "[redacted]", drop= removes them, and set= injects a top-level default
+// when the field is absent; values parse as JSON where possible, strings
+// otherwise. Routes attach transforms with req-transform=<name> and
+// resp-transform=<name>. Bodies that are not JSON, or larger than
+// max-body (default 1 MiB), pass through untouched — the response side
+// buffers only up to the cap and falls back to streaming beyond it, so a
+// transform can never stall a large download.
+
+const (
+	transformMaxBodyDefault = 1 << 20
+	transformRedacted       = "[redacted]"
+)
+
+type bodyTransform struct {
+	name    string
+	redact  map[string]bool
+	drop    map[string]bool
+	set     map[string]any // top-level defaults, only added when absent
+	maxBody int64
+}
+
+// parseTransformFile reads named transforms; '#' starts a comment.
+func parseTransformFile(path string) (map[string]*bodyTransform, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	transforms := make(map[string]*bodyTransform)
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tr, err := parseTransformLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if _, dup := transforms[tr.name]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate transform %q", path, lineNo, tr.name)
+		}
+		transforms[tr.name] = tr
+	}
+	return transforms, sc.Err()
+}
+
+func parseTransformLine(line string) (*bodyTransform, error) {
+	tr := &bodyTransform{
+		redact:  make(map[string]bool),
+		drop:    make(map[string]bool),
+		set:     make(map[string]any),
+		maxBody: transformMaxBodyDefault,
+	}
+	for i, tok := range splitRouteTokens(line) {
+		if i == 0 {
+			if strings.Contains(tok, "=") {
+				return nil, fmt.Errorf("transform line must start with a name")
+			}
+			tr.name = tok
+			continue
+		}
+		key, value, ok := strings.Cut(tok, "=")
+		if !ok {
+			return nil, fmt.Errorf("unknown token %q", tok)
+		}
+		switch key {
+		case "redact":
+			for _, k := range splitCommaList(value) {
+				tr.redact[k] = true
+			}
+		case "drop":
+			for _, k := range splitCommaList(value) {
+				tr.drop[k] = true
+			}
+		case "set":
+			field, raw, ok := strings.Cut(value, ":")
+			if !ok || field == "" {
+				return nil, fmt.Errorf("set %q: want key:value", value)
+			}
+			var v any
+			if err := json.Unmarshal([]byte(raw), &v); err != nil {
+				v = raw // not valid JSON; treat as a plain string
+			}
+			tr.set[field] = v
+		case "max-body":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("max-body %q: want a positive byte count", value)
+			}
+			tr.maxBody = n
+		default:
+			return nil, fmt.Errorf("unknown token %q", tok)
+		}
+	}
+	if len(tr.redact) == 0 && len(tr.drop) == 0 && len(tr.set) == 0 {
+		return nil, fmt.Errorf("transform %q does nothing", tr.name)
+	}
+	return tr, nil
+}
+
+// apply rewrites one JSON document. The second return is false when the
+// body was left untouched (not JSON).
+func (tr *bodyTransform) apply(data []byte) ([]byte, bool) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data, false
+	}
+	v = tr.walk(v)
+	if m, ok := v.(map[string]any); ok {
+		for k, def := range tr.set {
+			if _, exists := m[k]; !exists {
+				m[k] = def
+			}
+		}
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data, false
+	}
+	return out, true
+}
+
+// walk applies redact/drop to every object field, at any depth.
+func (tr *bodyTransform) walk(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, val := range x {
+			switch {
+			case tr.drop[k]:
+				delete(x, k)
+			case tr.redact[k]:
+				x[k] = transformRedacted
+			default:
+				x[k] = tr.walk(val)
+			}
+		}
+		return x
+	case []any:
+		for i, val := range x {
+			x[i] = tr.walk(val)
+		}
+		return x
+	default:
+		return v
+	}
+}
+
+// transformRequestBody rewrites the request body in place. Oversized or
+// non-JSON bodies are restored untouched.
+func (p *ProxyServer) transformRequestBody(r *http.Request, tr *bodyTransform) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	if r.ContentLength > tr.maxBody {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, tr.maxBody+1))
+	if err != nil || int64(len(data)) > tr.maxBody {
+		// Reassemble what we consumed so the backend still sees it all.
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+		return
+	}
+	out, changed := tr.apply(data)
+	if changed {
+		p.metrics.Inc(`clawdbot_proxy_body_transforms_total{direction="request"}`)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(out))
+	r.ContentLength = int64(len(out))
+	r.Header.Set("Content-Length", strconv.Itoa(len(out)))
+}
+
+// transformWriter buffers a JSON response up to the transform's cap,
+// rewrites it, and releases it with a corrected Content-Length. Non-JSON
+// or oversized responses switch to plain streaming.
+type transformWriter struct {
+	http.ResponseWriter
+	tr      *bodyTransform
+	metrics *Metrics
+
+	status      int
+	decided     bool // WriteHeader seen, buffering decision made
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (tw *transformWriter) Unwrap() http.ResponseWriter { return tw.ResponseWriter }
+
+func (tw *transformWriter) WriteHeader(status int) {
+	if tw.decided {
+		return
+	}
+	tw.decided = true
+	tw.status = status
+	ct := tw.Header().Get("Content-Type")
+	if !strings.Contains(ct, "json") {
+		tw.passthrough = true
+		tw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (tw *transformWriter) Write(b []byte) (int, error) {
+	if !tw.decided {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.passthrough {
+		return tw.ResponseWriter.Write(b)
+	}
+	if int64(tw.buf.Len()+len(b)) > tw.tr.maxBody {
+		// Too big to transform; flush what we held and stream the rest.
+		tw.flushUntouched()
+		return tw.ResponseWriter.Write(b)
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *transformWriter) Flush() {
+	if tw.passthrough {
+		if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	// Buffered writes flush when the response completes.
+}
+
+func (tw *transformWriter) flushUntouched() {
+	tw.passthrough = true
+	tw.Header().Del("Content-Length")
+	tw.ResponseWriter.WriteHeader(tw.status)
+	if tw.buf.Len() > 0 {
+		tw.ResponseWriter.Write(tw.buf.Bytes())
+		tw.buf.Reset()
+	}
+}
+
+// finish releases the buffered body; call after the handler returns.
+func (tw *transformWriter) finish() {
+	if !tw.decided || tw.passthrough {
+		return
+	}
+	out, changed := tw.tr.apply(tw.buf.Bytes())
+	if changed {
+		tw.metrics.Inc(`clawdbot_proxy_body_transforms_total{direction="response"}`)
+	}
+	tw.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	tw.ResponseWriter.WriteHeader(tw.status)
+	tw.ResponseWriter.Write(out)
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func writeTransformFile(t *testing.T, lines string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transforms")
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseTransformLine(t *testing.T) {
+	tr, err := parseTransformLine(`scrub redact=token,secret drop=stack set=source:proxy set=retries:3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tr.redact["token"] || !tr.redact["secret"] || !tr.drop["stack"] {
+		t.Fatalf("matchers = %+v", tr)
+	}
+	if tr.set["source"] != "proxy" || tr.set["retries"] != float64(3) {
+		t.Fatalf("set = %v", tr.set)
+	}
+	for _, bad := range []string{
+		"redact=x",      // no name
+		"scrub",         // does nothing
+		"scrub wat=1",   // unknown token
+		"scrub set=bad", // set without value
+	} {
+		if _, err := parseTransformLine(bad); err == nil {
+			t.Errorf("parseTransformLine(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	tr, err := parseTransformLine(`scrub redact=token drop=internal set=via:proxy`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := `{"token":"s3cret","nested":{"token":"also","keep":1},"internal":{"trace":"x"},"list":[{"token":"t"}]}`
+	out, changed := tr.apply([]byte(in))
+	if !changed {
+		t.Fatal("JSON body not transformed")
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["token"] != transformRedacted {
+		t.Fatalf("top-level token = %v", got["token"])
+	}
+	if nested := got["nested"].(map[string]any); nested["token"] != transformRedacted || nested["keep"] != float64(1) {
+		t.Fatalf("nested = %v", nested)
+	}
+	if _, exists := got["internal"]; exists {
+		t.Fatal("internal field survived drop")
+	}
+	if item := got["list"].([]any)[0].(map[string]any); item["token"] != transformRedacted {
+		t.Fatalf("array item = %v", item)
+	}
+	if got["via"] != "proxy" {
+		t.Fatalf("default not injected: %v", got["via"])
+	}
+
+	// Non-JSON bodies pass through untouched.
+	if out, changed := tr.apply([]byte("<html>")); changed || string(out) != "<html>" {
+		t.Fatalf("non-JSON body altered: %q", out)
+	}
+}
+
+func TestTransformEndToEnd(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// The request transform runs before us; echo what we received
+		// under "received" and add a secret for the response side.
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"received":` + string(body) + `,"api_key":"k"}`))
+	}))
+	defer backend.Close()
+
+	transforms := writeTransformFile(t, "inject set=via:proxy\nscrub redact=api_key\n")
+	routes := filepath.Join(t.TempDir(), "routes")
+	line := "path=/api/ backend=" + backend.URL + " req-transform=inject resp-transform=scrub\n"
+	if err := os.WriteFile(routes, []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{
+		Backend:       backend.URL,
+		RouteFile:     routes,
+		TransformFile: transforms,
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/send", strings.NewReader(`{"msg":"hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d body %q", rec.Code, rec.Body.String())
+	}
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response %q: %v", rec.Body.String(), err)
+	}
+	received := got["received"].(map[string]any)
+	if received["via"] != "proxy" || received["msg"] != "hi" {
+		t.Fatalf("request transform missed: %v", received)
+	}
+	if got["api_key"] != transformRedacted {
+		t.Fatalf("response transform missed: %v", got["api_key"])
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" && cl != strconv.Itoa(rec.Body.Len()) {
+		t.Fatalf("Content-Length %q != body %d", cl, rec.Body.Len())
+	}
+}
+
+func TestTransformOversizedResponseStreamsUntouched(t *testing.T) {
+	big := strings.Repeat("x", 64)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"api_key":"k","pad":"` + big + `"}`))
+	}))
+	defer backend.Close()
+
+	transforms := writeTransformFile(t, "scrub redact=api_key max-body=16\n")
+	routes := filepath.Join(t.TempDir(), "routes")
+	line := "path=/api/ backend=" + backend.URL + " resp-transform=scrub\n"
+	if err := os.WriteFile(routes, []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{Backend: backend.URL, RouteFile: routes, TransformFile: transforms})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/dump", nil))
+	if !strings.Contains(rec.Body.String(), `"api_key":"k"`) {
+		t.Fatalf("oversized body was altered: %q", rec.Body.String())
+	}
+}
+
+func TestUnknownTransformNameRejected(t *testing.T) {
+	routes := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(routes, []byte("path=/api/ backend=http://x:1 resp-transform=nope\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewProxyServer(&Config{Backend: "http://x:1", RouteFile: routes}, slog.Default())
+	if err == nil || !strings.Contains(err.Error(), "unknown transform") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackendTransportConfig(t *testing.T) {
+	cfg, err := parseConfig([]string{
+		"-pool-max-idle", "10",
+		"-pool-max-idle-per-host", "4",
+		"-pool-max-per-host", "8",
+		"-idle-conn-timeout", "1m",
+		"-tls-handshake-timeout", "3s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, cfg)
+	tr := p.newBackendTransport("")
+	if tr.MaxIdleConns != 10 || tr.MaxIdleConnsPerHost != 4 || tr.MaxConnsPerHost != 8 {
+		t.Errorf("pool sizes = %d/%d/%d", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost)
+	}
+	if tr.IdleConnTimeout != time.Minute || tr.TLSHandshakeTimeout != 3*time.Second {
+		t.Errorf("timeouts = %v/%v", tr.IdleConnTimeout, tr.TLSHandshakeTimeout)
+	}
+}
+
+func TestBackendTransportDialMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	p := newTestProxy(t, &Config{Backend: backend.URL, DialTimeout: 5 * time.Second, RateLimitRPS: 100, RateLimitBurst: 100})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_backend_dials_total`) == 0 {
+		t.Error("dial counter not incremented")
+	}
+	if p.metrics.Gauge(`clawdbot_proxy_backend_conns_open`) < 1 {
+		t.Error("open connection gauge not tracking the pooled conn")
+	}
+}
+
+func TestBackendTransportDialErrorMetric(t *testing.T) {
+	p := newTestProxy(t, &Config{Backend: "http://127.0.0.1:1", DialTimeout: time.Second, RateLimitRPS: 100, RateLimitBurst: 100})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+	if p.metrics.Counter(`clawdbot_proxy_backend_dial_errors_total`) == 0 {
+		t.Error("dial error counter not incremented")
+	}
+}
+
+func TestAdminPoolEndpoint(t *testing.T) {
+	p := newTestProxy(t, &Config{PoolMaxIdle: 7, PoolMaxIdlePerHost: 3})
+	rec := httptest.NewRecorder()
+	p.newAdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/admin/pool", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `"max_idle":7`) || !strings.Contains(body, `"dial_errors":0`) {
+		t.Errorf("pool view = %q", body)
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	// A stale socket from a previous run must not block startup.
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Listen: "unix:" + path, UnixSocketMode: 0o660}
+	ln, err := listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o660 {
+		t.Errorf("socket mode = %o, want 0660", perm)
+	}
+	ln.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("socket file must be unlinked on close")
+	}
+}
+
+func TestProxyToUnixBackend(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "gateway.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	backend := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "via %s", r.URL.Path)
+	})}
+	go backend.Serve(ln)
+	defer backend.Close()
+
+	cfg, err := parseConfig([]string{"-backend", "unix:" + socket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxyServer(cfg, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "via /api/ping" {
+		t.Errorf("got %d %q, want 200 %q", resp.StatusCode, body, "via /api/ping")
+	}
+}
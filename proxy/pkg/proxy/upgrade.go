@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// upgradeFDEnv tells a freshly exec'd child which inherited fd carries the
+// listening socket. It uses our own variable rather than LISTEN_FDS because
+// systemd's protocol pins LISTEN_PID to a pid we cannot know before exec.
+const upgradeFDEnv = "CLAWDBOT_PROXY_UPGRADE_FD"
+
+// inheritedListener returns the listener handed down by a parent process
+// during a SIGUSR2 binary upgrade, or nil when starting fresh.
+func inheritedListener() (net.Listener, error) {
+	fdStr := os.Getenv(upgradeFDEnv)
+	if fdStr == "" {
+		return nil, nil
+	}
+	os.Unsetenv(upgradeFDEnv)
+	var fd int
+	if _, err := fmt.Sscanf(fdStr, "%d", &fd); err != nil || fd < 3 {
+		return nil, fmt.Errorf("upgrade: invalid %s %q", upgradeFDEnv, fdStr)
+	}
+	f := os.NewFile(uintptr(fd), "upgrade-listener")
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("upgrade: %w", err)
+	}
+	return ln, nil
+}
+
+// forkUpgrade re-execs the (possibly replaced) binary with the listener fd
+// inherited, so the child accepts new connections on the same socket while
+// the parent drains. Active WebSocket sessions stay with the parent until
+// they end or the drain deadline forces them closed.
+func forkUpgrade(ln net.Listener) (*os.Process, error) {
+	filer, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("upgrade: listener %T cannot be inherited", ln)
+	}
+	f, err := filer.File()
+	if err != nil {
+		return nil, fmt.Errorf("upgrade: duplicating listener fd: %w", err)
+	}
+	defer f.Close()
+	if ul, ok := ln.(*net.UnixListener); ok {
+		// The child owns the socket path now; the parent's close must not
+		// unlink it.
+		ul.SetUnlinkOnClose(false)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("upgrade: %w", err)
+	}
+	// The dup'd fd lands at index 3 of Files.
+	proc, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   append(os.Environ(), fmt.Sprintf("%s=3", upgradeFDEnv)),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, f},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upgrade: starting %s: %w", exe, err)
+	}
+	return proc, nil
+}
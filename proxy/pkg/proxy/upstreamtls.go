@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// upstreamTLSConfig builds the TLS client configuration used toward an
+// HTTPS backend: a custom CA bundle for private gateway certs, an optional
+// client certificate for mTLS, and a development-only skip-verify escape
+// hatch. Returns nil when none of the options are set so the transport
+// keeps system defaults.
+func upstreamTLSConfig(cfg *Config) (*tls.Config, error) {
+	if cfg.UpstreamCAFile == "" && cfg.UpstreamClientCert == "" && !cfg.UpstreamSkipVerify {
+		return nil, nil
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.UpstreamCAFile != "" {
+		pem, err := os.ReadFile(cfg.UpstreamCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading upstream CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("upstream CA bundle %s: no certificates found", cfg.UpstreamCAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if (cfg.UpstreamClientCert == "") != (cfg.UpstreamClientKey == "") {
+		return nil, fmt.Errorf("-upstream-client-cert and -upstream-client-key must be set together")
+	}
+	if cfg.UpstreamClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.UpstreamClientCert, cfg.UpstreamClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading upstream client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	tc.InsecureSkipVerify = cfg.UpstreamSkipVerify
+	return tc, nil
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key in PEM form and
+// returns their paths.
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-gateway"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestUpstreamTLSDisabled(t *testing.T) {
+	tc, err := upstreamTLSConfig(&Config{})
+	if err != nil || tc != nil {
+		t.Errorf("got %v, %v; want nil config for default settings", tc, err)
+	}
+}
+
+func TestUpstreamTLSCustomCA(t *testing.T) {
+	certFile, _ := writeTestCert(t)
+	tc, err := upstreamTLSConfig(&Config{UpstreamCAFile: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.RootCAs == nil {
+		t.Error("custom CA bundle not loaded")
+	}
+	if tc.InsecureSkipVerify {
+		t.Error("skip-verify must stay off")
+	}
+}
+
+func TestUpstreamTLSClientCert(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	tc, err := upstreamTLSConfig(&Config{UpstreamClientCert: certFile, UpstreamClientKey: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tc.Certificates) != 1 {
+		t.Errorf("client certificates = %d, want 1", len(tc.Certificates))
+	}
+}
+
+func TestUpstreamTLSClientCertRequiresKey(t *testing.T) {
+	certFile, _ := writeTestCert(t)
+	if _, err := upstreamTLSConfig(&Config{UpstreamClientCert: certFile}); err == nil {
+		t.Error("cert without key should fail")
+	}
+}
+
+func TestUpstreamTLSBadCA(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bad, []byte("not a cert"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upstreamTLSConfig(&Config{UpstreamCAFile: bad}); err == nil {
+		t.Error("garbage CA bundle should fail")
+	}
+}
+
+func TestUpstreamTLSSkipVerify(t *testing.T) {
+	tc, err := upstreamTLSConfig(&Config{UpstreamSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tc.InsecureSkipVerify {
+		t.Error("skip-verify not applied")
+	}
+}
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// vhost is one named site. It supplies per-host defaults that apply when a
+// route does not name its own backend or static dir: where to forward, what
+// to serve, which certificate to present, and how hard to rate limit.
+type vhost struct {
+	name      string
+	hosts     []string // exact hosts or "*.suffix" patterns
+	backend   *url.URL
+	socket    string // set when the backend is a unix: address
+	proxy     *httputil.ReverseProxy
+	staticDir string
+	cert      *tls.Certificate // presented via SNI when set
+	rps       float64          // per-IP rate limit override; 0 uses global
+	burst     int
+}
+
+type vhostTable struct {
+	sites []*vhost
+}
+
+// Site file format, one site per line:
+//
+//	site main  hosts=claw.example,www.claw.example backend=http://127.0.0.1:18790 static=/srv/main
+//	site beta  hosts=*.beta.claw.example backend=http://127.0.0.1:18890 cert=/etc/tls/beta.crt key=/etc/tls/beta.key rate-limit=10 rate-limit-burst=20
+func parseVHostFile(path string) (*vhostTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &vhostTable{}
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		vh, err := parseVHostLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		t.sites = append(t.sites, vh)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parseVHostLine(line string) (*vhost, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "site" {
+		return nil, fmt.Errorf("want \"site <name> key=value...\"")
+	}
+	vh := &vhost{name: fields[1]}
+	var certFile, keyFile string
+	for _, tok := range fields[2:] {
+		key, value, ok := strings.Cut(tok, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed token %q", tok)
+		}
+		switch key {
+		case "hosts":
+			for _, h := range splitCommaList(value) {
+				vh.hosts = append(vh.hosts, strings.ToLower(h))
+			}
+		case "backend":
+			if path, ok := strings.CutPrefix(value, "unix:"); ok {
+				vh.socket = path
+				value = "http://unix"
+			}
+			u, err := url.Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("backend %q: %w", value, err)
+			}
+			vh.backend = u
+		case "static":
+			vh.staticDir = value
+		case "cert":
+			certFile = value
+		case "key":
+			keyFile = value
+		case "rate-limit":
+			rps, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("rate-limit %q: %w", value, err)
+			}
+			vh.rps = rps
+		case "rate-limit-burst":
+			burst, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("rate-limit-burst %q: %w", value, err)
+			}
+			vh.burst = burst
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if len(vh.hosts) == 0 {
+		return nil, fmt.Errorf("site %s has no hosts=", vh.name)
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("site %s: cert= and key= must be set together", vh.name)
+	}
+	if vh.rps > 0 && vh.burst == 0 {
+		// Same burst-to-rate ratio as the global flag defaults.
+		vh.burst = int(vh.rps * 2)
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("site %s: %w", vh.name, err)
+		}
+		vh.cert = &cert
+	}
+	return vh, nil
+}
+
+// match returns the first site claiming the host, or nil.
+func (t *vhostTable) match(host string) *vhost {
+	if t == nil {
+		return nil
+	}
+	for _, vh := range t.sites {
+		for _, pattern := range vh.hosts {
+			if hostMatches(pattern, host) {
+				return vh
+			}
+		}
+	}
+	return nil
+}
+
+// buildVHostProxies creates the per-site reverse proxies, sharing the tuned
+// transport unless the site talks to its own unix socket.
+func (p *ProxyServer) buildVHostProxies() {
+	if p.vhosts == nil {
+		return
+	}
+	for _, vh := range p.vhosts.sites {
+		if vh.backend == nil {
+			continue
+		}
+		vh.proxy = p.newReverseProxy(vh.backend)
+		if vh.socket != "" {
+			rp := *vh.proxy
+			rp.Transport = p.newBackendTransport(vh.socket)
+			vh.proxy = &rp
+		}
+	}
+}
+
+// getCertificate selects a site certificate by SNI, falling back to the
+// default certificate from -tls-cert.
+func (p *ProxyServer) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if p.vhosts != nil {
+		name := strings.ToLower(hello.ServerName)
+		for _, vh := range p.vhosts.sites {
+			if vh.cert == nil {
+				continue
+			}
+			for _, pattern := range vh.hosts {
+				if hostMatches(pattern, name) {
+					return vh.cert, nil
+				}
+			}
+		}
+	}
+	if p.certs != nil {
+		return p.certs.current(), nil
+	}
+	if p.defaultCert != nil {
+		return p.defaultCert, nil
+	}
+	return nil, fmt.Errorf("no certificate for server name %q", hello.ServerName)
+}
+
+// tlsServerConfig builds the listener TLS configuration with SNI support.
+func (p *ProxyServer) tlsServerConfig() (*tls.Config, error) {
+	if p.cfg.TLSCert != "" {
+		certs, err := newCertWatcher(p.cfg.TLSCert, p.cfg.TLSKey, p.metrics, p.log, p.hooks)
+		if err != nil {
+			return nil, err
+		}
+		p.certs = certs
+	}
+	tc := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: p.getCertificate,
+	}
+	p.applyClientMTLS(tc)
+	return tc, nil
+}
+
+// hasTLS reports whether the listener should terminate TLS: either a default
+// certificate or at least one site certificate is configured.
+func (p *ProxyServer) hasTLS() bool {
+	if p.cfg.TLSCert != "" {
+		return true
+	}
+	if p.vhosts != nil {
+		for _, vh := range p.vhosts.sites {
+			if vh.cert != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
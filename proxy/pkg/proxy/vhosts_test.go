@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func parseVHosts(t *testing.T, content string) *vhostTable {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sites.conf")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	table, err := parseVHostFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestVHostMatching(t *testing.T) {
+	table := parseVHosts(t, `
+site main hosts=claw.example,www.claw.example backend=http://main:1
+site beta hosts=*.beta.claw.example backend=http://beta:1 rate-limit=10
+`)
+	if vh := table.match("www.claw.example"); vh == nil || vh.name != "main" {
+		t.Errorf("www.claw.example: got %+v", vh)
+	}
+	if vh := table.match("x.beta.claw.example"); vh == nil || vh.name != "beta" {
+		t.Errorf("wildcard: got %+v", vh)
+	}
+	if vh := table.match("other.example"); vh != nil {
+		t.Errorf("unknown host must not match, got %+v", vh)
+	}
+}
+
+func TestVHostRateLimitDefaults(t *testing.T) {
+	table := parseVHosts(t, "site beta hosts=beta.example backend=http://b:1 rate-limit=10\n")
+	vh := table.match("beta.example")
+	if vh.rps != 10 || vh.burst != 20 {
+		t.Errorf("rps/burst = %v/%v, want 10/20", vh.rps, vh.burst)
+	}
+}
+
+func TestVHostUnixBackend(t *testing.T) {
+	table := parseVHosts(t, "site s hosts=s.example backend=unix:/run/s.sock\n")
+	vh := table.match("s.example")
+	if vh.socket != "/run/s.sock" || vh.backend.Host != "unix" {
+		t.Errorf("socket = %q, backend = %v", vh.socket, vh.backend)
+	}
+}
+
+func TestVHostParseErrors(t *testing.T) {
+	for _, line := range []string{
+		"route x hosts=a backend=http://x:1", // wrong directive
+		"site x backend=http://x:1",          // no hosts
+		"site x hosts=a cert=/only-cert.pem", // cert without key
+		"site x hosts=a rate-limit=abc",
+	} {
+		if _, err := parseVHostLine(line); err == nil {
+			t.Errorf("parseVHostLine(%q) succeeded, want error", line)
+		}
+	}
+}
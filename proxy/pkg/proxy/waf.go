@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A small WAF. The public endpoint gets a constant drizzle of scanner
+// traffic (wp-login probes, .env fetches, traversal attempts) that is
+// cheap to recognize before auth and routing run. -waf turns on a bundled
+// ruleset plus a few hardcoded anomaly checks (null bytes, oversized
+// headers, nonsense methods); -waf-rules adds site-specific rules on top.
+//
+// Rule file format, one rule per line, all matchers must hold:
+//
+//	id=env-probe block path~(?i)/\.env
+//	id=sqlmap block header=User-Agent~(?i)sqlmap
+//	id=odd-verb log method=TRACE,TRACK
+//	id=big-upload tag body~(?i)<script
+//
+// Actions: block answers 403 (and counts an offense toward an automatic
+// ban), log records the match and lets the request through, tag appends
+// the rule id to the X-Claw-Waf-Tags request header for the backend.
+
+const (
+	wafActionBlock = "block"
+	wafActionLog   = "log"
+	wafActionTag   = "tag"
+
+	// wafMaxHeaderSize blocks any single header value larger than this;
+	// legitimate clients have no business sending one.
+	wafMaxHeaderSize = 8 << 10
+	// wafBodySniffLimit bounds how much request body a body~ rule reads.
+	wafBodySniffLimit = 64 << 10
+
+	wafTagHeader = "X-Claw-Waf-Tags"
+)
+
+type wafRule struct {
+	id         string
+	action     string
+	pathRE     *regexp.Regexp
+	headerName string
+	headerRE   *regexp.Regexp
+	bodyRE     *regexp.Regexp
+	methods    map[string]bool
+}
+
+type wafEngine struct {
+	rules []*wafRule
+}
+
+// wafStandardMethods is the set a normal HTTP client uses; anything else
+// is treated as an anomaly and blocked outright.
+var wafStandardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodOptions: true,
+}
+
+// defaultWAFRules covers the scanner traffic every public endpoint sees.
+func defaultWAFRules() []*wafRule {
+	mustRule := func(line string) *wafRule {
+		rule, err := parseWAFRule(line)
+		if err != nil {
+			panic("bad builtin waf rule: " + err.Error())
+		}
+		return rule
+	}
+	return []*wafRule{
+		mustRule(`id=dotfile-probe block path~(?i)/\.(env|git|svn|htaccess|aws)`),
+		mustRule(`id=php-probe block path~(?i)\.(php[0-9]?|asp|aspx|jsp)($|\?)`),
+		mustRule(`id=admin-panel-probe block path~(?i)/(wp-(login|admin|content)|phpmyadmin|cgi-bin|vendor/phpunit)`),
+		mustRule(`id=path-traversal block path~\.\./`),
+		mustRule(`id=scanner-ua block header=User-Agent~(?i)(sqlmap|nikto|nmap|masscan|zgrab|dirbuster|gobuster)`),
+	}
+}
+
+func newWAFEngine(rulePath string) (*wafEngine, error) {
+	e := &wafEngine{rules: defaultWAFRules()}
+	if rulePath == "" {
+		return e, nil
+	}
+	f, err := os.Open(rulePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rule, err := parseWAFRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", rulePath, lineNo, err)
+		}
+		e.rules = append(e.rules, rule)
+	}
+	return e, sc.Err()
+}
+
+func parseWAFRule(line string) (*wafRule, error) {
+	rule := &wafRule{}
+	for _, tok := range splitRouteTokens(line) {
+		key, value, hasValue := strings.Cut(tok, "=")
+		switch {
+		case key == "id" && hasValue:
+			rule.id = value
+		case tok == wafActionBlock || tok == wafActionLog || tok == wafActionTag:
+			rule.action = tok
+		case strings.HasPrefix(tok, "path~"):
+			re, err := regexp.Compile(strings.TrimPrefix(tok, "path~"))
+			if err != nil {
+				return nil, fmt.Errorf("path regex: %w", err)
+			}
+			rule.pathRE = re
+		case key == "header" && hasValue:
+			name, expr, ok := strings.Cut(value, "~")
+			if !ok {
+				return nil, fmt.Errorf("header matcher %q: want Name~regex", value)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("header regex: %w", err)
+			}
+			rule.headerName, rule.headerRE = http.CanonicalHeaderKey(name), re
+		case strings.HasPrefix(tok, "body~"):
+			re, err := regexp.Compile(strings.TrimPrefix(tok, "body~"))
+			if err != nil {
+				return nil, fmt.Errorf("body regex: %w", err)
+			}
+			rule.bodyRE = re
+		case key == "method" && hasValue:
+			rule.methods = make(map[string]bool)
+			for _, m := range splitCommaList(value) {
+				rule.methods[strings.ToUpper(m)] = true
+			}
+		default:
+			return nil, fmt.Errorf("unknown token %q", tok)
+		}
+	}
+	if rule.id == "" {
+		return nil, fmt.Errorf("rule has no id")
+	}
+	if rule.action == "" {
+		return nil, fmt.Errorf("rule %q has no action (block, log, tag)", rule.id)
+	}
+	if rule.pathRE == nil && rule.headerRE == nil && rule.bodyRE == nil && rule.methods == nil {
+		return nil, fmt.Errorf("rule %q has no matcher", rule.id)
+	}
+	return rule, nil
+}
+
+// match evaluates all configured matchers; body holds the sniffed request
+// body (nil when no body rule needs it).
+func (rule *wafRule) match(r *http.Request, body []byte) bool {
+	if rule.methods != nil && !rule.methods[r.Method] {
+		return false
+	}
+	if rule.pathRE != nil && !rule.pathRE.MatchString(r.URL.RequestURI()) {
+		return false
+	}
+	if rule.headerRE != nil {
+		matched := false
+		for _, v := range r.Header.Values(rule.headerName) {
+			if rule.headerRE.MatchString(v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if rule.bodyRE != nil && !rule.bodyRE.Match(body) {
+		return false
+	}
+	return true
+}
+
+// anomaly runs the hardcoded checks; a non-empty result names the problem.
+func wafAnomaly(r *http.Request) string {
+	if strings.ContainsRune(r.URL.RequestURI(), 0) ||
+		strings.Contains(r.URL.RequestURI(), "%00") {
+		return "null byte in request target"
+	}
+	if !wafStandardMethods[r.Method] {
+		return "nonstandard method " + r.Method
+	}
+	for _, vals := range r.Header {
+		for _, v := range vals {
+			if len(v) > wafMaxHeaderSize {
+				return "oversized header value"
+			}
+		}
+	}
+	return ""
+}
+
+// needsBody reports whether any rule wants to inspect the request body.
+func (e *wafEngine) needsBody() bool {
+	for _, rule := range e.rules {
+		if rule.bodyRE != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWAF evaluates the anomaly checks and the ruleset. Returns false
+// when the request was blocked (and answered).
+func (p *ProxyServer) checkWAF(w http.ResponseWriter, r *http.Request) bool {
+	if p.waf == nil {
+		return true
+	}
+	if reason := wafAnomaly(r); reason != "" {
+		p.wafBlock(w, r, "anomaly", reason)
+		return false
+	}
+	var body []byte
+	if p.waf.needsBody() && r.Body != nil && r.ContentLength != 0 {
+		body, _ = io.ReadAll(io.LimitReader(r.Body, wafBodySniffLimit))
+		// Reassemble so the backend still sees the full body.
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	}
+	r.Header.Del(wafTagHeader) // clients cannot pre-seed tags
+	for _, rule := range p.waf.rules {
+		if !rule.match(r, body) {
+			continue
+		}
+		p.metrics.Inc(`clawdbot_proxy_waf_matches_total`)
+		switch rule.action {
+		case wafActionBlock:
+			p.wafBlock(w, r, rule.id, "rule matched")
+			return false
+		case wafActionLog:
+			p.reqLog(r).Warn("waf rule matched", "rule", rule.id,
+				"path", r.URL.Path, "client", p.clientIP(r))
+		case wafActionTag:
+			if tags := r.Header.Get(wafTagHeader); tags != "" {
+				r.Header.Set(wafTagHeader, tags+","+rule.id)
+			} else {
+				r.Header.Set(wafTagHeader, rule.id)
+			}
+		}
+	}
+	return true
+}
+
+func (p *ProxyServer) wafBlock(w http.ResponseWriter, r *http.Request, rule, reason string) {
+	p.metrics.Inc(`clawdbot_proxy_waf_blocked_total`)
+	p.strike(r, "waf: "+rule)
+	p.reqLog(r).Warn("waf blocked request", "rule", rule, "reason", reason,
+		"method", r.Method, "path", r.URL.Path, "client", p.clientIP(r))
+	p.httpError(w, r, http.StatusForbidden, "request blocked")
+}
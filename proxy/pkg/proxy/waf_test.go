@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func wafRequest(p *ProxyServer, method, target string, header http.Header) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, nil)
+	for name, vals := range header {
+		req.Header[name] = vals
+	}
+	p.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWAFDefaultRulesBlockScanners(t *testing.T) {
+	p := newTestProxy(t, &Config{WAF: true})
+	for _, target := range []string{
+		"/.env",
+		"/wp-login.php",
+		"/cgi-bin/test",
+		"/api/../../etc/passwd",
+	} {
+		// Build the request with an unsanitized URL so traversal survives.
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL = &url.URL{Path: target}
+		p.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s = %d, want 403", target, rec.Code)
+		}
+	}
+	if rec := wafRequest(p, "GET", "/api/status", nil); rec.Code == http.StatusForbidden {
+		t.Errorf("legitimate request blocked: %d", rec.Code)
+	}
+}
+
+func TestWAFScannerUserAgent(t *testing.T) {
+	p := newTestProxy(t, &Config{WAF: true})
+	h := http.Header{"User-Agent": {"sqlmap/1.7"}}
+	if rec := wafRequest(p, "GET", "/api/status", h); rec.Code != http.StatusForbidden {
+		t.Fatalf("sqlmap UA = %d, want 403", rec.Code)
+	}
+}
+
+func TestWAFAnomalies(t *testing.T) {
+	p := newTestProxy(t, &Config{WAF: true})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.URL.RawQuery = "q=%00"
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("null byte = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("X-Junk", strings.Repeat("a", wafMaxHeaderSize+1))
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("oversized header = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("BREW", "/api/status", nil)
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("nonstandard method = %d, want 403", rec.Code)
+	}
+}
+
+func TestWAFCustomRulesAndActions(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "waf")
+	content := "id=tag-curl tag header=User-Agent~(?i)curl\n" +
+		"id=block-probe block path~^/api/secret\n" +
+		"# comment\n"
+	if err := os.WriteFile(rules, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProxy(t, &Config{WAF: true, WAFRuleFile: rules})
+
+	h := http.Header{"User-Agent": {"curl/8.0"}}
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header = h
+	if !p.checkWAF(httptest.NewRecorder(), req) {
+		t.Fatal("tag action should not block")
+	}
+	if got := req.Header.Get(wafTagHeader); got != "tag-curl" {
+		t.Fatalf("tag header = %q", got)
+	}
+
+	if rec := wafRequest(p, "GET", "/api/secret/x", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("custom block rule = %d, want 403", rec.Code)
+	}
+}
+
+func TestWAFBlocksCountAsBanOffenses(t *testing.T) {
+	cfg := banConfig("")
+	cfg.WAF = true
+	p := newTestProxy(t, cfg)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/wp-login.php", nil)
+		req.RemoteAddr = "198.51.100.4:9999"
+		p.ServeHTTP(rec, req)
+	}
+	if banned, _ := p.bans.banned("198.51.100.4"); !banned {
+		t.Fatal("repeated WAF blocks should ban the IP")
+	}
+}
+
+func TestParseWAFRuleErrors(t *testing.T) {
+	for _, line := range []string{
+		"block path~x",          // no id
+		"id=x path~y",           // no action
+		"id=x block",            // no matcher
+		"id=x block path~[",     // bad regex
+		"id=x block header=Foo", // header without regex
+	} {
+		if _, err := parseWAFRule(line); err == nil {
+			t.Errorf("parseWAFRule(%q) succeeded, want error", line)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WebAssembly plugins attach small filters at fixed hook points without
+// recompiling the proxy:
+//
+//	-wasm-plugins "/etc/clawdbot/authz.wasm=on-request,/etc/clawdbot/scrub.wasm=on-response"
+//
+// Modules run on the interpreter in wasmvm.go and follow a deliberately
+// small ABI: each module exports a function named after its hook with
+// dashes as underscores (on_request, on_response, on_ws_message) taking
+// (ptr i32, len i32) and returning i32. The proxy writes the hook payload
+// into the module's memory above its initial size and passes its address:
+//
+//   - on_request gets "<METHOD> <request-target>\n<host>\n"; return 0 to
+//     allow or an HTTP status in 400..599 to reject with that status.
+//   - on_response gets the upstream status code as decimal text; return 0
+//     to keep it or a status in 100..599 to replace it.
+//   - on_ws_message gets one relayed data frame's payload (unmasked);
+//     return 0 to forward the frame or anything else to drop it.
+//
+// Any other return value, and any trap, counts as a plugin error: request
+// hooks fail closed like Lua access hooks, the other hooks log and let
+// traffic through unchanged.
+
+// Hook points a plugin can attach to.
+const (
+	wasmHookRequest   = "on-request"    // before the request is forwarded
+	wasmHookResponse  = "on-response"   // before the response is written
+	wasmHookWSMessage = "on-ws-message" // per relayed WebSocket data frame
+)
+
+var wasmHooks = []string{wasmHookRequest, wasmHookResponse, wasmHookWSMessage}
+
+// wasmMagic is the module preamble: "\0asm" followed by version 1.
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// wasmPlugin is one configured module, loaded and validated but not yet
+// instantiated.
+type wasmPlugin struct {
+	path   string
+	hook   string
+	module []byte
+}
+
+// wasmFilter is one instantiated plugin bound to its hook entry point.
+type wasmFilter struct {
+	path  string
+	entry string
+	inst  *wasmInstance
+}
+
+// invoke stages the payload in the instance's memory and calls the entry
+// point. Invocations are serialised per instance since memory is shared.
+func (f *wasmFilter) invoke(payload []byte) (int32, error) {
+	f.inst.mu.Lock()
+	defer f.inst.mu.Unlock()
+	ptr, err := f.inst.stageArg(payload)
+	if err != nil {
+		return 0, err
+	}
+	v, err := f.inst.call(f.entry, int64(ptr), int64(len(payload)))
+	return int32(v), err
+}
+
+// wasmEngine holds the instantiated plugins grouped by hook point.
+type wasmEngine struct {
+	hooks map[string][]*wasmFilter
+}
+
+func newWasmEngine() *wasmEngine {
+	return &wasmEngine{hooks: map[string][]*wasmFilter{}}
+}
+
+// filters returns the plugins for one hook; nil-safe so call sites need
+// no -wasm-plugins guard.
+func (e *wasmEngine) filters(hook string) []*wasmFilter {
+	if e == nil {
+		return nil
+	}
+	return e.hooks[hook]
+}
+
+// instantiate decodes and instantiates one module and checks that it
+// exports its hook's entry point with the (i32, i32) -> i32 signature.
+func (e *wasmEngine) instantiate(p wasmPlugin) error {
+	mod, err := decodeWasmModule(p.module)
+	if err != nil {
+		return err
+	}
+	inst, err := newWasmInstance(mod)
+	if err != nil {
+		return err
+	}
+	entry := strings.ReplaceAll(p.hook, "-", "_")
+	exp, ok := mod.exports[entry]
+	if !ok || exp.kind != 0 || exp.index >= uint32(len(mod.funcs)) {
+		return fmt.Errorf("module exports no %s function", entry)
+	}
+	ft := mod.types[mod.funcs[exp.index].typeIdx]
+	if len(ft.params) != 2 || ft.params[0] != wasmTypeI32 || ft.params[1] != wasmTypeI32 ||
+		len(ft.results) != 1 || ft.results[0] != wasmTypeI32 {
+		return fmt.Errorf("%s must have signature (i32, i32) -> i32", entry)
+	}
+	e.hooks[p.hook] = append(e.hooks[p.hook], &wasmFilter{path: p.path, entry: entry, inst: inst})
+	return nil
+}
+
+// parseWasmPlugins turns "-wasm-plugins" entries ("<path>=<hook>") into
+// loaded plugins, verifying each file exists and starts with the wasm
+// module preamble so typos surface at startup rather than at traffic
+// time.
+func parseWasmPlugins(entries []string) ([]wasmPlugin, error) {
+	var plugins []wasmPlugin
+	for _, entry := range entries {
+		path, hook, ok := strings.Cut(entry, "=")
+		if !ok || path == "" || hook == "" {
+			return nil, fmt.Errorf("wasm-plugins: entry %q must be <path>=<hook>", entry)
+		}
+		found := false
+		for _, h := range wasmHooks {
+			if hook == h {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("wasm-plugins: unknown hook %q (known: %s)", hook, strings.Join(wasmHooks, ", "))
+		}
+		module, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("wasm-plugins: %w", err)
+		}
+		if !bytes.HasPrefix(module, wasmMagic) {
+			return nil, fmt.Errorf("wasm-plugins: %s is not a WebAssembly v1 module", path)
+		}
+		plugins = append(plugins, wasmPlugin{path: path, hook: hook, module: module})
+	}
+	return plugins, nil
+}
+
+// loadWasmPlugins loads the configured modules and instantiates them on
+// the engine. Called from NewProxyServer when -wasm-plugins is set.
+func loadWasmPlugins(entries []string) (*wasmEngine, error) {
+	plugins, err := parseWasmPlugins(entries)
+	if err != nil {
+		return nil, err
+	}
+	eng := newWasmEngine()
+	for _, p := range plugins {
+		if err := eng.instantiate(p); err != nil {
+			return nil, fmt.Errorf("wasm-plugins: instantiating %s: %w", p.path, err)
+		}
+	}
+	return eng, nil
+}
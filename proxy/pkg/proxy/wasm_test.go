@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeWasmModule(t *testing.T, body []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	if err := os.WriteFile(path, body, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseWasmPlugins(t *testing.T) {
+	mod := writeWasmModule(t, append(append([]byte(nil), wasmMagic...), 0x01))
+
+	plugins, err := parseWasmPlugins([]string{mod + "=on-request"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plugins) != 1 || plugins[0].hook != wasmHookRequest || len(plugins[0].module) != 9 {
+		t.Fatalf("plugins = %+v, want one on-request module", plugins)
+	}
+
+	for entry, wantErr := range map[string]string{
+		mod:                          "must be <path>=<hook>",
+		mod + "=on-teardown":         "unknown hook",
+		"/does/not/exist=on-request": "no such file",
+	} {
+		if _, err := parseWasmPlugins([]string{entry}); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("parseWasmPlugins(%q) = %v, want %q", entry, err, wantErr)
+		}
+	}
+
+	notWasm := writeWasmModule(t, []byte("#!/bin/sh\n"))
+	if _, err := parseWasmPlugins([]string{notWasm + "=on-response"}); err == nil || !strings.Contains(err.Error(), "not a WebAssembly v1 module") {
+		t.Errorf("non-wasm file accepted: %v", err)
+	}
+}
+
+// wasmFirstByteFilter builds a module whose hook export compares the first
+// payload byte against b and returns ret on a match, 0 otherwise.
+func wasmFirstByteFilter(entry string, b byte, ret int64) []byte {
+	instrs := wasmCat(
+		[]byte{0x20, 0x00, 0x2d, 0x00, 0x00},  // local.get 0; i32.load8_u
+		[]byte{0x41}, wasmSlebBytes(int64(b)), // i32.const b
+		[]byte{0x46, 0x04, 0x7f}, // i32.eq; if (result i32)
+		[]byte{0x41}, wasmSlebBytes(ret),
+		[]byte{0x05, 0x41, 0x00, 0x0b}, // else; i32.const 0; end
+	)
+	sig := []byte{wasmTypeI32, wasmTypeI32}
+	return wasmOneFuncMod(entry, sig, []byte{wasmTypeI32}, 0, instrs, 0, nil)
+}
+
+func TestWasmRequestHookDenies(t *testing.T) {
+	// Deny requests whose payload starts with 'P' (POST, PUT, PATCH).
+	mod := writeWasmModule(t, wasmFirstByteFilter("on_request", 'P', 403))
+	p := newTestProxy(t, &Config{WasmPlugins: []string{mod + "=on-request"}})
+
+	rec := httptest.NewRecorder()
+	if !p.runWasmRequestHooks(rec, httptest.NewRequest("GET", "/api/x", nil)) {
+		t.Fatal("GET was denied")
+	}
+	rec = httptest.NewRecorder()
+	if p.runWasmRequestHooks(rec, httptest.NewRequest("POST", "/api/x", nil)) {
+		t.Fatal("POST was allowed")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("deny status = %d, want 403", rec.Code)
+	}
+}
+
+func TestWasmRequestHookFailsClosedOnBadVerdict(t *testing.T) {
+	// A verdict outside 0 and 400..599 is a plugin bug, not an allow.
+	mod := writeWasmModule(t, wasmFirstByteFilter("on_request", 'G', 7))
+	p := newTestProxy(t, &Config{WasmPlugins: []string{mod + "=on-request"}})
+	rec := httptest.NewRecorder()
+	if p.runWasmRequestHooks(rec, httptest.NewRequest("GET", "/api/x", nil)) {
+		t.Fatal("bad verdict allowed the request")
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+}
+
+func TestWasmResponseHookOverridesStatus(t *testing.T) {
+	// Replace any 5xx status (payload starts with '5') with 503.
+	mod := writeWasmModule(t, wasmFirstByteFilter("on_response", '5', 503))
+	p := newTestProxy(t, &Config{WasmPlugins: []string{mod + "=on-response"}})
+
+	rec := httptest.NewRecorder()
+	w := &wasmResponseWriter{ResponseWriter: rec, p: p}
+	w.WriteHeader(http.StatusBadGateway)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	w = &wasmResponseWriter{ResponseWriter: rec, p: p}
+	w.WriteHeader(http.StatusOK)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 untouched", rec.Code)
+	}
+}
+
+func TestWasmWSMessageVerdicts(t *testing.T) {
+	mod := writeWasmModule(t, wasmFirstByteFilter("on_ws_message", 'x', 1))
+	p := newTestProxy(t, &Config{WasmPlugins: []string{mod + "=on-ws-message"}})
+	filters := p.wasm.filters(wasmHookWSMessage)
+	if len(filters) != 1 {
+		t.Fatalf("filters = %d, want 1", len(filters))
+	}
+	if ret, err := filters[0].invoke([]byte("xyz")); err != nil || ret != 1 {
+		t.Errorf("invoke(xyz) = %d, %v, want drop", ret, err)
+	}
+	if ret, err := filters[0].invoke([]byte("abc")); err != nil || ret != 0 {
+		t.Errorf("invoke(abc) = %d, %v, want forward", ret, err)
+	}
+}
+
+func TestWasmPluginEntryValidation(t *testing.T) {
+	// The module is valid wasm but exports the wrong entry point.
+	mod := writeWasmModule(t, wasmFirstByteFilter("on_response", 'x', 1))
+	cfg := &Config{Backend: "http://127.0.0.1:0", WasmPlugins: []string{mod + "=on-request"}}
+	if _, err := NewProxyServer(cfg, discardLogger()); err == nil || !strings.Contains(err.Error(), "exports no on_request") {
+		t.Fatalf("NewProxyServer = %v, want missing-export error", err)
+	}
+
+	// Right name, wrong signature.
+	sig := wasmOneFuncMod("on_request", nil, nil, 0, nil, 0, nil)
+	mod = writeWasmModule(t, sig)
+	cfg = &Config{Backend: "http://127.0.0.1:0", WasmPlugins: []string{mod + "=on-request"}}
+	if _, err := NewProxyServer(cfg, discardLogger()); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("NewProxyServer = %v, want signature error", err)
+	}
+}
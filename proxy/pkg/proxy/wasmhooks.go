@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Hook dispatch for wasm plugins: building each hook's payload, invoking
+// the filters and acting on their verdicts. The ABI itself is documented
+// in wasm.go.
+
+// wasmRequestPayload renders the on-request payload.
+func wasmRequestPayload(r *http.Request) []byte {
+	return []byte(r.Method + " " + r.URL.RequestURI() + "\n" + r.Host + "\n")
+}
+
+// runWasmRequestHooks executes every on-request plugin. Returns false when
+// a plugin answered the request (denial or plugin error).
+func (p *ProxyServer) runWasmRequestHooks(w http.ResponseWriter, r *http.Request) bool {
+	payload := wasmRequestPayload(r)
+	for _, f := range p.wasm.filters(wasmHookRequest) {
+		ret, err := f.invoke(payload)
+		if err == nil && ret != 0 && (ret < 400 || ret > 599) {
+			err = fmt.Errorf("returned %d, want 0 or an HTTP status in 400..599", ret)
+		}
+		if err != nil {
+			// A broken request filter must not fail open.
+			p.log.Error("wasm request hook failed", "plugin", f.path, "error", err)
+			p.metrics.Inc(`clawdbot_proxy_wasm_errors_total`)
+			p.httpError(w, r, http.StatusInternalServerError, "request filter failed")
+			return false
+		}
+		if ret != 0 {
+			p.metrics.Inc(`clawdbot_proxy_wasm_denies_total`)
+			p.httpError(w, r, int(ret), "denied by request filter")
+			return false
+		}
+	}
+	return true
+}
+
+// wasmResponseWriter runs the on-response plugins once, just before the
+// response headers go out; a plugin may replace the status code.
+type wasmResponseWriter struct {
+	http.ResponseWriter
+	p    *ProxyServer
+	done bool
+}
+
+func (w *wasmResponseWriter) WriteHeader(code int) {
+	if !w.done {
+		w.done = true
+		payload := []byte(strconv.Itoa(code))
+		for _, f := range w.p.wasm.filters(wasmHookResponse) {
+			ret, err := f.invoke(payload)
+			if err != nil || (ret != 0 && (ret < 100 || ret > 599)) {
+				// The response still goes out; the filter just did not run.
+				w.p.log.Error("wasm response hook failed", "plugin", f.path, "error", err, "returned", ret)
+				w.p.metrics.Inc(`clawdbot_proxy_wasm_errors_total`)
+				continue
+			}
+			if ret != 0 {
+				code = int(ret)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *wasmResponseWriter) Write(b []byte) (int, error) {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *wasmResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// wasmMaxWSFilterPayload bounds how much of a relayed frame is buffered
+// for filtering; larger frames pass through unfiltered rather than stall
+// the relay.
+const wasmMaxWSFilterPayload = 1 << 20
+
+// wasmFilterFrame relays one frame like copyFrame, but buffers data-frame
+// payloads and runs the on-ws-message plugins over them. A nonzero verdict
+// drops the frame; like chaos injection, fragmented messages are judged
+// frame by frame. Plugin errors forward the frame unchanged.
+func (p *ProxyServer) wasmFilterFrame(dst, src *wsConn, pol *wsPolicy) (byte, error) {
+	header, opcode, payloadLen, err := readFrameHeader(src.br)
+	if err != nil {
+		return 0, err
+	}
+	if pol != nil {
+		if code, reason := pol.check(opcode, payloadLen); code != 0 {
+			writeControl(src, opClose, closePayload(code, reason))
+			return opcode, fmt.Errorf("%w: %s", errWSPolicy, reason)
+		}
+	}
+	data := opcode == opText || opcode == opBinary || opcode == opContinuation
+	if !data || payloadLen > wasmMaxWSFilterPayload {
+		return opcode, forwardFrame(dst, src, header, payloadLen)
+	}
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(src.br, payload); err != nil {
+		return opcode, err
+	}
+	// Client frames arrive masked; the filter sees the clear payload while
+	// the wire bytes are forwarded untouched.
+	clear := payload
+	if len(header) >= 4 && header[1]&0x80 != 0 {
+		key := header[len(header)-4:]
+		clear = make([]byte, len(payload))
+		for i, b := range payload {
+			clear[i] = b ^ key[i%4]
+		}
+	}
+	for _, f := range p.wasm.filters(wasmHookWSMessage) {
+		ret, err := f.invoke(clear)
+		if err != nil {
+			p.log.Error("wasm ws hook failed", "plugin", f.path, "error", err)
+			p.metrics.Inc(`clawdbot_proxy_wasm_errors_total`)
+			continue
+		}
+		if ret != 0 {
+			p.metrics.Inc(`clawdbot_proxy_wasm_ws_drops_total`)
+			return opcode, nil
+		}
+	}
+	dst.wmu.Lock()
+	defer dst.wmu.Unlock()
+	if _, err := dst.Write(header); err != nil {
+		return opcode, err
+	}
+	if len(payload) > 0 {
+		if _, err := dst.Write(payload); err != nil {
+			return opcode, err
+		}
+	}
+	return opcode, nil
+}
@@ -0,0 +1,1185 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// A small WebAssembly 1.0 interpreter. The proxy carries no third-party
+// dependencies, so plugin modules run on this hand-rolled VM rather than a
+// full runtime. It covers the integer subset a filter needs — i32/i64
+// arithmetic, structured control flow, calls, linear memory, globals and
+// data segments — and rejects everything else (floats, imports, tables,
+// call_indirect) at load time with a clear error. Execution is bounded by
+// a step budget, a call-depth limit and a memory cap, so a misbehaving
+// module fails its invocation instead of wedging the proxy.
+
+const (
+	wasmPageSize = 64 * 1024
+	wasmMaxPages = 64      // 4 MiB of linear memory per instance
+	wasmMaxSteps = 1 << 22 // instruction budget per invocation
+	wasmMaxDepth = 128     // call stack depth
+)
+
+// Value types from the binary format. Floats (0x7d, 0x7c) are rejected.
+const (
+	wasmTypeI32 = 0x7f
+	wasmTypeI64 = 0x7e
+)
+
+type wasmFuncType struct {
+	params  []byte
+	results []byte
+}
+
+// wasmCtrl records the matching else/end offsets for one block/loop/if
+// opcode, precomputed at load time so branches are O(1) at run time.
+type wasmCtrl struct {
+	elsePC int // -1 when the if has no else
+	endPC  int
+}
+
+type wasmFunc struct {
+	typeIdx uint32
+	locals  int // extra locals beyond the parameters, all zero-initialised
+	body    []byte
+	ctrl    map[int]wasmCtrl
+}
+
+type wasmGlobalDef struct {
+	typ     byte
+	mutable bool
+	init    int64
+}
+
+type wasmExport struct {
+	kind  byte // 0 = function, 2 = memory
+	index uint32
+}
+
+type wasmDataSeg struct {
+	offset uint32
+	bytes  []byte
+}
+
+type wasmModule struct {
+	types   []wasmFuncType
+	funcs   []wasmFunc
+	memMin  uint32
+	hasMem  bool
+	globals []wasmGlobalDef
+	exports map[string]wasmExport
+	start   int // start function index, -1 when absent
+	data    []wasmDataSeg
+}
+
+// wasmReader walks the binary format with bounds checking.
+type wasmReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *wasmReader) more() bool { return r.pos < len(r.b) }
+
+func (r *wasmReader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, fmt.Errorf("wasm: truncated module")
+	}
+	b := r.b[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *wasmReader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)-r.pos) {
+		return nil, fmt.Errorf("wasm: truncated module")
+	}
+	b := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *wasmReader) uleb() (uint64, error) {
+	v, n := decodeUleb(r.b[r.pos:])
+	if n == 0 {
+		return 0, fmt.Errorf("wasm: bad varint")
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *wasmReader) sleb() (int64, error) {
+	v, n := decodeSleb(r.b[r.pos:])
+	if n == 0 {
+		return 0, fmt.Errorf("wasm: bad varint")
+	}
+	r.pos += n
+	return v, nil
+}
+
+func decodeUleb(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func decodeSleb(b []byte) (int64, int) {
+	var v int64
+	var shift uint
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= int64(b[i]&0x7f) << shift
+		shift += 7
+		if b[i]&0x80 == 0 {
+			if shift < 64 && b[i]&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func wasmIntType(t byte) error {
+	if t != wasmTypeI32 && t != wasmTypeI64 {
+		return fmt.Errorf("wasm: value type 0x%02x is not supported (integer types only)", t)
+	}
+	return nil
+}
+
+// decodeWasmModule parses and validates a binary module against the
+// supported subset.
+func decodeWasmModule(b []byte) (*wasmModule, error) {
+	if !bytes.HasPrefix(b, wasmMagic) {
+		return nil, fmt.Errorf("wasm: not a WebAssembly v1 module")
+	}
+	mod := &wasmModule{exports: map[string]wasmExport{}, start: -1}
+	r := &wasmReader{b: b, pos: len(wasmMagic)}
+	var typeIdxs []uint64
+	var bodies [][]byte
+	for r.more() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.uleb()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.bytes(size)
+		if err != nil {
+			return nil, err
+		}
+		s := &wasmReader{b: payload}
+		switch id {
+		case 1: // type
+			if err := mod.decodeTypes(s); err != nil {
+				return nil, err
+			}
+		case 2: // import
+			n, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				return nil, fmt.Errorf("wasm: imports are not supported; modules must be self-contained")
+			}
+		case 3: // function
+			n, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			for i := uint64(0); i < n; i++ {
+				ti, err := s.uleb()
+				if err != nil {
+					return nil, err
+				}
+				typeIdxs = append(typeIdxs, ti)
+			}
+		case 5: // memory
+			if err := mod.decodeMemory(s); err != nil {
+				return nil, err
+			}
+		case 6: // global
+			if err := mod.decodeGlobals(s); err != nil {
+				return nil, err
+			}
+		case 7: // export
+			if err := mod.decodeExports(s); err != nil {
+				return nil, err
+			}
+		case 8: // start
+			idx, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			mod.start = int(idx)
+		case 10: // code
+			n, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			for i := uint64(0); i < n; i++ {
+				size, err := s.uleb()
+				if err != nil {
+					return nil, err
+				}
+				body, err := s.bytes(size)
+				if err != nil {
+					return nil, err
+				}
+				bodies = append(bodies, body)
+			}
+		case 11: // data
+			if err := mod.decodeData(s); err != nil {
+				return nil, err
+			}
+		default:
+			// Custom, table and element sections carry nothing this VM
+			// executes; skip them.
+		}
+	}
+	if len(typeIdxs) != len(bodies) {
+		return nil, fmt.Errorf("wasm: function and code sections disagree (%d vs %d)", len(typeIdxs), len(bodies))
+	}
+	for i, ti := range typeIdxs {
+		if ti >= uint64(len(mod.types)) {
+			return nil, fmt.Errorf("wasm: function %d references unknown type %d", i, ti)
+		}
+		fn, err := decodeWasmFunc(uint32(ti), bodies[i])
+		if err != nil {
+			return nil, fmt.Errorf("wasm: function %d: %w", i, err)
+		}
+		mod.funcs = append(mod.funcs, fn)
+	}
+	if mod.start >= len(mod.funcs) {
+		return nil, fmt.Errorf("wasm: start function %d does not exist", mod.start)
+	}
+	return mod, nil
+}
+
+func (m *wasmModule) decodeTypes(s *wasmReader) error {
+	n, err := s.uleb()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		form, err := s.byte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return fmt.Errorf("wasm: bad func type form 0x%02x", form)
+		}
+		var ft wasmFuncType
+		if ft.params, err = s.valtypes(); err != nil {
+			return err
+		}
+		if ft.results, err = s.valtypes(); err != nil {
+			return err
+		}
+		if len(ft.results) > 1 {
+			return fmt.Errorf("wasm: multi-value results are not supported")
+		}
+		m.types = append(m.types, ft)
+	}
+	return nil
+}
+
+func (r *wasmReader) valtypes() ([]byte, error) {
+	n, err := r.uleb()
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range out {
+		if err := wasmIntType(t); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (m *wasmModule) decodeMemory(s *wasmReader) error {
+	n, err := s.uleb()
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		return fmt.Errorf("wasm: at most one memory is supported")
+	}
+	if n == 0 {
+		return nil
+	}
+	flags, err := s.byte()
+	if err != nil {
+		return err
+	}
+	min, err := s.uleb()
+	if err != nil {
+		return err
+	}
+	if flags&0x01 != 0 {
+		if _, err := s.uleb(); err != nil { // declared max; the VM cap applies regardless
+			return err
+		}
+	}
+	if min > wasmMaxPages {
+		return fmt.Errorf("wasm: module wants %d memory pages, cap is %d", min, wasmMaxPages)
+	}
+	m.hasMem = true
+	m.memMin = uint32(min)
+	return nil
+}
+
+func (m *wasmModule) decodeGlobals(s *wasmReader) error {
+	n, err := s.uleb()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		typ, err := s.byte()
+		if err != nil {
+			return err
+		}
+		if err := wasmIntType(typ); err != nil {
+			return err
+		}
+		mut, err := s.byte()
+		if err != nil {
+			return err
+		}
+		init, err := s.constExpr()
+		if err != nil {
+			return err
+		}
+		m.globals = append(m.globals, wasmGlobalDef{typ: typ, mutable: mut == 1, init: init})
+	}
+	return nil
+}
+
+// constExpr evaluates the "i32.const/i64.const n; end" initialiser form.
+func (r *wasmReader) constExpr() (int64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	if op != 0x41 && op != 0x42 {
+		return 0, fmt.Errorf("wasm: only constant initialiser expressions are supported")
+	}
+	v, err := r.sleb()
+	if err != nil {
+		return 0, err
+	}
+	end, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	if end != 0x0b {
+		return 0, fmt.Errorf("wasm: unterminated initialiser expression")
+	}
+	return v, nil
+}
+
+func (m *wasmModule) decodeExports(s *wasmReader) error {
+	n, err := s.uleb()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		nameLen, err := s.uleb()
+		if err != nil {
+			return err
+		}
+		name, err := s.bytes(nameLen)
+		if err != nil {
+			return err
+		}
+		kind, err := s.byte()
+		if err != nil {
+			return err
+		}
+		idx, err := s.uleb()
+		if err != nil {
+			return err
+		}
+		m.exports[string(name)] = wasmExport{kind: kind, index: uint32(idx)}
+	}
+	return nil
+}
+
+func (m *wasmModule) decodeData(s *wasmReader) error {
+	n, err := s.uleb()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		memIdx, err := s.uleb()
+		if err != nil {
+			return err
+		}
+		if memIdx != 0 {
+			return fmt.Errorf("wasm: data segment for unknown memory %d", memIdx)
+		}
+		off, err := s.constExpr()
+		if err != nil {
+			return err
+		}
+		size, err := s.uleb()
+		if err != nil {
+			return err
+		}
+		b, err := s.bytes(size)
+		if err != nil {
+			return err
+		}
+		m.data = append(m.data, wasmDataSeg{offset: uint32(off), bytes: b})
+	}
+	return nil
+}
+
+// decodeWasmFunc parses a code entry: the flattened locals followed by the
+// body, which is scanned once to reject unsupported opcodes and record the
+// else/end offset of every structured block.
+func decodeWasmFunc(typeIdx uint32, b []byte) (wasmFunc, error) {
+	s := &wasmReader{b: b}
+	groups, err := s.uleb()
+	if err != nil {
+		return wasmFunc{}, err
+	}
+	locals := 0
+	for i := uint64(0); i < groups; i++ {
+		count, err := s.uleb()
+		if err != nil {
+			return wasmFunc{}, err
+		}
+		typ, err := s.byte()
+		if err != nil {
+			return wasmFunc{}, err
+		}
+		if err := wasmIntType(typ); err != nil {
+			return wasmFunc{}, err
+		}
+		locals += int(count)
+		if locals > 1024 {
+			return wasmFunc{}, fmt.Errorf("too many locals")
+		}
+	}
+	fn := wasmFunc{typeIdx: typeIdx, locals: locals, body: b[s.pos:]}
+	if fn.ctrl, err = scanWasmBody(fn.body); err != nil {
+		return wasmFunc{}, err
+	}
+	return fn, nil
+}
+
+// scanWasmBody walks every instruction once, validating that only
+// supported opcodes appear and matching each block/loop/if with its else
+// and end.
+func scanWasmBody(body []byte) (map[int]wasmCtrl, error) {
+	ctrl := map[int]wasmCtrl{}
+	var open []int // PCs of unmatched block/loop/if opcodes
+	s := &wasmReader{b: body}
+	ended := false
+	for s.more() {
+		if ended {
+			return nil, fmt.Errorf("trailing bytes after function end")
+		}
+		pc := s.pos
+		op, _ := s.byte()
+		switch {
+		case op == 0x02 || op == 0x03 || op == 0x04: // block, loop, if
+			bt, err := s.byte()
+			if err != nil {
+				return nil, err
+			}
+			if bt != 0x40 {
+				if err := wasmIntType(bt); err != nil {
+					return nil, err
+				}
+			}
+			ctrl[pc] = wasmCtrl{elsePC: -1}
+			open = append(open, pc)
+		case op == 0x05: // else
+			if len(open) == 0 {
+				return nil, fmt.Errorf("else outside an if")
+			}
+			c := ctrl[open[len(open)-1]]
+			c.elsePC = pc
+			ctrl[open[len(open)-1]] = c
+		case op == 0x0b: // end
+			if len(open) == 0 {
+				ended = true
+				break
+			}
+			c := ctrl[open[len(open)-1]]
+			c.endPC = pc
+			ctrl[open[len(open)-1]] = c
+			open = open[:len(open)-1]
+		case op == 0x0e: // br_table
+			n, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			for i := uint64(0); i <= n; i++ {
+				if _, err := s.uleb(); err != nil {
+					return nil, err
+				}
+			}
+		case op == 0x0c || op == 0x0d || op == 0x10 || // br, br_if, call
+			(op >= 0x20 && op <= 0x24): // local/global access
+			if _, err := s.uleb(); err != nil {
+				return nil, err
+			}
+		case op >= 0x28 && op <= 0x3e: // loads and stores
+			if op == 0x2a || op == 0x2b || op == 0x38 || op == 0x39 {
+				return nil, fmt.Errorf("float opcode 0x%02x is not supported", op)
+			}
+			if _, err := s.uleb(); err != nil { // alignment hint
+				return nil, err
+			}
+			if _, err := s.uleb(); err != nil { // offset
+				return nil, err
+			}
+		case op == 0x3f || op == 0x40: // memory.size, memory.grow
+			if _, err := s.byte(); err != nil {
+				return nil, err
+			}
+		case op == 0x41: // i32.const
+			if _, err := s.sleb(); err != nil {
+				return nil, err
+			}
+		case op == 0x42: // i64.const
+			if _, err := s.sleb(); err != nil {
+				return nil, err
+			}
+		case op == 0x00 || op == 0x01 || op == 0x0f || op == 0x1a || op == 0x1b: // unreachable, nop, return, drop, select
+		case op >= 0x45 && op <= 0x5a: // integer comparisons
+		case op >= 0x67 && op <= 0x8a: // integer arithmetic
+		case op == 0xa7 || op == 0xac || op == 0xad: // wrap and extend
+		default:
+			return nil, fmt.Errorf("unsupported opcode 0x%02x at offset %d", op, pc)
+		}
+	}
+	if !ended || len(open) > 0 {
+		return nil, fmt.Errorf("unterminated function body")
+	}
+	return ctrl, nil
+}
+
+// wasmInstance is one instantiated module: its memory, globals and a lock
+// serialising invocations, since linear memory is shared state.
+type wasmInstance struct {
+	mod     *wasmModule
+	mem     []byte
+	globals []int64
+	argBase int // end of the module's initial memory; call payloads land here
+
+	mu sync.Mutex
+}
+
+func newWasmInstance(mod *wasmModule) (*wasmInstance, error) {
+	in := &wasmInstance{mod: mod, mem: make([]byte, int(mod.memMin)*wasmPageSize)}
+	for _, seg := range mod.data {
+		end := uint64(seg.offset) + uint64(len(seg.bytes))
+		if end > uint64(len(in.mem)) {
+			return nil, fmt.Errorf("wasm: data segment [%d,%d) outside memory", seg.offset, end)
+		}
+		copy(in.mem[seg.offset:], seg.bytes)
+	}
+	for _, g := range mod.globals {
+		in.globals = append(in.globals, g.init)
+	}
+	if mod.start >= 0 {
+		fuel := wasmMaxSteps
+		if _, _, err := in.exec(uint32(mod.start), nil, 0, &fuel); err != nil {
+			return nil, fmt.Errorf("wasm: start function: %w", err)
+		}
+	}
+	in.argBase = len(in.mem)
+	return in, nil
+}
+
+// stageArg copies an invocation payload into memory above the module's own
+// data, growing to the cap if needed, and returns its address. Modules
+// must not assume ownership of memory above their initial size.
+func (in *wasmInstance) stageArg(payload []byte) (int, error) {
+	need := in.argBase + len(payload)
+	if need > wasmMaxPages*wasmPageSize {
+		return 0, fmt.Errorf("wasm: payload of %d bytes exceeds the memory cap", len(payload))
+	}
+	if need > len(in.mem) {
+		pages := (need + wasmPageSize - 1) / wasmPageSize
+		in.mem = append(in.mem, make([]byte, pages*wasmPageSize-len(in.mem))...)
+	}
+	copy(in.mem[in.argBase:], payload)
+	return in.argBase, nil
+}
+
+// call invokes an exported function. The caller must hold in.mu.
+func (in *wasmInstance) call(name string, args ...int64) (int64, error) {
+	exp, ok := in.mod.exports[name]
+	if !ok || exp.kind != 0 {
+		return 0, fmt.Errorf("wasm: no exported function %q", name)
+	}
+	if exp.index >= uint32(len(in.mod.funcs)) {
+		return 0, fmt.Errorf("wasm: export %q references unknown function %d", name, exp.index)
+	}
+	ft := in.mod.types[in.mod.funcs[exp.index].typeIdx]
+	if len(args) != len(ft.params) {
+		return 0, fmt.Errorf("wasm: %q takes %d arguments, got %d", name, len(ft.params), len(args))
+	}
+	fuel := wasmMaxSteps
+	v, _, err := in.exec(exp.index, args, 0, &fuel)
+	return v, err
+}
+
+// exec interprets one function. Values are int64 slots; i32 values are
+// kept sign-extended and reinterpreted as uint32 where an operator needs
+// the unsigned view.
+func (in *wasmInstance) exec(fidx uint32, args []int64, depth int, fuel *int) (int64, bool, error) {
+	if depth > wasmMaxDepth {
+		return 0, false, fmt.Errorf("call depth limit exceeded")
+	}
+	mod := in.mod
+	fn := &mod.funcs[fidx]
+	ft := mod.types[fn.typeIdx]
+	locals := make([]int64, len(ft.params)+fn.locals)
+	copy(locals, args)
+	body := fn.body
+
+	type block struct {
+		op        byte
+		opPC      int
+		stackH    int
+		hasResult bool
+	}
+	var stack []int64
+	var blocks []block
+	var trap error
+	pc := 0
+
+	push := func(v int64) { stack = append(stack, v) }
+	pop := func() int64 {
+		if len(stack) == 0 {
+			trap = fmt.Errorf("value stack underflow")
+			return 0
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	uleb := func() uint64 {
+		v, n := decodeUleb(body[pc:])
+		if n == 0 {
+			trap = fmt.Errorf("bad varint")
+		}
+		pc += n
+		return v
+	}
+	sleb := func() int64 {
+		v, n := decodeSleb(body[pc:])
+		if n == 0 {
+			trap = fmt.Errorf("bad varint")
+		}
+		pc += n
+		return v
+	}
+	// memAddr pops the base address, adds the static offset and
+	// bounds-checks an n-byte access.
+	memAddr := func(n int) int {
+		off := uleb() // alignment hint, unused
+		off = uleb()
+		base := uint64(uint32(pop()))
+		eff := base + off
+		if trap == nil && eff+uint64(n) > uint64(len(in.mem)) {
+			trap = fmt.Errorf("out-of-bounds memory access at %d", eff)
+		}
+		if trap != nil {
+			return 0
+		}
+		return int(eff)
+	}
+	returned := false
+	// doBr branches l labels outward: loops restart, blocks exit past
+	// their end, and branching beyond the outermost block returns.
+	doBr := func(l int) {
+		if l >= len(blocks) {
+			returned = true
+			return
+		}
+		t := blocks[len(blocks)-1-l]
+		if t.op == 0x03 { // loop: jump back to the body
+			blocks = blocks[:len(blocks)-l]
+			stack = stack[:t.stackH]
+			pc = t.opPC + 2 // past the opcode and block type
+			return
+		}
+		var res int64
+		if t.hasResult && len(stack) > t.stackH {
+			res = stack[len(stack)-1]
+		}
+		blocks = blocks[:len(blocks)-1-l]
+		stack = stack[:t.stackH]
+		if t.hasResult {
+			push(res)
+		}
+		pc = fn.ctrl[t.opPC].endPC + 1
+	}
+
+	for !returned {
+		*fuel--
+		if *fuel < 0 {
+			return 0, false, fmt.Errorf("step limit exceeded")
+		}
+		if pc >= len(body) {
+			break
+		}
+		opPC := pc
+		op := body[pc]
+		pc++
+		switch op {
+		case 0x00: // unreachable
+			return 0, false, fmt.Errorf("unreachable executed")
+		case 0x01: // nop
+		case 0x02, 0x03: // block, loop
+			bt := body[pc]
+			pc++
+			blocks = append(blocks, block{op: op, opPC: opPC, stackH: len(stack), hasResult: bt != 0x40})
+		case 0x04: // if
+			bt := body[pc]
+			pc++
+			cond := pop()
+			blocks = append(blocks, block{op: op, opPC: opPC, stackH: len(stack), hasResult: bt != 0x40})
+			if cond == 0 {
+				c := fn.ctrl[opPC]
+				if c.elsePC >= 0 {
+					pc = c.elsePC + 1
+				} else {
+					pc = c.endPC // the end opcode pops the frame
+				}
+			}
+		case 0x05: // else: the true branch is done, skip to end
+			pc = fn.ctrl[blocks[len(blocks)-1].opPC].endPC
+		case 0x0b: // end
+			if len(blocks) == 0 {
+				returned = true
+				break
+			}
+			blocks = blocks[:len(blocks)-1]
+		case 0x0c: // br
+			doBr(int(uleb()))
+		case 0x0d: // br_if
+			l := int(uleb())
+			if pop() != 0 {
+				doBr(l)
+			}
+		case 0x0e: // br_table
+			n := int(uleb())
+			labels := make([]int, n+1)
+			for i := range labels {
+				labels[i] = int(uleb())
+			}
+			idx := int(uint32(pop()))
+			if idx >= n {
+				idx = n
+			}
+			doBr(labels[idx])
+		case 0x0f: // return
+			returned = true
+		case 0x10: // call
+			callee := uint32(uleb())
+			if callee >= uint32(len(mod.funcs)) {
+				return 0, false, fmt.Errorf("call to unknown function %d", callee)
+			}
+			nargs := len(mod.types[mod.funcs[callee].typeIdx].params)
+			if nargs > len(stack) {
+				return 0, false, fmt.Errorf("value stack underflow")
+			}
+			callArgs := make([]int64, nargs)
+			copy(callArgs, stack[len(stack)-nargs:])
+			stack = stack[:len(stack)-nargs]
+			v, has, err := in.exec(callee, callArgs, depth+1, fuel)
+			if err != nil {
+				return 0, false, err
+			}
+			if has {
+				push(v)
+			}
+		case 0x1a: // drop
+			pop()
+		case 0x1b: // select
+			c, b2, a := pop(), pop(), pop()
+			if c != 0 {
+				push(a)
+			} else {
+				push(b2)
+			}
+		case 0x20: // local.get
+			i := uleb()
+			if i >= uint64(len(locals)) {
+				return 0, false, fmt.Errorf("local %d out of range", i)
+			}
+			push(locals[i])
+		case 0x21, 0x22: // local.set, local.tee
+			i := uleb()
+			if i >= uint64(len(locals)) {
+				return 0, false, fmt.Errorf("local %d out of range", i)
+			}
+			v := pop()
+			locals[i] = v
+			if op == 0x22 {
+				push(v)
+			}
+		case 0x23: // global.get
+			i := uleb()
+			if i >= uint64(len(in.globals)) {
+				return 0, false, fmt.Errorf("global %d out of range", i)
+			}
+			push(in.globals[i])
+		case 0x24: // global.set
+			i := uleb()
+			if i >= uint64(len(in.globals)) {
+				return 0, false, fmt.Errorf("global %d out of range", i)
+			}
+			if !mod.globals[i].mutable {
+				return 0, false, fmt.Errorf("global %d is immutable", i)
+			}
+			in.globals[i] = pop()
+		case 0x28: // i32.load
+			a := memAddr(4)
+			if trap == nil {
+				push(int64(int32(binary.LittleEndian.Uint32(in.mem[a:]))))
+			}
+		case 0x29: // i64.load
+			a := memAddr(8)
+			if trap == nil {
+				push(int64(binary.LittleEndian.Uint64(in.mem[a:])))
+			}
+		case 0x2c: // i32.load8_s
+			a := memAddr(1)
+			if trap == nil {
+				push(int64(int8(in.mem[a])))
+			}
+		case 0x2d: // i32.load8_u
+			a := memAddr(1)
+			if trap == nil {
+				push(int64(in.mem[a]))
+			}
+		case 0x2e: // i32.load16_s
+			a := memAddr(2)
+			if trap == nil {
+				push(int64(int16(binary.LittleEndian.Uint16(in.mem[a:]))))
+			}
+		case 0x2f: // i32.load16_u
+			a := memAddr(2)
+			if trap == nil {
+				push(int64(binary.LittleEndian.Uint16(in.mem[a:])))
+			}
+		case 0x30: // i64.load8_s
+			a := memAddr(1)
+			if trap == nil {
+				push(int64(int8(in.mem[a])))
+			}
+		case 0x31: // i64.load8_u
+			a := memAddr(1)
+			if trap == nil {
+				push(int64(in.mem[a]))
+			}
+		case 0x32: // i64.load16_s
+			a := memAddr(2)
+			if trap == nil {
+				push(int64(int16(binary.LittleEndian.Uint16(in.mem[a:]))))
+			}
+		case 0x33: // i64.load16_u
+			a := memAddr(2)
+			if trap == nil {
+				push(int64(binary.LittleEndian.Uint16(in.mem[a:])))
+			}
+		case 0x34: // i64.load32_s
+			a := memAddr(4)
+			if trap == nil {
+				push(int64(int32(binary.LittleEndian.Uint32(in.mem[a:]))))
+			}
+		case 0x35: // i64.load32_u
+			a := memAddr(4)
+			if trap == nil {
+				push(int64(binary.LittleEndian.Uint32(in.mem[a:])))
+			}
+		case 0x36: // i32.store
+			v := pop()
+			a := memAddr(4)
+			if trap == nil {
+				binary.LittleEndian.PutUint32(in.mem[a:], uint32(v))
+			}
+		case 0x37: // i64.store
+			v := pop()
+			a := memAddr(8)
+			if trap == nil {
+				binary.LittleEndian.PutUint64(in.mem[a:], uint64(v))
+			}
+		case 0x3a, 0x3c: // i32.store8, i64.store8
+			v := pop()
+			a := memAddr(1)
+			if trap == nil {
+				in.mem[a] = byte(v)
+			}
+		case 0x3b, 0x3d: // i32.store16, i64.store16
+			v := pop()
+			a := memAddr(2)
+			if trap == nil {
+				binary.LittleEndian.PutUint16(in.mem[a:], uint16(v))
+			}
+		case 0x3e: // i64.store32
+			v := pop()
+			a := memAddr(4)
+			if trap == nil {
+				binary.LittleEndian.PutUint32(in.mem[a:], uint32(v))
+			}
+		case 0x3f: // memory.size
+			pc++
+			push(int64(len(in.mem) / wasmPageSize))
+		case 0x40: // memory.grow
+			pc++
+			delta := pop()
+			cur := len(in.mem) / wasmPageSize
+			if delta < 0 || cur+int(delta) > wasmMaxPages {
+				push(-1)
+				break
+			}
+			in.mem = append(in.mem, make([]byte, int(delta)*wasmPageSize)...)
+			push(int64(cur))
+		case 0x41: // i32.const
+			push(int64(int32(sleb())))
+		case 0x42: // i64.const
+			push(sleb())
+		case 0x45: // i32.eqz
+			push(b2i(pop() == 0))
+		case 0x46, 0x47, 0x48, 0x49, 0x4a, 0x4b, 0x4c, 0x4d, 0x4e, 0x4f:
+			r := pop()
+			l := pop()
+			push(i32Cmp(op, int32(l), int32(r)))
+		case 0x50: // i64.eqz
+			push(b2i(pop() == 0))
+		case 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a:
+			r := pop()
+			l := pop()
+			push(i64Cmp(op, l, r))
+		case 0x67: // i32.clz
+			push(int64(bits.LeadingZeros32(uint32(pop()))))
+		case 0x68: // i32.ctz
+			push(int64(bits.TrailingZeros32(uint32(pop()))))
+		case 0x69: // i32.popcnt
+			push(int64(bits.OnesCount32(uint32(pop()))))
+		case 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78:
+			r := pop()
+			l := pop()
+			v, err := i32Arith(op, int32(l), int32(r))
+			if err != nil {
+				return 0, false, err
+			}
+			push(v)
+		case 0x79: // i64.clz
+			push(int64(bits.LeadingZeros64(uint64(pop()))))
+		case 0x7a: // i64.ctz
+			push(int64(bits.TrailingZeros64(uint64(pop()))))
+		case 0x7b: // i64.popcnt
+			push(int64(bits.OnesCount64(uint64(pop()))))
+		case 0x7c, 0x7d, 0x7e, 0x7f, 0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89, 0x8a:
+			r := pop()
+			l := pop()
+			v, err := i64Arith(op, l, r)
+			if err != nil {
+				return 0, false, err
+			}
+			push(v)
+		case 0xa7: // i32.wrap_i64
+			push(int64(int32(pop())))
+		case 0xac: // i64.extend_i32_s
+			push(int64(int32(pop())))
+		case 0xad: // i64.extend_i32_u
+			push(int64(uint32(pop())))
+		default:
+			return 0, false, fmt.Errorf("unsupported opcode 0x%02x", op)
+		}
+		if trap != nil {
+			return 0, false, trap
+		}
+	}
+	if len(ft.results) == 1 {
+		if len(stack) == 0 {
+			return 0, false, fmt.Errorf("function left no result on the stack")
+		}
+		return stack[len(stack)-1], true, nil
+	}
+	return 0, false, nil
+}
+
+func b2i(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func i32Cmp(op byte, l, r int32) int64 {
+	switch op {
+	case 0x46:
+		return b2i(l == r)
+	case 0x47:
+		return b2i(l != r)
+	case 0x48:
+		return b2i(l < r)
+	case 0x49:
+		return b2i(uint32(l) < uint32(r))
+	case 0x4a:
+		return b2i(l > r)
+	case 0x4b:
+		return b2i(uint32(l) > uint32(r))
+	case 0x4c:
+		return b2i(l <= r)
+	case 0x4d:
+		return b2i(uint32(l) <= uint32(r))
+	case 0x4e:
+		return b2i(l >= r)
+	}
+	return b2i(uint32(l) >= uint32(r)) // 0x4f ge_u
+}
+
+func i64Cmp(op byte, l, r int64) int64 {
+	switch op {
+	case 0x51:
+		return b2i(l == r)
+	case 0x52:
+		return b2i(l != r)
+	case 0x53:
+		return b2i(l < r)
+	case 0x54:
+		return b2i(uint64(l) < uint64(r))
+	case 0x55:
+		return b2i(l > r)
+	case 0x56:
+		return b2i(uint64(l) > uint64(r))
+	case 0x57:
+		return b2i(l <= r)
+	case 0x58:
+		return b2i(uint64(l) <= uint64(r))
+	case 0x59:
+		return b2i(l >= r)
+	}
+	return b2i(uint64(l) >= uint64(r)) // 0x5a ge_u
+}
+
+func i32Arith(op byte, l, r int32) (int64, error) {
+	switch op {
+	case 0x6a:
+		return int64(l + r), nil
+	case 0x6b:
+		return int64(l - r), nil
+	case 0x6c:
+		return int64(l * r), nil
+	case 0x6d:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		if l == math.MinInt32 && r == -1 {
+			return 0, fmt.Errorf("integer overflow in division")
+		}
+		return int64(l / r), nil
+	case 0x6e:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		return int64(int32(uint32(l) / uint32(r))), nil
+	case 0x6f:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		if l == math.MinInt32 && r == -1 {
+			return 0, nil
+		}
+		return int64(l % r), nil
+	case 0x70:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		return int64(int32(uint32(l) % uint32(r))), nil
+	case 0x71:
+		return int64(l & r), nil
+	case 0x72:
+		return int64(l | r), nil
+	case 0x73:
+		return int64(l ^ r), nil
+	case 0x74:
+		return int64(l << (uint32(r) % 32)), nil
+	case 0x75:
+		return int64(l >> (uint32(r) % 32)), nil
+	case 0x76:
+		return int64(int32(uint32(l) >> (uint32(r) % 32))), nil
+	case 0x77:
+		return int64(int32(bits.RotateLeft32(uint32(l), int(uint32(r)%32)))), nil
+	}
+	return int64(int32(bits.RotateLeft32(uint32(l), -int(uint32(r)%32)))), nil // 0x78 rotr
+}
+
+func i64Arith(op byte, l, r int64) (int64, error) {
+	switch op {
+	case 0x7c:
+		return l + r, nil
+	case 0x7d:
+		return l - r, nil
+	case 0x7e:
+		return l * r, nil
+	case 0x7f:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			return 0, fmt.Errorf("integer overflow in division")
+		}
+		return l / r, nil
+	case 0x80:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		return int64(uint64(l) / uint64(r)), nil
+	case 0x81:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			return 0, nil
+		}
+		return l % r, nil
+	case 0x82:
+		if r == 0 {
+			return 0, fmt.Errorf("integer division by zero")
+		}
+		return int64(uint64(l) % uint64(r)), nil
+	case 0x83:
+		return l & r, nil
+	case 0x84:
+		return l | r, nil
+	case 0x85:
+		return l ^ r, nil
+	case 0x86:
+		return l << (uint64(r) % 64), nil
+	case 0x87:
+		return l >> (uint64(r) % 64), nil
+	case 0x88:
+		return int64(uint64(l) >> (uint64(r) % 64)), nil
+	case 0x89:
+		return int64(bits.RotateLeft64(uint64(l), int(uint64(r)%64))), nil
+	}
+	return int64(bits.RotateLeft64(uint64(l), -int(uint64(r)%64))), nil // 0x8a rotr
+}
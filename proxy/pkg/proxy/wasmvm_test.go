@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+// Hand-assembled binary modules: enough of an encoder to build small test
+// programs without external tooling.
+
+func wasmUleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if v == 0 {
+			return out
+		}
+	}
+}
+
+func wasmSlebBytes(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		done := (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0)
+		if !done {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if done {
+			return out
+		}
+	}
+}
+
+func wasmCat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// wasmByteVec length-prefixes raw bytes (names, valtype lists).
+func wasmByteVec(b []byte) []byte { return wasmCat(wasmUleb(uint64(len(b))), b) }
+
+func wasmSec(id byte, payload []byte) []byte {
+	return wasmCat([]byte{id}, wasmUleb(uint64(len(payload))), payload)
+}
+
+// wasmFuncBody encodes a code entry: flattened i32 locals plus the
+// instructions, with the closing end appended.
+func wasmFuncBody(locals int, instrs []byte) []byte {
+	decl := wasmUleb(0)
+	if locals > 0 {
+		decl = wasmCat(wasmUleb(1), wasmUleb(uint64(locals)), []byte{wasmTypeI32})
+	}
+	body := wasmCat(decl, instrs, []byte{0x0b})
+	return wasmCat(wasmUleb(uint64(len(body))), body)
+}
+
+// wasmOneFuncMod builds a module with a single exported function, an
+// optional memory of memPages, and an optional data segment at offset 0.
+func wasmOneFuncMod(name string, params, results []byte, locals int, instrs []byte, memPages int, data []byte) []byte {
+	typeEntry := wasmCat([]byte{0x60}, wasmByteVec(params), wasmByteVec(results))
+	secs := wasmCat(
+		wasmSec(1, wasmCat(wasmUleb(1), typeEntry)),
+		wasmSec(3, wasmCat(wasmUleb(1), wasmUleb(0))),
+	)
+	if memPages > 0 {
+		secs = wasmCat(secs, wasmSec(5, wasmCat(wasmUleb(1), []byte{0x00}, wasmUleb(uint64(memPages)))))
+	}
+	secs = wasmCat(secs,
+		wasmSec(7, wasmCat(wasmUleb(1), wasmByteVec([]byte(name)), []byte{0x00}, wasmUleb(0))),
+		wasmSec(10, wasmCat(wasmUleb(1), wasmFuncBody(locals, instrs))),
+	)
+	if data != nil {
+		seg := wasmCat(wasmUleb(0), []byte{0x41}, wasmSlebBytes(0), []byte{0x0b}, wasmByteVec(data))
+		secs = wasmCat(secs, wasmSec(11, wasmCat(wasmUleb(1), seg)))
+	}
+	return wasmCat(wasmMagic, secs)
+}
+
+func wasmCallExport(t *testing.T, mod []byte, name string, args ...int64) (int64, error) {
+	t.Helper()
+	m, err := decodeWasmModule(mod)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	in, err := newWasmInstance(m)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	return in.call(name, args...)
+}
+
+func TestWasmVMArithmetic(t *testing.T) {
+	ii := []byte{wasmTypeI32, wasmTypeI32}
+	i := []byte{wasmTypeI32}
+	for _, tc := range []struct {
+		name   string
+		instrs []byte
+		a, b   int64
+		want   int64
+	}{
+		{"add", []byte{0x20, 0x00, 0x20, 0x01, 0x6a}, 2, 3, 5},
+		{"sub", []byte{0x20, 0x00, 0x20, 0x01, 0x6b}, 2, 3, -1},
+		{"mul", []byte{0x20, 0x00, 0x20, 0x01, 0x6c}, -4, 3, -12},
+		{"div_s", []byte{0x20, 0x00, 0x20, 0x01, 0x6d}, -7, 2, -3},
+		{"div_u", []byte{0x20, 0x00, 0x20, 0x01, 0x6e}, -1, 2, 0x7fffffff},
+		{"and", []byte{0x20, 0x00, 0x20, 0x01, 0x71}, 6, 3, 2},
+		{"shl", []byte{0x20, 0x00, 0x20, 0x01, 0x74}, 1, 5, 32},
+		{"lt_s", []byte{0x20, 0x00, 0x20, 0x01, 0x48}, -1, 1, 1},
+		{"lt_u", []byte{0x20, 0x00, 0x20, 0x01, 0x49}, -1, 1, 0},
+		// Round-trip through i64: extend both, multiply, wrap.
+		{"i64", []byte{0x20, 0x00, 0xac, 0x20, 0x01, 0xac, 0x7e, 0xa7}, 1000, 1000, 1000000},
+	} {
+		got, err := wasmCallExport(t, wasmOneFuncMod("f", ii, i, 0, tc.instrs, 0, nil), "f", tc.a, tc.b)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s(%d, %d) = %d, want %d", tc.name, tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	div := wasmOneFuncMod("f", ii, i, 0, []byte{0x20, 0x00, 0x20, 0x01, 0x6d}, 0, nil)
+	if _, err := wasmCallExport(t, div, "f", 1, 0); err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("division by zero = %v, want trap", err)
+	}
+}
+
+func TestWasmVMControlFlow(t *testing.T) {
+	i := []byte{wasmTypeI32}
+
+	// if/else with a result.
+	pick := []byte{
+		0x20, 0x00, // local.get 0
+		0x04, 0x7f, // if (result i32)
+		0x41, 0x0a, // i32.const 10
+		0x05,       // else
+		0x41, 0x14, // i32.const 20
+		0x0b, // end
+	}
+	for arg, want := range map[int64]int64{1: 10, 0: 20} {
+		if got, err := wasmCallExport(t, wasmOneFuncMod("f", i, i, 0, pick, 0, nil), "f", arg); err != nil || got != want {
+			t.Errorf("pick(%d) = %d, %v, want %d", arg, got, err, want)
+		}
+	}
+
+	// Loop: sum 1..n using a counter and an accumulator local.
+	sum := []byte{
+		0x02, 0x40, // block
+		0x03, 0x40, // loop
+		0x20, 0x00, 0x45, 0x0d, 0x01, // local.get 0; i32.eqz; br_if 1
+		0x20, 0x01, 0x20, 0x00, 0x6a, 0x21, 0x01, // acc += n
+		0x20, 0x00, 0x41, 0x01, 0x6b, 0x21, 0x00, // n -= 1
+		0x0c, 0x00, // br 0
+		0x0b, 0x0b, // end; end
+		0x20, 0x01, // local.get 1
+	}
+	if got, err := wasmCallExport(t, wasmOneFuncMod("f", i, i, 1, sum, 0, nil), "f", 100); err != nil || got != 5050 {
+		t.Errorf("sum(100) = %d, %v, want 5050", got, err)
+	}
+}
+
+func TestWasmVMCalls(t *testing.T) {
+	// Two functions sharing one type: main calls double on its argument.
+	i := []byte{wasmTypeI32}
+	typeEntry := wasmCat([]byte{0x60}, wasmByteVec(i), wasmByteVec(i))
+	mod := wasmCat(wasmMagic,
+		wasmSec(1, wasmCat(wasmUleb(1), typeEntry)),
+		wasmSec(3, wasmCat(wasmUleb(2), wasmUleb(0), wasmUleb(0))),
+		wasmSec(7, wasmCat(wasmUleb(1), wasmByteVec([]byte("main")), []byte{0x00}, wasmUleb(0))),
+		wasmSec(10, wasmCat(wasmUleb(2),
+			wasmFuncBody(0, []byte{0x20, 0x00, 0x10, 0x01, 0x41, 0x01, 0x6a}), // main: double(x) + 1
+			wasmFuncBody(0, []byte{0x20, 0x00, 0x20, 0x00, 0x6a}),             // double
+		)),
+	)
+	if got, err := wasmCallExport(t, mod, "main", 21); err != nil || got != 43 {
+		t.Errorf("main(21) = %d, %v, want 43", got, err)
+	}
+}
+
+func TestWasmVMMemory(t *testing.T) {
+	i := []byte{wasmTypeI32}
+
+	// Read back a data segment: mem[0] + mem[1].
+	read := []byte{
+		0x41, 0x00, 0x2d, 0x00, 0x00, // i32.const 0; i32.load8_u
+		0x41, 0x01, 0x2d, 0x00, 0x00,
+		0x6a,
+	}
+	mod := wasmOneFuncMod("f", nil, i, 0, read, 1, []byte{7, 35})
+	if got, err := wasmCallExport(t, mod, "f"); err != nil || got != 42 {
+		t.Errorf("data read = %d, %v, want 42", got, err)
+	}
+
+	// Store then load through an offset immediate.
+	rt := []byte{
+		0x41, 0x04, 0x41, 0x99, 0x01, 0x36, 0x02, 0x08, // i32.store offset=8 at addr 4 -> 153
+		0x41, 0x04, 0x28, 0x02, 0x08, // i32.load offset=8
+	}
+	if got, err := wasmCallExport(t, wasmOneFuncMod("f", nil, i, 0, rt, 1, nil), "f"); err != nil || got != 153 {
+		t.Errorf("store/load = %d, %v, want 153", got, err)
+	}
+
+	// memory.grow then memory.size.
+	grow := []byte{
+		0x41, 0x01, 0x40, 0x00, 0x1a, // grow by 1, drop old size
+		0x3f, 0x00, // memory.size
+	}
+	if got, err := wasmCallExport(t, wasmOneFuncMod("f", nil, i, 0, grow, 1, nil), "f"); err != nil || got != 2 {
+		t.Errorf("grown size = %d, %v, want 2", got, err)
+	}
+
+	// Out-of-bounds access traps instead of reading Go memory.
+	oob := []byte{0x41, 0x7f, 0x2d, 0x00, 0x00}
+	if _, err := wasmCallExport(t, wasmOneFuncMod("f", nil, i, 0, oob, 1, nil), "f"); err == nil || !strings.Contains(err.Error(), "out-of-bounds") {
+		t.Errorf("oob load = %v, want trap", err)
+	}
+}
+
+func TestWasmVMRunawayLoopHitsStepLimit(t *testing.T) {
+	spin := []byte{0x03, 0x40, 0x0c, 0x00, 0x0b} // loop; br 0; end
+	_, err := wasmCallExport(t, wasmOneFuncMod("f", nil, nil, 0, spin, 0, nil), "f")
+	if err == nil || !strings.Contains(err.Error(), "step limit") {
+		t.Errorf("infinite loop = %v, want step limit error", err)
+	}
+}
+
+func TestWasmVMDecodeRejectsUnsupported(t *testing.T) {
+	i := []byte{wasmTypeI32}
+	for name, tc := range map[string]struct {
+		mod     []byte
+		wantErr string
+	}{
+		"float opcode": {
+			wasmOneFuncMod("f", nil, i, 0, []byte{0x43, 0x00, 0x00, 0x00, 0x00}, 0, nil),
+			"unsupported opcode",
+		},
+		"float type": {
+			wasmOneFuncMod("f", []byte{0x7d}, i, 0, []byte{0x41, 0x00}, 0, nil),
+			"integer types only",
+		},
+		"call_indirect": {
+			wasmOneFuncMod("f", nil, i, 0, []byte{0x41, 0x00, 0x11, 0x00, 0x00}, 0, nil),
+			"unsupported opcode",
+		},
+		"imports": {
+			wasmCat(wasmMagic, wasmSec(2, wasmUleb(1))),
+			"imports are not supported",
+		},
+		"truncated": {
+			wasmCat(wasmMagic, []byte{0x01, 0x7f}),
+			"truncated",
+		},
+	} {
+		if _, err := decodeWasmModule(tc.mod); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: decode = %v, want %q", name, err, tc.wantErr)
+		}
+	}
+}
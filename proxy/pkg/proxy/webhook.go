@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Webhook notifier: operational events (breaker trips, bans, certificate
+// expiry, shutdown) are POSTed as JSON to the configured URLs so operators
+// can feed Slack/Discord or a pager without scraping logs. Delivery is
+// best-effort with retries on a background worker; a dead webhook endpoint
+// must never slow down or block the proxy itself.
+
+const (
+	webhookAttempts = 3
+	webhookQueue    = 64
+)
+
+type webhookEvent struct {
+	Event   string            `json:"event"`
+	Time    string            `json:"time"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+type webhookNotifier struct {
+	urls    []string
+	secret  string
+	client  *http.Client
+	events  chan webhookEvent
+	backoff time.Duration // base retry delay, grows linearly per attempt
+	metrics *Metrics
+	log     *slog.Logger
+}
+
+func newWebhookNotifier(urls []string, secret string, metrics *Metrics, log *slog.Logger) *webhookNotifier {
+	n := &webhookNotifier{
+		urls:    urls,
+		secret:  secret,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		events:  make(chan webhookEvent, webhookQueue),
+		backoff: time.Second,
+		metrics: metrics,
+		log:     log,
+	}
+	go n.loop()
+	return n
+}
+
+// notify enqueues one event; kv are alternating key/value detail pairs.
+// Safe on a nil receiver, and drops rather than blocks when the queue is
+// full.
+func (n *webhookNotifier) notify(event string, kv ...string) {
+	if n == nil {
+		return
+	}
+	e := webhookEvent{Event: event, Time: time.Now().UTC().Format(time.RFC3339)}
+	if len(kv) > 0 {
+		e.Details = make(map[string]string, len(kv)/2)
+		for i := 0; i+1 < len(kv); i += 2 {
+			e.Details[kv[i]] = kv[i+1]
+		}
+	}
+	select {
+	case n.events <- e:
+	default:
+		n.metrics.Inc(`clawdbot_proxy_webhooks_dropped_total`)
+	}
+}
+
+func (n *webhookNotifier) loop() {
+	for e := range n.events {
+		body, _ := json.Marshal(e)
+		for _, url := range n.urls {
+			n.deliver(url, e.Event, body)
+		}
+	}
+}
+
+// deliver POSTs body to url, retrying transient failures with a linear
+// backoff. With a secret configured the payload is signed so receivers can
+// reject forgeries.
+func (n *webhookNotifier) deliver(url, event string, body []byte) {
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			n.log.Warn("webhook request invalid", "url", url, "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "clawdbot-proxy-webhook")
+		if n.secret != "" {
+			mac := hmac.New(sha256.New, []byte(n.secret))
+			mac.Write(body)
+			req.Header.Set("X-Claw-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		resp, err := n.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				n.metrics.Inc(`clawdbot_proxy_webhooks_sent_total`)
+				return
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if attempt == webhookAttempts {
+			n.metrics.Inc(`clawdbot_proxy_webhooks_failed_total`)
+			n.log.Warn("webhook delivery failed", "url", url, "event", event, "error", err)
+			return
+		}
+		time.Sleep(n.backoff * time.Duration(attempt))
+	}
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliversSignedEvent(t *testing.T) {
+	got := make(chan *http.Request, 1)
+	body := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- r
+		body <- b
+	}))
+	defer srv.Close()
+
+	n := newWebhookNotifier([]string{srv.URL}, "s3cret", NewMetrics(), discardLogger())
+	n.notify("backend_down", "breaker", "open")
+
+	select {
+	case r := <-got:
+		b := <-body
+		var e webhookEvent
+		if err := json.Unmarshal(b, &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Event != "backend_down" || e.Details["breaker"] != "open" {
+			t.Fatalf("event = %+v", e)
+		}
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(b)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.Header.Get("X-Claw-Signature") != want {
+			t.Errorf("signature = %q, want %q", r.Header.Get("X-Claw-Signature"), want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook never delivered")
+	}
+}
+
+func TestWebhookRetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	n := newWebhookNotifier([]string{srv.URL}, "", NewMetrics(), discardLogger())
+	n.backoff = time.Millisecond
+	n.notify("ban", "ip", "203.0.113.9")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want retry after 502", calls.Load())
+	}
+	if n.metrics.Counter(`clawdbot_proxy_webhooks_sent_total`) != 1 {
+		t.Errorf("sent counter = %d", n.metrics.Counter(`clawdbot_proxy_webhooks_sent_total`))
+	}
+}
+
+func TestWebhookNilNotifierIsSafe(t *testing.T) {
+	var n *webhookNotifier
+	n.notify("shutdown") // must not panic
+}
@@ -0,0 +1,524 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocket opcodes (RFC 6455 §5.2).
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// wsCloseGrace bounds how long the relay waits for the peer to echo a close
+// frame before tearing the TCP connections down.
+const wsCloseGrace = 5 * time.Second
+
+// errWSPolicy marks frames rejected by the client-side frame policy.
+var errWSPolicy = errors.New("websocket: policy violation")
+
+// wsPolicy is the per-session limit set the relay enforces on frames coming
+// from the client. The backend side is ours and runs unrestricted.
+type wsPolicy struct {
+	maxMessage int64      // total payload cap per message, fragments included; 0 = off
+	frames     string     // "text", "binary", or "" for both
+	limiter    *wsLimiter // message/byte rate pacing; nil = off
+	msgBytes   int64      // running payload size of the in-progress message
+}
+
+// check validates one frame header against the policy. It returns a close
+// code and reason when the frame must be rejected, or 0 to let it through.
+func (pol *wsPolicy) check(opcode byte, payloadLen int64) (uint16, string) {
+	switch opcode {
+	case opText:
+		if pol.frames == "binary" {
+			return 1003, "text frames not accepted here"
+		}
+		pol.msgBytes = payloadLen
+	case opBinary:
+		if pol.frames == "text" {
+			return 1003, "binary frames not accepted here"
+		}
+		pol.msgBytes = payloadLen
+	case opContinuation:
+		pol.msgBytes += payloadLen
+	default:
+		// Control frames carry at most 125 bytes (RFC 6455 §5.5); anything
+		// bigger is a protocol violation, not a large message.
+		if payloadLen > 125 {
+			return 1002, "oversized control frame"
+		}
+		return 0, ""
+	}
+	if pol.maxMessage > 0 && pol.msgBytes > pol.maxMessage {
+		return 1009, "message too big"
+	}
+	if pol.limiter != nil {
+		d, hard := pol.limiter.reserve(opcode != opContinuation, payloadLen)
+		if hard {
+			return 1008, "rate limit exceeded"
+		}
+		if d > 0 {
+			// Soft throttle: stalling the read loop here backpressures the
+			// client through TCP instead of buffering in the proxy.
+			time.Sleep(d)
+		}
+	}
+	return 0, ""
+}
+
+// wsConn wraps one side of a relayed session. The write mutex keeps injected
+// keepalive pings from interleaving with a frame mid-copy.
+type wsConn struct {
+	net.Conn
+	br  *bufio.Reader
+	wmu sync.Mutex
+	// mask is true when frames we originate toward this peer must be
+	// masked (i.e. the peer is the backend and we act as a client).
+	mask bool
+	// written counts bytes written to this peer, for the session registry.
+	written atomic.Int64
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// handleWebSocket relays an upgrade request to the default backend.
+func (p *ProxyServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	p.handleWebSocketVia(w, r, p.backend, p.backendSocket)
+}
+
+// handleWebSocketVia relays an upgrade request to the given backend and then
+// tunnels frames in both directions, injecting keepalive pings and enforcing
+// the configured idle timeout on each side.
+func (p *ProxyServer) handleWebSocketVia(w http.ResponseWriter, r *http.Request, backendURL *url.URL, socket string) {
+	if !isUpgradeRequest(r) {
+		p.httpError(w, r, http.StatusBadRequest, "websocket upgrade required")
+		return
+	}
+	if p.resume != nil {
+		if token := r.Header.Get(wsResumeHeader); token != "" && p.resumeSession(w, r, token) {
+			return
+		}
+		// Unknown or expired token: connect fresh below.
+	}
+	backendConn, err := p.dialGateway(backendURL, socket, 10*time.Second)
+	if err != nil {
+		p.log.Error("websocket backend dial failed", "error", err)
+		p.metrics.Inc(`clawdbot_proxy_backend_errors_total`)
+		p.httpError(w, r, http.StatusBadGateway, "gateway connection failed")
+		return
+	}
+	handedOff := false
+	defer func() {
+		// A parked session's backend now belongs to the resume registry.
+		if !handedOff {
+			backendConn.Close()
+		}
+	}()
+
+	if err := writeUpgradeRequest(backendConn, r, backendURL.Host, p.cfg.WSCompression); err != nil {
+		p.log.Error("websocket handshake write failed", "error", err)
+		p.httpError(w, r, http.StatusBadGateway, "gateway connection failed")
+		return
+	}
+	backendBr := bufio.NewReader(backendConn)
+	resp, err := http.ReadResponse(backendBr, r)
+	if err != nil {
+		p.log.Error("websocket handshake read failed", "error", err)
+		p.httpError(w, r, http.StatusBadGateway, "gateway connection failed")
+		return
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// Backend declined the upgrade; relay its answer as-is.
+		copyResponse(w, resp)
+		return
+	}
+
+	// Compression: when the backend negotiated permessage-deflate the frames
+	// relay verbatim (passthrough). When it declined but the client offered
+	// and proxy-side compression is on, the proxy accepts the extension
+	// itself and recodes data frames in the relay.
+	terminateDeflate := false
+	if p.cfg.WSCompression && hasPermessageDeflate(r.Header) && !hasPermessageDeflate(resp.Header) {
+		terminateDeflate = true
+		resp.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; server_no_context_takeover; client_no_context_takeover")
+	}
+
+	// Resumable sessions get a token the client presents on reconnect.
+	resumeToken := ""
+	if p.resume != nil {
+		resumeToken = newHexID(16)
+		resp.Header.Set(wsResumeHeader, resumeToken)
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		p.httpError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	clientConn, clientRW, err := hj.Hijack()
+	if err != nil {
+		p.log.Error("websocket hijack failed", "error", err)
+		return
+	}
+	defer clientConn.Close()
+	// The HTTP server's deadlines no longer apply; the relay manages its own.
+	clientConn.SetDeadline(time.Time{})
+
+	if err := resp.Write(clientConn); err != nil {
+		return
+	}
+
+	client := &wsConn{Conn: clientConn, br: clientRW.Reader, mask: false}
+	backend := &wsConn{Conn: backendConn, br: backendBr, mask: true}
+
+	// Registry identity: reuse the request ID when the middleware minted one
+	// (direct handler tests skip it), so logs and the admin view line up.
+	id, _ := r.Context().Value(ctxKeyRequestID{}).(string)
+	if id == "" {
+		id = newRequestID()
+	}
+	session := &wsSession{
+		id:       id,
+		client:   client,
+		backend:  backend,
+		clientIP: p.clientIP(r),
+		path:     r.URL.Path,
+		started:  time.Now(),
+	}
+	if p.bg != nil {
+		if s := p.bg.active(); s.url == backendURL {
+			session.set = s.name
+		}
+	}
+	p.sessions.add(session)
+	defer p.sessions.remove(session)
+
+	p.metrics.AddGauge(`clawdbot_proxy_ws_active`, 1)
+	p.metrics.Inc(`clawdbot_proxy_ws_sessions_total`)
+	start := time.Now()
+	defer func() {
+		p.metrics.AddGauge(`clawdbot_proxy_ws_active`, -1)
+		p.reqLog(r).Info("websocket session closed",
+			"path", r.URL.Path,
+			"client", p.clientIP(r),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}()
+
+	pol := p.newWSPolicy(r)
+	if p.resume != nil {
+		if parked := p.relayResumable(client, backend, pol, resumeToken); parked != nil {
+			p.resume.park(parked)
+			handedOff = true
+		}
+		return
+	}
+	p.relay(client, backend, pol, terminateDeflate)
+}
+
+// newWSPolicy builds the client-side frame policy for one session: the frame
+// type restriction from the matched route plus the global size and rate caps.
+func (p *ProxyServer) newWSPolicy(r *http.Request) *wsPolicy {
+	frames := ""
+	if rt, ok := r.Context().Value(ctxKeyRoute{}).(*route); ok {
+		frames = rt.wsFrames
+	}
+	return &wsPolicy{
+		maxMessage: p.cfg.WSMaxMessage,
+		frames:     frames,
+		limiter:    newWSLimiter(p.cfg.WSMsgRate, p.cfg.WSByteRate),
+	}
+}
+
+// relay runs the two copy loops plus the keepalive ticker and returns once
+// both directions have ended.
+func (p *ProxyServer) relay(client, backend *wsConn, pol *wsPolicy, deflate bool) {
+	// done carries true when the direction ended with a cleanly forwarded
+	// close frame, false on error.
+	done := make(chan bool, 2)
+	relayDir := func(src, dst *wsConn, pol *wsPolicy, compress bool) {
+		for {
+			src.SetReadDeadline(time.Now().Add(p.cfg.WSIdleTimeout))
+			var opcode byte
+			var err error
+			switch {
+			case deflate:
+				opcode, err = p.recodeFrame(dst, src, pol, compress)
+			case p.chaos.dropDataFrame():
+				// Chaos injection: swallow the next data frame (control
+				// frames still pass so the session itself stays healthy).
+				opcode, err = discardFrame(dst, src, pol)
+			case len(p.wasm.filters(wasmHookWSMessage)) > 0:
+				opcode, err = p.wasmFilterFrame(dst, src, pol)
+			default:
+				opcode, err = copyFrame(dst, src, pol)
+			}
+			if err != nil || opcode == opClose {
+				if errors.Is(err, errWSPolicy) {
+					p.metrics.Inc(`clawdbot_proxy_ws_policy_closes_total`)
+					p.log.Warn("websocket session closed by frame policy", "error", err)
+				}
+				done <- err == nil
+				return
+			}
+		}
+	}
+	go relayDir(client, backend, pol, false)
+	go relayDir(backend, client, nil, true)
+
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if p.cfg.WSPingInterval > 0 {
+		ticker = time.NewTicker(p.cfg.WSPingInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case clean := <-done:
+			if clean {
+				// A close frame went through; give the other side a bounded
+				// window to relay the echoed close before tearing down, so
+				// the handshake completes instead of ending in a TCP reset.
+				select {
+				case <-done:
+					client.Close()
+					backend.Close()
+					return
+				case <-time.After(wsCloseGrace):
+				}
+			}
+			// Closing both conns unblocks the other direction.
+			client.Close()
+			backend.Close()
+			<-done
+			return
+		case <-tick:
+			if writeControl(client, opPing, nil) != nil || writeControl(backend, opPing, nil) != nil {
+				client.Close()
+				backend.Close()
+				<-done
+				<-done
+				return
+			}
+		}
+	}
+}
+
+// copyFrame relays exactly one frame from src to dst, header bytes verbatim,
+// and returns the frame's opcode. Payloads are streamed, not buffered. A
+// non-nil policy is checked against the header before any byte is forwarded;
+// violations close src with the policy's status code and nothing reaches dst.
+func copyFrame(dst, src *wsConn, pol *wsPolicy) (byte, error) {
+	header, opcode, payloadLen, err := readFrameHeader(src.br)
+	if err != nil {
+		return 0, err
+	}
+	if pol != nil {
+		if code, reason := pol.check(opcode, payloadLen); code != 0 {
+			writeControl(src, opClose, closePayload(code, reason))
+			return opcode, fmt.Errorf("%w: %s", errWSPolicy, reason)
+		}
+	}
+	return opcode, forwardFrame(dst, src, header, payloadLen)
+}
+
+// discardFrame reads one frame and drops it when it carries data; control
+// frames are forwarded as usual. Used only by chaos injection.
+func discardFrame(dst, src *wsConn, pol *wsPolicy) (byte, error) {
+	header, opcode, payloadLen, err := readFrameHeader(src.br)
+	if err != nil {
+		return 0, err
+	}
+	if pol != nil {
+		if code, reason := pol.check(opcode, payloadLen); code != 0 {
+			writeControl(src, opClose, closePayload(code, reason))
+			return opcode, fmt.Errorf("%w: %s", errWSPolicy, reason)
+		}
+	}
+	if opcode == opText || opcode == opBinary || opcode == opContinuation {
+		_, err := io.CopyN(io.Discard, src.br, payloadLen)
+		return opcode, err
+	}
+	return opcode, forwardFrame(dst, src, header, payloadLen)
+}
+
+// forwardFrame copies an already-parsed frame verbatim: header bytes as read,
+// payload streamed from src's buffered reader.
+func forwardFrame(dst, src *wsConn, header []byte, payloadLen int64) error {
+	dst.wmu.Lock()
+	defer dst.wmu.Unlock()
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	if payloadLen > 0 {
+		if _, err := io.CopyN(dst, src.br, payloadLen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closePayload builds a close frame payload: status code plus reason text.
+func closePayload(code uint16, reason string) []byte {
+	p := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(p, code)
+	copy(p[2:], reason)
+	return p
+}
+
+// readFrameHeader parses a frame header and returns its raw bytes so it can
+// be forwarded without re-encoding (masked frames stay masked).
+func readFrameHeader(br *bufio.Reader) (header []byte, opcode byte, payloadLen int64, err error) {
+	var buf [14]byte
+	if _, err = io.ReadFull(br, buf[:2]); err != nil {
+		return nil, 0, 0, err
+	}
+	opcode = buf[0] & 0x0f
+	masked := buf[1]&0x80 != 0
+	n := 2
+	switch length := buf[1] & 0x7f; {
+	case length < 126:
+		payloadLen = int64(length)
+	case length == 126:
+		if _, err = io.ReadFull(br, buf[2:4]); err != nil {
+			return nil, 0, 0, err
+		}
+		payloadLen = int64(binary.BigEndian.Uint16(buf[2:4]))
+		n = 4
+	default:
+		if _, err = io.ReadFull(br, buf[2:10]); err != nil {
+			return nil, 0, 0, err
+		}
+		payloadLen = int64(binary.BigEndian.Uint64(buf[2:10]))
+		if payloadLen < 0 {
+			return nil, 0, 0, errors.New("websocket: invalid frame length")
+		}
+		n = 10
+	}
+	if masked {
+		if _, err = io.ReadFull(br, buf[n:n+4]); err != nil {
+			return nil, 0, 0, err
+		}
+		n += 4
+	}
+	return buf[:n], opcode, payloadLen, nil
+}
+
+// writeControl sends a proxy-originated control frame, masking it when the
+// peer expects client frames.
+func writeControl(c *wsConn, opcode byte, payload []byte) error {
+	if len(payload) > 125 {
+		return errors.New("websocket: control payload too large")
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	header := []byte{0x80 | opcode, byte(len(payload))}
+	if c.mask {
+		header[1] |= 0x80
+		var key [4]byte
+		rand.Read(key[:])
+		header = append(header, key[:]...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ key[i%4]
+		}
+		payload = masked
+	}
+	c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	defer c.SetWriteDeadline(time.Time{})
+	if _, err := c.Write(header); err != nil {
+		return err
+	}
+	if len(payload) > 0 {
+		if _, err := c.Write(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		headerContainsToken(r.Header, "Connection", "upgrade") &&
+		r.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeUpgradeRequest forwards the client's handshake to the backend. The
+// extensions offer is only forwarded when compression support is enabled, so
+// the backend never negotiates an encoding the relay would have to undo.
+func writeUpgradeRequest(w io.Writer, r *http.Request, backendHost string, forwardExtensions bool) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "GET %s HTTP/1.1\r\n", r.URL.RequestURI())
+	fmt.Fprintf(&b, "Host: %s\r\n", backendHost)
+	fmt.Fprintf(&b, "Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	fmt.Fprintf(&b, "Sec-WebSocket-Key: %s\r\n", r.Header.Get("Sec-WebSocket-Key"))
+	fmt.Fprintf(&b, "Sec-WebSocket-Version: %s\r\n", r.Header.Get("Sec-WebSocket-Version"))
+	// Subprotocol selection is the gateway's call: forward the client's offer
+	// and let the backend's 101 (relayed verbatim) carry the chosen one back.
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		fmt.Fprintf(&b, "Sec-WebSocket-Protocol: %s\r\n", v)
+	}
+	if forwardExtensions {
+		for _, v := range r.Header.Values("Sec-WebSocket-Extensions") {
+			fmt.Fprintf(&b, "Sec-WebSocket-Extensions: %s\r\n", v)
+		}
+	}
+	for name, values := range r.Header {
+		switch name {
+		case "Host", "Upgrade", "Connection",
+			"Sec-Websocket-Key", "Sec-Websocket-Version",
+			"Sec-Websocket-Protocol", "Sec-Websocket-Extensions":
+			continue
+		}
+		for _, v := range values {
+			fmt.Fprintf(&b, "%s: %s\r\n", name, v)
+		}
+	}
+	b.WriteString("\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func copyResponse(w http.ResponseWriter, resp *http.Response) {
+	defer resp.Body.Close()
+	for name, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
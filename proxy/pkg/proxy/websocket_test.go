@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// nopConn adapts a plain writer to net.Conn for frame-encoding tests.
+type nopConn struct{ io.Writer }
+
+func (nopConn) Read([]byte) (int, error)         { return 0, io.EOF }
+func (nopConn) Close() error                     { return nil }
+func (nopConn) LocalAddr() net.Addr              { return nil }
+func (nopConn) RemoteAddr() net.Addr             { return nil }
+func (nopConn) SetDeadline(time.Time) error      { return nil }
+func (nopConn) SetReadDeadline(time.Time) error  { return nil }
+func (nopConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestReadFrameHeaderRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		raw     []byte
+		opcode  byte
+		payload int64
+	}{
+		{"small text", []byte{0x81, 0x05}, opText, 5},
+		{"masked small", []byte{0x82, 0x85, 1, 2, 3, 4}, opBinary, 5},
+		{"extended16", []byte{0x82, 126, 0x01, 0x00}, opBinary, 256},
+		{"extended64", []byte{0x82, 127, 0, 0, 0, 0, 0, 2, 0, 0}, opBinary, 1 << 17},
+		{"ping", []byte{0x89, 0x00}, opPing, 0},
+		{"close", []byte{0x88, 0x02}, opClose, 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(tc.raw))
+			header, opcode, payloadLen, err := readFrameHeader(br)
+			if err != nil {
+				t.Fatalf("readFrameHeader: %v", err)
+			}
+			if opcode != tc.opcode {
+				t.Errorf("opcode = %#x, want %#x", opcode, tc.opcode)
+			}
+			if payloadLen != tc.payload {
+				t.Errorf("payloadLen = %d, want %d", payloadLen, tc.payload)
+			}
+			if !bytes.Equal(header, tc.raw) {
+				t.Errorf("header bytes = %v, want %v (must forward verbatim)", header, tc.raw)
+			}
+		})
+	}
+}
+
+func TestWriteControlMasksTowardBackend(t *testing.T) {
+	var buf bytes.Buffer
+	c := &wsConn{Conn: nopConn{&buf}, mask: true}
+	if err := writeControl(c, opPing, []byte("hi")); err != nil {
+		t.Fatalf("writeControl: %v", err)
+	}
+	raw := buf.Bytes()
+	if raw[0] != 0x80|opPing {
+		t.Errorf("first byte = %#x, want fin+ping", raw[0])
+	}
+	if raw[1]&0x80 == 0 {
+		t.Error("frame toward backend must be masked")
+	}
+	if len(raw) != 2+4+2 {
+		t.Errorf("frame length = %d, want 8", len(raw))
+	}
+	key := raw[2:6]
+	if got := []byte{raw[6] ^ key[0], raw[7] ^ key[1]}; string(got) != "hi" {
+		t.Errorf("unmasked payload = %q, want %q", got, "hi")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+)
+
+// runService exists so the subcommand dispatch compiles everywhere; the
+// real implementation is in winservice_windows.go. On Unix, use systemd
+// (socket activation is already supported) or any other supervisor.
+func runService(args []string, out io.Writer) int {
+	fmt.Fprintln(out, "error: the service subcommand is only supported on Windows")
+	return 1
+}
@@ -0,0 +1,235 @@
+//go:build windows
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Windows service integration, hand-rolled against advapi32 so the proxy
+// stays dependency-free. `clawdbot-proxy service install <flags>` registers
+// the binary with the service control manager; the SCM then starts it as
+// `service run <flags>`, which dispatches into the normal run() path with a
+// control handler translating stop/shutdown requests into a graceful drain.
+
+const windowsServiceName = "clawdbot-proxy"
+
+var (
+	advapi32                       = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW             = advapi32.NewProc("OpenSCManagerW")
+	procCreateServiceW             = advapi32.NewProc("CreateServiceW")
+	procOpenServiceW               = advapi32.NewProc("OpenServiceW")
+	procDeleteService              = advapi32.NewProc("DeleteService")
+	procStartServiceW              = advapi32.NewProc("StartServiceW")
+	procControlService             = advapi32.NewProc("ControlService")
+	procCloseServiceHandle         = advapi32.NewProc("CloseServiceHandle")
+	procStartServiceCtrlDispatcher = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandler = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus           = advapi32.NewProc("SetServiceStatus")
+)
+
+const (
+	scManagerAllAccess = 0xF003F
+	serviceAllAccess   = 0xF01FF
+
+	serviceWin32OwnProcess = 0x10
+	serviceAutoStart       = 2
+	serviceErrorNormal     = 1
+
+	serviceControlStop     = 1
+	serviceControlShutdown = 5
+
+	serviceStateStopped   = 1
+	serviceStateStartPend = 2
+	serviceStateStopPend  = 3
+	serviceStateRunning   = 4
+	serviceAcceptStop     = 1
+	serviceAcceptShutdown = 4
+)
+
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// serviceRunArgs carries the proxy flags from runService into serviceMain,
+// which the SCM invokes on its own thread with its own argv.
+var serviceRunArgs []string
+
+var serviceStatusHandle uintptr
+
+// runService is the `service` subcommand: install/uninstall/start/stop
+// manage the SCM registration; `run` is what the SCM itself executes.
+func runService(args []string, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(out, "usage: clawdbot-proxy service install|uninstall|start|stop|run [flags]")
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "install":
+		err = serviceInstall(args[1:])
+	case "uninstall":
+		err = serviceControl(func(h uintptr) error {
+			if r, _, e := procDeleteService.Call(h); r == 0 {
+				return e
+			}
+			return nil
+		})
+	case "start":
+		err = serviceControl(func(h uintptr) error {
+			if r, _, e := procStartServiceW.Call(h, 0, 0); r == 0 {
+				return e
+			}
+			return nil
+		})
+	case "stop":
+		err = serviceControl(func(h uintptr) error {
+			var st serviceStatus
+			if r, _, e := procControlService.Call(h, serviceControlStop, uintptr(unsafe.Pointer(&st))); r == 0 {
+				return e
+			}
+			return nil
+		})
+	case "run":
+		return serviceDispatch(args[1:])
+	default:
+		fmt.Fprintf(out, "unknown service action %q\n", args[0])
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(out, "error: service %s: %v\n", args[0], err)
+		return 1
+	}
+	fmt.Fprintf(out, "ok: service %s\n", args[0])
+	return 0
+}
+
+// serviceInstall registers the current binary, preserving the proxy flags
+// in the service command line.
+func serviceInstall(flags []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("%q service run", exe)
+	if len(flags) > 0 {
+		cmd += " " + strings.Join(flags, " ")
+	}
+	scm, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(scm)
+	name, _ := syscall.UTF16PtrFromString(windowsServiceName)
+	display, _ := syscall.UTF16PtrFromString("Clawdbot Proxy")
+	path, _ := syscall.UTF16PtrFromString(cmd)
+	h, _, e := procCreateServiceW.Call(scm,
+		uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(display)),
+		serviceAllAccess, serviceWin32OwnProcess, serviceAutoStart, serviceErrorNormal,
+		uintptr(unsafe.Pointer(path)), 0, 0, 0, 0, 0)
+	if h == 0 {
+		return e
+	}
+	procCloseServiceHandle.Call(h)
+	return nil
+}
+
+// serviceControl opens the installed service and applies op to its handle.
+func serviceControl(op func(h uintptr) error) error {
+	scm, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(scm)
+	name, _ := syscall.UTF16PtrFromString(windowsServiceName)
+	h, _, e := procOpenServiceW.Call(scm, uintptr(unsafe.Pointer(name)), serviceAllAccess)
+	if h == 0 {
+		return e
+	}
+	defer procCloseServiceHandle.Call(h)
+	return op(h)
+}
+
+func openSCManager() (uintptr, error) {
+	h, _, e := procOpenSCManagerW.Call(0, 0, scManagerAllAccess)
+	if h == 0 {
+		return 0, fmt.Errorf("opening service manager: %w (administrator required)", e)
+	}
+	return h, nil
+}
+
+// serviceDispatch hands control to the SCM; it blocks until serviceMain
+// returns.
+func serviceDispatch(flags []string) int {
+	serviceRunArgs = flags
+	name, _ := syscall.UTF16PtrFromString(windowsServiceName)
+	table := []serviceTableEntry{
+		{name: name, proc: syscall.NewCallback(serviceMain)},
+		{},
+	}
+	if r, _, e := procStartServiceCtrlDispatcher.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+		fmt.Fprintf(os.Stderr, "service dispatcher failed: %v (not started by the service manager?)\n", e)
+		return 1
+	}
+	return 0
+}
+
+// serviceMain is invoked by the SCM; it runs the proxy and reflects its
+// lifecycle back as service status transitions.
+func serviceMain(argc uint32, argv uintptr) uintptr {
+	name, _ := syscall.UTF16PtrFromString(windowsServiceName)
+	h, _, _ := procRegisterServiceCtrlHandler.Call(
+		uintptr(unsafe.Pointer(name)), syscall.NewCallback(serviceHandler), 0)
+	if h == 0 {
+		return 1
+	}
+	serviceStatusHandle = h
+	setServiceState(serviceStateRunning, 0)
+	code := run(serviceRunArgs)
+	setServiceState(serviceStateStopped, uint32(code))
+	return 0
+}
+
+// serviceHandler receives control requests; stop and shutdown trigger the
+// same graceful drain a SIGTERM does on Unix.
+func serviceHandler(control, eventType uint32, eventData, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		setServiceState(serviceStateStopPend, 0)
+		select {
+		case serviceStop <- struct{}{}:
+		default:
+		}
+		return 0
+	}
+	return 0
+}
+
+func setServiceState(state, exitCode uint32) {
+	st := serviceStatus{
+		serviceType:   serviceWin32OwnProcess,
+		currentState:  state,
+		win32ExitCode: exitCode,
+		waitHint:      10000,
+	}
+	if state == serviceStateRunning {
+		st.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	}
+	procSetServiceStatus.Call(serviceStatusHandle, uintptr(unsafe.Pointer(&st)))
+}
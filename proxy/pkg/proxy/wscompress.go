@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WebSocket permessage-deflate (RFC 7692) support. Two modes:
+//
+//   - Passthrough: the client's extension offer is forwarded to the backend;
+//     when the backend accepts, compressed frames relay verbatim and neither
+//     side knows the proxy exists.
+//   - Termination: the backend declines (or does not speak) the extension but
+//     the client offered it, so the proxy accepts on the backend's behalf and
+//     recodes data frames in the relay: client messages are inflated before
+//     they reach the gateway, gateway messages are deflated toward the client.
+//
+// Termination always negotiates no_context_takeover on both sides so every
+// message is a self-contained deflate stream and no sliding window has to be
+// carried between messages.
+
+const (
+	// wsCompressMin is the smallest backend message worth compressing;
+	// RFC 7692 makes per-message compression optional, so tiny payloads go
+	// out as-is.
+	wsCompressMin = 64
+
+	// wsDeflateMaxMessage caps message assembly (and inflated output) when
+	// the proxy terminates compression, independent of -ws-max-message.
+	wsDeflateMaxMessage = 16 << 20
+)
+
+// deflateTail re-completes a raw deflate stream that was cut after a sync
+// flush: the four flush bytes the sender stripped, plus an empty final block
+// so the flate reader terminates cleanly.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// hasPermessageDeflate reports whether a Sec-WebSocket-Extensions header
+// (offer or acceptance) includes permessage-deflate.
+func hasPermessageDeflate(h http.Header) bool {
+	for _, v := range h.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Frame header bit helpers; header is the raw bytes from readFrameHeader.
+func frameFin(header []byte) bool  { return header[0]&0x80 != 0 }
+func frameRSV1(header []byte) bool { return header[0]&0x40 != 0 }
+
+// unmaskPayload undoes client masking in place, keyed from the frame header.
+func unmaskPayload(data, header []byte) {
+	if header[1]&0x80 == 0 {
+		return
+	}
+	key := header[len(header)-4:]
+	for i := range data {
+		data[i] ^= key[i%4]
+	}
+}
+
+// recodeFrame relays one frame while terminating permessage-deflate at the
+// proxy. compress is the direction: false inflates client frames toward the
+// gateway, true deflates gateway frames toward the client. Frames already in
+// the form the receiver expects pass through verbatim.
+func (p *ProxyServer) recodeFrame(dst, src *wsConn, pol *wsPolicy, compress bool) (byte, error) {
+	header, opcode, payloadLen, err := readFrameHeader(src.br)
+	if err != nil {
+		return 0, err
+	}
+	if pol != nil {
+		if code, reason := pol.check(opcode, payloadLen); code != 0 {
+			writeControl(src, opClose, closePayload(code, reason))
+			return opcode, fmt.Errorf("%w: %s", errWSPolicy, reason)
+		}
+	}
+	if opcode >= opClose {
+		// Control frames are never compressed (RFC 7692 §6.1).
+		return opcode, forwardFrame(dst, src, header, payloadLen)
+	}
+	if frameRSV1(header) == compress {
+		// Client sent plain toward the gateway, or the gateway compressed
+		// on its own: nothing to recode.
+		return opcode, forwardFrame(dst, src, header, payloadLen)
+	}
+	if compress && frameFin(header) && payloadLen < wsCompressMin {
+		return opcode, forwardFrame(dst, src, header, payloadLen)
+	}
+
+	limit := int64(wsDeflateMaxMessage)
+	if pol != nil && pol.maxMessage > 0 && pol.maxMessage < limit {
+		limit = pol.maxMessage
+	}
+	msg, err := readMessage(dst, src, header, payloadLen, limit)
+	if err != nil {
+		if err == errWSMessageTooBig {
+			writeControl(src, opClose, closePayload(1009, "message too big"))
+			return opcode, fmt.Errorf("%w: message too big", errWSPolicy)
+		}
+		return opcode, err
+	}
+
+	if !compress {
+		plain, err := inflateMessage(msg, limit)
+		if err != nil {
+			if err == errWSMessageTooBig {
+				writeControl(src, opClose, closePayload(1009, "message too big"))
+				return opcode, fmt.Errorf("%w: inflated message too big", errWSPolicy)
+			}
+			writeControl(src, opClose, closePayload(1002, "invalid compressed payload"))
+			return opcode, fmt.Errorf("%w: %v", errWSPolicy, err)
+		}
+		return opcode, writeDataFrame(dst, opcode, false, plain)
+	}
+	comp, err := deflateMessage(msg, p.cfg.WSCompressionLevel)
+	if err != nil || len(comp) >= len(msg) {
+		// Incompressible payload: send it plain rather than larger.
+		return opcode, writeDataFrame(dst, opcode, false, msg)
+	}
+	return opcode, writeDataFrame(dst, opcode, true, comp)
+}
+
+var errWSMessageTooBig = fmt.Errorf("websocket: message too big")
+
+// readMessage consumes the remaining frames of a (possibly fragmented)
+// message whose first header was already read, relaying any interleaved
+// control frames, and returns the unmasked payload.
+func readMessage(dst, src *wsConn, header []byte, payloadLen int64, limit int64) ([]byte, error) {
+	var msg []byte
+	for {
+		if int64(len(msg))+payloadLen > limit {
+			return nil, errWSMessageTooBig
+		}
+		part := make([]byte, payloadLen)
+		if _, err := io.ReadFull(src.br, part); err != nil {
+			return nil, err
+		}
+		unmaskPayload(part, header)
+		msg = append(msg, part...)
+		if frameFin(header) {
+			return msg, nil
+		}
+		for {
+			h, op, n, err := readFrameHeader(src.br)
+			if err != nil {
+				return nil, err
+			}
+			if op >= opClose {
+				if err := forwardFrame(dst, src, h, n); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			header, payloadLen = h, n
+			break
+		}
+	}
+}
+
+// writeDataFrame sends one unfragmented data frame, masking it when the peer
+// expects client frames.
+func writeDataFrame(c *wsConn, opcode byte, rsv1 bool, payload []byte) error {
+	b0 := 0x80 | opcode
+	if rsv1 {
+		b0 |= 0x40
+	}
+	header := []byte{b0, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n < 1<<16:
+		header[1] = 126
+		header = append(header, byte(n>>8), byte(n))
+	default:
+		header[1] = 127
+		var ext [8]byte
+		for i := 0; i < 8; i++ {
+			ext[i] = byte(uint64(n) >> (56 - 8*i))
+		}
+		header = append(header, ext[:]...)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.mask {
+		header[1] |= 0x80
+		var key [4]byte
+		rand.Read(key[:])
+		header = append(header, key[:]...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ key[i%4]
+		}
+		payload = masked
+	}
+	if _, err := c.Write(header); err != nil {
+		return err
+	}
+	_, err := c.Write(payload)
+	return err
+}
+
+// deflateMessage compresses one message per RFC 7692: a raw deflate stream
+// flushed with an empty block, trailing sync-flush bytes stripped.
+func deflateMessage(data []byte, level int) ([]byte, error) {
+	var b bytes.Buffer
+	fw, err := flate.NewWriter(&b, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	out := b.Bytes()
+	return out[:len(out)-4], nil
+}
+
+// inflateMessage reverses deflateMessage, refusing output above limit so a
+// small compressed bomb cannot balloon in proxy memory.
+func inflateMessage(data []byte, limit int64) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail)))
+	defer fr.Close()
+	out, err := io.ReadAll(io.LimitReader(fr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, errWSMessageTooBig
+	}
+	return out, nil
+}
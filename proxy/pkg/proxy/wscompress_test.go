@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHasPermessageDeflate(t *testing.T) {
+	h := http.Header{}
+	if hasPermessageDeflate(h) {
+		t.Error("empty header should not offer deflate")
+	}
+	h.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_max_window_bits")
+	if !hasPermessageDeflate(h) {
+		t.Error("offer with params not recognized")
+	}
+	h.Set("Sec-WebSocket-Extensions", "foo, permessage-deflate")
+	if !hasPermessageDeflate(h) {
+		t.Error("offer in extension list not recognized")
+	}
+}
+
+func TestDeflateRoundTrip(t *testing.T) {
+	msg := bytes.Repeat([]byte("clawdbot "), 50)
+	comp, err := deflateMessage(msg, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comp) >= len(msg) {
+		t.Fatalf("compressed %d bytes into %d", len(msg), len(comp))
+	}
+	plain, err := inflateMessage(comp, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, msg) {
+		t.Error("round trip mismatch")
+	}
+	if _, err := inflateMessage(comp, 16); err != errWSMessageTooBig {
+		t.Errorf("inflate past limit = %v, want errWSMessageTooBig", err)
+	}
+}
+
+// dialWSDeflate upgrades with a permessage-deflate offer and returns the
+// response so tests can inspect the negotiated extensions.
+func dialWSDeflate(t *testing.T, addr string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n\r\n", addr)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status = %d, want 101", resp.StatusCode)
+	}
+	return conn, br, resp
+}
+
+func TestWebSocketCompressionTermination(t *testing.T) {
+	// The echo backend does not speak permessage-deflate, so the proxy must
+	// accept the extension itself and recode frames in both directions.
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:            "http://" + backend,
+		WSPingInterval:     0,
+		WSIdleTimeout:      time.Minute,
+		WSCompression:      true,
+		WSCompressionLevel: 6,
+	}
+	addr := startProxy(t, cfg)
+	conn, br, resp := dialWSDeflate(t, addr)
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("extensions = %q, want permessage-deflate accepted", ext)
+	}
+
+	// Between wsCompressMin and 125 bytes: big enough that the proxy
+	// compresses the echo, small enough for writeServerFrame's short header.
+	msg := bytes.Repeat([]byte("node gateway "), 8)
+	comp, err := deflateMessage(msg, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &wsConn{Conn: conn, mask: true}
+	if err := writeDataFrame(client, opText, true, comp); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backend echoed the inflated plaintext; the proxy re-compresses it
+	// on the way back.
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header, opcode, n, err := readFrameHeader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != opText || !frameRSV1(header) {
+		t.Fatalf("reply = opcode %#x rsv1 %v, want compressed text", opcode, frameRSV1(header))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := inflateMessage(payload, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, msg) {
+		t.Errorf("echo = %q, want %q", plain, msg)
+	}
+}
+
+func TestWebSocketCompressionPassthrough(t *testing.T) {
+	// A backend that accepts permessage-deflate itself: the proxy forwards
+	// the offer and relays compressed frames verbatim.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		if !hasPermessageDeflate(req.Header) {
+			fmt.Fprintf(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+			return
+		}
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\nSec-WebSocket-Extensions: permessage-deflate\r\n\r\n",
+			wsAccept(req.Header.Get("Sec-WebSocket-Key")))
+		// Echo one frame verbatim modulo unmasking, RSV1 preserved.
+		header, _, n, err := readFrameHeader(br)
+		if err != nil {
+			return
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return
+		}
+		unmaskPayload(payload, header)
+		conn.Write([]byte{header[0] & 0xcf, byte(len(payload))})
+		conn.Write(payload)
+	}()
+
+	cfg := &Config{
+		Backend:        "http://" + ln.Addr().String(),
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+		WSCompression:  true,
+	}
+	addr := startProxy(t, cfg)
+	conn, br, resp := dialWSDeflate(t, addr)
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("extensions = %q, want backend acceptance forwarded", ext)
+	}
+
+	comp, err := deflateMessage([]byte("compressed hello"), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &wsConn{Conn: conn, mask: true}
+	if err := writeDataFrame(client, opText, true, comp); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header, opcode, n, err := readFrameHeader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != opText || !frameRSV1(header) {
+		t.Fatalf("reply = opcode %#x rsv1 %v, want compressed frame relayed verbatim", opcode, frameRSV1(header))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, comp) {
+		t.Error("compressed payload changed in passthrough relay")
+	}
+}
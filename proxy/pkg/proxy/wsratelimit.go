@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"time"
+)
+
+// Per-session WebSocket rate limiting, separate from the HTTP limiter: the
+// Node gateway handles every message on one thread, so a client blasting
+// thousands of small frames hurts everyone even at modest bandwidth. Two
+// token buckets per session (messages and payload bytes) pace client→backend
+// traffic. Overdraw is soft-throttled by delaying the relay read loop, which
+// backpressures the client through TCP; a single message too expensive to
+// ever pace (longer than wsThrottleMaxDelay of budget) closes the session
+// with 1008.
+
+// wsThrottleMaxDelay bounds how much budget a single message may consume
+// before the session is hard-closed instead of throttled.
+const wsThrottleMaxDelay = 3 * time.Second
+
+// wsLimiter is used by exactly one relay goroutine, so no locking. Buckets
+// refill continuously and hold at most one second of burst, matching the
+// egress shaper.
+type wsLimiter struct {
+	msgRate  float64 // messages/sec; 0 disables
+	byteRate float64 // bytes/sec; 0 disables
+	msgs     float64
+	bytes    float64
+	last     time.Time
+}
+
+// newWSLimiter returns nil when both limits are off.
+func newWSLimiter(msgRate, byteRate float64) *wsLimiter {
+	if msgRate <= 0 && byteRate <= 0 {
+		return nil
+	}
+	return &wsLimiter{
+		msgRate:  msgRate,
+		byteRate: byteRate,
+		msgs:     msgRate,
+		bytes:    byteRate,
+		last:     time.Now(),
+	}
+}
+
+// reserve books one data frame (newMessage is true for the first fragment)
+// and returns how long the relay must sleep before forwarding it, or
+// hard=true when the frame alone exceeds the hard limit.
+func (l *wsLimiter) reserve(newMessage bool, n int64) (time.Duration, bool) {
+	// A frame this expensive can never be paced; closing is kinder than a
+	// multi-second stall.
+	if l.byteRate > 0 && float64(n)/l.byteRate > wsThrottleMaxDelay.Seconds() {
+		return 0, true
+	}
+	now := time.Now()
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if l.msgRate > 0 {
+		l.msgs += elapsed * l.msgRate
+		if l.msgs > l.msgRate {
+			l.msgs = l.msgRate
+		}
+	}
+	if l.byteRate > 0 {
+		l.bytes += elapsed * l.byteRate
+		if l.bytes > l.byteRate {
+			l.bytes = l.byteRate
+		}
+	}
+	var deficit float64
+	if l.msgRate > 0 && newMessage {
+		l.msgs--
+		if d := -l.msgs / l.msgRate; d > deficit {
+			deficit = d
+		}
+	}
+	if l.byteRate > 0 {
+		l.bytes -= float64(n)
+		if d := -l.bytes / l.byteRate; d > deficit {
+			deficit = d
+		}
+	}
+	if deficit <= 0 {
+		return 0, false
+	}
+	return time.Duration(deficit * float64(time.Second)), false
+}
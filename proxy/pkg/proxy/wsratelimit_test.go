@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestWSLimiterReserve(t *testing.T) {
+	l := newWSLimiter(10, 0)
+	for i := 0; i < 10; i++ {
+		if d, hard := l.reserve(true, 10); d > 0 || hard {
+			t.Fatalf("message %d within burst: delay %v hard %v", i, d, hard)
+		}
+	}
+	if d, hard := l.reserve(true, 10); d == 0 || hard {
+		t.Errorf("message past burst: delay %v hard %v, want soft delay", d, hard)
+	}
+
+	// A single frame worth minutes of byte budget trips the hard limit.
+	l = newWSLimiter(0, 1024)
+	if _, hard := l.reserve(true, 1<<20); !hard {
+		t.Error("1MB frame at 1KB/s should be a hard violation")
+	}
+	if d, hard := l.reserve(true, 512); d > 0 || hard {
+		t.Errorf("small frame: delay %v hard %v, want neither", d, hard)
+	}
+
+	if newWSLimiter(0, 0) != nil {
+		t.Error("disabled limits should return a nil limiter")
+	}
+}
+
+func TestWebSocketByteRateHardClose(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+		WSByteRate:     1024,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	client := &wsConn{Conn: conn, mask: true}
+	if err := writeDataFrame(client, opBinary, false, bytes.Repeat([]byte{0xcc}, 64<<10)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	opcode, payload := readFrame(t, br)
+	if opcode != opClose || len(payload) < 2 {
+		t.Fatalf("oversized frame = opcode %#x, want close", opcode)
+	}
+	if code := binary.BigEndian.Uint16(payload); code != 1008 {
+		t.Errorf("close code = %d, want 1008", code)
+	}
+}
+
+func TestWebSocketMsgRateSoftThrottle(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+		WSMsgRate:      200,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	// Bursting past the budget throttles but never kills the session.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 250; i++ {
+		writeClientFrame(conn, opText, []byte("m"))
+	}
+	for i := 0; i < 250; i++ {
+		if opcode, _ := readFrame(t, br); opcode != opText {
+			t.Fatalf("echo %d = opcode %#x, want text", i, opcode)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DE1378A"
+
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// startEchoBackend runs a minimal WebSocket server that echoes text frames,
+// answers pings with pongs, and echoes close frames.
+func startEchoBackend(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveEcho(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveEcho(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		wsAccept(req.Header.Get("Sec-WebSocket-Key")))
+	for {
+		header, opcode, n, err := readFrameHeader(br)
+		if err != nil {
+			return
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return
+		}
+		if len(header) >= 6 && header[1]&0x80 != 0 {
+			key := header[len(header)-4:]
+			for i := range payload {
+				payload[i] ^= key[i%4]
+			}
+		}
+		switch opcode {
+		case opPing:
+			writeServerFrame(conn, opPong, payload)
+		case opClose:
+			writeServerFrame(conn, opClose, payload)
+			return
+		default:
+			writeServerFrame(conn, opcode, payload)
+		}
+	}
+}
+
+func writeServerFrame(w io.Writer, opcode byte, payload []byte) {
+	header := []byte{0x80 | opcode, byte(len(payload))}
+	w.Write(header)
+	w.Write(payload)
+}
+
+func writeClientFrame(w io.Writer, opcode byte, payload []byte) {
+	header := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	key := []byte{0xa, 0xb, 0xc, 0xd}
+	header = append(header, key...)
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ key[i%4]
+	}
+	w.Write(header)
+	w.Write(masked)
+}
+
+func startProxy(t *testing.T, cfg *Config) string {
+	_, addr := startProxyServer(t, cfg)
+	return addr
+}
+
+func startProxyServer(t *testing.T, cfg *Config) (*ProxyServer, string) {
+	t.Helper()
+	p, err := NewProxyServer(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: p.accessLog(p)}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return p, ln.Addr().String()
+}
+
+func dialWS(t *testing.T, addr, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status = %d, want 101", resp.StatusCode)
+	}
+	return conn, br
+}
+
+func readFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	_, opcode, n, err := readFrameHeader(br)
+	if err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("reading payload: %v", err)
+	}
+	return opcode, payload
+}
+
+func TestWebSocketRelayEcho(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	writeClientFrame(conn, opText, []byte("hello"))
+	opcode, payload := readFrame(t, br)
+	if opcode != opText || string(payload) != "hello" {
+		t.Fatalf("echo = opcode %#x payload %q, want text %q", opcode, payload, "hello")
+	}
+}
+
+func TestWebSocketKeepalivePing(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 20 * time.Millisecond,
+		WSIdleTimeout:  time.Minute,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		opcode, _ := readFrame(t, br)
+		if opcode == opPing {
+			return // proxy keepalive reached the client
+		}
+	}
+}
+
+func TestWebSocketMaxMessageCloses1009(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+		WSMaxMessage:   16,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	writeClientFrame(conn, opText, []byte("well within the limit"[:8]))
+	if opcode, payload := readFrame(t, br); opcode != opText || string(payload) != "well wit" {
+		t.Fatalf("small message = opcode %#x payload %q, want echo", opcode, payload)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	writeClientFrame(conn, opText, make([]byte, 32))
+	opcode, payload := readFrame(t, br)
+	if opcode != opClose || len(payload) < 2 {
+		t.Fatalf("oversized message = opcode %#x payload %q, want close", opcode, payload)
+	}
+	if code := binary.BigEndian.Uint16(payload); code != 1009 {
+		t.Errorf("close code = %d, want 1009", code)
+	}
+}
+
+func TestWebSocketFrameTypePolicy(t *testing.T) {
+	backend := startEchoBackend(t)
+	routes := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(routes, []byte("path=/ws websocket ws-frames=text\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		RouteFile:      routes,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	writeClientFrame(conn, opBinary, []byte{0x1, 0x2, 0x3})
+	opcode, payload := readFrame(t, br)
+	if opcode != opClose || len(payload) < 2 {
+		t.Fatalf("binary frame on text route = opcode %#x payload %q, want close", opcode, payload)
+	}
+	if code := binary.BigEndian.Uint16(payload); code != 1003 {
+		t.Errorf("close code = %d, want 1003", code)
+	}
+}
+
+func TestWebSocketCloseHandshakeEchoed(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	// The backend echoes close frames; the relay's close grace must let the
+	// echo travel back before the sockets are torn down.
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	writeClientFrame(conn, opClose, closePayload(1000, "bye"))
+	opcode, payload := readFrame(t, br)
+	if opcode != opClose {
+		t.Fatalf("reply opcode = %#x, want close", opcode)
+	}
+	if code := binary.BigEndian.Uint16(payload); code != 1000 {
+		t.Errorf("echoed close code = %d, want 1000", code)
+	}
+}
+
+func TestAdminWSSessionRegistryAndKill(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+	}
+	p, addr := startProxyServer(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	writeClientFrame(conn, opText, []byte("hi"))
+	if opcode, _ := readFrame(t, br); opcode != opText {
+		t.Fatalf("echo opcode = %#x", opcode)
+	}
+
+	admin := p.newAdminHandler()
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/ws/sessions", nil))
+	var sessions []struct {
+		ID       string `json:"id"`
+		Path     string `json:"path"`
+		BytesIn  int64  `json:"bytes_in"`
+		BytesOut int64  `json:"bytes_out"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("sessions list: %v (%q)", err, rec.Body.String())
+	}
+	if len(sessions) != 1 || sessions[0].Path != "/ws" {
+		t.Fatalf("sessions = %+v, want one /ws entry", sessions)
+	}
+	if sessions[0].BytesIn == 0 || sessions[0].BytesOut == 0 {
+		t.Errorf("byte counters = in %d out %d, want both > 0", sessions[0].BytesIn, sessions[0].BytesOut)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/ws/kill?id="+sessions[0].ID+"&reason=test+kill", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("kill = %d %q", rec.Code, rec.Body.String())
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	opcode, payload := readFrame(t, br)
+	if opcode != opClose || !strings.Contains(string(payload), "test kill") {
+		t.Errorf("after kill = opcode %#x payload %q, want close with reason", opcode, payload)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/ws/kill?id=nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("kill unknown id = %d, want 404", rec.Code)
+	}
+}
+
+func TestWebSocketSubprotocolNegotiated(t *testing.T) {
+	// A backend that picks the second offered subprotocol; the proxy must
+	// forward the offer and relay the selection back in the 101.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		offer := req.Header.Get("Sec-WebSocket-Protocol")
+		if !strings.Contains(offer, "clawdbot.v2") {
+			fmt.Fprintf(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+			return
+		}
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\nSec-WebSocket-Protocol: clawdbot.v2\r\n\r\n",
+			wsAccept(req.Header.Get("Sec-WebSocket-Key")))
+	}()
+
+	cfg := &Config{
+		Backend:        "http://" + ln.Addr().String(),
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+	}
+	addr := startProxy(t, cfg)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: clawdbot.v1, clawdbot.v2\r\n\r\n", addr)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status = %d, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "clawdbot.v2" {
+		t.Errorf("negotiated subprotocol = %q, want clawdbot.v2", got)
+	}
+}
+
+func TestWebSocketIdleTimeoutReapsSession(t *testing.T) {
+	backend := startEchoBackend(t)
+	cfg := &Config{
+		Backend:        "http://" + backend,
+		WSPingInterval: 0, // no pings: a silent session must hit the idle timeout
+		WSIdleTimeout:  100 * time.Millisecond,
+	}
+	addr := startProxy(t, cfg)
+	conn, br := dialWS(t, addr, "/ws")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := br.ReadByte(); err == nil {
+		t.Fatal("expected connection to be closed by idle timeout")
+	}
+}
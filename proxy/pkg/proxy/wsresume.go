@@ -0,0 +1,365 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocket reconnect buffering: with -ws-resume-grace set, the proxy keeps
+// the backend connection alive for a grace period after a client drops,
+// buffers backend messages (bounded by -ws-resume-buffer), and replays them
+// when the client reconnects presenting the session token it was handed in
+// the upgrade response. Flaky mobile connections to the Control UI resume
+// where they left off instead of losing whatever the gateway said meanwhile.
+//
+// Resumable sessions relay whole frames (never streamed), so a client drop
+// mid-frame cannot leave half a frame on the backend stream.
+
+const (
+	// wsResumeHeader carries the session token: minted by the proxy on the
+	// 101 response, presented by the client on reconnect.
+	wsResumeHeader = "X-Clawdbot-Resume"
+
+	// wsResumePoll is how often a blocked backend read wakes up to check for
+	// a dead client or a claim on a parked session.
+	wsResumePoll = 250 * time.Millisecond
+
+	// wsResumeMaxFrame caps a single whole-frame read in resumable mode.
+	wsResumeMaxFrame = 16 << 20
+
+	wsGUIDConst = "258EAFA5-E914-47DA-95CA-C5AB0DE1378A"
+)
+
+// wsAcceptKey computes the Sec-WebSocket-Accept value for a client key.
+func wsAcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + wsGUIDConst))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// parkedSession is a backend connection waiting for its client to return.
+type parkedSession struct {
+	token   string
+	backend *wsConn
+	frames  [][]byte // whole raw backend frames awaiting replay
+	size    int64
+	claimed chan struct{} // closed by claim()
+	handoff chan bool     // hold() -> claim(): true when the backend is still good
+}
+
+func (s *parkedSession) buffer(frame []byte) bool {
+	s.frames = append(s.frames, frame)
+	s.size += int64(len(frame))
+	return true
+}
+
+// resumeRegistry tracks parked sessions by token.
+type resumeRegistry struct {
+	grace     time.Duration
+	maxBuffer int64
+	metrics   *Metrics
+	log       *slog.Logger
+
+	mu     sync.Mutex
+	parked map[string]*parkedSession
+}
+
+func newResumeRegistry(grace time.Duration, maxBuffer int64, m *Metrics, log *slog.Logger) *resumeRegistry {
+	return &resumeRegistry{
+		grace:     grace,
+		maxBuffer: maxBuffer,
+		metrics:   m,
+		log:       log,
+		parked:    make(map[string]*parkedSession),
+	}
+}
+
+// park registers the session and starts holding its backend connection open.
+func (g *resumeRegistry) park(s *parkedSession) {
+	s.claimed = make(chan struct{})
+	s.handoff = make(chan bool, 1)
+	g.mu.Lock()
+	g.parked[s.token] = s
+	g.mu.Unlock()
+	g.metrics.AddGauge(`clawdbot_proxy_ws_parked`, 1)
+	g.log.Info("websocket session parked awaiting resume", "token", s.token, "buffered", s.size)
+	go g.hold(s)
+}
+
+// claim hands a parked session to a reconnecting client, or nil when the
+// token is unknown or the backend died while parked.
+func (g *resumeRegistry) claim(token string) *parkedSession {
+	g.mu.Lock()
+	s := g.parked[token]
+	delete(g.parked, token)
+	g.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	close(s.claimed)
+	if ok := <-s.handoff; !ok {
+		return nil
+	}
+	g.metrics.Inc(`clawdbot_proxy_ws_resumed_total`)
+	return s
+}
+
+// drop closes the parked backend, unless a concurrent claim got there first
+// (then the claimer is told the session is gone).
+func (g *resumeRegistry) drop(s *parkedSession, reason string) {
+	select {
+	case <-s.claimed:
+		s.handoff <- false
+	default:
+		g.mu.Lock()
+		delete(g.parked, s.token)
+		g.mu.Unlock()
+		s.backend.Close()
+	}
+	g.metrics.AddGauge(`clawdbot_proxy_ws_parked`, -1)
+	g.metrics.Inc(`clawdbot_proxy_ws_park_drops_total`)
+	g.log.Info("parked websocket session dropped", "token", s.token, "reason", reason)
+}
+
+// hold babysits the parked backend: buffers data frames, answers pings, and
+// gives up when the grace period expires, the buffer overflows, or the
+// backend goes away.
+func (g *resumeRegistry) hold(s *parkedSession) {
+	deadline := time.Now().Add(g.grace)
+	for {
+		select {
+		case <-s.claimed:
+			s.handoff <- true
+			g.metrics.AddGauge(`clawdbot_proxy_ws_parked`, -1)
+			return
+		default:
+		}
+		if time.Now().After(deadline) {
+			g.drop(s, "grace period expired")
+			return
+		}
+		s.backend.SetReadDeadline(time.Now().Add(wsResumePoll))
+		if _, err := s.backend.br.Peek(2); err != nil {
+			if os.IsTimeout(err) {
+				continue
+			}
+			g.drop(s, "backend closed")
+			return
+		}
+		s.backend.SetReadDeadline(time.Now().Add(10 * time.Second))
+		frame, opcode, n, err := readWholeFrame(s.backend)
+		if err != nil {
+			g.drop(s, "backend read failed")
+			return
+		}
+		switch opcode {
+		case opPing:
+			writeControl(s.backend, opPong, frame[len(frame)-int(n):])
+		case opPong:
+			// Keepalive noise; nothing to replay.
+		case opClose:
+			g.drop(s, "backend sent close")
+			return
+		default:
+			s.buffer(frame)
+			if s.size > g.maxBuffer {
+				g.drop(s, "replay buffer overflow")
+				return
+			}
+		}
+	}
+}
+
+// readWholeFrame reads one complete frame (header and payload) into memory.
+func readWholeFrame(c *wsConn) (frame []byte, opcode byte, payloadLen int64, err error) {
+	header, opcode, n, err := readFrameHeader(c.br)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if n > wsResumeMaxFrame {
+		return nil, 0, 0, fmt.Errorf("websocket: frame of %d bytes exceeds resumable limit", n)
+	}
+	frame = make([]byte, len(header)+int(n))
+	copy(frame, header)
+	if _, err := io.ReadFull(c.br, frame[len(header):]); err != nil {
+		return nil, 0, 0, err
+	}
+	return frame, opcode, n, nil
+}
+
+// writeRaw sends pre-encoded frame bytes under the peer's write lock.
+func writeRaw(c *wsConn, frame []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.Write(frame)
+	return err
+}
+
+// relayResumable relays whole frames in both directions and returns a
+// parkedSession (client gone, backend healthy) or nil (session over, both
+// connections closed).
+func (p *ProxyServer) relayResumable(client, backend *wsConn, pol *wsPolicy, token string) *parkedSession {
+	var clientDead, noResume atomic.Bool
+	aDone := make(chan struct{}, 1)
+	go func() { // client → backend
+		defer func() { aDone <- struct{}{} }()
+		for {
+			client.SetReadDeadline(time.Now().Add(p.cfg.WSIdleTimeout))
+			frame, opcode, payloadLen, err := readWholeFrame(client)
+			if err != nil {
+				clientDead.Store(true)
+				return
+			}
+			if code, reason := pol.check(opcode, payloadLen); code != 0 {
+				writeControl(client, opClose, closePayload(code, reason))
+				p.metrics.Inc(`clawdbot_proxy_ws_policy_closes_total`)
+				p.log.Warn("websocket session closed by frame policy", "reason", reason)
+				noResume.Store(true)
+				clientDead.Store(true)
+				client.Close()
+				return
+			}
+			if err := writeRaw(backend, frame); err != nil {
+				noResume.Store(true)
+				return
+			}
+			if opcode == opClose {
+				// Deliberate goodbye: nothing to resume. The backend's close
+				// echo still flows through the other direction.
+				noResume.Store(true)
+				return
+			}
+		}
+	}()
+
+	teardown := func() {
+		client.Close()
+		backend.Close()
+		<-aDone
+	}
+	lastPing := time.Now()
+	idle := time.Now().Add(p.cfg.WSIdleTimeout)
+	for { // backend → client, peek-polling so a silent backend can still park
+		backend.SetReadDeadline(time.Now().Add(wsResumePoll))
+		if _, err := backend.br.Peek(2); err != nil {
+			if !os.IsTimeout(err) {
+				teardown()
+				return nil
+			}
+			if clientDead.Load() {
+				if noResume.Load() {
+					teardown()
+					return nil
+				}
+				client.Close()
+				<-aDone
+				return &parkedSession{token: token, backend: backend}
+			}
+			if time.Now().After(idle) {
+				teardown()
+				return nil
+			}
+			if p.cfg.WSPingInterval > 0 && time.Since(lastPing) > p.cfg.WSPingInterval {
+				lastPing = time.Now()
+				if writeControl(client, opPing, nil) != nil || writeControl(backend, opPing, nil) != nil {
+					teardown()
+					return nil
+				}
+			}
+			continue
+		}
+		idle = time.Now().Add(p.cfg.WSIdleTimeout)
+		backend.SetReadDeadline(time.Now().Add(10 * time.Second))
+		frame, opcode, _, err := readWholeFrame(backend)
+		if err != nil {
+			teardown()
+			return nil
+		}
+		if err := writeRaw(client, frame); err != nil {
+			clientDead.Store(true)
+			client.Close()
+			<-aDone
+			if noResume.Load() {
+				backend.Close()
+				return nil
+			}
+			s := &parkedSession{token: token, backend: backend}
+			if opcode != opPing && opcode != opPong && opcode != opClose {
+				s.buffer(frame)
+			}
+			return s
+		}
+		if opcode == opClose {
+			// Close handshake done from the backend's side; allow the client
+			// echo a moment to drain, then tear down.
+			select {
+			case <-aDone:
+				aDone <- struct{}{}
+			case <-time.After(wsCloseGrace):
+			}
+			teardown()
+			return nil
+		}
+	}
+}
+
+// resumeSession completes an upgrade against a parked backend: it answers the
+// handshake itself, replays the buffered frames, and resumes the relay.
+// Returns false when the token is unknown so the caller connects fresh.
+func (p *ProxyServer) resumeSession(w http.ResponseWriter, r *http.Request, token string) bool {
+	s := p.resume.claim(token)
+	if s == nil {
+		return false
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		s.backend.Close()
+		p.httpError(w, r, http.StatusInternalServerError, "internal error")
+		return true
+	}
+	clientConn, clientRW, err := hj.Hijack()
+	if err != nil {
+		s.backend.Close()
+		p.log.Error("websocket resume hijack failed", "error", err)
+		return true
+	}
+	defer clientConn.Close()
+	clientConn.SetDeadline(time.Time{})
+	fmt.Fprintf(clientConn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n%s: %s\r\n\r\n",
+		wsAcceptKey(r.Header.Get("Sec-WebSocket-Key")), wsResumeHeader, token)
+
+	client := &wsConn{Conn: clientConn, br: clientRW.Reader, mask: false}
+	for _, frame := range s.frames {
+		if err := writeRaw(client, frame); err != nil {
+			s.backend.Close()
+			return true
+		}
+	}
+	p.log.Info("websocket session resumed", "token", token, "replayed_frames", len(s.frames), "replayed_bytes", s.size)
+
+	pol := p.newWSPolicy(r)
+	session := &wsSession{
+		id:       token,
+		client:   client,
+		backend:  s.backend,
+		clientIP: p.clientIP(r),
+		path:     r.URL.Path,
+		started:  time.Now(),
+	}
+	p.sessions.add(session)
+	defer p.sessions.remove(session)
+	p.metrics.AddGauge(`clawdbot_proxy_ws_active`, 1)
+	defer p.metrics.AddGauge(`clawdbot_proxy_ws_active`, -1)
+
+	if parked := p.relayResumable(client, s.backend, pol, token); parked != nil {
+		p.resume.park(parked)
+	}
+	return true
+}
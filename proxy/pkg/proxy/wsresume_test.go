@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResumeRegistryGraceExpiry(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	g := newResumeRegistry(100*time.Millisecond, 1<<20, NewMetrics(), discardLogger())
+	g.park(&parkedSession{token: "tok", backend: &wsConn{Conn: c1, br: bufio.NewReader(c1), mask: true}})
+
+	time.Sleep(500 * time.Millisecond)
+	if g.claim("tok") != nil {
+		t.Fatal("claim succeeded after the grace period expired")
+	}
+}
+
+// dialWSResume upgrades (optionally presenting a resume token) and returns
+// the token from the 101 response.
+func dialWSResume(t *testing.T, addr, token string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	extra := ""
+	if token != "" {
+		extra = wsResumeHeader + ": " + token + "\r\n"
+	}
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n%s\r\n", addr, extra)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status = %d, want 101", resp.StatusCode)
+	}
+	return conn, br, resp.Header.Get(wsResumeHeader)
+}
+
+func TestWebSocketResumeReplaysBufferedMessages(t *testing.T) {
+	// Backend: upgrade, push two messages after a delay (while the client is
+	// gone), then echo whatever arrives.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			wsAcceptKey(req.Header.Get("Sec-WebSocket-Key")))
+		time.Sleep(600 * time.Millisecond)
+		writeServerFrame(conn, opText, []byte("late1"))
+		writeServerFrame(conn, opText, []byte("late2"))
+		for {
+			header, opcode, n, err := readFrameHeader(br)
+			if err != nil {
+				return
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(br, payload); err != nil {
+				return
+			}
+			unmaskPayload(payload, header)
+			writeServerFrame(conn, opcode, payload)
+			if opcode == opClose {
+				return
+			}
+		}
+	}()
+
+	cfg := &Config{
+		Backend:        "http://" + ln.Addr().String(),
+		WSPingInterval: 0,
+		WSIdleTimeout:  time.Minute,
+		WSResumeGrace:  3 * time.Second,
+		WSResumeBuffer: 64 << 10,
+	}
+	addr := startProxy(t, cfg)
+
+	conn, _, token := dialWSResume(t, addr, "")
+	if token == "" {
+		t.Fatal("upgrade response carried no resume token")
+	}
+	conn.Close() // client drops before the backend says anything
+
+	time.Sleep(1200 * time.Millisecond) // parked; backend pushed while away
+
+	conn2, br2, token2 := dialWSResume(t, addr, token)
+	if token2 != token {
+		t.Errorf("resumed token = %q, want %q", token2, token)
+	}
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range []string{"late1", "late2"} {
+		opcode, payload := readFrame(t, br2)
+		if opcode != opText || string(payload) != want {
+			t.Fatalf("replayed frame = opcode %#x payload %q, want %q", opcode, payload, want)
+		}
+	}
+
+	// The relay is live again: echoes flow.
+	writeClientFrame(conn2, opText, []byte("back"))
+	if opcode, payload := readFrame(t, br2); opcode != opText || string(payload) != "back" {
+		t.Errorf("post-resume echo = opcode %#x payload %q", opcode, payload)
+	}
+}